@@ -1,17 +1,33 @@
 package chat
 
 import (
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/glimesh/broadcast-box/internal/metrics"
 )
 
 const (
 	DefaultMaxHistory      = 10000
 	DefaultTTL             = 72 * time.Hour
 	DefaultCleanupInterval = 1 * time.Hour
+	DefaultBoltStorePath   = "chat.db"
+
+	StoreTypeMemory = "memory"
+	StoreTypeBolt   = "bolt"
 
-	EventTypeMessage = "message"
+	EventTypeMessage  = "message"
+	EventTypeDelete   = "delete"
+	EventTypeTimeout  = "timeout"
+	EventTypeBan      = "ban"
+	EventTypeUnban    = "unban"
+	EventTypeSlowMode = "slowmode"
 )
 
 type Message struct {
@@ -19,12 +35,22 @@ type Message struct {
 	TS          int64  `json:"ts"`
 	Text        string `json:"text"`
 	DisplayName string `json:"displayName"`
+	UserID      string `json:"userId,omitempty"`
+}
+
+// Details of a moderation event, Until is a unix timestamp in milliseconds and zero for permanent bans
+type ModerationEvent struct {
+	UserID          string `json:"userId,omitempty"`
+	MessageID       string `json:"messageId,omitempty"`
+	Until           int64  `json:"until,omitempty"`
+	SlowModeSeconds int64  `json:"slowModeSeconds,omitempty"`
 }
 
 type Event struct {
-	ID      uint64  `json:"-"`
-	Type    string  `json:"type"`
-	Message Message `json:"message"`
+	ID         uint64           `json:"-"`
+	Type       string           `json:"type"`
+	Message    Message          `json:"message"`
+	Moderation *ModerationEvent `json:"moderation,omitempty"`
 }
 
 type Session struct {
@@ -35,20 +61,35 @@ type Session struct {
 
 type Store interface {
 	Connect(streamKey string, now time.Time) string
+
+	// Returns the session without updating its activity
 	GetSession(sessionID string, now time.Time) (*Session, bool)
 	TouchSession(sessionID string, now time.Time) bool
 	Subscribe(sessionID string, lastEventID uint64, now time.Time) (chan Event, func(), []Event, error)
 	SubscribeStream(streamKey string, lastEventID uint64, now time.Time) (chan Event, func(), []Event, error)
-	Send(sessionID string, text string, displayName string, now time.Time) error
+
+	// Send a message from a session returned by GetSession, updating its activity
+	Send(session *Session, text string, displayName string, now time.Time) error
 	SendToStream(streamKey string, text string, displayName string, now time.Time) error
 	Cleanup(now time.Time, ttl time.Duration)
+
+	// Remove a message from the history of a stream
+	DeleteMessage(streamKey string, messageID string, now time.Time) error
+
+	// Send an event to the subscribers of a stream without adding it to the history
+	Publish(streamKey string, event Event, now time.Time) error
 }
 
 type Manager struct {
 	store           Store
+	moderation      *moderation
+	floodProtection *floodProtection
 	defaultTTL      time.Duration
 	cleanupInterval time.Duration
 	stop            chan struct{}
+	onMessage       func(streamKey string, userID string, displayName string, text string)
+
+	moderationSaveLock sync.Mutex
 }
 
 func NewManager() *Manager {
@@ -73,18 +114,85 @@ func NewManager() *Manager {
 		}
 	}
 
-	m := NewManagerWithStore(NewInMemoryStore(maxHistory), defaultTTL, cleanupInterval)
+	m := NewManagerWithStore(newStore(maxHistory), defaultTTL, cleanupInterval)
+	m.SetRateLimits(
+		RateLimit{
+			Rate:  getFloatEnv("CHAT_RATE_LIMIT", DefaultRateLimit),
+			Burst: getIntEnv("CHAT_RATE_BURST", DefaultRateBurst),
+		},
+		RateLimit{
+			Rate:  getFloatEnv("CHAT_ADDRESS_RATE_LIMIT", DefaultAddressRateLimit),
+			Burst: getIntEnv("CHAT_ADDRESS_RATE_BURST", DefaultAddressRateBurst),
+		})
 
 	return m
 }
 
+func getIntEnv(key string, fallback int) int {
+	if val := os.Getenv(key); val != "" {
+		if i, err := strconv.Atoi(val); err == nil {
+			return i
+		}
+	}
+
+	return fallback
+}
+
+func getFloatEnv(key string, fallback float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+
+	return fallback
+}
+
+// Returns the store selected by CHAT_STORE, history is kept in memory by default
+func newStore(maxHistory int) Store {
+	switch storeType := strings.ToLower(os.Getenv("CHAT_STORE")); storeType {
+	case "", StoreTypeMemory:
+		return NewInMemoryStore(maxHistory)
+	case StoreTypeBolt:
+		path := os.Getenv("CHAT_STORE_PATH")
+		if path == "" {
+			path = DefaultBoltStorePath
+		}
+
+		store, err := NewBoltStore(path, maxHistory)
+		if err != nil {
+			slog.Error("Chat.NewBoltStore.Error", "path", path, "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("Chat.Store: Persisting chat", "path", path)
+		return store
+	default:
+		slog.Error("Chat.Store: Unknown CHAT_STORE", "store", storeType)
+		os.Exit(1)
+		return nil
+	}
+}
+
 func NewManagerWithStore(store Store, defaultTTL time.Duration, cleanupInterval time.Duration) *Manager {
 	m := &Manager{
 		store:           store,
+		moderation:      newModeration(),
+		floodProtection: newFloodProtection(RateLimit{}, RateLimit{}),
 		defaultTTL:      defaultTTL,
 		cleanupInterval: cleanupInterval,
 		stop:            make(chan struct{}),
 	}
+
+	if moderationStore, ok := store.(ModerationStore); ok {
+		states, err := moderationStore.LoadModeration()
+		if err != nil {
+			slog.Error("Chat.Manager.LoadModeration.Error", "error", err)
+		}
+
+		m.moderation.restore(states, time.Now())
+	}
+
 	go m.cleanupLoop()
 	return m
 }
@@ -105,8 +213,39 @@ func (m *Manager) Subscribe(sessionID string, lastEventID uint64) (chan Event, f
 	return m.store.Subscribe(sessionID, lastEventID, time.Now())
 }
 
+// Send a message from a chat session, subject to the rate limits and moderation of its stream
 func (m *Manager) Send(sessionID string, text string, displayName string) error {
-	return m.store.Send(sessionID, text, displayName, time.Now())
+	now := time.Now()
+
+	session, ok := m.store.GetSession(sessionID, now)
+	if !ok {
+		return fmt.Errorf("invalid session")
+	}
+
+	userID := UserIDForSession(sessionID)
+	if err := m.floodProtection.allow(session.StreamKey, sessionID, m.moderation.getAddress(userID), now); err != nil {
+		metrics.ChatMessagesRateLimited.Inc(session.StreamKey)
+		return err
+	}
+
+	if err := m.moderation.allowMessage(session.StreamKey, userID, text, now); err != nil {
+		return err
+	}
+
+	if err := m.store.Send(session, text, displayName, now); err != nil {
+		return err
+	}
+
+	metrics.ChatMessages.Inc(session.StreamKey)
+	if m.onMessage != nil {
+		m.onMessage(session.StreamKey, userID, displayName, text)
+	}
+	return nil
+}
+
+// Set the function called after a message was sent from a chat session
+func (m *Manager) SetOnMessage(onMessage func(streamKey string, userID string, displayName string, text string)) {
+	m.onMessage = onMessage
 }
 
 func (m *Manager) SubscribeStream(streamKey string, lastEventID uint64) (chan Event, func(), []Event, error) {
@@ -132,8 +271,17 @@ func (m *Manager) cleanupLoop() {
 
 func (m *Manager) Stop() {
 	close(m.stop)
+
+	if closer, ok := m.store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Warn("Chat.Manager.Stop.Close.Error", "error", err)
+		}
+	}
 }
 
 func (m *Manager) cleanup() {
-	m.store.Cleanup(time.Now(), m.defaultTTL)
+	now := time.Now()
+	m.store.Cleanup(now, m.defaultTTL)
+	m.moderation.cleanup(now, m.defaultTTL)
+	m.floodProtection.cleanup(now, m.defaultTTL)
 }
@@ -62,3 +62,18 @@ func TestChat(t *testing.T) {
 	}
 	cleanup3()
 }
+
+func TestChatOnMessage(t *testing.T) {
+	m := NewManager()
+	sessionID := m.Connect("test-stream")
+
+	var messages []string
+	m.SetOnMessage(func(streamKey string, userID string, displayName string, text string) {
+		assert.Equal(t, "test-stream", streamKey)
+		assert.Equal(t, UserIDForSession(sessionID), userID)
+		messages = append(messages, displayName+": "+text)
+	})
+
+	assert.NoError(t, m.Send(sessionID, "hello", "user1"))
+	assert.Equal(t, []string{"user1: hello"}, messages)
+}
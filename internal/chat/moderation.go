@@ -0,0 +1,503 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrBanned      = errors.New("you are banned from this chat")
+	ErrFiltered    = errors.New("message contains a filtered word")
+	ErrNotFound    = errors.New("message not found")
+	ErrUnknownUser = errors.New("user not found")
+)
+
+// Returned when a message is sent during a timeout or before the slow mode interval has passed
+type WaitError struct {
+	Reason string
+	Until  time.Time
+}
+
+func (e *WaitError) Error() string {
+	return fmt.Sprintf("%s, try again in %s", e.Reason, time.Until(e.Until).Round(time.Second))
+}
+
+// Moderation state of a stream
+type ModerationState struct {
+	SlowModeSeconds int64            `json:"slowModeSeconds"`
+	WordFilter      []string         `json:"wordFilter"`
+	BannedUsers     map[string]int64 `json:"bannedUsers"`
+	BannedAddresses map[string]int64 `json:"bannedAddresses"`
+}
+
+// Moderation state of a stream as persisted by a ModerationStore.
+// Bans expire at their time, the zero time is a permanent ban.
+type StoredModeration struct {
+	SlowMode        time.Duration        `json:"slowMode"`
+	WordFilter      []string             `json:"wordFilter,omitempty"`
+	BannedUsers     map[string]time.Time `json:"bannedUsers,omitempty"`
+	BannedAddresses map[string]time.Time `json:"bannedAddresses,omitempty"`
+}
+
+// Store persisting the moderation state of streams, so it is kept over a restart
+type ModerationStore interface {
+	LoadModeration() (map[string]StoredModeration, error)
+	SaveModeration(streamKey string, state StoredModeration) error
+}
+
+type streamModeration struct {
+	slowMode   time.Duration
+	wordFilter []string
+
+	// Expiry of a timeout or ban, the zero time is a permanent ban
+	bannedUsers     map[string]time.Time
+	bannedAddresses map[string]time.Time
+
+	lastMessage map[string]time.Time
+}
+
+// Moderation state of all streams, kept in memory
+type moderation struct {
+	mu      sync.Mutex
+	streams map[string]*streamModeration
+
+	// Remote address of users, used for address bans
+	addresses map[string]*userAddress
+}
+
+type userAddress struct {
+	address  string
+	lastSeen time.Time
+}
+
+func newModeration() *moderation {
+	return &moderation{
+		streams:   make(map[string]*streamModeration),
+		addresses: make(map[string]*userAddress),
+	}
+}
+
+// Returns the public identifier of a chat session.
+// The session ID authorizes sending messages, so it is never shared with other users.
+func UserIDForSession(sessionID string) string {
+	hash := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(hash[:8])
+}
+
+func (m *moderation) getStreamLocked(streamKey string) *streamModeration {
+	stream, ok := m.streams[streamKey]
+	if !ok {
+		stream = &streamModeration{
+			bannedUsers:     make(map[string]time.Time),
+			bannedAddresses: make(map[string]time.Time),
+			lastMessage:     make(map[string]time.Time),
+		}
+		m.streams[streamKey] = stream
+	}
+
+	return stream
+}
+
+// Verify that a user is allowed to send the message, and record it for slow mode
+func (m *moderation) allowMessage(streamKey string, userID string, text string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream := m.getStreamLocked(streamKey)
+
+	if err := isBanned(stream.bannedUsers, userID, now); err != nil {
+		return err
+	}
+
+	if address, ok := m.addresses[userID]; ok {
+		address.lastSeen = now
+		if err := isBanned(stream.bannedAddresses, address.address, now); err != nil {
+			return err
+		}
+	}
+
+	if containsFilteredWord(text, stream.wordFilter) {
+		return ErrFiltered
+	}
+
+	if stream.slowMode > 0 {
+		if next := stream.lastMessage[userID].Add(stream.slowMode); now.Before(next) {
+			return &WaitError{Reason: "slow mode is enabled", Until: next}
+		}
+	}
+
+	stream.lastMessage[userID] = now
+	return nil
+}
+
+// Ban a user for the duration, a duration of zero bans permanently.
+// The remote address of the user is banned as well when byAddress is set.
+func (m *moderation) ban(streamKey string, userID string, duration time.Duration, byAddress bool, now time.Time) (until time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if duration > 0 {
+		until = now.Add(duration)
+	}
+
+	address, ok := m.addresses[userID]
+	if byAddress && !ok {
+		return until, ErrUnknownUser
+	}
+
+	stream := m.getStreamLocked(streamKey)
+	stream.bannedUsers[userID] = until
+
+	if byAddress {
+		stream.bannedAddresses[address.address] = until
+	}
+
+	return until, nil
+}
+
+func (m *moderation) banAddress(streamKey string, address string, duration time.Duration, now time.Time) (until time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if duration > 0 {
+		until = now.Add(duration)
+	}
+
+	m.getStreamLocked(streamKey).bannedAddresses[address] = until
+	return until
+}
+
+// Remove the ban of a user, including the ban of their remote address
+func (m *moderation) unban(streamKey string, userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream := m.getStreamLocked(streamKey)
+	delete(stream.bannedUsers, userID)
+
+	if address, ok := m.addresses[userID]; ok {
+		delete(stream.bannedAddresses, address.address)
+	}
+}
+
+func (m *moderation) unbanAddress(streamKey string, address string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.getStreamLocked(streamKey).bannedAddresses, address)
+}
+
+func (m *moderation) setSlowMode(streamKey string, interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.getStreamLocked(streamKey).slowMode = interval
+}
+
+func (m *moderation) setWordFilter(streamKey string, words []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	filter := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			filter = append(filter, word)
+		}
+	}
+
+	m.getStreamLocked(streamKey).wordFilter = filter
+}
+
+func (m *moderation) setAddress(userID string, address string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addresses[userID] = &userAddress{
+		address:  address,
+		lastSeen: now,
+	}
+}
+
+// Returns the remote address of a user, empty when unknown
+func (m *moderation) getAddress(userID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if address, ok := m.addresses[userID]; ok {
+		return address.address
+	}
+
+	return ""
+}
+
+func (m *moderation) getState(streamKey string, now time.Time) ModerationState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream := m.getStreamLocked(streamKey)
+	state := ModerationState{
+		SlowModeSeconds: int64(stream.slowMode / time.Second),
+		WordFilter:      append([]string{}, stream.wordFilter...),
+		BannedUsers:     make(map[string]int64),
+		BannedAddresses: make(map[string]int64),
+	}
+
+	for userID, until := range stream.bannedUsers {
+		if isBanned(stream.bannedUsers, userID, now) != nil {
+			state.BannedUsers[userID] = unixMilliOrZero(until)
+		}
+	}
+
+	for address, until := range stream.bannedAddresses {
+		if isBanned(stream.bannedAddresses, address, now) != nil {
+			state.BannedAddresses[address] = unixMilliOrZero(until)
+		}
+	}
+
+	return state
+}
+
+// Returns the moderation state of a stream to persist
+func (m *moderation) getStoredState(streamKey string) StoredModeration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream := m.getStreamLocked(streamKey)
+	return StoredModeration{
+		SlowMode:        stream.slowMode,
+		WordFilter:      slices.Clone(stream.wordFilter),
+		BannedUsers:     maps.Clone(stream.bannedUsers),
+		BannedAddresses: maps.Clone(stream.bannedAddresses),
+	}
+}
+
+// Restore the persisted moderation state of streams, expired bans are dropped
+func (m *moderation) restore(states map[string]StoredModeration, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for streamKey, state := range states {
+		stream := m.getStreamLocked(streamKey)
+		stream.slowMode = state.SlowMode
+		stream.wordFilter = state.WordFilter
+
+		for userID, until := range state.BannedUsers {
+			if isBanned(state.BannedUsers, userID, now) != nil {
+				stream.bannedUsers[userID] = until
+			}
+		}
+
+		for address, until := range state.BannedAddresses {
+			if isBanned(state.BannedAddresses, address, now) != nil {
+				stream.bannedAddresses[address] = until
+			}
+		}
+	}
+}
+
+// Remove expired bans, slow mode records and addresses of inactive users
+func (m *moderation) cleanup(now time.Time, ttl time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for userID, address := range m.addresses {
+		if now.Sub(address.lastSeen) > ttl {
+			delete(m.addresses, userID)
+		}
+	}
+
+	for _, stream := range m.streams {
+		for userID, until := range stream.bannedUsers {
+			if !until.IsZero() && !now.Before(until) {
+				delete(stream.bannedUsers, userID)
+			}
+		}
+
+		for address, until := range stream.bannedAddresses {
+			if !until.IsZero() && !now.Before(until) {
+				delete(stream.bannedAddresses, address)
+			}
+		}
+
+		for userID, last := range stream.lastMessage {
+			if now.Sub(last) > stream.slowMode {
+				delete(stream.lastMessage, userID)
+			}
+		}
+	}
+}
+
+func isBanned(bans map[string]time.Time, key string, now time.Time) error {
+	until, ok := bans[key]
+	switch {
+	case !ok:
+		return nil
+	case until.IsZero():
+		return ErrBanned
+	case now.Before(until):
+		return &WaitError{Reason: "you are timed out", Until: until}
+	default:
+		return nil
+	}
+}
+
+// Permanent bans have no expiry and are represented by zero
+func unixMilliOrZero(until time.Time) int64 {
+	if until.IsZero() {
+		return 0
+	}
+
+	return until.UnixMilli()
+}
+
+// Filtered words match whole words regardless of case
+func containsFilteredWord(text string, filter []string) bool {
+	if len(filter) == 0 {
+		return false
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	for _, word := range words {
+		for _, filtered := range filter {
+			if word == filtered {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Connect a chat session to a stream, remembering the remote address of the user for address bans
+func (m *Manager) ConnectFrom(streamKey string, address string) string {
+	now := time.Now()
+	sessionID := m.store.Connect(streamKey, now)
+
+	if address != "" {
+		m.moderation.setAddress(UserIDForSession(sessionID), address, now)
+	}
+
+	return sessionID
+}
+
+// Delete a message and notify the subscribers of the stream
+func (m *Manager) DeleteMessage(streamKey string, messageID string) error {
+	now := time.Now()
+	if err := m.store.DeleteMessage(streamKey, messageID, now); err != nil {
+		return err
+	}
+
+	return m.store.Publish(streamKey, Event{
+		Type:       EventTypeDelete,
+		Moderation: &ModerationEvent{MessageID: messageID},
+	}, now)
+}
+
+// Prevent a user from sending messages for the duration
+func (m *Manager) TimeoutUser(streamKey string, userID string, duration time.Duration) error {
+	if duration <= 0 {
+		return fmt.Errorf("timeout duration must be positive")
+	}
+
+	now := time.Now()
+	until, err := m.moderation.ban(streamKey, userID, duration, false, now)
+	if err != nil {
+		return err
+	}
+	m.saveModeration(streamKey)
+
+	return m.store.Publish(streamKey, Event{
+		Type:       EventTypeTimeout,
+		Moderation: &ModerationEvent{UserID: userID, Until: unixMilliOrZero(until)},
+	}, now)
+}
+
+// Permanently prevent a user from sending messages, optionally including any user with the same remote address
+func (m *Manager) BanUser(streamKey string, userID string, byAddress bool) error {
+	now := time.Now()
+	if _, err := m.moderation.ban(streamKey, userID, 0, byAddress, now); err != nil {
+		return err
+	}
+	m.saveModeration(streamKey)
+
+	return m.store.Publish(streamKey, Event{
+		Type:       EventTypeBan,
+		Moderation: &ModerationEvent{UserID: userID},
+	}, now)
+}
+
+// Remove a timeout or ban of a user
+func (m *Manager) UnbanUser(streamKey string, userID string) error {
+	m.moderation.unban(streamKey, userID)
+	m.saveModeration(streamKey)
+
+	return m.store.Publish(streamKey, Event{
+		Type:       EventTypeUnban,
+		Moderation: &ModerationEvent{UserID: userID},
+	}, time.Now())
+}
+
+// Ban a remote address, a duration of zero bans permanently.
+// Addresses are not shared with subscribers, so no event is sent.
+func (m *Manager) BanAddress(streamKey string, address string, duration time.Duration) {
+	m.moderation.banAddress(streamKey, address, duration, time.Now())
+	m.saveModeration(streamKey)
+}
+
+func (m *Manager) UnbanAddress(streamKey string, address string) {
+	m.moderation.unbanAddress(streamKey, address)
+	m.saveModeration(streamKey)
+}
+
+// Limit users to one message per interval, an interval of zero disables slow mode
+func (m *Manager) SetSlowMode(streamKey string, interval time.Duration) error {
+	if interval < 0 {
+		return fmt.Errorf("slow mode interval must not be negative")
+	}
+
+	m.moderation.setSlowMode(streamKey, interval)
+	m.saveModeration(streamKey)
+
+	return m.store.Publish(streamKey, Event{
+		Type:       EventTypeSlowMode,
+		Moderation: &ModerationEvent{SlowModeSeconds: int64(interval / time.Second)},
+	}, time.Now())
+}
+
+// Replace the words that are not allowed in messages of a stream
+func (m *Manager) SetWordFilter(streamKey string, words []string) {
+	m.moderation.setWordFilter(streamKey, words)
+	m.saveModeration(streamKey)
+}
+
+func (m *Manager) GetModerationState(streamKey string) ModerationState {
+	return m.moderation.getState(streamKey, time.Now())
+}
+
+// Persist the moderation state of a stream when the store is a ModerationStore
+func (m *Manager) saveModeration(streamKey string) {
+	store, ok := m.store.(ModerationStore)
+	if !ok {
+		return
+	}
+
+	// Saves are serialized, so the last saved state includes every change
+	m.moderationSaveLock.Lock()
+	defer m.moderationSaveLock.Unlock()
+
+	if err := store.SaveModeration(streamKey, m.moderation.getStoredState(streamKey)); err != nil {
+		slog.Error("Chat.Manager.SaveModeration.Error", "streamKey", streamKey, "error", err)
+	}
+}
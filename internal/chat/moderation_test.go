@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModeration(t *testing.T) {
+	m := NewManagerWithStore(NewInMemoryStore(DefaultMaxHistory), DefaultTTL, DefaultCleanupInterval)
+	defer m.Stop()
+
+	streamKey := "test-stream"
+	sessionID := m.ConnectFrom(streamKey, "203.0.113.1")
+	userID := UserIDForSession(sessionID)
+
+	ch, cleanup, _, err := m.SubscribeStream(streamKey, 0)
+	require.NoError(t, err)
+	defer cleanup()
+
+	receive := func() Event {
+		t.Helper()
+		select {
+		case event := <-ch:
+			return event
+		case <-time.After(1 * time.Second):
+			t.Fatal("timeout waiting for event")
+			return Event{}
+		}
+	}
+
+	// Messages carry the public user ID, never the session ID
+	require.NoError(t, m.Send(sessionID, "hello", "user1"))
+	message := receive()
+	assert.Equal(t, userID, message.Message.UserID)
+	assert.NotEqual(t, sessionID, message.Message.UserID)
+
+	// Deleted messages are removed from history
+	require.NoError(t, m.DeleteMessage(streamKey, message.Message.ID))
+	deleted := receive()
+	assert.Equal(t, EventTypeDelete, deleted.Type)
+	assert.Equal(t, message.Message.ID, deleted.Moderation.MessageID)
+
+	_, cleanupHistory, history, err := m.SubscribeStream(streamKey, 0)
+	require.NoError(t, err)
+	cleanupHistory()
+	assert.Empty(t, history)
+	assert.ErrorIs(t, m.DeleteMessage(streamKey, message.Message.ID), ErrNotFound)
+
+	// Word filter matches whole words regardless of case
+	m.SetWordFilter(streamKey, []string{"Spoiler"})
+	assert.ErrorIs(t, m.Send(sessionID, "no SPOILER please", "user1"), ErrFiltered)
+	assert.NoError(t, m.Send(sessionID, "no spoilers please", "user1"))
+	receive()
+	m.SetWordFilter(streamKey, nil)
+
+	// Slow mode limits the message rate of each user
+	require.NoError(t, m.SetSlowMode(streamKey, time.Minute))
+	assert.Equal(t, EventTypeSlowMode, receive().Type)
+	var waitError *WaitError
+	assert.ErrorAs(t, m.Send(sessionID, "again", "user1"), &waitError)
+	require.NoError(t, m.SetSlowMode(streamKey, 0))
+	receive()
+
+	// Timeouts expire, bans are permanent until removed
+	require.NoError(t, m.TimeoutUser(streamKey, userID, time.Minute))
+	assert.Equal(t, EventTypeTimeout, receive().Type)
+	assert.ErrorAs(t, m.Send(sessionID, "timed out", "user1"), &waitError)
+
+	require.NoError(t, m.UnbanUser(streamKey, userID))
+	receive()
+	assert.NoError(t, m.Send(sessionID, "back", "user1"))
+	receive()
+
+	// Address bans apply to new sessions from the same address
+	require.NoError(t, m.BanUser(streamKey, userID, true))
+	assert.Equal(t, EventTypeBan, receive().Type)
+	assert.ErrorIs(t, m.Send(sessionID, "banned", "user1"), ErrBanned)
+
+	otherSessionID := m.ConnectFrom(streamKey, "203.0.113.1")
+	assert.ErrorIs(t, m.Send(otherSessionID, "evading", "user2"), ErrBanned)
+
+	state := m.GetModerationState(streamKey)
+	assert.Equal(t, int64(0), state.BannedUsers[userID])
+	assert.Contains(t, state.BannedAddresses, "203.0.113.1")
+
+	m.UnbanAddress(streamKey, "203.0.113.1")
+	assert.NoError(t, m.Send(otherSessionID, "welcome back", "user2"))
+}
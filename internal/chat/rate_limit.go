@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRateLimit        = 1.0
+	DefaultRateBurst        = 5
+	DefaultAddressRateLimit = 5.0
+	DefaultAddressRateBurst = 20
+)
+
+var ErrRateLimited = errors.New("too many messages, slow down")
+
+// Token bucket settings, a rate of zero disables the limit
+type RateLimit struct {
+	// Messages per second that are added to the bucket
+	Rate float64
+
+	// Messages that can be sent at once when the bucket is full
+	Burst int
+}
+
+// Messages accepted and rejected by the rate limits of a stream
+type RateLimitStats struct {
+	Allowed          uint64 `json:"allowed"`
+	LimitedBySession uint64 `json:"limitedBySession"`
+	LimitedByAddress uint64 `json:"limitedByAddress"`
+
+	lastActivity time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type rateLimiter struct {
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	return &rateLimiter{
+		limit:   limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (l *rateLimiter) enabled() bool {
+	return l.limit.Rate > 0 && l.limit.Burst > 0
+}
+
+// Returns the tokens in the bucket of a key at the given time
+func (l *rateLimiter) refill(key string, now time.Time) *tokenBucket {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.limit.Burst), updated: now}
+		l.buckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.updated); elapsed > 0 {
+		bucket.tokens = min(float64(l.limit.Burst), bucket.tokens+elapsed.Seconds()*l.limit.Rate)
+		bucket.updated = now
+	}
+
+	return bucket
+}
+
+// Buckets that are full again behave the same as new buckets and are removed
+func (l *rateLimiter) cleanup(now time.Time) {
+	for key := range l.buckets {
+		if l.refill(key, now).tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Limits the message rate of each chat session and of each remote address
+type floodProtection struct {
+	mu        sync.Mutex
+	sessions  *rateLimiter
+	addresses *rateLimiter
+	stats     map[string]*RateLimitStats
+}
+
+func newFloodProtection(session RateLimit, address RateLimit) *floodProtection {
+	return &floodProtection{
+		sessions:  newRateLimiter(session),
+		addresses: newRateLimiter(address),
+		stats:     make(map[string]*RateLimitStats),
+	}
+}
+
+// Take a token for the session and the address, the message is rejected when either bucket is empty
+func (f *floodProtection) allow(streamKey string, sessionID string, address string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats, ok := f.stats[streamKey]
+	if !ok {
+		stats = &RateLimitStats{}
+		f.stats[streamKey] = stats
+	}
+	stats.lastActivity = now
+
+	var sessionBucket, addressBucket *tokenBucket
+
+	if f.sessions.enabled() {
+		if sessionBucket = f.sessions.refill(sessionID, now); sessionBucket.tokens < 1 {
+			stats.LimitedBySession++
+			return ErrRateLimited
+		}
+	}
+
+	if f.addresses.enabled() && address != "" {
+		if addressBucket = f.addresses.refill(address, now); addressBucket.tokens < 1 {
+			stats.LimitedByAddress++
+			return ErrRateLimited
+		}
+	}
+
+	if sessionBucket != nil {
+		sessionBucket.tokens--
+	}
+
+	if addressBucket != nil {
+		addressBucket.tokens--
+	}
+
+	stats.Allowed++
+	return nil
+}
+
+func (f *floodProtection) getStats(streamKey string) RateLimitStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if stats, ok := f.stats[streamKey]; ok {
+		return *stats
+	}
+
+	return RateLimitStats{}
+}
+
+// Remove full buckets and the counters of streams without messages within the ttl
+func (f *floodProtection) cleanup(now time.Time, ttl time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sessions.cleanup(now)
+	f.addresses.cleanup(now)
+
+	for streamKey, stats := range f.stats {
+		if now.Sub(stats.lastActivity) > ttl {
+			delete(f.stats, streamKey)
+		}
+	}
+}
+
+// Replace the rate limits of chat sessions and remote addresses, existing buckets are reset
+func (m *Manager) SetRateLimits(session RateLimit, address RateLimit) {
+	m.floodProtection.mu.Lock()
+	defer m.floodProtection.mu.Unlock()
+
+	m.floodProtection.sessions = newRateLimiter(session)
+	m.floodProtection.addresses = newRateLimiter(address)
+}
+
+// Returns the rate limit counters of a stream
+func (m *Manager) GetRateLimitStats(streamKey string) RateLimitStats {
+	return m.floodProtection.getStats(streamKey)
+}
@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFloodProtection(t *testing.T) {
+	now := time.Now()
+	f := newFloodProtection(RateLimit{Rate: 1, Burst: 2}, RateLimit{Rate: 1, Burst: 3})
+
+	// Each session can send a burst before being limited
+	assert.NoError(t, f.allow("stream", "session1", "203.0.113.1", now))
+	assert.NoError(t, f.allow("stream", "session1", "203.0.113.1", now))
+	assert.ErrorIs(t, f.allow("stream", "session1", "203.0.113.1", now), ErrRateLimited)
+
+	// Sessions sharing an address are limited by the address bucket
+	assert.NoError(t, f.allow("stream", "session2", "203.0.113.1", now))
+	assert.ErrorIs(t, f.allow("stream", "session2", "203.0.113.1", now), ErrRateLimited)
+
+	// Tokens are refilled at the configured rate
+	later := now.Add(time.Second)
+	assert.NoError(t, f.allow("stream", "session1", "203.0.113.1", later))
+	assert.ErrorIs(t, f.allow("stream", "session1", "203.0.113.1", later), ErrRateLimited)
+
+	assert.Equal(t, RateLimitStats{
+		Allowed:          4,
+		LimitedBySession: 2,
+		LimitedByAddress: 1,
+		lastActivity:     later,
+	}, f.getStats("stream"))
+
+	// Full buckets and inactive streams are removed
+	f.cleanup(later.Add(time.Hour), time.Minute)
+	assert.Empty(t, f.sessions.buckets)
+	assert.Empty(t, f.addresses.buckets)
+	assert.Equal(t, RateLimitStats{}, f.getStats("stream"))
+}
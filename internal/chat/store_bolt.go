@@ -0,0 +1,533 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltSessionsBucket   = []byte("sessions")
+	boltRoomsBucket      = []byte("rooms")
+	boltEventsBucket     = []byte("events")
+	boltModerationBucket = []byte("moderation")
+	boltLastActivity     = []byte("lastActivity")
+)
+
+// Persisted form of an Event, the ID is the key of the record
+type boltEvent struct {
+	Type    string  `json:"type"`
+	Message Message `json:"message"`
+}
+
+type boltRoom struct {
+	mu          sync.Mutex
+	subscribers map[string]*subscriber
+}
+
+// Store persisting sessions and chat history in a bbolt database.
+// Event IDs are the sequence of the room bucket, so they continue after a restart
+// and a lastEventID received before the restart resumes the backlog correctly.
+// Subscribers are kept in memory as they are bound to the connections of this instance.
+type BoltStore struct {
+	db         *bolt.DB
+	maxHistory int
+
+	mu    sync.Mutex
+	rooms map[string]*boltRoom
+}
+
+func NewBoltStore(path string, maxHistory int) (*BoltStore, error) {
+	if maxHistory <= 0 {
+		maxHistory = DefaultMaxHistory
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltSessionsBucket); err != nil {
+			return err
+		}
+
+		if _, err := tx.CreateBucketIfNotExists(boltModerationBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucketIfNotExists(boltRoomsBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &BoltStore{
+		db:         db,
+		maxHistory: maxHistory,
+		rooms:      make(map[string]*boltRoom),
+	}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Connect(streamKey string, now time.Time) string {
+	sessionID := uuid.New().String()
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := putSession(tx, &Session{
+			ID:           sessionID,
+			StreamKey:    streamKey,
+			LastActivity: now,
+		}); err != nil {
+			return err
+		}
+
+		_, err := getOrCreateRoomBucket(tx, streamKey, now)
+		return err
+	}); err != nil {
+		slog.Error("Chat.BoltStore.Connect.Error", "error", err)
+	}
+
+	return sessionID
+}
+
+func (s *BoltStore) GetSession(sessionID string, now time.Time) (session *Session, ok bool) {
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		session, ok = getSession(tx, sessionID)
+		return nil
+	}); err != nil {
+		slog.Error("Chat.BoltStore.GetSession.Error", "error", err)
+		return nil, false
+	}
+
+	return session, ok
+}
+
+func (s *BoltStore) TouchSession(sessionID string, now time.Time) (ok bool) {
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		_, ok = touchSession(tx, sessionID, now)
+		return nil
+	}); err != nil {
+		slog.Error("Chat.BoltStore.TouchSession.Error", "error", err)
+		return false
+	}
+
+	return ok
+}
+
+func (s *BoltStore) Subscribe(sessionID string, lastEventID uint64, now time.Time) (chan Event, func(), []Event, error) {
+	session, ok := s.GetSession(sessionID, now)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("invalid session")
+	}
+
+	return s.subscribeToRoom(session.StreamKey, session.ID, lastEventID, now)
+}
+
+func (s *BoltStore) SubscribeStream(streamKey string, lastEventID uint64, now time.Time) (chan Event, func(), []Event, error) {
+	return s.subscribeToRoom(streamKey, "", lastEventID, now)
+}
+
+func (s *BoltStore) Send(session *Session, text string, displayName string, now time.Time) error {
+	return s.sendToRoom(session.StreamKey, session.ID, text, displayName, now)
+}
+
+func (s *BoltStore) SendToStream(streamKey string, text string, displayName string, now time.Time) error {
+	return s.sendToRoom(streamKey, "", text, displayName, now)
+}
+
+func (s *BoltStore) DeleteMessage(streamKey string, messageID string, now time.Time) error {
+	r := s.getRoom(streamKey)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		room, err := getRoomBucket(tx, streamKey, now, false)
+		if err != nil {
+			return ErrNotFound
+		}
+
+		cursor := room.Bucket(boltEventsBucket).Cursor()
+		for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+			var stored boltEvent
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+
+			if stored.Type == EventTypeMessage && stored.Message.ID == messageID {
+				return cursor.Delete()
+			}
+		}
+
+		return ErrNotFound
+	})
+}
+
+func (s *BoltStore) Publish(streamKey string, event Event, now time.Time) error {
+	r := s.getRoom(streamKey)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, sub := range r.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (s *BoltStore) Cleanup(now time.Time, ttl time.Duration) {
+	// Rooms with subscribers are kept, collected before the transaction as sends and subscriptions
+	// hold the room lock while waiting for a transaction
+	s.mu.Lock()
+	activeRooms := make(map[string]bool, len(s.rooms))
+	for streamKey, r := range s.rooms {
+		r.mu.Lock()
+		activeRooms[streamKey] = len(r.subscribers) != 0
+		r.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	var expiredRooms []string
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		sessions := tx.Bucket(boltSessionsBucket)
+		var expiredSessions [][]byte
+		if err := sessions.ForEach(func(key []byte, value []byte) error {
+			var session Session
+			if err := json.Unmarshal(value, &session); err != nil || now.Sub(session.LastActivity) > ttl {
+				expiredSessions = append(expiredSessions, key)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, key := range expiredSessions {
+			if err := sessions.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		rooms := tx.Bucket(boltRoomsBucket)
+		if err := rooms.ForEachBucket(func(key []byte) error {
+			if !activeRooms[string(key)] && now.Sub(getLastActivity(rooms.Bucket(key))) > ttl {
+				expiredRooms = append(expiredRooms, string(key))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, streamKey := range expiredRooms {
+			if err := rooms.DeleteBucket([]byte(streamKey)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		slog.Error("Chat.BoltStore.Cleanup.Error", "error", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, streamKey := range expiredRooms {
+		if r, ok := s.rooms[streamKey]; ok {
+			r.mu.Lock()
+			if len(r.subscribers) == 0 {
+				delete(s.rooms, streamKey)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (s *BoltStore) LoadModeration() (map[string]StoredModeration, error) {
+	states := make(map[string]StoredModeration)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltModerationBucket).ForEach(func(key []byte, value []byte) error {
+			var state StoredModeration
+			if err := json.Unmarshal(value, &state); err != nil {
+				return err
+			}
+
+			states[string(key)] = state
+			return nil
+		})
+	})
+
+	return states, err
+}
+
+func (s *BoltStore) SaveModeration(streamKey string, state StoredModeration) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltModerationBucket).Put([]byte(streamKey), value)
+	})
+}
+
+// Subscribe to the room of the stream key. Without a session ID the room is created on demand,
+// otherwise the activity of the session is updated in the same transaction.
+func (s *BoltStore) subscribeToRoom(streamKey string, sessionID string, lastEventID uint64, now time.Time) (chan Event, func(), []Event, error) {
+	r := s.getRoom(streamKey)
+
+	// Holding the room lock while reading the history ensures no event is both missed and not yet in history
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var history []Event
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		room, err := getSessionRoomBucket(tx, streamKey, sessionID, now)
+		if err != nil {
+			return err
+		}
+
+		cursor := room.Bucket(boltEventsBucket).Cursor()
+		key, value := cursor.First()
+		if lastEventID > 0 {
+			key, value = cursor.Seek(encodeEventID(lastEventID + 1))
+		}
+
+		for ; key != nil; key, value = cursor.Next() {
+			var stored boltEvent
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+
+			history = append(history, Event{
+				ID:      binary.BigEndian.Uint64(key),
+				Type:    stored.Type,
+				Message: stored.Message,
+			})
+		}
+
+		return nil
+	}); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if history == nil {
+		history = []Event{}
+	}
+
+	subID := uuid.New().String()
+	ch := make(chan Event, 100)
+	r.subscribers[subID] = &subscriber{ch: ch}
+
+	cleanup := func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		sub, ok := r.subscribers[subID]
+		if !ok {
+			return
+		}
+
+		delete(r.subscribers, subID)
+		close(sub.ch)
+	}
+
+	return ch, cleanup, history, nil
+}
+
+// Add a message to the room of the stream key. Without a session ID the room is created on demand,
+// otherwise the message is sent by the session and its activity is updated in the same transaction.
+func (s *BoltStore) sendToRoom(streamKey string, sessionID string, text string, displayName string, now time.Time) error {
+	userID := ""
+	if sessionID != "" {
+		userID = UserIDForSession(sessionID)
+	}
+
+	r := s.getRoom(streamKey)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event := Event{
+		Type: EventTypeMessage,
+		Message: Message{
+			ID:          uuid.New().String(),
+			TS:          now.UnixMilli(),
+			Text:        text,
+			DisplayName: displayName,
+			UserID:      userID,
+		},
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		room, err := getSessionRoomBucket(tx, streamKey, sessionID, now)
+		if err != nil {
+			return err
+		}
+
+		events := room.Bucket(boltEventsBucket)
+		if event.ID, err = events.NextSequence(); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(boltEvent{
+			Type:    event.Type,
+			Message: event.Message,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := events.Put(encodeEventID(event.ID), value); err != nil {
+			return err
+		}
+
+		// Event IDs are sequential, so everything up to the oldest kept ID is removed
+		if event.ID <= uint64(s.maxHistory) {
+			return nil
+		}
+
+		oldestKept := encodeEventID(event.ID - uint64(s.maxHistory) + 1)
+		cursor := events.Cursor()
+		for key, _ := cursor.First(); key != nil && bytes.Compare(key, oldestKept) < 0; key, _ = cursor.First() {
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, sub := range r.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (s *BoltStore) getRoom(streamKey string) *boltRoom {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rooms[streamKey]
+	if !ok {
+		r = &boltRoom{
+			subscribers: make(map[string]*subscriber),
+		}
+		s.rooms[streamKey] = r
+	}
+
+	return r
+}
+
+func putSession(tx *bolt.Tx, session *Session) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(boltSessionsBucket).Put([]byte(session.ID), value)
+}
+
+func getSession(tx *bolt.Tx, sessionID string) (*Session, bool) {
+	value := tx.Bucket(boltSessionsBucket).Get([]byte(sessionID))
+	if value == nil {
+		return nil, false
+	}
+
+	var session Session
+	if err := json.Unmarshal(value, &session); err != nil {
+		return nil, false
+	}
+
+	return &session, true
+}
+
+func touchSession(tx *bolt.Tx, sessionID string, now time.Time) (*Session, bool) {
+	session, ok := getSession(tx, sessionID)
+	if !ok {
+		return nil, false
+	}
+
+	session.LastActivity = now
+	if err := putSession(tx, session); err != nil {
+		return nil, false
+	}
+
+	return session, true
+}
+
+// Returns the bucket of the room a session is in and updates the activity of both.
+// Without a session ID the room of the stream key is created on demand.
+func getSessionRoomBucket(tx *bolt.Tx, streamKey string, sessionID string, now time.Time) (*bolt.Bucket, error) {
+	if sessionID == "" {
+		return getRoomBucket(tx, streamKey, now, true)
+	}
+
+	if _, ok := touchSession(tx, sessionID, now); !ok {
+		return nil, fmt.Errorf("invalid session")
+	}
+
+	return getRoomBucket(tx, streamKey, now, false)
+}
+
+// Returns the bucket of a room and updates its activity.
+// Rooms of sessions must exist, rooms addressed by stream key are created on demand.
+func getRoomBucket(tx *bolt.Tx, streamKey string, now time.Time, create bool) (*bolt.Bucket, error) {
+	if !create && tx.Bucket(boltRoomsBucket).Bucket([]byte(streamKey)) == nil {
+		return nil, fmt.Errorf("room not found")
+	}
+
+	return getOrCreateRoomBucket(tx, streamKey, now)
+}
+
+func getOrCreateRoomBucket(tx *bolt.Tx, streamKey string, now time.Time) (*bolt.Bucket, error) {
+	room, err := tx.Bucket(boltRoomsBucket).CreateBucketIfNotExists([]byte(streamKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := room.CreateBucketIfNotExists(boltEventsBucket); err != nil {
+		return nil, err
+	}
+
+	if err := room.Put(boltLastActivity, binary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))); err != nil {
+		return nil, err
+	}
+
+	return room, nil
+}
+
+func getLastActivity(room *bolt.Bucket) time.Time {
+	value := room.Get(boltLastActivity)
+	if len(value) != 8 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(value)))
+}
+
+func encodeEventID(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStoreRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	now := time.Now()
+
+	store, err := NewBoltStore(path, 2)
+	require.NoError(t, err)
+
+	sessionID := store.Connect("test-stream", now.Add(-time.Minute))
+
+	// Reading a session does not update its activity, sending does
+	session, ok := store.GetSession(sessionID, now)
+	require.True(t, ok)
+	assert.True(t, session.LastActivity.Equal(now.Add(-time.Minute)))
+
+	for _, text := range []string{"one", "two", "three"} {
+		assert.NoError(t, store.Send(session, text, "user1", now))
+	}
+
+	session, _ = store.GetSession(sessionID, now)
+	assert.True(t, session.LastActivity.Equal(now))
+	require.NoError(t, store.Close())
+
+	// Sessions and history survive a restart
+	store, err = NewBoltStore(path, 2)
+	require.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+
+	session, ok = store.GetSession(sessionID, now)
+	assert.True(t, ok)
+	assert.Equal(t, "test-stream", session.StreamKey)
+
+	// History is limited to the two most recent events
+	_, cleanup, history, err := store.Subscribe(sessionID, 0, now)
+	require.NoError(t, err)
+	cleanup()
+	require.Len(t, history, 2)
+	assert.Equal(t, uint64(2), history[0].ID)
+	assert.Equal(t, "three", history[1].Message.Text)
+
+	// Resume after the last received event
+	ch, cleanup, history, err := store.SubscribeStream("test-stream", 2, now)
+	require.NoError(t, err)
+	defer cleanup()
+	require.Len(t, history, 1)
+	assert.Equal(t, uint64(3), history[0].ID)
+
+	// Event IDs continue after the restart
+	assert.NoError(t, store.SendToStream("test-stream", "four", "user2", now))
+	select {
+	case event := <-ch:
+		assert.Equal(t, uint64(4), event.ID)
+		assert.Equal(t, "four", event.Message.Text)
+	case <-time.After(1 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+
+	// Expired sessions and rooms without subscribers are removed
+	cleanup()
+	store.Cleanup(now.Add(2*time.Hour), time.Hour)
+
+	_, ok = store.GetSession(sessionID, now)
+	assert.False(t, ok)
+
+	_, _, history, err = store.SubscribeStream("test-stream", 0, now)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestBoltStoreModeration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	streamKey := "test-stream"
+
+	store, err := NewBoltStore(path, DefaultMaxHistory)
+	require.NoError(t, err)
+	m := NewManagerWithStore(store, DefaultTTL, DefaultCleanupInterval)
+
+	userID := UserIDForSession(m.ConnectFrom(streamKey, "203.0.113.1"))
+	require.NoError(t, m.BanUser(streamKey, userID, true))
+	require.NoError(t, m.TimeoutUser(streamKey, "timed-out", time.Hour))
+	require.NoError(t, m.TimeoutUser(streamKey, "expiring", time.Hour))
+	require.NoError(t, m.UnbanUser(streamKey, "expiring"))
+	require.NoError(t, m.SetSlowMode(streamKey, time.Minute))
+	m.SetWordFilter(streamKey, []string{"spoiler"})
+
+	state := m.GetModerationState(streamKey)
+	m.Stop()
+
+	// Moderation survives a restart, address bans also keep out new sessions of the user
+	store, err = NewBoltStore(path, DefaultMaxHistory)
+	require.NoError(t, err)
+	m = NewManagerWithStore(store, DefaultTTL, DefaultCleanupInterval)
+	defer m.Stop()
+
+	assert.Equal(t, state, m.GetModerationState(streamKey))
+	assert.NotContains(t, state.BannedUsers, "expiring")
+
+	sessionID := m.ConnectFrom(streamKey, "203.0.113.1")
+	assert.ErrorIs(t, m.Send(sessionID, "evading", "user1"), ErrBanned)
+}
@@ -56,15 +56,14 @@ func (s *InMemoryStore) Connect(streamKey string, now time.Time) string {
 }
 
 func (s *InMemoryStore) GetSession(sessionID string, now time.Time) (*Session, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	session, ok := s.sessions[sessionID]
 	if !ok {
 		return nil, false
 	}
 
-	session.LastActivity = now
 	copy := *session
 	return &copy, true
 }
@@ -109,24 +108,23 @@ func (s *InMemoryStore) SubscribeStream(streamKey string, lastEventID uint64, no
 	return s.subscribeToRoom(r, lastEventID, now)
 }
 
-func (s *InMemoryStore) Send(sessionID string, text string, displayName string, now time.Time) error {
+func (s *InMemoryStore) Send(session *Session, text string, displayName string, now time.Time) error {
 	s.mu.Lock()
-	session, ok := s.sessions[sessionID]
+	storedSession, ok := s.sessions[session.ID]
 	if !ok {
 		s.mu.Unlock()
 		return fmt.Errorf("invalid session")
 	}
 
-	session.LastActivity = now
-	streamKey := session.StreamKey
-	r, ok := s.rooms[streamKey]
+	storedSession.LastActivity = now
+	r, ok := s.rooms[session.StreamKey]
 	s.mu.Unlock()
 
 	if !ok {
 		return fmt.Errorf("room not found")
 	}
 
-	s.sendToRoom(r, text, displayName, now)
+	s.sendToRoom(r, text, displayName, UserIDForSession(session.ID), now)
 	return nil
 }
 
@@ -135,7 +133,49 @@ func (s *InMemoryStore) SendToStream(streamKey string, text string, displayName
 	r := s.getOrCreateRoomLocked(streamKey, now)
 	s.mu.Unlock()
 
-	s.sendToRoom(r, text, displayName, now)
+	s.sendToRoom(r, text, displayName, "", now)
+	return nil
+}
+
+func (s *InMemoryStore) DeleteMessage(streamKey string, messageID string, now time.Time) error {
+	s.mu.Lock()
+	r, ok := s.rooms[streamKey]
+	s.mu.Unlock()
+
+	if !ok {
+		return ErrNotFound
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, event := range r.history {
+		if event.Type == EventTypeMessage && event.Message.ID == messageID {
+			r.history = append(r.history[:i], r.history[i+1:]...)
+			r.lastActivity = now
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *InMemoryStore) Publish(streamKey string, event Event, now time.Time) error {
+	s.mu.Lock()
+	r := s.getOrCreateRoomLocked(streamKey, now)
+	s.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastActivity = now
+	for _, sub := range r.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+
 	return nil
 }
 
@@ -202,7 +242,7 @@ func (s *InMemoryStore) subscribeToRoom(r *room, lastEventID uint64, now time.Ti
 	return ch, cleanup, history, nil
 }
 
-func (s *InMemoryStore) sendToRoom(r *room, text string, displayName string, now time.Time) {
+func (s *InMemoryStore) sendToRoom(r *room, text string, displayName string, userID string, now time.Time) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -215,6 +255,7 @@ func (s *InMemoryStore) sendToRoom(r *room, text string, displayName string, now
 			TS:          now.UnixMilli(),
 			Text:        text,
 			DisplayName: displayName,
+			UserID:      userID,
 		},
 	}
 	r.nextEventID++
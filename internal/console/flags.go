@@ -4,4 +4,15 @@ const (
 	// Create new profile
 	createNewProfile          = "createNewProfile"
 	createNewProfileStreamKey = "streamKey"
+
+	// Add a token to an existing profile
+	addProfileToken = "addProfileToken"
+
+	// Options of the token created by createNewProfile or addProfileToken
+	tokenLabel  = "tokenLabel"
+	tokenScopes = "tokenScopes"
+	tokenExpiry = "tokenExpiry"
+
+	// Import per-file profiles into the profile store
+	migrateProfiles = "migrateProfiles"
 )
@@ -2,31 +2,74 @@ package console
 
 import (
 	"flag"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 )
 
 func HandleConsoleFlags() {
 	createNewProfile := flag.Bool(createNewProfile, false, "Create a new stream profile from the -streamKey flag")
+	addProfileToken := flag.Bool(addProfileToken, false, "Add a token to the stream profile of the -streamKey flag")
 	streamKey := flag.String(createNewProfileStreamKey, "", "The stream key used to identify a streaming session")
+	tokenLabel := flag.String(tokenLabel, "", "Label of the created token")
+	tokenScopes := flag.String(tokenScopes, "", "Comma separated scopes of the created token: publish, profile and moderate. Defaults to all scopes")
+	tokenExpiry := flag.Duration(tokenExpiry, 0, "Duration after which the created token expires, such as 720h. Defaults to no expiry")
+	migrateProfiles := flag.Bool(migrateProfiles, false, "Import the stream profiles stored as one file per profile into the profile store")
 
 	flag.Parse()
 
-	if *createNewProfile {
+	if *createNewProfile || *addProfileToken {
 		if len(*streamKey) == 0 {
-			log.Println("No stream key was provided. Use the flags `-createNewProfile -streamKey MyStreamKey` to create a new profile.")
+			slog.Error("No stream key was provided. Use the flags `-createNewProfile -streamKey MyStreamKey` to create a new profile.")
 			os.Exit(0)
 		}
 
-		token, err := authorization.CreateProfile(*streamKey)
+		scopes, err := authorization.ParseTokenScopes(*tokenScopes)
 		if err != nil {
-			log.Println(err)
+			slog.Error("Could not read token scopes", "error", err)
 			os.Exit(0)
 		}
 
-		log.Println("Created", *streamKey, "with bearer token:", token)
+		options := authorization.TokenOptions{
+			Label:  *tokenLabel,
+			Scopes: scopes,
+		}
+		if *tokenExpiry > 0 {
+			expiresAt := time.Now().Add(*tokenExpiry).UTC()
+			options.ExpiresAt = &expiresAt
+		}
+
+		if *addProfileToken {
+			token, err := authorization.AddProfileToken(*streamKey, options)
+			if err != nil {
+				slog.Error("Could not add profile token", "streamKey", *streamKey, "error", err)
+				os.Exit(0)
+			}
+
+			slog.Info("Added profile token", "streamKey", *streamKey, "token", token)
+			os.Exit(0)
+		}
+
+		token, err := authorization.CreateProfile(*streamKey, options)
+		if err != nil {
+			slog.Error("Could not create profile", "streamKey", *streamKey, "error", err)
+			os.Exit(0)
+		}
+
+		slog.Info("Created profile", "streamKey", *streamKey, "token", token)
+		os.Exit(0)
+	}
+
+	if *migrateProfiles {
+		imported, err := authorization.MigrateProfiles()
+		if err != nil {
+			slog.Error("Could not migrate profiles", "imported", imported, "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("Migrated profiles", "imported", imported)
 		os.Exit(0)
 	}
 }
@@ -2,7 +2,7 @@ package environment
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -20,22 +20,26 @@ var errNoBuildDirectory = errors.New("build directory does not exist, run `npm i
 func LoadEnvironmentVariables() {
 	if err := loadConfigs(); err != nil {
 		if errors.Is(err, errNoBuildDirectory) {
-			log.Fatal("Environment:", err)
+			slog.Error("Environment: Could not load configuration", "error", err)
+			os.Exit(1)
 		}
 
-		log.Println("Environment: Failed to find config in CWD, changing CWD to executable path")
+		slog.Warn("Environment: Failed to find config in CWD, changing CWD to executable path")
 
 		executablePath, executableErr := os.Executable()
 		if executableErr != nil {
-			log.Fatal("Environment:", executableErr)
+			slog.Error("Environment: Could not find executable path", "error", executableErr)
+			os.Exit(1)
 		}
 
 		if chdirErr := os.Chdir(filepath.Dir(executablePath)); chdirErr != nil {
-			log.Fatal("Environment:", chdirErr)
+			slog.Error("Environment: Could not change CWD", "error", chdirErr)
+			os.Exit(1)
 		}
 
 		if retryErr := loadConfigs(); retryErr != nil {
-			log.Fatal("Environment:", retryErr)
+			slog.Error("Environment: Could not load configuration", "error", retryErr)
+			os.Exit(1)
 		}
 	}
 
@@ -44,16 +48,16 @@ func LoadEnvironmentVariables() {
 
 func loadConfigs() error {
 	if os.Getenv(appEnv) == "development" {
-		log.Println("Environment: Loading `" + envFileDevelopment + "`")
+		slog.Info("Environment: Loading", "file", envFileDevelopment)
 		if err := godotenv.Load(envFileDevelopment); err != nil {
-			log.Printf("Environment: Could not load `%s`: %v", envFileDevelopment, err)
+			slog.Warn("Environment: Could not load", "file", envFileDevelopment, "error", err)
 		}
 		return nil
 	}
 
-	log.Println("Environment: Loading `" + envFileProduction + "`")
+	slog.Info("Environment: Loading", "file", envFileProduction)
 	if err := godotenv.Load(envFileProduction); err != nil {
-		log.Printf("Environment: Could not load `%s`: %v", envFileProduction, err)
+		slog.Warn("Environment: Could not load", "file", envFileProduction, "error", err)
 	}
 
 	if os.Getenv(FrontendDisabled) == "" {
@@ -78,10 +82,10 @@ func GetFrontendPath() string {
 
 func setDefaultEnvironmentVariables() {
 	if os.Getenv(StreamProfilePath) == "" {
-		log.Println("Environment: Setting STREAM_PROFILE_PATH: profiles")
-		err := os.Setenv(StreamProfilePath, "profiles")
-		if err != nil {
-			log.Panic("Error setting default value for STREAM_PROFILE_PATH")
+		slog.Info("Environment: Setting STREAM_PROFILE_PATH", "value", "profiles")
+		if err := os.Setenv(StreamProfilePath, "profiles"); err != nil {
+			slog.Error("Environment: Error setting default value for STREAM_PROFILE_PATH", "error", err)
+			os.Exit(1)
 		}
 	}
 }
@@ -0,0 +1,174 @@
+package environment
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Selects log entries by minimum level, stream key and time range.
+// Entries that cannot be parsed only match an empty filter.
+type LogFilter struct {
+	Level     *slog.Level
+	StreamKey string
+	Since     time.Time
+	Until     time.Time
+}
+
+type logEntry struct {
+	time      time.Time
+	level     slog.Level
+	hasLevel  bool
+	streamKey string
+}
+
+// Returns the filter of the level, streamKey, since and until query parameters, times are RFC 3339
+func ParseLogFilter(query url.Values) (filter LogFilter, err error) {
+	if value := query.Get("level"); value != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return filter, fmt.Errorf("invalid level: %s", value)
+		}
+		filter.Level = &level
+	}
+
+	filter.StreamKey = query.Get("streamKey")
+
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, fmt.Errorf("invalid since: %s", value)
+		}
+	}
+
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			return filter, fmt.Errorf("invalid until: %s", value)
+		}
+	}
+
+	return filter, nil
+}
+
+func (f LogFilter) isEmpty() bool {
+	return f.Level == nil && f.StreamKey == "" && f.Since.IsZero() && f.Until.IsZero()
+}
+
+func (f LogFilter) matches(entry logEntry) bool {
+	if f.Level != nil && (!entry.hasLevel || entry.level < *f.Level) {
+		return false
+	}
+
+	if f.StreamKey != "" && entry.streamKey != f.StreamKey {
+		return false
+	}
+
+	if !f.Since.IsZero() && (entry.time.IsZero() || entry.time.Before(f.Since)) {
+		return false
+	}
+
+	if !f.Until.IsZero() && (entry.time.IsZero() || entry.time.After(f.Until)) {
+		return false
+	}
+
+	return true
+}
+
+// Copy the log lines matching the filter, supports both the text and the json log format
+func FilterLogs(reader io.Reader, writer io.Writer, filter LogFilter) error {
+	if filter.isEmpty() {
+		_, err := io.Copy(writer, reader)
+		return err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !filter.matches(parseLogEntry(line)) {
+			continue
+		}
+
+		if _, err := io.WriteString(writer, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseLogEntry(line string) (entry logEntry) {
+	attributes := make(map[string]string)
+
+	if strings.HasPrefix(line, "{") {
+		var values map[string]any
+		if err := json.Unmarshal([]byte(line), &values); err != nil {
+			return entry
+		}
+
+		for _, key := range []string{slog.TimeKey, slog.LevelKey, "streamKey"} {
+			if value, ok := values[key].(string); ok {
+				attributes[key] = value
+			}
+		}
+	} else {
+		attributes = parseTextAttributes(line)
+	}
+
+	if value, ok := attributes[slog.TimeKey]; ok {
+		entry.time, _ = time.Parse(time.RFC3339Nano, value)
+	}
+
+	if value, ok := attributes[slog.LevelKey]; ok {
+		entry.hasLevel = entry.level.UnmarshalText([]byte(value)) == nil
+	}
+
+	entry.streamKey = attributes["streamKey"]
+	return entry
+}
+
+// Returns the key=value pairs of a line written by the text handler
+func parseTextAttributes(line string) map[string]string {
+	attributes := make(map[string]string)
+
+	for line != "" {
+		line = strings.TrimLeft(line, " ")
+
+		separator := strings.IndexAny(line, "= ")
+		if separator <= 0 || line[separator] != '=' {
+			break
+		}
+
+		key := line[:separator]
+		line = line[separator+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				break
+			}
+
+			value, _ = strconv.Unquote(quoted)
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+
+			value = line[:end]
+			line = line[end:]
+		}
+
+		attributes[key] = value
+	}
+
+	return attributes
+}
@@ -0,0 +1,87 @@
+package environment
+
+import (
+	"bytes"
+	"log/slog"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterLogs(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			entries := 0
+			options := &slog.HandlerOptions{
+				Level: slog.LevelDebug,
+				ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+					// Entries are one minute apart
+					if attr.Key == slog.TimeKey {
+						attr.Value = slog.TimeValue(start.Add(time.Duration(entries) * time.Minute))
+						entries++
+					}
+					return attr
+				},
+			}
+
+			var handler slog.Handler = slog.NewTextHandler(buffer, options)
+			if format == "json" {
+				handler = slog.NewJSONHandler(buffer, options)
+			}
+
+			logger := slog.New(handler)
+			logger.Debug("Debug", "streamKey", "first stream")
+			logger.Warn("Warning", "streamKey", "second")
+			logger.Error("Error", "streamKey", "first stream")
+			buffer.WriteString("\nunstructured line\n")
+
+			filter := func(query string) []string {
+				values, err := url.ParseQuery(query)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				logFilter, err := ParseLogFilter(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				output := &bytes.Buffer{}
+				if err := FilterLogs(bytes.NewReader(buffer.Bytes()), output, logFilter); err != nil {
+					t.Fatal(err)
+				}
+
+				var messages []string
+				for _, line := range strings.Split(output.String(), "\n") {
+					for _, message := range []string{"Debug", "Warning", "Error"} {
+						if strings.Contains(line, message) {
+							messages = append(messages, message)
+						}
+					}
+				}
+
+				return messages
+			}
+
+			tests := []struct {
+				query    string
+				expected []string
+			}{
+				{"level=warn", []string{"Warning", "Error"}},
+				{"streamKey=first+stream", []string{"Debug", "Error"}},
+				{"since=2025-01-01T12:01:00Z&until=2025-01-01T12:01:30Z", []string{"Warning"}},
+				{"level=error&streamKey=second", nil},
+			}
+
+			for _, test := range tests {
+				if messages := filter(test.query); strings.Join(messages, ",") != strings.Join(test.expected, ",") {
+					t.Errorf("%s: got %v, expected %v", test.query, messages, test.expected)
+				}
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,9 +16,42 @@ import (
 var (
 	currentDate string
 	logMutex    sync.Mutex
+	logOutput   = &logWriter{writer: os.Stdout}
 )
 
+// Writer of the default logger, replaced when the log file is rotated
+type logWriter struct {
+	lock   sync.Mutex
+	writer io.Writer
+	file   *os.File
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.writer.Write(p)
+}
+
+// Write to stdout and the file, closing the previous file
+func (w *logWriter) setFile(file *os.File) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "Logger.Close Error:", err)
+		}
+	}
+
+	w.file = file
+	w.writer = io.MultiWriter(os.Stdout, file)
+}
+
+// Configure the default logger using LOG_LEVEL and LOG_FORMAT, and write to a log file unless disabled
 func SetupLogger() {
+	slog.SetDefault(slog.New(newLogHandler(logOutput)))
+
 	if strings.EqualFold(os.Getenv(loggingEnabled), "false") {
 		return
 	}
@@ -26,15 +59,38 @@ func SetupLogger() {
 	startLogRotation()
 }
 
+func newLogHandler(writer io.Writer) slog.Handler {
+	options := &slog.HandlerOptions{Level: GetLogLevel()}
+
+	if strings.EqualFold(os.Getenv(logFormat), "json") {
+		return slog.NewJSONHandler(writer, options)
+	}
+
+	return slog.NewTextHandler(writer, options)
+}
+
+// Returns the minimum level that is logged, defaults to info
+func GetLogLevel() slog.Level {
+	level := slog.LevelInfo
+
+	if value := os.Getenv(logLevel); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			slog.Warn("Logger: Invalid LOG_LEVEL, using info", "value", value)
+			return slog.LevelInfo
+		}
+	}
+
+	return level
+}
+
 func setupLoggerForDate(date string) {
 	logFile, err := getLogFileWriter()
 	if err != nil {
-		log.Printf("Failed to open log file: %v", err)
+		slog.Error("Logger: Failed to open log file", "error", err)
 		return
 	}
 
-	multiWriter := io.MultiWriter(os.Stdout, logFile)
-	log.SetOutput(multiWriter)
+	logOutput.setFile(logFile)
 	currentDate = date
 }
 
@@ -56,22 +112,17 @@ func GetLogFileReader() (logFile *os.File, err error) {
 	logDir, _, _ := getLogfilePath()
 	logFilePath, err := getLatestLogFile(logDir)
 	if err != nil {
-		log.Println("Logger Error:", err)
-	}
-
-	file, err := os.Open(logFilePath)
-	if err != nil {
-		log.Println("Logger Error:", err)
+		return nil, err
 	}
 
-	return file, err
+	return os.Open(logFilePath)
 }
 
 func getLogFileWriter() (logFile *os.File, err error) {
 	logDir, _, logFilePath := getLogfilePath()
 
 	if err := os.MkdirAll(logDir, os.ModePerm); err != nil {
-		log.Fatalf("Failed to create log directory: %v", err)
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
 	if envLogTruncateExistingFile := strings.EqualFold(os.Getenv(loggingNewFileOnStartup), "true"); envLogTruncateExistingFile {
@@ -81,9 +132,7 @@ func getLogFileWriter() (logFile *os.File, err error) {
 	}
 
 	if err != nil {
-		log.Println("Logger Error: FilePath", logFilePath)
-		log.Fatalf("Logger Error: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to open %s: %w", logFilePath, err)
 	}
 
 	return logFile, nil
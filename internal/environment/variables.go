@@ -20,6 +20,25 @@ const (
 	StreamProfilePath   = "STREAM_PROFILE_PATH"
 	StreamProfilePolicy = "STREAM_PROFILE_POLICY"
 	WebhookURL          = "WEBHOOK_URL"
+	ViewerTokenSecret   = "VIEWER_TOKEN_SECRET"
+
+	// JWT AUTHORIZATION
+	JWTJWKSPath       = "JWT_JWKS_PATH"
+	JWTJWKS           = "JWT_JWKS"
+	JWTIssuer         = "JWT_ISSUER"
+	JWTAudience       = "JWT_AUDIENCE"
+	JWTStreamKeyClaim = "JWT_STREAM_KEY_CLAIM"
+	JWTMOTDClaim      = "JWT_MOTD_CLAIM"
+	JWTPublicClaim    = "JWT_PUBLIC_CLAIM"
+	JWTActionsClaim   = "JWT_ACTIONS_CLAIM"
+
+	// EVENT WEBHOOK
+	EventWebhookURL         = "EVENT_WEBHOOK_URL"
+	EventWebhookSecret      = "EVENT_WEBHOOK_SECRET"
+	EventWebhookEvents      = "EVENT_WEBHOOK_EVENTS"
+	EventWebhookOutboxPath  = "EVENT_WEBHOOK_OUTBOX_PATH"
+	EventWebhookMaxAttempts = "EVENT_WEBHOOK_MAX_ATTEMPTS"
+	KeyframeStallTimeout    = "KEYFRAME_STALL_TIMEOUT"
 
 	// FRONTEND
 	FrontendDisabled   = "DISABLE_FRONTEND"
@@ -43,6 +62,41 @@ const (
 
 	// PEERCONNECTION
 	AppendCandidate = "APPEND_CANDIDATE"
+	TrickleICE      = "TRICKLE_ICE"
+
+	// INTERCEPTORS
+	BandwidthEstimator               = "BANDWIDTH_ESTIMATOR"
+	BandwidthEstimatorPacing         = "BANDWIDTH_ESTIMATOR_PACING"
+	BandwidthEstimatorInitialBitrate = "BANDWIDTH_ESTIMATOR_INITIAL_BITRATE"
+	BandwidthEstimatorMinBitrate     = "BANDWIDTH_ESTIMATOR_MIN_BITRATE"
+	BandwidthEstimatorMaxBitrate     = "BANDWIDTH_ESTIMATOR_MAX_BITRATE"
+	TWCCEnabled                      = "TWCC_ENABLED"
+	TWCCInterval                     = "TWCC_INTERVAL"
+	NACKGeneratorSize                = "NACK_GENERATOR_SIZE"
+	NACKResponderSize                = "NACK_RESPONDER_SIZE"
+	RTCPReportInterval               = "RTCP_REPORT_INTERVAL"
+
+	// INGEST
+	BackupIngestEnabled  = "BACKUP_INGEST_ENABLED"
+	BackupIngestTimeout  = "BACKUP_INGEST_TIMEOUT"
+	ReconnectGracePeriod = "RECONNECT_GRACE_PERIOD"
+
+	// RTMP
+	RTMPAddress = "RTMP_ADDRESS"
+
+	// RECORDING
+	RecordingPath    = "RECORDING_PATH"
+	RecordAllStreams = "RECORD_ALL_STREAMS"
+
+	// HLS
+	HLSEnabled         = "HLS_ENABLED"
+	HLSSegmentDuration = "HLS_SEGMENT_DURATION"
+	HLSPartDuration    = "HLS_PART_DURATION"
+	HLSSegmentCount    = "HLS_SEGMENT_COUNT"
+
+	// METRICS
+	MetricsEnabled = "METRICS_ENABLED"
+	MetricsToken   = "METRICS_TOKEN"
 
 	// DEBUGGING
 	DebugIncomingAPIRequest = "DEBUG_INCOMING_API_REQUEST"
@@ -51,6 +105,8 @@ const (
 	DebugPrintSSEMessages   = "DEBUG_PRINT_SSE_MESSAGES"
 
 	// LOGGING
+	logLevel                = "LOG_LEVEL"
+	logFormat               = "LOG_FORMAT"
 	loggingEnabled          = "LOGGING_ENABLED"
 	loggingDirectory        = "LOGGING_DIRECTORY"
 	loggingSingleFile       = "LOGGING_SINGLEFILE"
@@ -0,0 +1,353 @@
+package hls
+
+import (
+	"encoding/binary"
+)
+
+const (
+	videoTrackID = 1
+	audioTrackID = 2
+
+	videoTimescale = 90000
+	audioTimescale = 48000
+
+	opusPreSkip = 312
+
+	// Sample flags as described in ISO/IEC 14496-12 8.8.3.1
+	sampleFlagsKeyframe    = 0x02000000
+	sampleFlagsNonKeyframe = 0x01010000
+)
+
+type sample struct {
+	data       []byte
+	duration   uint32
+	decodeTime uint64
+	isKeyframe bool
+}
+
+// Writes ISO BMFF boxes into a single buffer
+type boxWriter struct {
+	buffer []byte
+}
+
+// Starts a new box, returns the offset used to finish the box
+func (b *boxWriter) start(boxType string) int {
+	offset := len(b.buffer)
+	b.buffer = append(b.buffer, 0, 0, 0, 0)
+	b.buffer = append(b.buffer, boxType...)
+	return offset
+}
+
+// Starts a new full box with version and flags
+func (b *boxWriter) startFull(boxType string, version uint8, flags uint32) int {
+	offset := b.start(boxType)
+	b.u32(uint32(version)<<24 | flags&0x00ffffff)
+	return offset
+}
+
+// Writes the size of the box started at the provided offset
+func (b *boxWriter) end(offset int) {
+	binary.BigEndian.PutUint32(b.buffer[offset:], uint32(len(b.buffer)-offset))
+}
+
+func (b *boxWriter) u8(value uint8) {
+	b.buffer = append(b.buffer, value)
+}
+
+func (b *boxWriter) u16(value uint16) {
+	b.buffer = binary.BigEndian.AppendUint16(b.buffer, value)
+}
+
+func (b *boxWriter) u32(value uint32) {
+	b.buffer = binary.BigEndian.AppendUint32(b.buffer, value)
+}
+
+func (b *boxWriter) u64(value uint64) {
+	b.buffer = binary.BigEndian.AppendUint64(b.buffer, value)
+}
+
+func (b *boxWriter) bytes(value []byte) {
+	b.buffer = append(b.buffer, value...)
+}
+
+func (b *boxWriter) zeros(count int) {
+	b.buffer = append(b.buffer, make([]byte, count)...)
+}
+
+// Unity transformation matrix used by mvhd and tkhd
+func (b *boxWriter) matrix() {
+	for _, value := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		b.u32(value)
+	}
+}
+
+// Creates the initialization segment for the provided tracks.
+// A nil video or audio configuration leaves out the track.
+func createInitSegment(video *videoConfig, hasAudio bool) []byte {
+	b := &boxWriter{}
+
+	ftyp := b.start("ftyp")
+	b.bytes([]byte("iso5"))
+	b.u32(512)
+	b.bytes([]byte("iso5iso6mp41"))
+	b.end(ftyp)
+
+	moov := b.start("moov")
+
+	mvhd := b.startFull("mvhd", 0, 0)
+	b.u32(0)    // creation time
+	b.u32(0)    // modification time
+	b.u32(1000) // timescale
+	b.u32(0)    // duration
+	b.u32(0x00010000)
+	b.u16(0x0100)
+	b.zeros(10)
+	b.matrix()
+	b.zeros(24)
+	b.u32(audioTrackID + 1) // next track id
+	b.end(mvhd)
+
+	if video != nil {
+		writeVideoTrack(b, video)
+	}
+
+	if hasAudio {
+		writeAudioTrack(b)
+	}
+
+	mvex := b.start("mvex")
+	if video != nil {
+		writeTrex(b, videoTrackID)
+	}
+	if hasAudio {
+		writeTrex(b, audioTrackID)
+	}
+	b.end(mvex)
+
+	b.end(moov)
+
+	return b.buffer
+}
+
+func writeTrex(b *boxWriter, trackID uint32) {
+	trex := b.startFull("trex", 0, 0)
+	b.u32(trackID)
+	b.u32(1) // default sample description index
+	b.u32(0)
+	b.u32(0)
+	b.u32(0)
+	b.end(trex)
+}
+
+func writeTrackHeader(b *boxWriter, trackID uint32, volume uint16, width uint16, height uint16) {
+	tkhd := b.startFull("tkhd", 0, 0x000003)
+	b.u32(0) // creation time
+	b.u32(0) // modification time
+	b.u32(trackID)
+	b.u32(0) // reserved
+	b.u32(0) // duration
+	b.zeros(8)
+	b.u16(0) // layer
+	b.u16(0) // alternate group
+	b.u16(volume)
+	b.u16(0)
+	b.matrix()
+	b.u32(uint32(width) << 16)
+	b.u32(uint32(height) << 16)
+	b.end(tkhd)
+}
+
+func writeMediaHeader(b *boxWriter, timescale uint32, handlerType string, handlerName string) {
+	mdhd := b.startFull("mdhd", 0, 0)
+	b.u32(0) // creation time
+	b.u32(0) // modification time
+	b.u32(timescale)
+	b.u32(0)      // duration
+	b.u16(0x55c4) // language 'und'
+	b.u16(0)
+	b.end(mdhd)
+
+	hdlr := b.startFull("hdlr", 0, 0)
+	b.u32(0)
+	b.bytes([]byte(handlerType))
+	b.zeros(12)
+	b.bytes([]byte(handlerName))
+	b.u8(0)
+	b.end(hdlr)
+}
+
+func writeDataInformation(b *boxWriter) {
+	dinf := b.start("dinf")
+	dref := b.startFull("dref", 0, 0)
+	b.u32(1)
+	url := b.startFull("url ", 0, 1)
+	b.end(url)
+	b.end(dref)
+	b.end(dinf)
+}
+
+// Writes the empty sample tables, samples are described in the fragments
+func writeEmptySampleTables(b *boxWriter) {
+	for _, boxType := range []string{"stts", "stsc", "stco"} {
+		box := b.startFull(boxType, 0, 0)
+		b.u32(0)
+		b.end(box)
+	}
+
+	stsz := b.startFull("stsz", 0, 0)
+	b.u32(0)
+	b.u32(0)
+	b.end(stsz)
+}
+
+func writeVideoTrack(b *boxWriter, video *videoConfig) {
+	trak := b.start("trak")
+	writeTrackHeader(b, videoTrackID, 0, video.width, video.height)
+
+	mdia := b.start("mdia")
+	writeMediaHeader(b, videoTimescale, "vide", "Video")
+
+	minf := b.start("minf")
+	vmhd := b.startFull("vmhd", 0, 1)
+	b.zeros(8)
+	b.end(vmhd)
+	writeDataInformation(b)
+
+	stbl := b.start("stbl")
+	stsd := b.startFull("stsd", 0, 0)
+	b.u32(1)
+
+	avc1 := b.start("avc1")
+	b.zeros(6)
+	b.u16(1) // data reference index
+	b.zeros(16)
+	b.u16(video.width)
+	b.u16(video.height)
+	b.u32(0x00480000) // horizontal resolution
+	b.u32(0x00480000) // vertical resolution
+	b.u32(0)
+	b.u16(1) // frame count
+	b.zeros(32)
+	b.u16(0x0018) // depth
+	b.u16(0xffff)
+
+	avcC := b.start("avcC")
+	b.u8(1)
+	b.u8(video.sps[1]) // profile
+	b.u8(video.sps[2]) // profile compatibility
+	b.u8(video.sps[3]) // level
+	b.u8(0xff)         // 4 byte NALU lengths
+	b.u8(0xe1)         // 1 SPS
+	b.u16(uint16(len(video.sps)))
+	b.bytes(video.sps)
+	b.u8(1) // 1 PPS
+	b.u16(uint16(len(video.pps)))
+	b.bytes(video.pps)
+	b.end(avcC)
+
+	b.end(avc1)
+	b.end(stsd)
+	writeEmptySampleTables(b)
+	b.end(stbl)
+
+	b.end(minf)
+	b.end(mdia)
+	b.end(trak)
+}
+
+func writeAudioTrack(b *boxWriter) {
+	trak := b.start("trak")
+	writeTrackHeader(b, audioTrackID, 0x0100, 0, 0)
+
+	mdia := b.start("mdia")
+	writeMediaHeader(b, audioTimescale, "soun", "Audio")
+
+	minf := b.start("minf")
+	smhd := b.startFull("smhd", 0, 0)
+	b.u32(0)
+	b.end(smhd)
+	writeDataInformation(b)
+
+	stbl := b.start("stbl")
+	stsd := b.startFull("stsd", 0, 0)
+	b.u32(1)
+
+	opus := b.start("Opus")
+	b.zeros(6)
+	b.u16(1) // data reference index
+	b.zeros(8)
+	b.u16(2)  // channel count
+	b.u16(16) // sample size
+	b.u32(0)
+	b.u32(audioTimescale << 16)
+
+	dOps := b.start("dOps")
+	b.u8(0) // version
+	b.u8(2) // output channel count
+	b.u16(opusPreSkip)
+	b.u32(audioTimescale)
+	b.u16(0) // output gain
+	b.u8(0)  // channel mapping family
+	b.end(dOps)
+
+	b.end(opus)
+	b.end(stsd)
+	writeEmptySampleTables(b)
+	b.end(stbl)
+
+	b.end(minf)
+	b.end(mdia)
+	b.end(trak)
+}
+
+// Creates a moof and mdat box pair holding the provided samples of a single track
+func createFragment(sequenceNumber uint32, trackID uint32, samples []sample) []byte {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	b := &boxWriter{}
+
+	moof := b.start("moof")
+	mfhd := b.startFull("mfhd", 0, 0)
+	b.u32(sequenceNumber)
+	b.end(mfhd)
+
+	traf := b.start("traf")
+	tfhd := b.startFull("tfhd", 0, 0x020000) // default-base-is-moof
+	b.u32(trackID)
+	b.end(tfhd)
+
+	tfdt := b.startFull("tfdt", 1, 0)
+	b.u64(samples[0].decodeTime)
+	b.end(tfdt)
+
+	// data-offset, sample-duration, sample-size and sample-flags present
+	trun := b.startFull("trun", 0, 0x000701)
+	b.u32(uint32(len(samples)))
+	dataOffsetPosition := len(b.buffer)
+	b.u32(0)
+	for _, s := range samples {
+		b.u32(s.duration)
+		b.u32(uint32(len(s.data)))
+		if s.isKeyframe {
+			b.u32(sampleFlagsKeyframe)
+		} else {
+			b.u32(sampleFlagsNonKeyframe)
+		}
+	}
+	b.end(trun)
+
+	b.end(traf)
+	b.end(moof)
+
+	binary.BigEndian.PutUint32(b.buffer[dataOffsetPosition:], uint32(len(b.buffer)-moof+8))
+
+	mdat := b.start("mdat")
+	for _, s := range samples {
+		b.bytes(s.data)
+	}
+	b.end(mdat)
+
+	return b.buffer
+}
@@ -0,0 +1,346 @@
+package hls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	naluTypeBitmask = 0x1f
+
+	naluTypeIDR = 5
+	naluTypeSPS = 7
+	naluTypePPS = 8
+	naluTypeAUD = 9
+)
+
+var errInvalidSPS = errors.New("hls: invalid sps")
+
+type videoConfig struct {
+	sps    []byte
+	pps    []byte
+	width  uint16
+	height uint16
+}
+
+// Returns the RFC 6381 codec string of the video configuration
+func (v *videoConfig) codecString() string {
+	return fmt.Sprintf("avc1.%02x%02x%02x", v.sps[1], v.sps[2], v.sps[3])
+}
+
+// Split a buffer of 4 byte length prefixed NAL units
+func splitAVCNalus(buffer []byte) (nalus [][]byte) {
+	for len(buffer) > 4 {
+		length := int(binary.BigEndian.Uint32(buffer))
+		buffer = buffer[4:]
+		if length <= 0 || length > len(buffer) {
+			return nalus
+		}
+
+		nalus = append(nalus, buffer[:length])
+		buffer = buffer[length:]
+	}
+
+	return nalus
+}
+
+// Reads Exp-Golomb coded values from a NAL unit without emulation prevention bytes
+type bitReader struct {
+	data     []byte
+	position int
+}
+
+func (r *bitReader) readBit() (uint, error) {
+	if r.position >= len(r.data)*8 {
+		return 0, errInvalidSPS
+	}
+
+	bit := (r.data[r.position/8] >> (7 - r.position%8)) & 1
+	r.position++
+	return uint(bit), nil
+}
+
+func (r *bitReader) readBits(count int) (uint, error) {
+	value := uint(0)
+	for range count {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | bit
+	}
+
+	return value, nil
+}
+
+func (r *bitReader) readUE() (uint, error) {
+	leadingZeros := 0
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+
+		leadingZeros++
+		if leadingZeros > 31 {
+			return 0, errInvalidSPS
+		}
+	}
+
+	value, err := r.readBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return (1 << leadingZeros) - 1 + value, nil
+}
+
+func (r *bitReader) readSE() (int, error) {
+	value, err := r.readUE()
+	if err != nil {
+		return 0, err
+	}
+
+	if value%2 == 0 {
+		return -int(value / 2), nil
+	}
+
+	return int(value+1) / 2, nil
+}
+
+func removeEmulationPrevention(nalu []byte) []byte {
+	result := make([]byte, 0, len(nalu))
+	zeros := 0
+	for _, value := range nalu {
+		if zeros >= 2 && value == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if value == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+
+		result = append(result, value)
+	}
+
+	return result
+}
+
+// Resolve the picture size from a H264 SPS NAL unit as described in ITU-T H.264 7.3.2.1.1
+func parseSPSResolution(sps []byte) (width uint16, height uint16, err error) {
+	if len(sps) < 4 {
+		return 0, 0, errInvalidSPS
+	}
+
+	r := &bitReader{data: removeEmulationPrevention(sps[1:])}
+	profileIdc, err := r.readBits(8)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Constraint flags and level
+	if _, err = r.readBits(16); err != nil {
+		return 0, 0, err
+	}
+
+	// seq_parameter_set_id
+	if _, err = r.readUE(); err != nil {
+		return 0, 0, err
+	}
+
+	chromaFormatIdc := uint(1)
+	separateColourPlane := uint(0)
+
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if chromaFormatIdc, err = r.readUE(); err != nil {
+			return 0, 0, err
+		}
+
+		if chromaFormatIdc == 3 {
+			if separateColourPlane, err = r.readBit(); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		// bit_depth_luma_minus8, bit_depth_chroma_minus8
+		for range 2 {
+			if _, err = r.readUE(); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		// qpprime_y_zero_transform_bypass_flag
+		if _, err = r.readBit(); err != nil {
+			return 0, 0, err
+		}
+
+		scalingMatrixPresent, err := r.readBit()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if scalingMatrixPresent == 1 {
+			listCount := 8
+			if chromaFormatIdc == 3 {
+				listCount = 12
+			}
+
+			for i := range listCount {
+				present, err := r.readBit()
+				if err != nil {
+					return 0, 0, err
+				}
+				if present == 0 {
+					continue
+				}
+
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				if err := skipScalingList(r, size); err != nil {
+					return 0, 0, err
+				}
+			}
+		}
+	}
+
+	// log2_max_frame_num_minus4
+	if _, err = r.readUE(); err != nil {
+		return 0, 0, err
+	}
+
+	picOrderCntType, err := r.readUE()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch picOrderCntType {
+	case 0:
+		if _, err = r.readUE(); err != nil {
+			return 0, 0, err
+		}
+	case 1:
+		if _, err = r.readBit(); err != nil {
+			return 0, 0, err
+		}
+		for range 2 {
+			if _, err = r.readSE(); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		cycleLength, err := r.readUE()
+		if err != nil {
+			return 0, 0, err
+		}
+		for range cycleLength {
+			if _, err = r.readSE(); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	// max_num_ref_frames
+	if _, err = r.readUE(); err != nil {
+		return 0, 0, err
+	}
+
+	// gaps_in_frame_num_value_allowed_flag
+	if _, err = r.readBit(); err != nil {
+		return 0, 0, err
+	}
+
+	widthInMbs, err := r.readUE()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	heightInMapUnits, err := r.readUE()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	frameMbsOnly, err := r.readBit()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if frameMbsOnly == 0 {
+		// mb_adaptive_frame_field_flag
+		if _, err = r.readBit(); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// direct_8x8_inference_flag
+	if _, err = r.readBit(); err != nil {
+		return 0, 0, err
+	}
+
+	frameCropping, err := r.readBit()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cropLeft, cropRight, cropTop, cropBottom := uint(0), uint(0), uint(0), uint(0)
+	if frameCropping == 1 {
+		for _, value := range []*uint{&cropLeft, &cropRight, &cropTop, &cropBottom} {
+			if *value, err = r.readUE(); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	cropUnitX, cropUnitY := uint(1), 2-frameMbsOnly
+	if separateColourPlane == 0 && chromaFormatIdc != 0 {
+		subWidth, subHeight := uint(2), uint(2)
+		switch chromaFormatIdc {
+		case 2:
+			subHeight = 1
+		case 3:
+			subWidth, subHeight = 1, 1
+		}
+
+		cropUnitX = subWidth
+		cropUnitY = subHeight * (2 - frameMbsOnly)
+	}
+
+	fullWidth := (widthInMbs + 1) * 16
+	fullHeight := (heightInMapUnits + 1) * 16 * (2 - frameMbsOnly)
+	croppedWidth := cropUnitX * (cropLeft + cropRight)
+	croppedHeight := cropUnitY * (cropTop + cropBottom)
+
+	if croppedWidth >= fullWidth || croppedHeight >= fullHeight {
+		return 0, 0, errInvalidSPS
+	}
+
+	return uint16(fullWidth - croppedWidth), uint16(fullHeight - croppedHeight), nil
+}
+
+func skipScalingList(r *bitReader, size int) error {
+	lastScale, nextScale := 8, 8
+	for range size {
+		if nextScale != 0 {
+			delta, err := r.readSE()
+			if err != nil {
+				return err
+			}
+			nextScale = (lastScale + delta + 256) % 256
+		}
+
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+
+	return nil
+}
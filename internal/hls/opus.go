@@ -0,0 +1,36 @@
+package hls
+
+// Frame sizes in 48kHz samples by TOC configuration as described in RFC 6716 3.1
+var opusFrameSizes = [32]uint32{
+	480, 960, 1920, 2880, // SILK NB
+	480, 960, 1920, 2880, // SILK MB
+	480, 960, 1920, 2880, // SILK WB
+	480, 960, // Hybrid SWB
+	480, 960, // Hybrid FB
+	120, 240, 480, 960, // CELT NB
+	120, 240, 480, 960, // CELT WB
+	120, 240, 480, 960, // CELT SWB
+	120, 240, 480, 960, // CELT FB
+}
+
+// Returns the duration of the Opus packet in 48kHz samples
+func opusPacketDuration(packet []byte) uint32 {
+	if len(packet) == 0 {
+		return 0
+	}
+
+	frameSize := opusFrameSizes[packet[0]>>3]
+
+	switch packet[0] & 0x03 {
+	case 0:
+		return frameSize
+	case 1, 2:
+		return frameSize * 2
+	default:
+		if len(packet) < 2 {
+			return 0
+		}
+
+		return frameSize * uint32(packet[1]&0x3f)
+	}
+}
@@ -0,0 +1,535 @@
+package hls
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+const (
+	defaultSegmentDuration = 2 * time.Second
+	defaultPartDuration    = 500 * time.Millisecond
+	defaultSegmentCount    = 6
+
+	// Switch to a different simulcast layer when the current one stopped sending
+	videoLayerStallTimeout = 2 * time.Second
+
+	defaultFrameDuration = videoTimescale / 30
+	maxFrameDuration     = videoTimescale * 2
+)
+
+// Returns true if HLS egress is enabled
+func IsEnabled() bool {
+	return strings.EqualFold(os.Getenv(environment.HLSEnabled), "true")
+}
+
+// Create a new packager for the provided stream key.
+// The PLI sender is used to request keyframes when a segment runs long.
+func NewPackager(streamKey string, pliSender func()) *Packager {
+	p := &Packager{
+		StreamKey: streamKey,
+		pliSender: pliSender,
+
+		segmentDuration: getDurationSetting(environment.HLSSegmentDuration, defaultSegmentDuration),
+		partDuration:    getDurationSetting(environment.HLSPartDuration, defaultPartDuration),
+		segmentCount:    defaultSegmentCount,
+
+		depacketizer: &pionCodecs.H264Packet{IsAVC: true},
+		initSegments: make(map[int][]byte),
+		updated:      make(chan struct{}),
+	}
+
+	if segmentCount, err := strconv.Atoi(os.Getenv(environment.HLSSegmentCount)); err == nil && segmentCount > 0 {
+		p.segmentCount = segmentCount
+	}
+
+	if p.partDuration > p.segmentDuration {
+		p.partDuration = p.segmentDuration
+	}
+
+	slog.Info("HLS.NewPackager", "streamKey", streamKey, "segmentDuration", p.segmentDuration, "partDuration", p.partDuration)
+	return p
+}
+
+func getDurationSetting(key string, defaultValue time.Duration) time.Duration {
+	if duration, err := time.ParseDuration(os.Getenv(key)); err == nil && duration > 0 {
+		return duration
+	}
+
+	return defaultValue
+}
+
+// Prepare the packager for media from a new host.
+// The following segment is marked as a discontinuity.
+func (p *Packager) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	slog.Debug("HLS.Packager.Reset", "streamKey", p.StreamKey)
+	p.flushPendingVideoLocked()
+	p.cutPartLocked()
+	p.cutSegmentLocked()
+
+	p.videoLayer = ""
+	p.hasVideoLayer = false
+	p.videoLayerPriority = 0
+	p.depacketizer = &pionCodecs.H264Packet{IsAVC: true}
+	p.frameNalus = nil
+	p.firstAudioPacket = time.Time{}
+	p.isAudioOnly = false
+	p.isDiscontinuity = true
+}
+
+// Stop the packager and release all waiting requests
+func (p *Packager) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	slog.Info("HLS.Packager.Close", "streamKey", p.StreamKey)
+	p.isClosed = true
+	p.notifyLocked()
+}
+
+// Add a video packet of the provided simulcast layer to the packager.
+// Only H264 is packaged, the best layer available at startup is selected.
+func (p *Packager) WriteVideo(packet codecs.TrackPacket, priority int) {
+	if packet.Codec != codecs.VideoTrackCodecH264 {
+		p.lock.Lock()
+		if !p.loggedVideoCodec {
+			slog.Warn("HLS.Packager.WriteVideo: Unsupported video codec", "streamKey", p.StreamKey, "codec", packet.Codec)
+			p.loggedVideoCodec = true
+		}
+		p.lock.Unlock()
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.isClosed || p.isAudioOnly {
+		return
+	}
+
+	now := time.Now()
+	if !p.hasVideoLayer || packet.Layer != p.videoLayer {
+		if !p.shouldSwitchVideoLayerLocked(packet, priority, now) {
+			return
+		}
+
+		slog.Info("HLS.Packager.WriteVideo: Using layer", "streamKey", p.StreamKey, "rid", packet.Layer)
+		p.switchVideoLayerLocked(packet.Layer, priority)
+	}
+	p.videoLayerLastPacket = now
+
+	rtpPacket := packet.Packet
+	if len(p.frameNalus) != 0 && rtpPacket.Timestamp != p.frameTimestamp {
+		p.finalizeFrameLocked()
+	}
+	p.frameTimestamp = rtpPacket.Timestamp
+
+	if buffer, err := p.depacketizer.Unmarshal(rtpPacket.Payload); err == nil {
+		for _, nalu := range splitAVCNalus(buffer) {
+			p.frameNalus = append(p.frameNalus, bytes.Clone(nalu))
+		}
+	}
+
+	if rtpPacket.Marker {
+		p.finalizeFrameLocked()
+	}
+}
+
+// Add an audio packet to the packager, only Opus is packaged
+func (p *Packager) WriteAudio(packet codecs.TrackPacket) {
+	if packet.Codec != codecs.AudioTrackCodecOpus {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.isClosed {
+		return
+	}
+
+	now := time.Now()
+	p.hasAudio = true
+	if p.firstAudioPacket.IsZero() {
+		p.firstAudioPacket = now
+	}
+
+	// No video arrived, package the stream as audio only
+	if !p.hasVideoLayer && !p.isAudioOnly && now.Sub(p.firstAudioPacket) >= p.segmentDuration {
+		slog.Info("HLS.Packager.WriteAudio: No video found, packaging audio only", "streamKey", p.StreamKey)
+		p.isAudioOnly = true
+		p.cutPartLocked()
+		p.cutSegmentLocked()
+	}
+
+	duration := opusPacketDuration(packet.Packet.Payload)
+	if duration == 0 {
+		return
+	}
+
+	if p.isAudioOnly {
+		partDuration := p.pendingPartDurationLocked()
+		sampleDuration := time.Duration(duration) * time.Second / audioTimescale
+
+		switch {
+		case p.currentSegment == nil:
+			p.startSegmentLocked()
+		case p.pendingSegmentDurationLocked()+sampleDuration > p.segmentDuration:
+			p.cutPartLocked()
+			p.cutSegmentLocked()
+			p.startSegmentLocked()
+		case partDuration+sampleDuration > p.partDuration:
+			p.cutPartLocked()
+		}
+	}
+
+	if p.currentSegment == nil || !p.currentSegment.hasAudio {
+		return
+	}
+
+	p.audioSamples = append(p.audioSamples, sample{
+		data:       bytes.Clone(packet.Packet.Payload),
+		duration:   duration,
+		decodeTime: p.audioDecodeTime,
+		isKeyframe: true,
+	})
+	p.audioDecodeTime += uint64(duration)
+}
+
+func (p *Packager) shouldSwitchVideoLayerLocked(packet codecs.TrackPacket, priority int, now time.Time) bool {
+	switch {
+	case !p.hasVideoLayer:
+		return true
+	case !packet.IsKeyframe:
+		return false
+	case p.currentSegment == nil && len(p.segments) == 0 && priority < p.videoLayerPriority:
+		return true
+	case now.Sub(p.videoLayerLastPacket) > videoLayerStallTimeout:
+		return true
+	}
+
+	return false
+}
+
+func (p *Packager) switchVideoLayerLocked(layer string, priority int) {
+	if p.hasVideoLayer {
+		p.flushPendingVideoLocked()
+		p.cutPartLocked()
+		p.cutSegmentLocked()
+		p.isDiscontinuity = true
+	}
+
+	p.videoLayer = layer
+	p.hasVideoLayer = true
+	p.videoLayerPriority = priority
+	p.depacketizer = &pionCodecs.H264Packet{IsAVC: true}
+	p.frameNalus = nil
+	p.pendingVideo = nil
+}
+
+// Turn the collected NAL units into a sample.
+// Samples are held back until the next frame arrives to resolve their duration.
+func (p *Packager) finalizeFrameLocked() {
+	nalus := p.frameNalus
+	p.frameNalus = nil
+
+	var (
+		sps, pps   []byte
+		data       []byte
+		isKeyframe bool
+	)
+
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+
+		switch nalu[0] & naluTypeBitmask {
+		case naluTypeSPS:
+			sps = nalu
+			continue
+		case naluTypePPS:
+			pps = nalu
+			continue
+		case naluTypeAUD:
+			continue
+		case naluTypeIDR:
+			isKeyframe = true
+		}
+
+		data = binary.BigEndian.AppendUint32(data, uint32(len(nalu)))
+		data = append(data, nalu...)
+	}
+
+	if p.pendingVideo != nil {
+		p.pendingVideo.duration = clampFrameDuration(p.frameTimestamp - p.pendingVideo.rtpTimestamp)
+		p.appendVideoSampleLocked(p.pendingVideo.sample)
+		p.pendingVideo = nil
+	}
+
+	if sps != nil && pps != nil {
+		p.updateVideoConfigLocked(sps, pps)
+	}
+
+	if len(data) == 0 || p.videoConfig == nil {
+		return
+	}
+
+	p.pendingVideo = &pendingSample{
+		sample: sample{
+			data:       data,
+			isKeyframe: isKeyframe,
+		},
+		rtpTimestamp: p.frameTimestamp,
+	}
+}
+
+func clampFrameDuration(duration uint32) uint32 {
+	if duration == 0 || duration > maxFrameDuration {
+		return defaultFrameDuration
+	}
+
+	return duration
+}
+
+func (p *Packager) flushPendingVideoLocked() {
+	if p.pendingVideo == nil {
+		return
+	}
+
+	p.pendingVideo.duration = defaultFrameDuration
+	p.appendVideoSampleLocked(p.pendingVideo.sample)
+	p.pendingVideo = nil
+}
+
+func (p *Packager) updateVideoConfigLocked(sps []byte, pps []byte) {
+	if p.videoConfig != nil && bytes.Equal(sps, p.videoConfig.sps) && bytes.Equal(pps, p.videoConfig.pps) {
+		return
+	}
+
+	width, height, err := parseSPSResolution(sps)
+	if err != nil {
+		slog.Warn("HLS.Packager.UpdateVideoConfig.Error", "streamKey", p.StreamKey, "error", err)
+		return
+	}
+
+	slog.Debug("HLS.Packager.UpdateVideoConfig", "streamKey", p.StreamKey, "width", width, "height", height)
+	p.videoConfig = &videoConfig{
+		sps:    sps,
+		pps:    pps,
+		width:  width,
+		height: height,
+	}
+
+	// A new initialization segment is required, start over at the next keyframe
+	p.cutPartLocked()
+	p.cutSegmentLocked()
+}
+
+func (p *Packager) appendVideoSampleLocked(s sample) {
+	partDuration := p.pendingPartDurationLocked()
+	sampleDuration := time.Duration(s.duration) * time.Second / videoTimescale
+
+	switch {
+	case p.currentSegment == nil:
+		if !s.isKeyframe {
+			p.requestKeyframeLocked()
+			return
+		}
+		p.startSegmentLocked()
+
+	case s.isKeyframe && p.pendingSegmentDurationLocked() >= p.segmentDuration:
+		p.cutPartLocked()
+		p.cutSegmentLocked()
+		p.startSegmentLocked()
+
+	case partDuration > 0 && partDuration+sampleDuration > p.partDuration:
+		p.cutPartLocked()
+	}
+
+	if !s.isKeyframe && p.pendingSegmentDurationLocked() >= p.segmentDuration {
+		p.requestKeyframeLocked()
+	}
+
+	s.decodeTime = p.videoDecodeTime
+	p.videoDecodeTime += uint64(s.duration)
+	p.videoSamples = append(p.videoSamples, s)
+}
+
+func (p *Packager) requestKeyframeLocked() {
+	if p.pliSender == nil || time.Since(p.lastPLI) < p.partDuration {
+		return
+	}
+
+	p.lastPLI = time.Now()
+	go p.pliSender()
+}
+
+// Returns the duration of the samples not yet written to a part
+func (p *Packager) pendingPartDurationLocked() time.Duration {
+	return p.ticksToDurationLocked(p.pendingPartTicksLocked())
+}
+
+// Returns the duration of the current segment including the samples not yet written to a part.
+// Durations are summed in timescale units to not accumulate rounding errors.
+func (p *Packager) pendingSegmentDurationLocked() time.Duration {
+	if p.currentSegment == nil {
+		return 0
+	}
+
+	return p.ticksToDurationLocked(p.currentSegment.ticks + p.pendingPartTicksLocked())
+}
+
+func (p *Packager) pendingPartTicksLocked() (total uint64) {
+	samples := p.videoSamples
+	if p.isAudioOnly {
+		samples = p.audioSamples
+	}
+
+	for _, s := range samples {
+		total += uint64(s.duration)
+	}
+
+	return total
+}
+
+func (p *Packager) ticksToDurationLocked(ticks uint64) time.Duration {
+	if p.isAudioOnly {
+		return time.Duration(ticks) * time.Second / audioTimescale
+	}
+
+	return time.Duration(ticks) * time.Second / videoTimescale
+}
+
+func (p *Packager) startSegmentLocked() {
+	var video *videoConfig
+	if !p.isAudioOnly {
+		video = p.videoConfig
+	}
+
+	initSegment := createInitSegment(video, p.hasAudio)
+	if !bytes.Equal(initSegment, p.initSegments[p.initVersion]) {
+		if p.initSegments[p.initVersion] != nil {
+			p.isDiscontinuity = true
+		}
+
+		p.initVersion++
+		p.initSegments[p.initVersion] = initSegment
+	}
+
+	isFirstSegment := len(p.segments) == 0
+	p.currentSegment = &segment{
+		sequence:        p.nextSequence,
+		initVersion:     p.initVersion,
+		isDiscontinuity: p.isDiscontinuity && !isFirstSegment,
+		hasAudio:        p.hasAudio,
+	}
+	p.nextSequence++
+
+	// Align the audio timeline with the video timeline when starting over
+	if (isFirstSegment || p.isDiscontinuity) && !p.isAudioOnly {
+		p.audioDecodeTime = p.videoDecodeTime * audioTimescale / videoTimescale
+	}
+	p.isDiscontinuity = false
+	p.audioSamples = nil
+
+	p.notifyLocked()
+}
+
+// Write the collected samples as a part of the current segment
+func (p *Packager) cutPartLocked() {
+	if p.currentSegment == nil || (len(p.videoSamples) == 0 && len(p.audioSamples) == 0) {
+		return
+	}
+
+	ticks := p.pendingPartTicksLocked()
+	isIndependent := p.isAudioOnly || (len(p.videoSamples) != 0 && p.videoSamples[0].isKeyframe)
+
+	var data []byte
+	if len(p.videoSamples) != 0 {
+		p.fragmentSequence++
+		data = append(data, createFragment(p.fragmentSequence, videoTrackID, p.videoSamples)...)
+	}
+
+	if len(p.audioSamples) != 0 {
+		p.fragmentSequence++
+		data = append(data, createFragment(p.fragmentSequence, audioTrackID, p.audioSamples)...)
+	}
+
+	p.videoSamples = nil
+	p.audioSamples = nil
+
+	p.currentSegment.parts = append(p.currentSegment.parts, &part{
+		data:          data,
+		duration:      p.ticksToDurationLocked(ticks),
+		isIndependent: isIndependent,
+	})
+	p.currentSegment.ticks += ticks
+	p.currentSegment.duration = p.ticksToDurationLocked(p.currentSegment.ticks)
+	p.currentSegment.byteCount += len(data)
+
+	p.notifyLocked()
+}
+
+// Complete the current segment and remove segments outside of the playlist window
+func (p *Packager) cutSegmentLocked() {
+	currentSegment := p.currentSegment
+	if currentSegment == nil {
+		return
+	}
+
+	p.currentSegment = nil
+	p.videoSamples = nil
+	p.audioSamples = nil
+
+	if len(currentSegment.parts) == 0 {
+		p.nextSequence = currentSegment.sequence
+		return
+	}
+
+	p.segments = append(p.segments, currentSegment)
+	for len(p.segments) > p.segmentCount {
+		if p.segments[0].isDiscontinuity {
+			p.discontinuities++
+		}
+		p.segments = p.segments[1:]
+	}
+
+	// Remove initialization segments no longer referenced
+	for version := range p.initSegments {
+		if version == p.initVersion {
+			continue
+		}
+
+		isReferenced := false
+		for _, s := range p.segments {
+			if s.initVersion == version {
+				isReferenced = true
+				break
+			}
+		}
+
+		if !isReferenced {
+			delete(p.initSegments, version)
+		}
+	}
+
+	p.notifyLocked()
+}
+
+// Wake up all requests waiting for new media
+func (p *Packager) notifyLocked() {
+	close(p.updated)
+	p.updated = make(chan struct{})
+}
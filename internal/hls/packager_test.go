@@ -0,0 +1,168 @@
+package hls
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+)
+
+var (
+	// Baseline 1280x720
+	testSPS720 = []byte{0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xe4}
+
+	// Baseline 1920x1088 cropped to 1920x1080
+	testSPS1080 = []byte{0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0xe0, 0x08, 0x9f, 0x95}
+
+	testPPS = []byte{0x68, 0xce, 0x38, 0x80}
+)
+
+func Test_parseSPSResolution(t *testing.T) {
+	tests := []struct {
+		name       string
+		sps        []byte
+		wantWidth  uint16
+		wantHeight uint16
+		wantErr    bool
+	}{
+		{
+			name:       "720p",
+			sps:        testSPS720,
+			wantWidth:  1280,
+			wantHeight: 720,
+		},
+		{
+			name:       "1080p with cropping",
+			sps:        testSPS1080,
+			wantWidth:  1920,
+			wantHeight: 1080,
+		},
+		{
+			name:    "Truncated",
+			sps:     testSPS720[:5],
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, err := parseSPSResolution(tt.sps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSPSResolution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && (width != tt.wantWidth || height != tt.wantHeight) {
+				t.Errorf("parseSPSResolution() = %dx%d, want %dx%d", width, height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+func Test_opusPacketDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   uint32
+	}{
+		{name: "CELT FB 20ms", packet: []byte{0xf8}, want: 960},
+		{name: "SILK WB 60ms", packet: []byte{0x58}, want: 2880},
+		{name: "Two frames of 10ms", packet: []byte{0xf1}, want: 960},
+		{name: "Arbitrary frame count", packet: []byte{0xfb, 0x03}, want: 2880},
+		{name: "Empty", packet: []byte{}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opusPacketDuration(tt.packet); got != tt.want {
+				t.Errorf("opusPacketDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackager_Playlists(t *testing.T) {
+	p := &Packager{
+		StreamKey:       "test",
+		segmentDuration: time.Second,
+		partDuration:    250 * time.Millisecond,
+		segmentCount:    3,
+		initSegments:    make(map[int][]byte),
+		updated:         make(chan struct{}),
+	}
+	p.Reset()
+
+	// Three seconds of 30 fps video with a keyframe every second
+	for frame := range 90 {
+		timestamp := uint32(frame * 3000)
+
+		if frame%30 == 0 {
+			p.WriteVideo(testVideoPacket(timestamp, testSTAPA(testSPS720, testPPS)), 0)
+			p.WriteVideo(testVideoPacket(timestamp, []byte{0x65, 0x88, 0x80}), 0)
+		} else {
+			p.WriteVideo(testVideoPacket(timestamp, []byte{0x41, 0x9a, 0x00}), 0)
+		}
+
+		if frame%3 == 0 {
+			p.WriteAudio(codecs.TrackPacket{
+				Codec:  codecs.AudioTrackCodecOpus,
+				Packet: &rtp.Packet{Payload: []byte{0xf8, 0x00}},
+			})
+		}
+	}
+
+	ctx := context.Background()
+	master, ok := p.GetMasterPlaylist(ctx, "")
+	if !ok {
+		t.Fatal("GetMasterPlaylist() returned no playlist")
+	}
+
+	if !strings.Contains(master, `CODECS="avc1.42c01f,opus",RESOLUTION=1280x720`) {
+		t.Errorf("GetMasterPlaylist() = %s", master)
+	}
+
+	media, ok := p.GetMediaPlaylist(ctx, -1, -1, "")
+	if !ok {
+		t.Fatal("GetMediaPlaylist() returned no playlist")
+	}
+
+	for _, want := range []string{
+		"#EXT-X-MAP:URI=\"init-1.mp4\"",
+		"segment-0.m4s",
+		"segment-1.m4s",
+		"#EXT-X-PART:DURATION=0.23333,URI=\"part-2-0.m4s\",INDEPENDENT=YES",
+		"#EXT-X-PRELOAD-HINT:TYPE=PART",
+	} {
+		if !strings.Contains(media, want) {
+			t.Errorf("GetMediaPlaylist() missing %q in\n%s", want, media)
+		}
+	}
+
+	if segment, ok := p.GetSegment(0); !ok || len(segment) == 0 {
+		t.Error("GetSegment() returned no data for the first segment")
+	}
+
+	if _, ok := p.GetInitSegment(1); !ok {
+		t.Error("GetInitSegment() returned no data")
+	}
+}
+
+func testVideoPacket(timestamp uint32, payload []byte) codecs.TrackPacket {
+	return codecs.TrackPacket{
+		Codec:  codecs.VideoTrackCodecH264,
+		Layer:  "",
+		Packet: &rtp.Packet{Header: rtp.Header{Timestamp: timestamp, Marker: true}, Payload: payload},
+	}
+}
+
+func testSTAPA(nalus ...[]byte) []byte {
+	payload := []byte{0x18}
+	for _, nalu := range nalus {
+		payload = append(payload, byte(len(nalu)>>8), byte(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+
+	return payload
+}
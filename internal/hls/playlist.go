@@ -0,0 +1,264 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// Parts are only listed for the most recent segments
+	partSegmentCount = 3
+
+	defaultBandwidth = 2_500_000
+)
+
+// Returns the multivariant playlist, waits until the first segment is available.
+// The query is appended to the URIs of the playlist, such as the viewer token of a private stream.
+func (p *Packager) GetMasterPlaylist(ctx context.Context, query string) (string, bool) {
+	if !p.waitFor(ctx, 2*p.segmentDuration, func() bool { return p.initVersion != 0 }) {
+		return "", false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	codecs := []string{}
+	resolution := ""
+	if p.videoConfig != nil && !p.isAudioOnly {
+		codecs = append(codecs, p.videoConfig.codecString())
+		resolution = fmt.Sprintf(",RESOLUTION=%dx%d", p.videoConfig.width, p.videoConfig.height)
+	}
+	if p.hasAudio {
+		codecs = append(codecs, "opus")
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:9\n")
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\"%s\n", p.getBandwidthLocked(), strings.Join(codecs, ","), resolution)
+	b.WriteString("stream.m3u8" + getURIQuery(query) + "\n")
+
+	return b.String(), true
+}
+
+// Returns the media playlist.
+// When a media sequence number is provided the request blocks until the segment or part is available.
+// The query is appended to the URIs of the playlist, such as the viewer token of a private stream.
+func (p *Packager) GetMediaPlaylist(ctx context.Context, mediaSequence int64, partIndex int64, query string) (string, bool) {
+	isReady := func() bool {
+		if len(p.segments) == 0 && (p.currentSegment == nil || len(p.currentSegment.parts) == 0) {
+			return false
+		}
+
+		return mediaSequence < 0 || p.hasMediaSequenceLocked(uint64(mediaSequence), partIndex)
+	}
+
+	if !p.waitFor(ctx, 3*p.segmentDuration, isReady) {
+		p.lock.Lock()
+		hasSegments := len(p.segments) != 0
+		p.lock.Unlock()
+
+		if !hasSegments {
+			return "", false
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.getMediaPlaylistLocked(getURIQuery(query)), true
+}
+
+// Returns the initialization segment of the provided version
+func (p *Packager) GetInitSegment(version int) ([]byte, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	initSegment, ok := p.initSegments[version]
+	return initSegment, ok
+}
+
+// Returns a completed segment
+func (p *Packager) GetSegment(sequence uint64) ([]byte, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, s := range p.segments {
+		if s.sequence != sequence {
+			continue
+		}
+
+		data := make([]byte, 0, s.byteCount)
+		for _, part := range s.parts {
+			data = append(data, part.data...)
+		}
+
+		return data, true
+	}
+
+	return nil, false
+}
+
+// Returns a part of a segment.
+// Requests for the upcoming part block until it is available.
+func (p *Packager) GetPart(ctx context.Context, sequence uint64, partIndex int) ([]byte, bool) {
+	var result *part
+
+	isResolved := func() bool {
+		var isGone bool
+		result, isGone = p.getPartLocked(sequence, partIndex)
+		return result != nil || isGone
+	}
+
+	if !p.waitFor(ctx, 2*p.segmentDuration, isResolved) || result == nil {
+		return nil, false
+	}
+
+	return result.data, true
+}
+
+func (p *Packager) getPartLocked(sequence uint64, partIndex int) (result *part, isGone bool) {
+	segments := p.segments
+	if p.currentSegment != nil {
+		segments = append(segments[:len(segments):len(segments)], p.currentSegment)
+	}
+
+	for _, s := range segments {
+		if s.sequence != sequence {
+			continue
+		}
+
+		if partIndex < len(s.parts) {
+			return s.parts[partIndex], false
+		}
+
+		return nil, s != p.currentSegment
+	}
+
+	return nil, sequence < p.nextSequence
+}
+
+func (p *Packager) hasMediaSequenceLocked(mediaSequence uint64, partIndex int64) bool {
+	if p.currentSegment != nil && p.currentSegment.sequence == mediaSequence && partIndex >= 0 {
+		return int64(len(p.currentSegment.parts)) > partIndex
+	}
+
+	return len(p.segments) != 0 && p.segments[len(p.segments)-1].sequence >= mediaSequence
+}
+
+func (p *Packager) getMediaPlaylistLocked(uriQuery string) string {
+	segments := p.segments
+	if p.currentSegment != nil {
+		segments = append(segments[:len(segments):len(segments)], p.currentSegment)
+	}
+
+	targetDuration := p.segmentDuration
+	for _, s := range p.segments {
+		targetDuration = max(targetDuration, s.duration)
+	}
+
+	mediaSequence := p.nextSequence
+	if len(segments) != 0 {
+		mediaSequence = segments[0].sequence
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration.Seconds())))
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", p.partDuration.Seconds())
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", (3 * p.partDuration).Seconds())
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", mediaSequence)
+	fmt.Fprintf(&b, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", p.discontinuities)
+
+	initVersion := 0
+	for i, s := range segments {
+		if s.isDiscontinuity {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+
+		if s.initVersion != initVersion {
+			fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"init-%d.mp4%s\"\n", s.initVersion, uriQuery)
+			initVersion = s.initVersion
+		}
+
+		if i >= len(segments)-partSegmentCount-1 {
+			for partIndex, part := range s.parts {
+				independent := ""
+				if part.isIndependent {
+					independent = ",INDEPENDENT=YES"
+				}
+
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.5f,URI=\"part-%d-%d.m4s%s\"%s\n", part.duration.Seconds(), s.sequence, partIndex, uriQuery, independent)
+			}
+		}
+
+		if s != p.currentSegment {
+			fmt.Fprintf(&b, "#EXTINF:%.5f,\n", s.duration.Seconds())
+			fmt.Fprintf(&b, "segment-%d.m4s%s\n", s.sequence, uriQuery)
+		}
+	}
+
+	if p.currentSegment != nil {
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part-%d-%d.m4s%s\"\n", p.currentSegment.sequence, len(p.currentSegment.parts), uriQuery)
+	}
+
+	return b.String()
+}
+
+func getURIQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+
+	return "?" + query
+}
+
+func (p *Packager) getBandwidthLocked() int {
+	totalBytes, totalDuration := 0, time.Duration(0)
+	for _, s := range p.segments {
+		totalBytes += s.byteCount
+		totalDuration += s.duration
+	}
+
+	if totalDuration == 0 {
+		return defaultBandwidth
+	}
+
+	return int(float64(totalBytes*8) / totalDuration.Seconds())
+}
+
+// Block until the condition is met, the timeout passes or the request is cancelled.
+// The condition is evaluated while holding the packager lock.
+func (p *Packager) waitFor(ctx context.Context, timeout time.Duration, condition func() bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		p.lock.Lock()
+		if condition() {
+			p.lock.Unlock()
+			return true
+		}
+
+		if p.isClosed {
+			p.lock.Unlock()
+			return false
+		}
+
+		updated := p.updated
+		p.lock.Unlock()
+
+		select {
+		case <-updated:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
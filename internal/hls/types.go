@@ -0,0 +1,79 @@
+package hls
+
+import (
+	"sync"
+	"time"
+
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+type (
+	// Packages the media of a single stream key into LL-HLS playlists and fMP4 segments
+	Packager struct {
+		StreamKey string
+		pliSender func()
+
+		segmentDuration time.Duration
+		partDuration    time.Duration
+		segmentCount    int
+
+		// Protects all fields below
+		lock sync.Mutex
+
+		// Video ingest
+		videoLayer           string
+		hasVideoLayer        bool
+		videoLayerPriority   int
+		videoLayerLastPacket time.Time
+		depacketizer         *pionCodecs.H264Packet
+		frameNalus           [][]byte
+		frameTimestamp       uint32
+		pendingVideo         *pendingSample
+		videoConfig          *videoConfig
+		videoDecodeTime      uint64
+		lastPLI              time.Time
+		loggedVideoCodec     bool
+
+		// Audio ingest
+		hasAudio         bool
+		firstAudioPacket time.Time
+		audioDecodeTime  uint64
+		isAudioOnly      bool
+
+		// Output
+		videoSamples     []sample
+		audioSamples     []sample
+		initSegments     map[int][]byte
+		initVersion      int
+		isDiscontinuity  bool
+		segments         []*segment
+		currentSegment   *segment
+		nextSequence     uint64
+		fragmentSequence uint32
+		discontinuities  uint64
+		updated          chan struct{}
+		isClosed         bool
+	}
+
+	pendingSample struct {
+		sample
+		rtpTimestamp uint32
+	}
+
+	segment struct {
+		sequence        uint64
+		initVersion     int
+		isDiscontinuity bool
+		hasAudio        bool
+		parts           []*part
+		ticks           uint64
+		duration        time.Duration
+		byteCount       int
+	}
+
+	part struct {
+		data          []byte
+		duration      time.Duration
+		isIndependent bool
+	}
+)
@@ -0,0 +1,228 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const namespace = "broadcastbox"
+
+var (
+	// Messages accepted and rejected by the chat of each stream
+	ChatMessages            = NewCounterVec("chat_messages_total", "Chat messages sent.", "stream")
+	ChatMessagesRateLimited = NewCounterVec("chat_messages_rate_limited_total", "Chat messages rejected by the rate limits.", "stream")
+
+	// Duration of requests made to WEBHOOK_URL
+	WebhookLatency = NewHistogramVec(
+		"webhook_request_duration_seconds",
+		"Duration of webhook requests.",
+		[]float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+		"action", "result")
+)
+
+// Writes metrics in the Prometheus text exposition format
+type Writer struct {
+	writer io.Writer
+	err    error
+}
+
+func NewWriter(writer io.Writer) *Writer {
+	return &Writer{writer: writer}
+}
+
+// Returns the first error that occurred while writing
+func (w *Writer) Err() error {
+	return w.err
+}
+
+// Write the HELP and TYPE lines of a metric, must be called once before its samples
+func (w *Writer) Header(name string, metricType string, help string) {
+	w.printf("# HELP %s_%s %s\n# TYPE %s_%s %s\n", namespace, name, help, namespace, name, metricType)
+}
+
+// Write a sample, labels are given as name and value pairs
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s_%s%s %s\n", namespace, name, formatLabels(labels), formatValue(value))
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+
+	_, w.err = fmt.Fprintf(w.writer, format, args...)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var builder strings.Builder
+	builder.WriteString("{")
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			builder.WriteString(",")
+		}
+		builder.WriteString(labels[i])
+		builder.WriteString("=")
+		builder.WriteString(escapeLabelValue(labels[i+1]))
+	}
+	builder.WriteString("}")
+
+	return builder.String()
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// Counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labelValues []string
+	value       uint64
+}
+
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*counterValue),
+	}
+}
+
+// Increment the counter of the label values, given in the order of the labels
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	value, ok := c.values[key]
+	if !ok {
+		value = &counterValue{labelValues: labelValues}
+		c.values[key] = value
+	}
+
+	value.value++
+}
+
+func (c *CounterVec) Write(w *Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w.Header(c.name, "counter", c.help)
+	for _, key := range slices.Sorted(maps.Keys(c.values)) {
+		value := c.values[key]
+		w.Sample(c.name, float64(value.value), zipLabels(c.labels, value.labelValues)...)
+	}
+}
+
+// Histogram partitioned by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Record a duration for the label values, given in the order of the labels
+func (h *HistogramVec) Observe(duration time.Duration, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+
+	seconds := duration.Seconds()
+	for i, bucket := range h.buckets {
+		if seconds <= bucket {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += seconds
+}
+
+func (h *HistogramVec) Write(w *Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w.Header(h.name, "histogram", h.help)
+	for _, key := range slices.Sorted(maps.Keys(h.values)) {
+		value := h.values[key]
+		labels := zipLabels(h.labels, value.labelValues)
+
+		for i, bucket := range h.buckets {
+			w.Sample(h.name+"_bucket", float64(value.counts[i]), append(labels, "le", formatValue(bucket))...)
+		}
+		w.Sample(h.name+"_bucket", float64(value.count), append(labels, "le", "+Inf")...)
+		w.Sample(h.name+"_sum", value.sum, labels...)
+		w.Sample(h.name+"_count", float64(value.count), labels...)
+	}
+}
+
+func zipLabels(names []string, values []string) []string {
+	labels := make([]string, 0, len(names)*2)
+	for i, name := range names {
+		if i < len(values) {
+			labels = append(labels, name, values[i])
+		}
+	}
+
+	return labels
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer := NewWriter(buffer)
+
+	counter := NewCounterVec("messages_total", "Messages.", "stream")
+	counter.Inc(`key"with\quotes`)
+	counter.Inc(`key"with\quotes`)
+	counter.Inc("other")
+	counter.Write(writer)
+
+	histogram := NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "action")
+	histogram.Observe(50*time.Millisecond, "connect")
+	histogram.Observe(500*time.Millisecond, "connect")
+	histogram.Observe(2*time.Second, "connect")
+	histogram.Write(writer)
+
+	if err := writer.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP broadcastbox_messages_total Messages.
+# TYPE broadcastbox_messages_total counter
+broadcastbox_messages_total{stream="key\"with\\quotes"} 2
+broadcastbox_messages_total{stream="other"} 1
+# HELP broadcastbox_latency_seconds Latency.
+# TYPE broadcastbox_latency_seconds histogram
+broadcastbox_latency_seconds_bucket{action="connect",le="0.1"} 1
+broadcastbox_latency_seconds_bucket{action="connect",le="1"} 2
+broadcastbox_latency_seconds_bucket{action="connect",le="+Inf"} 3
+broadcastbox_latency_seconds_sum{action="connect"} 2.55
+broadcastbox_latency_seconds_count{action="connect"} 3
+`
+
+	if buffer.String() != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", buffer.String(), expected)
+	}
+}
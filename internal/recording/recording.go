@@ -0,0 +1,250 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+	"github.com/pion/webrtc/v4/pkg/media/h265writer"
+	"github.com/pion/webrtc/v4/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+const (
+	defaultRecordingPath = "recordings"
+	fileTimeFormat       = "20060102-150405"
+
+	// Packets buffered for the writer goroutine, so a slow disk does not stall ingest
+	packetBufferSize = 1024
+)
+
+var invalidPathCharacters = regexp.MustCompile(`[^\p{L}\p{N}_-]+`)
+
+// Returns true if every incoming stream should be recorded
+func IsRecordingAllStreams() bool {
+	return strings.EqualFold(os.Getenv(environment.RecordAllStreams), "true")
+}
+
+// Returns the directory recordings are stored in
+func GetRecordingPath() string {
+	if recordingPath := os.Getenv(environment.RecordingPath); recordingPath != "" {
+		return recordingPath
+	}
+
+	return defaultRecordingPath
+}
+
+// Create a new recorder for the provided stream key.
+// Files are created lazily once the first packet of a track arrives.
+func NewRecorder(streamKey string) (*Recorder, error) {
+	directory := filepath.Join(GetRecordingPath(), sanitizePathSegment(streamKey))
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("recording: could not create directory %s: %w", directory, err)
+	}
+
+	slog.Info("Recording.NewRecorder", "streamKey", streamKey, "directory", directory)
+
+	recorder := &Recorder{
+		StreamKey:   streamKey,
+		Directory:   directory,
+		RecordStart: time.Now(),
+		packets:     make(chan recordedPacket, packetBufferSize),
+		done:        make(chan struct{}),
+		writers:     make(map[string]media.Writer),
+	}
+	go recorder.run()
+
+	return recorder, nil
+}
+
+// Write a video packet for the provided layer.
+// Simulcast layers are written to separate files.
+func (r *Recorder) WriteVideo(layer string, packet *rtp.Packet, codec codecs.TrackCodeType) {
+	r.write("video", layer, packet, codec)
+}
+
+// Write an audio packet for the provided layer
+func (r *Recorder) WriteAudio(layer string, packet *rtp.Packet, codec codecs.TrackCodeType) {
+	r.write("audio", layer, packet, codec)
+}
+
+// Set the function called when writing to disk failed and the recorder stopped.
+// Must be set before packets are written.
+func (r *Recorder) SetOnFailed(onFailed func()) {
+	r.onFailed = onFailed
+}
+
+// Write the buffered packets and close all open files of the recorder
+func (r *Recorder) Close() {
+	r.closePackets()
+	<-r.done
+}
+
+// Get the current state of the recorder
+func (r *Recorder) GetRecordingState() RecordingState {
+	r.filesLock.Lock()
+	defer r.filesLock.Unlock()
+
+	files := make([]string, len(r.files))
+	copy(files, r.files)
+
+	return RecordingState{
+		StreamKey:   r.StreamKey,
+		RecordStart: r.RecordStart,
+		Files:       files,
+	}
+}
+
+// Queue the packet for the writer goroutine, packets are dropped while the buffer is full
+func (r *Recorder) write(kind string, layer string, packet *rtp.Packet, codec codecs.TrackCodeType) {
+	r.packetsLock.Lock()
+	defer r.packetsLock.Unlock()
+
+	if r.isClosed {
+		return
+	}
+
+	// The ingest reuses the packet buffer
+	select {
+	case r.packets <- recordedPacket{key: kind + "_" + layer, packet: packet.Clone(), codec: codec}:
+		r.isDropping = false
+	default:
+		if !r.isDropping {
+			slog.Warn("Recording.Write.BufferFull", "streamKey", r.StreamKey)
+			r.isDropping = true
+		}
+	}
+}
+
+func (r *Recorder) closePackets() {
+	r.packetsLock.Lock()
+	defer r.packetsLock.Unlock()
+
+	if !r.isClosed {
+		r.isClosed = true
+		close(r.packets)
+	}
+}
+
+// Writes queued packets until the recorder is closed. When a file can not be written
+// the recorder stops, the remaining packets are discarded.
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	isFailed := false
+	for recorded := range r.packets {
+		if isFailed {
+			continue
+		}
+
+		if err := r.writePacket(recorded); err != nil {
+			slog.Error("Recording.Write.Error, stopping recording", "streamKey", r.StreamKey, "track", recorded.key, "error", err)
+			isFailed = true
+			r.closePackets()
+
+			if r.onFailed != nil {
+				r.onFailed()
+			}
+		}
+	}
+
+	for key, writer := range r.writers {
+		if err := writer.Close(); err != nil {
+			slog.Error("Recording.Close.Error", "streamKey", r.StreamKey, "track", key, "error", err)
+		}
+	}
+
+	slog.Info("Recording.Close", "streamKey", r.StreamKey, "files", r.GetRecordingState().Files)
+}
+
+// Write a packet to the file of its track, only errors writing to disk are returned
+func (r *Recorder) writePacket(recorded recordedPacket) error {
+	writer, ok := r.writers[recorded.key]
+	if !ok {
+		var err error
+		writer, err = r.createWriter(recorded.key, recorded.codec)
+		if err != nil {
+			slog.Error("Recording.CreateWriter.Error", "streamKey", r.StreamKey, "track", recorded.key, "error", err)
+
+			// Store a discarding writer to avoid retrying on every packet
+			writer = discardWriter{}
+		}
+
+		r.writers[recorded.key] = writer
+	}
+
+	var pathError *fs.PathError
+	if err := writer.WriteRTP(recorded.packet); errors.As(err, &pathError) {
+		return err
+	} else if err != nil {
+		slog.Debug("Recording.WriteRTP.Error", "streamKey", r.StreamKey, "track", recorded.key, "error", err)
+	}
+
+	return nil
+}
+
+func (r *Recorder) createWriter(key string, codec codecs.TrackCodeType) (media.Writer, error) {
+	baseName := filepath.Join(r.Directory, r.RecordStart.Format(fileTimeFormat)+"_"+sanitizePathSegment(key))
+
+	var (
+		fileName string
+		writer   media.Writer
+		err      error
+	)
+
+	switch codec {
+	case codecs.VideoTrackCodecH264:
+		fileName = baseName + ".h264"
+		writer, err = h264writer.New(fileName)
+	case codecs.VideoTrackCodecH265:
+		fileName = baseName + ".h265"
+		writer, err = h265writer.New(fileName)
+	case codecs.VideoTrackCodecVP8:
+		fileName = baseName + ".ivf"
+		writer, err = ivfwriter.New(fileName, ivfwriter.WithCodec(webrtc.MimeTypeVP8))
+	case codecs.VideoTrackCodecVP9:
+		fileName = baseName + ".ivf"
+		writer, err = ivfwriter.New(fileName, ivfwriter.WithCodec(webrtc.MimeTypeVP9))
+	case codecs.VideoTrackCodecAV1:
+		fileName = baseName + ".ivf"
+		writer, err = ivfwriter.New(fileName, ivfwriter.WithCodec(webrtc.MimeTypeAV1))
+	case codecs.AudioTrackCodecOpus:
+		fileName = baseName + ".ogg"
+		writer, err = oggwriter.New(fileName, 48000, 2)
+	default:
+		return nil, fmt.Errorf("recording: unsupported codec %d", codec)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Recording.CreateWriter", "streamKey", r.StreamKey, "file", fileName)
+
+	r.filesLock.Lock()
+	r.files = append(r.files, fileName)
+	r.filesLock.Unlock()
+
+	return writer, nil
+}
+
+func sanitizePathSegment(segment string) string {
+	return invalidPathCharacters.ReplaceAllString(segment, "_")
+}
+
+type discardWriter struct{}
+
+func (discardWriter) WriteRTP(*rtp.Packet) error { return nil }
+func (discardWriter) Close() error               { return nil }
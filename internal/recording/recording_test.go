@@ -0,0 +1,164 @@
+package recording
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/h264writer"
+)
+
+func newTestPacket(sequenceNumber uint16, isMarker bool, payload []byte) *rtp.Packet {
+	return &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         isMarker,
+			SequenceNumber: sequenceNumber,
+			Timestamp:      uint32(sequenceNumber) * 960,
+		},
+		Payload: payload,
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	t.Setenv(environment.RecordingPath, t.TempDir())
+
+	recorder, err := NewRecorder("my/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Base(recorder.Directory) != "my_stream" {
+		t.Fatalf("unexpected recording directory %s", recorder.Directory)
+	}
+
+	for i := range uint16(3) {
+		// SPS followed by an IDR slice
+		recorder.WriteVideo("h264", newTestPacket(i*2, false, []byte{0x67, 0x42, 0x00, 0x1f}), codecs.VideoTrackCodecH264)
+		recorder.WriteVideo("h264", newTestPacket(i*2+1, true, []byte{0x65, 0x88, 0x84, 0x00}), codecs.VideoTrackCodecH264)
+
+		// Single packet VP8 key frames
+		recorder.WriteVideo("vp8", newTestPacket(i, true, []byte{0x10, 0x00, 0x00, 0x00, 0x9d, 0x01, 0x2a}), codecs.VideoTrackCodecVP8)
+
+		recorder.WriteAudio("opus", newTestPacket(i, true, []byte{0xfc, 0xff, 0xfe}), codecs.AudioTrackCodecOpus)
+	}
+
+	recorder.WriteVideo("unsupported", newTestPacket(0, true, []byte{0x00}), codecs.TrackCodeType(0))
+
+	// Closing writes the buffered packets before the files are finalized
+	recorder.Close()
+
+	state := recorder.GetRecordingState()
+	if state.StreamKey != "my/stream" || len(state.Files) != 3 {
+		t.Fatalf("expected one file per supported track, got %v", state.Files)
+	}
+
+	extensions := []string{}
+	for _, file := range state.Files {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatal(err)
+		}
+
+		extensions = append(extensions, filepath.Ext(file))
+	}
+	slices.Sort(extensions)
+
+	if !slices.Equal(extensions, []string{".h264", ".ivf", ".ogg"}) {
+		t.Fatalf("unexpected recording files %v", state.Files)
+	}
+
+	// Packets after closing are dropped
+	recorder.WriteVideo("late", newTestPacket(10, true, []byte{0x67, 0x42, 0x00, 0x1f}), codecs.VideoTrackCodecH264)
+	if files := recorder.GetRecordingState().Files; len(files) != 3 {
+		t.Fatalf("expected no files after closing, got %v", files)
+	}
+
+	for _, file := range state.Files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch filepath.Ext(file) {
+		case ".h264":
+			if !bytes.HasPrefix(data, []byte{0x00, 0x00, 0x00, 0x01, 0x67}) {
+				t.Fatalf("expected an Annex B stream starting with the SPS, got %x", data)
+			}
+
+		case ".ivf":
+			// The frame count of the header is written when the file is closed
+			if len(data) < 32 || string(data[:4]) != "DKIF" || binary.LittleEndian.Uint32(data[24:28]) != 3 {
+				t.Fatalf("expected an IVF file with 3 frames, got %x", data)
+			}
+
+		case ".ogg":
+			// The last page is marked as end of stream when the file is closed
+			lastPage := bytes.LastIndex(data, []byte("OggS"))
+			if lastPage < 0 || data[lastPage+5]&0x04 == 0 {
+				t.Fatalf("expected the last Ogg page to end the stream, got %x", data)
+			}
+		}
+	}
+}
+
+func TestRecorderRejectsUnsupportedCodec(t *testing.T) {
+	t.Setenv(environment.RecordingPath, t.TempDir())
+
+	recorder, err := NewRecorder("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := recorder.createWriter("video_unsupported", codecs.TrackCodeType(0)); err == nil {
+		t.Fatal("expected an unsupported codec to be rejected")
+	}
+
+	recorder.WriteVideo("unsupported", newTestPacket(0, true, []byte{0x00}), codecs.TrackCodeType(0))
+	recorder.Close()
+	if files, _ := os.ReadDir(recorder.Directory); len(files) != 0 || len(recorder.GetRecordingState().Files) != 0 {
+		t.Fatalf("expected no recording files, got %d", len(files))
+	}
+}
+
+func TestRecorderStopsOnWriteError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("writing to a full disk is simulated with /dev/full")
+	}
+	t.Setenv(environment.RecordingPath, t.TempDir())
+
+	recorder, err := NewRecorder("stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := h264writer.New("/dev/full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.writers["video_h264"] = writer
+
+	failed := make(chan struct{})
+	recorder.SetOnFailed(func() { close(failed) })
+
+	recorder.WriteVideo("h264", newTestPacket(0, true, []byte{0x67, 0x42, 0x00, 0x1f}), codecs.VideoTrackCodecH264)
+
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the recording to stop when the disk is full")
+	}
+
+	// Packets after the failure are dropped without blocking
+	for i := range uint16(2 * packetBufferSize) {
+		recorder.WriteVideo("h264", newTestPacket(i, true, []byte{0x65, 0x88, 0x84, 0x00}), codecs.VideoTrackCodecH264)
+	}
+
+	recorder.Close()
+}
@@ -0,0 +1,49 @@
+package recording
+
+import (
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+type (
+	// Writes the incoming media of a single stream key to disk
+	Recorder struct {
+		StreamKey   string
+		Directory   string
+		RecordStart time.Time
+
+		// Packets waiting for the writer goroutine, done is closed once it has closed all files
+		packets  chan recordedPacket
+		done     chan struct{}
+		onFailed func()
+
+		// Protects isClosed, isDropping and sending to packets
+		packetsLock sync.Mutex
+		isClosed    bool
+		isDropping  bool
+
+		// Only used by the writer goroutine
+		writers map[string]media.Writer
+
+		// Protects files
+		filesLock sync.Mutex
+		files     []string
+	}
+
+	recordedPacket struct {
+		key    string
+		packet *rtp.Packet
+		codec  codecs.TrackCodeType
+	}
+
+	// Information about an active recording
+	RecordingState struct {
+		StreamKey   string    `json:"streamKey"`
+		RecordStart time.Time `json:"recordStart"`
+		Files       []string  `json:"files"`
+	}
+)
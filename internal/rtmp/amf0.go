@@ -0,0 +1,226 @@
+package rtmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+const (
+	amf0Number      = 0x00
+	amf0Boolean     = 0x01
+	amf0String      = 0x02
+	amf0Object      = 0x03
+	amf0Null        = 0x05
+	amf0Undefined   = 0x06
+	amf0ECMAArray   = 0x08
+	amf0ObjectEnd   = 0x09
+	amf0StrictArray = 0x0a
+	amf0Date        = 0x0b
+	amf0LongString  = 0x0c
+)
+
+var errAMF0Unsupported = errors.New("rtmp: unsupported amf0 type")
+
+// Decode all AMF0 values of a command message.
+// Numbers are decoded as float64, objects and ECMA arrays as map[string]any.
+func decodeAMF0(data []byte) (values []any, err error) {
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		value, err := decodeAMF0Value(reader)
+		if err != nil {
+			return values, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func decodeAMF0Value(reader *bytes.Reader) (any, error) {
+	marker, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch marker {
+	case amf0Number:
+		var value float64
+		err := binary.Read(reader, binary.BigEndian, &value)
+		return value, err
+
+	case amf0Boolean:
+		value, err := reader.ReadByte()
+		return value != 0, err
+
+	case amf0String:
+		return decodeAMF0String(reader)
+
+	case amf0LongString:
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+
+		return readAMF0String(reader, int(length))
+
+	case amf0Object:
+		return decodeAMF0Object(reader)
+
+	case amf0ECMAArray:
+		// Count is only a hint, the array is terminated like an object
+		if _, err := reader.Seek(4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+
+		return decodeAMF0Object(reader)
+
+	case amf0StrictArray:
+		var count uint32
+		if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+
+		values := []any{}
+		for range count {
+			value, err := decodeAMF0Value(reader)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, value)
+		}
+
+		return values, nil
+
+	case amf0Date:
+		var value float64
+		if err := binary.Read(reader, binary.BigEndian, &value); err != nil {
+			return nil, err
+		}
+
+		// Time zone, unused
+		_, err := reader.Seek(2, io.SeekCurrent)
+		return value, err
+
+	case amf0Null, amf0Undefined:
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("%w: 0x%02x", errAMF0Unsupported, marker)
+}
+
+func decodeAMF0String(reader *bytes.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+
+	return readAMF0String(reader, int(length))
+}
+
+func readAMF0String(reader *bytes.Reader, length int) (string, error) {
+	if length > reader.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	value := make([]byte, length)
+	_, err := io.ReadFull(reader, value)
+	return string(value), err
+}
+
+func decodeAMF0Object(reader *bytes.Reader) (map[string]any, error) {
+	object := map[string]any{}
+	for {
+		key, err := decodeAMF0String(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" {
+			marker, err := reader.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+
+			if marker == amf0ObjectEnd {
+				return object, nil
+			}
+
+			if err := reader.UnreadByte(); err != nil {
+				return nil, err
+			}
+		}
+
+		value, err := decodeAMF0Value(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		object[key] = value
+	}
+}
+
+// Encode values as AMF0.
+// Supports float64, int, bool, string, nil and map[string]any.
+func encodeAMF0(values ...any) []byte {
+	buffer := &bytes.Buffer{}
+	for _, value := range values {
+		encodeAMF0Value(buffer, value)
+	}
+
+	return buffer.Bytes()
+}
+
+func encodeAMF0Value(buffer *bytes.Buffer, value any) {
+	switch value := value.(type) {
+	case float64:
+		buffer.WriteByte(amf0Number)
+		buffer.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+
+	case int:
+		encodeAMF0Value(buffer, float64(value))
+
+	case bool:
+		buffer.WriteByte(amf0Boolean)
+		if value {
+			buffer.WriteByte(1)
+		} else {
+			buffer.WriteByte(0)
+		}
+
+	case string:
+		buffer.WriteByte(amf0String)
+		encodeAMF0String(buffer, value)
+
+	case map[string]any:
+		buffer.WriteByte(amf0Object)
+
+		// Sorted for a stable output
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+
+		for _, key := range keys {
+			encodeAMF0String(buffer, key)
+			encodeAMF0Value(buffer, value[key])
+		}
+
+		buffer.Write([]byte{0x00, 0x00, amf0ObjectEnd})
+
+	default:
+		buffer.WriteByte(amf0Null)
+	}
+}
+
+func encodeAMF0String(buffer *bytes.Buffer, value string) {
+	buffer.Write(binary.BigEndian.AppendUint16(nil, uint16(len(value))))
+	buffer.WriteString(value)
+}
@@ -0,0 +1,277 @@
+package rtmp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	handshakeSize    = 1536
+	handshakeVersion = 3
+
+	defaultChunkSize  = 128
+	outgoingChunkSize = 4096
+	maxChunkSize      = 0xffffff
+
+	extendedTimestamp = 0xffffff
+)
+
+// Message type IDs as described in the RTMP specification 5.4 and 7.1
+const (
+	messageSetChunkSize     = 1
+	messageAbort            = 2
+	messageAcknowledgement  = 3
+	messageUserControl      = 4
+	messageWindowAckSize    = 5
+	messageSetPeerBandwidth = 6
+	messageAudio            = 8
+	messageVideo            = 9
+	messageDataAMF3         = 15
+	messageCommandAMF3      = 17
+	messageDataAMF0         = 18
+	messageCommandAMF0      = 20
+)
+
+var errInvalidHandshake = errors.New("rtmp: invalid handshake")
+
+type (
+	message struct {
+		typeID    uint8
+		streamID  uint32
+		timestamp uint32
+		payload   []byte
+	}
+
+	// Header state of a single chunk stream, later chunks may omit fields of the header
+	chunkStream struct {
+		timestamp            uint32
+		timestampDelta       uint32
+		length               uint32
+		typeID               uint8
+		streamID             uint32
+		hasExtendedTimestamp bool
+		payload              []byte
+	}
+
+	chunkReader struct {
+		reader    *bufio.Reader
+		chunkSize uint32
+		streams   map[uint32]*chunkStream
+	}
+
+	chunkWriter struct {
+		writer    *bufio.Writer
+		chunkSize uint32
+	}
+)
+
+// Perform the simple handshake, digest validation is not required by common encoders
+func serverHandshake(reader io.Reader, writer *bufio.Writer) error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(reader, c0c1); err != nil {
+		return err
+	}
+
+	if c0c1[0] != handshakeVersion {
+		return fmt.Errorf("%w: version %d", errInvalidHandshake, c0c1[0])
+	}
+
+	// S0 and S1 followed by S2 echoing C1
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = handshakeVersion
+	if _, err := rand.Read(s0s1s2[9 : 1+handshakeSize]); err != nil {
+		return err
+	}
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:])
+
+	if _, err := writer.Write(s0s1s2); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	c2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(reader, c2)
+	return err
+}
+
+func newChunkReader(reader *bufio.Reader) *chunkReader {
+	return &chunkReader{
+		reader:    reader,
+		chunkSize: defaultChunkSize,
+		streams:   make(map[uint32]*chunkStream),
+	}
+}
+
+// Read chunks until a complete message has been received
+func (r *chunkReader) readMessage() (*message, error) {
+	for {
+		message, err := r.readChunk()
+		if err != nil || message != nil {
+			return message, err
+		}
+	}
+}
+
+func (r *chunkReader) readChunk() (*message, error) {
+	basicHeader, err := r.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	format := basicHeader >> 6
+	chunkStreamID := uint32(basicHeader & 0x3f)
+
+	switch chunkStreamID {
+	case 0:
+		value, err := r.reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		chunkStreamID = 64 + uint32(value)
+
+	case 1:
+		value := make([]byte, 2)
+		if _, err := io.ReadFull(r.reader, value); err != nil {
+			return nil, err
+		}
+		chunkStreamID = 64 + uint32(value[0]) + uint32(value[1])*256
+	}
+
+	stream, ok := r.streams[chunkStreamID]
+	if !ok {
+		stream = &chunkStream{}
+		r.streams[chunkStreamID] = stream
+	}
+
+	headerSize := [4]int{11, 7, 3, 0}[format]
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r.reader, header); err != nil {
+		return nil, err
+	}
+
+	timestamp := uint32(0)
+	if format <= 2 {
+		timestamp = readUint24(header[0:3])
+		stream.hasExtendedTimestamp = timestamp == extendedTimestamp
+	}
+
+	if format <= 1 {
+		stream.length = readUint24(header[3:6])
+		stream.typeID = header[6]
+	}
+
+	if format == 0 {
+		stream.streamID = binary.LittleEndian.Uint32(header[7:11])
+	}
+
+	if stream.hasExtendedTimestamp {
+		value := make([]byte, 4)
+		if _, err := io.ReadFull(r.reader, value); err != nil {
+			return nil, err
+		}
+
+		if format <= 2 {
+			timestamp = binary.BigEndian.Uint32(value)
+		}
+	}
+
+	switch format {
+	case 0:
+		stream.timestamp = timestamp
+		stream.timestampDelta = 0
+		stream.payload = nil
+	case 1, 2:
+		stream.timestampDelta = timestamp
+		stream.timestamp += timestamp
+		stream.payload = nil
+	case 3:
+		if len(stream.payload) == 0 {
+			stream.timestamp += stream.timestampDelta
+		}
+	}
+
+	if stream.payload == nil {
+		stream.payload = make([]byte, 0, stream.length)
+	}
+
+	size := min(r.chunkSize, stream.length-uint32(len(stream.payload)))
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, chunk); err != nil {
+		return nil, err
+	}
+	stream.payload = append(stream.payload, chunk...)
+
+	if uint32(len(stream.payload)) < stream.length {
+		return nil, nil
+	}
+
+	message := &message{
+		typeID:    stream.typeID,
+		streamID:  stream.streamID,
+		timestamp: stream.timestamp,
+		payload:   stream.payload,
+	}
+	stream.payload = nil
+
+	return message, nil
+}
+
+// Discard the partially received message of a chunk stream
+func (r *chunkReader) abort(chunkStreamID uint32) {
+	if stream, ok := r.streams[chunkStreamID]; ok {
+		stream.payload = nil
+	}
+}
+
+func newChunkWriter(writer *bufio.Writer) *chunkWriter {
+	return &chunkWriter{
+		writer:    writer,
+		chunkSize: defaultChunkSize,
+	}
+}
+
+// Write a message on the provided chunk stream, only chunk stream IDs below 64 are supported
+func (w *chunkWriter) writeMessage(chunkStreamID uint8, typeID uint8, streamID uint32, payload []byte) error {
+	header := []byte{chunkStreamID & 0x3f}
+	header = appendUint24(header, 0)
+	header = appendUint24(header, uint32(len(payload)))
+	header = append(header, typeID)
+	header = binary.LittleEndian.AppendUint32(header, streamID)
+
+	if _, err := w.writer.Write(header); err != nil {
+		return err
+	}
+
+	for {
+		size := min(len(payload), int(w.chunkSize))
+		if _, err := w.writer.Write(payload[:size]); err != nil {
+			return err
+		}
+
+		payload = payload[size:]
+		if len(payload) == 0 {
+			break
+		}
+
+		if err := w.writer.WriteByte(0xc0 | (chunkStreamID & 0x3f)); err != nil {
+			return err
+		}
+	}
+
+	return w.writer.Flush()
+}
+
+func readUint24(data []byte) uint32 {
+	return uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])
+}
+
+func appendUint24(data []byte, value uint32) []byte {
+	return append(data, byte(value>>16), byte(value>>8), byte(value))
+}
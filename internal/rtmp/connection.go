@@ -0,0 +1,399 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/server/webhook"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+)
+
+const (
+	readTimeout       = 30 * time.Second
+	windowAckSize     = 2_500_000
+	peerBandwidth     = 2_500_000
+	publishStreamID   = 1
+	userControlBegin  = 0
+	chunkStreamProto  = 2
+	chunkStreamInvoke = 3
+	chunkStreamStatus = 5
+)
+
+var (
+	errHostRemoved   = errors.New("rtmp: host has been removed")
+	errStreamEnded   = errors.New("rtmp: stream ended")
+	errInvalidApp    = errors.New("rtmp: invalid application")
+	errNotConnected  = errors.New("rtmp: publish before connect")
+	errInvalidStream = errors.New("rtmp: invalid stream key")
+)
+
+type connection struct {
+	conn   net.Conn
+	reader *chunkReader
+	writer *chunkWriter
+
+	bytesRead        *countingReader
+	clientAckWindow  uint32
+	lastAckBytesRead uint64
+
+	isConnected  bool
+	flashVersion string
+
+	streamKey string
+	session   *session.Session
+	host      *whip.WHIPSession
+	media     *mediaWriter
+}
+
+// Counts the bytes received to send acknowledgements
+type countingReader struct {
+	reader io.Reader
+	count  uint64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.count += uint64(n)
+	return n, err
+}
+
+func handleConnection(conn net.Conn) {
+	slog.Info("RTMP.Connection.Accepted", "address", conn.RemoteAddr())
+
+	bytesRead := &countingReader{reader: conn}
+	reader := bufio.NewReader(bytesRead)
+	writer := bufio.NewWriter(conn)
+
+	c := &connection{
+		conn:      conn,
+		reader:    newChunkReader(reader),
+		writer:    newChunkWriter(writer),
+		bytesRead: bytesRead,
+	}
+
+	defer c.close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		slog.Warn("RTMP.Connection.SetReadDeadline.Error", "error", err)
+		return
+	}
+
+	if err := serverHandshake(reader, writer); err != nil {
+		slog.Warn("RTMP.Connection.Handshake.Error", "address", conn.RemoteAddr(), "error", err)
+		return
+	}
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+			slog.Warn("RTMP.Connection.SetReadDeadline.Error", "error", err)
+			return
+		}
+
+		message, err := c.reader.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Warn("RTMP.Connection.Read.Error", "address", conn.RemoteAddr(), "streamKey", c.streamKey, "error", err)
+			}
+			return
+		}
+
+		if err := c.sendAcknowledgement(); err != nil {
+			slog.Warn("RTMP.Connection.Acknowledgement.Error", "address", conn.RemoteAddr(), "streamKey", c.streamKey, "error", err)
+			return
+		}
+
+		if err := c.handleMessage(message); err != nil {
+			if !errors.Is(err, errStreamEnded) {
+				slog.Error("RTMP.Connection.Error", "address", conn.RemoteAddr(), "streamKey", c.streamKey, "error", err)
+			}
+			return
+		}
+	}
+}
+
+func (c *connection) close() {
+	slog.Info("RTMP.Connection.Closed", "address", c.conn.RemoteAddr(), "streamKey", c.streamKey)
+
+	if c.media != nil {
+		c.media.close()
+	}
+
+	if c.host != nil {
+		c.host.Close()
+	}
+
+	if err := c.conn.Close(); err != nil {
+		slog.Warn("RTMP.Connection.Close.Error", "error", err)
+	}
+}
+
+func (c *connection) handleMessage(message *message) error {
+	switch message.typeID {
+	case messageSetChunkSize:
+		if len(message.payload) < 4 {
+			return fmt.Errorf("rtmp: invalid chunk size message")
+		}
+
+		chunkSize := binary.BigEndian.Uint32(message.payload) & 0x7fffffff
+		if chunkSize == 0 || chunkSize > maxChunkSize {
+			return fmt.Errorf("rtmp: invalid chunk size %d", chunkSize)
+		}
+		c.reader.chunkSize = chunkSize
+
+	case messageAbort:
+		if len(message.payload) >= 4 {
+			c.reader.abort(binary.BigEndian.Uint32(message.payload))
+		}
+
+	case messageWindowAckSize:
+		if len(message.payload) >= 4 {
+			c.clientAckWindow = binary.BigEndian.Uint32(message.payload)
+		}
+
+	case messageCommandAMF0:
+		return c.handleCommand(message.payload)
+
+	case messageCommandAMF3:
+		if len(message.payload) == 0 {
+			return nil
+		}
+
+		// AMF3 commands are prefixed with a format byte followed by AMF0 values
+		return c.handleCommand(message.payload[1:])
+
+	case messageVideo:
+		if err := c.verifyHost(); err != nil {
+			return err
+		}
+		c.media.writeVideo(message.timestamp, message.payload)
+
+	case messageAudio:
+		if err := c.verifyHost(); err != nil {
+			return err
+		}
+		c.media.writeAudio(message.timestamp, message.payload)
+	}
+
+	return nil
+}
+
+func (c *connection) handleCommand(payload []byte) error {
+	values, err := decodeAMF0(payload)
+	if err != nil && len(values) < 2 {
+		return err
+	}
+
+	if len(values) < 2 {
+		return nil
+	}
+
+	name, _ := values[0].(string)
+	transactionID, _ := values[1].(float64)
+
+	slog.Debug("RTMP.Connection.Command", "address", c.conn.RemoteAddr(), "command", name)
+
+	switch name {
+	case "connect":
+		var commandObject map[string]any
+		if len(values) > 2 {
+			commandObject, _ = values[2].(map[string]any)
+		}
+		return c.handleConnect(transactionID, commandObject)
+
+	case "releaseStream", "FCPublish":
+		return c.sendCommand(chunkStreamInvoke, 0, "_result", transactionID, nil)
+
+	case "createStream":
+		return c.sendCommand(chunkStreamInvoke, 0, "_result", transactionID, nil, publishStreamID)
+
+	case "publish":
+		streamName := ""
+		if len(values) > 3 {
+			streamName, _ = values[3].(string)
+		}
+		return c.handlePublish(streamName)
+
+	case "FCUnpublish", "deleteStream", "closeStream":
+		return errStreamEnded
+	}
+
+	return nil
+}
+
+func (c *connection) handleConnect(transactionID float64, commandObject map[string]any) error {
+	app, _ := commandObject["app"].(string)
+	app, _, _ = strings.Cut(app, "?")
+	app = strings.Trim(app, "/")
+
+	if app != applicationName {
+		if err := c.sendCommand(chunkStreamInvoke, 0, "_error", transactionID, nil, map[string]any{
+			"level":       "error",
+			"code":        "NetConnection.Connect.Rejected",
+			"description": "Application " + app + " is not available, publish to /" + applicationName,
+		}); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("%w: %s", errInvalidApp, app)
+	}
+
+	c.flashVersion, _ = commandObject["flashVer"].(string)
+	c.isConnected = true
+
+	if err := c.writer.writeMessage(chunkStreamProto, messageWindowAckSize, 0, binary.BigEndian.AppendUint32(nil, windowAckSize)); err != nil {
+		return err
+	}
+
+	// Dynamic peer bandwidth limit
+	if err := c.writer.writeMessage(chunkStreamProto, messageSetPeerBandwidth, 0, append(binary.BigEndian.AppendUint32(nil, peerBandwidth), 2)); err != nil {
+		return err
+	}
+
+	if err := c.writer.writeMessage(chunkStreamProto, messageSetChunkSize, 0, binary.BigEndian.AppendUint32(nil, outgoingChunkSize)); err != nil {
+		return err
+	}
+	c.writer.chunkSize = outgoingChunkSize
+
+	return c.sendCommand(chunkStreamInvoke, 0, "_result", transactionID,
+		map[string]any{
+			"fmsVer":       "FMS/3,0,1,123",
+			"capabilities": 31,
+		},
+		map[string]any{
+			"level":          "status",
+			"code":           "NetConnection.Connect.Success",
+			"description":    "Connection succeeded.",
+			"objectEncoding": 0,
+		})
+}
+
+// Authorize the stream key and add the connection as host of the session
+func (c *connection) handlePublish(streamName string) error {
+	if !c.isConnected {
+		return errNotConnected
+	}
+
+	if c.host != nil {
+		return fmt.Errorf("rtmp: stream is already publishing")
+	}
+
+	streamName, rawQuery, _ := strings.Cut(streamName, "?")
+	token := helpers.ResolveBearerToken("Bearer " + streamName)
+	if token == "" {
+		return c.rejectPublish(streamName, errInvalidStream)
+	}
+
+	var webhookProfile *authorization.PublicProfile
+
+	// Stream requires webhook validation
+	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" {
+		streamKey, err := webhook.CallWebhook(webhookURL, webhook.WHIPConnect, token, c.getWebhookRequest(rawQuery))
+		if err != nil {
+			return c.rejectPublish(token, err)
+		}
+
+		webhookProfile = &authorization.PublicProfile{
+			StreamKey: streamKey,
+			IsPublic:  true,
+			MOTD:      "Welcome to " + streamKey + "'s stream!",
+		}
+	}
+
+	profile, err := authorization.GetHostProfile(token, webhookProfile)
+	if err != nil {
+		return c.rejectPublish(token, err)
+	}
+
+	streamSession, err := manager.SessionsManager.GetOrAddSession(*profile, true)
+	if err != nil {
+		return c.rejectPublish(profile.StreamKey, err)
+	}
+
+	host, err := streamSession.AddExternalHost()
+	if err != nil {
+		return c.rejectPublish(profile.StreamKey, err)
+	}
+
+	slog.Info("RTMP.Connection.Publish", "address", c.conn.RemoteAddr(), "streamKey", profile.StreamKey)
+	c.streamKey = profile.StreamKey
+	c.session = streamSession
+	c.host = host
+	c.media = newMediaWriter(profile.StreamKey, host)
+
+	streamBegin := binary.BigEndian.AppendUint16(nil, userControlBegin)
+	streamBegin = binary.BigEndian.AppendUint32(streamBegin, publishStreamID)
+	if err := c.writer.writeMessage(chunkStreamProto, messageUserControl, 0, streamBegin); err != nil {
+		return err
+	}
+
+	return c.sendCommand(chunkStreamStatus, publishStreamID, "onStatus", 0, nil, map[string]any{
+		"level":       "status",
+		"code":        "NetStream.Publish.Start",
+		"description": "Publishing " + profile.StreamKey,
+	})
+}
+
+func (c *connection) rejectPublish(streamKey string, reason error) error {
+	slog.Warn("RTMP.Connection.Publish.Rejected", "address", c.conn.RemoteAddr(), "streamKey", streamKey, "error", reason)
+
+	if err := c.sendCommand(chunkStreamStatus, publishStreamID, "onStatus", 0, nil, map[string]any{
+		"level":       "error",
+		"code":        "NetStream.Publish.BadName",
+		"description": "Publishing is not allowed",
+	}); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("rtmp: publish rejected: %w", reason)
+}
+
+// Stop reading media once the host has been closed or replaced
+func (c *connection) verifyHost() error {
+	if c.host == nil {
+		return nil
+	}
+
+	if c.host.IsClosed() || !c.session.IsHostOrStandby(c.host) {
+		return errHostRemoved
+	}
+
+	return nil
+}
+
+func (c *connection) sendCommand(chunkStreamID uint8, streamID uint32, name string, transactionID float64, values ...any) error {
+	payload := encodeAMF0(append([]any{name, transactionID}, values...)...)
+	return c.writer.writeMessage(chunkStreamID, messageCommandAMF0, streamID, payload)
+}
+
+func (c *connection) sendAcknowledgement() error {
+	if c.clientAckWindow == 0 || c.bytesRead.count-c.lastAckBytesRead < uint64(c.clientAckWindow) {
+		return nil
+	}
+
+	c.lastAckBytesRead = c.bytesRead.count
+	return c.writer.writeMessage(chunkStreamProto, messageAcknowledgement, 0, binary.BigEndian.AppendUint32(nil, uint32(c.bytesRead.count)))
+}
+
+// The webhook receives the same information as for WHIP requests
+func (c *connection) getWebhookRequest(rawQuery string) *http.Request {
+	return &http.Request{
+		RemoteAddr: c.conn.RemoteAddr().String(),
+		URL:        &url.URL{RawQuery: rawQuery},
+		Header:     http.Header{"User-Agent": []string{c.flashVersion}},
+	}
+}
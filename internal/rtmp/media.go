@@ -0,0 +1,315 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+const (
+	rtpMTU               = 1200
+	rtpReaderBufferSize  = 512
+	videoPayloadType     = 96
+	audioPayloadType     = 111
+	videoClockRateMillis = 90
+	audioClockRateMillis = 48
+
+	// FLV video tag as described in the FLV specification E.4.3.1
+	flvVideoFrameTypeCommand = 5
+	flvVideoCodecAVC         = 7
+	flvVideoExHeader         = 0x80
+	avcPacketSequenceHeader  = 0
+	avcPacketNALU            = 1
+
+	// FLV audio tag and the Enhanced RTMP audio extension
+	flvAudioFormatAAC         = 10
+	flvAudioFormatExHeader    = 9
+	audioPacketTypeCodedFrame = 1
+)
+
+var annexBStartCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+type (
+	// Converts FLV tags to RTP packets and forwards them to the host
+	mediaWriter struct {
+		streamKey string
+		host      *whip.WHIPSession
+
+		videoReader    *rtpReader
+		videoPayloader *pionCodecs.H264Payloader
+		videoSequence  uint16
+		videoSSRC      uint32
+		naluLengthSize int
+		sps            []byte
+		pps            []byte
+
+		audioReader   *rtpReader
+		audioSequence uint16
+		audioSSRC     uint32
+
+		loggedUnsupportedVideo bool
+		loggedUnsupportedAudio bool
+	}
+
+	// Provides RTP packets to the host writers, see whip.RTPReader
+	rtpReader struct {
+		packets   chan []byte
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+)
+
+func newMediaWriter(streamKey string, host *whip.WHIPSession) *mediaWriter {
+	return &mediaWriter{
+		streamKey:      streamKey,
+		host:           host,
+		videoPayloader: &pionCodecs.H264Payloader{},
+		videoSequence:  uint16(rand.Uint32()),
+		videoSSRC:      rand.Uint32(),
+		audioSequence:  uint16(rand.Uint32()),
+		audioSSRC:      rand.Uint32(),
+	}
+}
+
+// Stop forwarding media, the host writers end once the readers are closed
+func (m *mediaWriter) close() {
+	if m.videoReader != nil {
+		m.videoReader.close()
+	}
+
+	if m.audioReader != nil {
+		m.audioReader.close()
+	}
+}
+
+func (m *mediaWriter) writeVideo(timestamp uint32, payload []byte) {
+	if len(payload) < 5 {
+		return
+	}
+
+	if payload[0]&flvVideoExHeader != 0 || payload[0]&0x0f != flvVideoCodecAVC {
+		if !m.loggedUnsupportedVideo {
+			slog.Warn("RTMP.MediaWriter.WriteVideo: Unsupported video codec, only H264 is supported", "streamKey", m.streamKey)
+			m.loggedUnsupportedVideo = true
+		}
+		return
+	}
+
+	frameType := payload[0] >> 4
+	if frameType == flvVideoFrameTypeCommand {
+		return
+	}
+
+	// Composition time is a signed 24 bit offset from the decode timestamp
+	compositionTime := int32(readUint24(payload[2:5])<<8) >> 8
+	data := payload[5:]
+
+	switch payload[1] {
+	case avcPacketSequenceHeader:
+		m.parseAVCDecoderConfiguration(data)
+		return
+	case avcPacketNALU:
+	default:
+		return
+	}
+
+	if m.naluLengthSize == 0 {
+		return
+	}
+
+	annexB := make([]byte, 0, len(data)+len(m.sps)+len(m.pps)+16)
+	hasParameterSets := false
+	isKeyframe := false
+
+	for len(data) >= m.naluLengthSize {
+		length := 0
+		for _, value := range data[:m.naluLengthSize] {
+			length = length<<8 | int(value)
+		}
+		data = data[m.naluLengthSize:]
+
+		if length <= 0 || length > len(data) {
+			break
+		}
+
+		nalu := data[:length]
+		data = data[length:]
+
+		switch nalu[0] & 0x1f {
+		case 5:
+			isKeyframe = true
+		case 7:
+			hasParameterSets = true
+		}
+
+		annexB = append(annexB, annexBStartCode...)
+		annexB = append(annexB, nalu...)
+	}
+
+	// Viewers joining at a keyframe require the parameter sets from the sequence header
+	if isKeyframe && !hasParameterSets && m.sps != nil && m.pps != nil {
+		parameterSets := make([]byte, 0, len(m.sps)+len(m.pps)+8)
+		parameterSets = append(parameterSets, annexBStartCode...)
+		parameterSets = append(parameterSets, m.sps...)
+		parameterSets = append(parameterSets, annexBStartCode...)
+		parameterSets = append(parameterSets, m.pps...)
+		annexB = append(parameterSets, annexB...)
+	}
+
+	payloads := m.videoPayloader.Payload(rtpMTU, annexB)
+	if len(payloads) == 0 {
+		return
+	}
+
+	if m.videoReader == nil {
+		m.videoReader = newRTPReader()
+		go m.host.IngestVideo(m.videoReader, codecs.VideoTrackCodecH264, m.streamKey)
+	}
+
+	rtpTimestamp := uint32((int64(timestamp) + int64(compositionTime)) * videoClockRateMillis)
+	for i, rtpPayload := range payloads {
+		m.videoReader.write(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				Marker:         i == len(payloads)-1,
+				PayloadType:    videoPayloadType,
+				SequenceNumber: m.videoSequence,
+				Timestamp:      rtpTimestamp,
+				SSRC:           m.videoSSRC,
+			},
+			Payload: rtpPayload,
+		})
+		m.videoSequence++
+	}
+}
+
+// Parse the AVCDecoderConfigurationRecord as described in ISO/IEC 14496-15 5.2.4.1
+func (m *mediaWriter) parseAVCDecoderConfiguration(data []byte) {
+	if len(data) < 7 {
+		slog.Warn("RTMP.MediaWriter.ParseAVCDecoderConfiguration: Invalid record", "streamKey", m.streamKey)
+		return
+	}
+
+	naluLengthSize := int(data[4]&0x03) + 1
+	readParameterSets := func(data []byte, count int) (first []byte, remaining []byte, ok bool) {
+		for range count {
+			if len(data) < 2 {
+				return nil, nil, false
+			}
+
+			length := int(binary.BigEndian.Uint16(data))
+			if len(data) < 2+length {
+				return nil, nil, false
+			}
+
+			if first == nil {
+				first = data[2 : 2+length]
+			}
+			data = data[2+length:]
+		}
+
+		return first, data, true
+	}
+
+	sps, data, ok := readParameterSets(data[6:], int(data[5]&0x1f))
+	if !ok || len(data) < 1 {
+		slog.Warn("RTMP.MediaWriter.ParseAVCDecoderConfiguration: Invalid SPS", "streamKey", m.streamKey)
+		return
+	}
+
+	pps, _, ok := readParameterSets(data[1:], int(data[0]))
+	if !ok {
+		slog.Warn("RTMP.MediaWriter.ParseAVCDecoderConfiguration: Invalid PPS", "streamKey", m.streamKey)
+		return
+	}
+
+	slog.Debug("RTMP.MediaWriter.ParseAVCDecoderConfiguration", "streamKey", m.streamKey)
+	m.naluLengthSize = naluLengthSize
+	m.sps = sps
+	m.pps = pps
+}
+
+func (m *mediaWriter) writeAudio(timestamp uint32, payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+
+	soundFormat := payload[0] >> 4
+	if soundFormat != flvAudioFormatExHeader || len(payload) < 5 || string(payload[1:5]) != "Opus" {
+		if !m.loggedUnsupportedAudio {
+			if soundFormat == flvAudioFormatAAC {
+				slog.Warn("RTMP.MediaWriter.WriteAudio: AAC is not supported by WebRTC viewers, configure the encoder to send Opus", "streamKey", m.streamKey)
+			} else {
+				slog.Warn("RTMP.MediaWriter.WriteAudio: Unsupported audio codec, only Opus is supported", "streamKey", m.streamKey)
+			}
+			m.loggedUnsupportedAudio = true
+		}
+		return
+	}
+
+	if payload[0]&0x0f != audioPacketTypeCodedFrame || len(payload) == 5 {
+		return
+	}
+
+	if m.audioReader == nil {
+		m.audioReader = newRTPReader()
+		go m.host.IngestAudio(m.audioReader, codecs.AudioTrackCodecOpus, m.streamKey)
+	}
+
+	m.audioReader.write(&rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    audioPayloadType,
+			SequenceNumber: m.audioSequence,
+			Timestamp:      timestamp * audioClockRateMillis,
+			SSRC:           m.audioSSRC,
+		},
+		Payload: payload[5:],
+	})
+	m.audioSequence++
+}
+
+func newRTPReader() *rtpReader {
+	return &rtpReader{
+		packets: make(chan []byte, rtpReaderBufferSize),
+		done:    make(chan struct{}),
+	}
+}
+
+func (r *rtpReader) Read(b []byte) (int, interceptor.Attributes, error) {
+	select {
+	case packet := <-r.packets:
+		return copy(b, packet), nil, nil
+	case <-r.done:
+		return 0, nil, io.EOF
+	}
+}
+
+// Queue a packet for the host, packets are dropped when the host does not keep up
+func (r *rtpReader) write(packet *rtp.Packet) {
+	data, err := packet.Marshal()
+	if err != nil {
+		slog.Debug("RTMP.RTPReader.Marshal.Error", "error", err)
+		return
+	}
+
+	select {
+	case r.packets <- data:
+	case <-r.done:
+	default:
+	}
+}
+
+func (r *rtpReader) close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
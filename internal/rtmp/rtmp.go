@@ -0,0 +1,45 @@
+package rtmp
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+// Streams are published to rtmp://host/live/{streamKey}
+const applicationName = "live"
+
+// Start accepting RTMP connections when an address is configured
+func Setup() {
+	address := os.Getenv(environment.RTMPAddress)
+	if address == "" {
+		return
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		slog.Error("RTMP.Listen.Error", "address", address, "error", err)
+		os.Exit(1)
+	}
+
+	slog.Info("Starting RTMP server", "address", address)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+
+				slog.Warn("RTMP.Accept.Error", "error", err)
+				continue
+			}
+
+			go handleConnection(conn)
+		}
+	}()
+}
@@ -0,0 +1,184 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+func TestAMF0RoundTrip(t *testing.T) {
+	payload := encodeAMF0("connect", 1, map[string]any{
+		"app":   "live",
+		"video": true,
+		"nested": map[string]any{
+			"value": 2.5,
+		},
+	}, nil)
+
+	values, err := decodeAMF0(payload)
+	if err != nil {
+		t.Fatalf("decodeAMF0() error = %v", err)
+	}
+
+	if len(values) != 4 || values[0] != "connect" || values[1] != float64(1) || values[3] != nil {
+		t.Fatalf("decodeAMF0() = %v", values)
+	}
+
+	object, ok := values[2].(map[string]any)
+	if !ok || object["app"] != "live" || object["video"] != true {
+		t.Fatalf("decodeAMF0() object = %v", values[2])
+	}
+
+	if nested, ok := object["nested"].(map[string]any); !ok || nested["value"] != 2.5 {
+		t.Fatalf("decodeAMF0() nested = %v", object["nested"])
+	}
+}
+
+func TestPublish(t *testing.T) {
+	t.Setenv(environment.StreamProfilePath, t.TempDir())
+	t.Setenv(environment.StreamProfilePolicy, "")
+	t.Setenv(environment.WebhookURL, "")
+
+	manager.SessionsManager = &manager.SessionManager{}
+	manager.SessionsManager.Setup()
+
+	serverConn, clientConn := net.Pipe()
+	defer func() {
+		_ = clientConn.Close()
+	}()
+
+	go handleConnection(serverConn)
+
+	if err := clientConn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	clientReader := bufio.NewReader(clientConn)
+	clientWriter := bufio.NewWriter(clientConn)
+
+	// C0 and C1, the S0 S1 S2 response is followed by C2
+	if _, err := clientWriter.Write(append([]byte{handshakeVersion}, make([]byte, handshakeSize)...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientReader.Discard(1 + 2*handshakeSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientWriter.Write(make([]byte, handshakeSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := newChunkWriter(clientWriter)
+	reader := newChunkReader(clientReader)
+
+	sendCommand := func(streamID uint32, values ...any) {
+		t.Helper()
+		if err := writer.writeMessage(chunkStreamInvoke, messageCommandAMF0, streamID, encodeAMF0(values...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Wait for a command response, applying the chunk size of the server
+	readCommand := func(name string) []any {
+		t.Helper()
+		for {
+			message, err := reader.readMessage()
+			if err != nil {
+				t.Fatalf("readMessage() error = %v", err)
+			}
+
+			switch message.typeID {
+			case messageSetChunkSize:
+				reader.chunkSize = binary.BigEndian.Uint32(message.payload)
+			case messageCommandAMF0:
+				values, err := decodeAMF0(message.payload)
+				if err != nil {
+					t.Fatalf("decodeAMF0() error = %v", err)
+				}
+
+				if values[0] == name {
+					return values
+				}
+			}
+		}
+	}
+
+	sendCommand(0, "connect", 1, map[string]any{"app": "live", "flashVer": "FMLE/3.0"})
+	readCommand("_result")
+
+	sendCommand(0, "createStream", 2, nil)
+	if values := readCommand("_result"); values[3] != float64(publishStreamID) {
+		t.Fatalf("createStream _result = %v", values)
+	}
+
+	sendCommand(publishStreamID, "publish", 0, nil, "rtmp-test", "live")
+	status := readCommand("onStatus")
+	if info, _ := status[3].(map[string]any); info["code"] != "NetStream.Publish.Start" {
+		t.Fatalf("publish onStatus = %v", status)
+	}
+
+	// AVC sequence header followed by a keyframe, the message is split over multiple chunks
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xe4}
+	pps := []byte{0x68, 0xce, 0x38, 0x80}
+	sequenceHeader := []byte{0x17, avcPacketSequenceHeader, 0, 0, 0, 1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+	sequenceHeader = binary.BigEndian.AppendUint16(sequenceHeader, uint16(len(sps)))
+	sequenceHeader = append(sequenceHeader, sps...)
+	sequenceHeader = append(sequenceHeader, 1)
+	sequenceHeader = binary.BigEndian.AppendUint16(sequenceHeader, uint16(len(pps)))
+	sequenceHeader = append(sequenceHeader, pps...)
+
+	if err := writer.writeMessage(6, messageVideo, publishStreamID, sequenceHeader); err != nil {
+		t.Fatal(err)
+	}
+
+	idr := append([]byte{0x65, 0x88}, make([]byte, 3000)...)
+	keyframe := []byte{0x17, avcPacketNALU, 0, 0, 0}
+	keyframe = binary.BigEndian.AppendUint32(keyframe, uint32(len(idr)))
+	keyframe = append(keyframe, idr...)
+
+	if err := writer.writeMessage(6, messageVideo, publishStreamID, keyframe); err != nil {
+		t.Fatal(err)
+	}
+
+	session, ok := manager.SessionsManager.GetSessionByID("rtmp-test")
+	if !ok {
+		t.Fatal("session was not created")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		host := session.Host.Load()
+		if host != nil {
+			host.TracksLock.RLock()
+			track := host.VideoTracks["Video"]
+			host.TracksLock.RUnlock()
+
+			// STAP-A with the parameter sets followed by the fragmented keyframe
+			if track != nil && track.PacketsReceived.Load() >= 4 {
+				break
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("video packets were not received by the host")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sendCommand(publishStreamID, "deleteStream", 3, nil, publishStreamID)
+
+	deadline = time.Now().Add(5 * time.Second)
+	for session.Host.Load() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("host was not removed after the stream ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
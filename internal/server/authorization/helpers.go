@@ -1,10 +1,9 @@
 package authorization
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/google/uuid"
@@ -15,95 +14,46 @@ func assureProfilePath() {
 
 	err := os.MkdirAll(profilePath, os.ModePerm)
 	if err != nil {
-		log.Println("Authorization: Error creating profile path folder folder:", err)
+		slog.Error("Authorization: Error creating profile path folder", "error", err)
 		return
 	}
 }
 
-func hasExistingStreamKey(streamKey string) bool {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	files, err := os.ReadDir(profilePath)
-
+// Returns the stored profile of the bearer token, when the token may be used for the scope
+func getProfileByBearerToken(bearerToken string, scope TokenScope) (*StoredProfile, error) {
+	store, err := getProfileStore()
 	if err != nil {
-		log.Println("Authorization: Error reading profile directory", err)
-		return false
-	}
-
-	filePrefix := streamKey + "_"
-	for _, file := range files {
-		if !file.IsDir() && strings.HasPrefix(file.Name(), filePrefix) {
-			return true
-		}
+		return nil, err
 	}
 
-	return false
-}
-
-func hasExistingBearerToken(bearerToken string) bool {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-
-	files, err := os.ReadDir(profilePath)
+	tokenHash := hashToken(bearerToken)
+	profile, err := store.GetByTokenHash(tokenHash)
 	if err != nil {
-		log.Println("Authorization: Error reading profile directory", err)
-		return false
+		return nil, err
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), bearerToken) {
-			return true
-		}
+	if err := profile.getToken(tokenHash).authorize(scope, time.Now()); err != nil {
+		return nil, err
 	}
 
-	return false
+	return profile, nil
 }
 
-func getProfileFileNameByStreamKey(streamKey string) (string, error) {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-
-	files, err := os.ReadDir(profilePath)
+// Returns the stored profile reserved for the stream key
+func getProfileByStreamKey(streamKey string) (*StoredProfile, error) {
+	store, err := getProfileStore()
 	if err != nil {
-		log.Println("Authorization: Error reading profile directory", err)
-		return "", err
-	}
-
-	for _, file := range files {
-		fileToken := strings.Split(file.Name(), "_")
-
-		if !file.IsDir() && strings.EqualFold(streamKey, fileToken[0]) {
-			return file.Name(), nil
-		}
-	}
-
-	return "", fmt.Errorf("could not find profile file")
-}
-
-func getProfileFileNameByBearerToken(bearerToken string) (string, error) {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-
-	files, err := os.ReadDir(profilePath)
-	if err != nil {
-		log.Println("Authorization: Error reading profile directory", err)
-		return "", err
-	}
-
-	separator := "_"
-	for _, file := range files {
-		splitIndex := strings.LastIndex(file.Name(), separator)
-		fileToken := file.Name()[splitIndex+len(separator):]
-
-		if !file.IsDir() && strings.EqualFold(bearerToken, fileToken) {
-			return file.Name(), nil
-		}
+		return nil, err
 	}
 
-	return "", fmt.Errorf("could not find profile file")
+	return store.GetByStreamKey(streamKey)
 }
 
-func generateToken() string {
+func generateToken(store ProfileStore) string {
 	token := uuid.New().String()
 
-	if hasExistingBearerToken(token) {
-		return generateToken()
+	if _, err := store.GetByTokenHash(hashToken(token)); err == nil {
+		return generateToken(store)
 	}
 
 	return token
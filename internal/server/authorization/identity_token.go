@@ -0,0 +1,212 @@
+package authorization
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+// Actions an identity token may grant
+const (
+	IdentityActionPublish = "publish"
+	IdentityActionWatch   = "watch"
+)
+
+const (
+	defaultStreamKeyClaim = "sub"
+	defaultMOTDClaim      = "motd"
+	defaultPublicClaim    = "is_public"
+	defaultActionsClaim   = "actions"
+
+	// Allowed difference between the clocks of the identity provider and the server
+	identityTokenLeeway = time.Minute
+)
+
+var ErrIdentityTokenInvalid = errors.New("authorization: identity token is invalid")
+
+// Claims of a JWT issued by an identity provider, mapped to a stream
+type IdentityClaims struct {
+	StreamKey string
+	MOTD      string
+	IsPublic  bool
+	Actions   []string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// Returns true when JWTs of an identity provider are accepted, by configuring a key set file or an inline key set
+func IsIdentityTokenEnabled() bool {
+	return os.Getenv(environment.JWTJWKSPath) != "" || os.Getenv(environment.JWTJWKS) != ""
+}
+
+// Returns the claims of the identity token sent as bearer token of the authorization header.
+// Nil claims are returned when identity tokens are disabled or the bearer token is not a JWT of an identity provider.
+func GetIdentityTokenClaims(authHeader string) (*IdentityClaims, error) {
+	bearerToken, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok || !IsIdentityTokenEnabled() || strings.Count(bearerToken, ".") != 2 || IsViewerToken(bearerToken) {
+		return nil, nil
+	}
+
+	claims, err := ParseIdentityToken(bearerToken)
+	if err != nil {
+		slog.Warn("Authorization: Identity token was rejected", "error", err)
+		return nil, ErrIdentityTokenInvalid
+	}
+
+	return claims, nil
+}
+
+// Verifies an identity token against the configured key set, issuer and audience, and maps its claims
+func ParseIdentityToken(token string) (*IdentityClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a JWT")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+
+	keys, err := getVerificationKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifySignature(keys, header.KeyID, header.Algorithm, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+
+	return mapIdentityClaims(claims, time.Now())
+}
+
+// Validates the registered claims and maps the configured claims to the stream
+func mapIdentityClaims(claims map[string]any, now time.Time) (*IdentityClaims, error) {
+	expiresAt, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+
+	if now.Add(-identityTokenLeeway).Unix() >= int64(expiresAt) {
+		return nil, errors.New("token has expired")
+	}
+
+	if notBefore, ok := claims["nbf"].(float64); ok && now.Add(identityTokenLeeway).Unix() < int64(notBefore) {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	if issuer := os.Getenv(environment.JWTIssuer); issuer != "" && claims["iss"] != issuer {
+		return nil, fmt.Errorf("token issuer %v is not %s", claims["iss"], issuer)
+	}
+
+	if audience := os.Getenv(environment.JWTAudience); audience != "" && !slices.Contains(getStringsClaim(claims["aud"]), audience) {
+		return nil, fmt.Errorf("token audience %v does not contain %s", claims["aud"], audience)
+	}
+
+	streamKey, _ := claims[getClaimName(environment.JWTStreamKeyClaim, defaultStreamKeyClaim)].(string)
+	if !isValidStreamKey(streamKey) {
+		return nil, errors.New("token has no valid stream key")
+	}
+
+	identityClaims := &IdentityClaims{
+		StreamKey: streamKey,
+		MOTD:      "Welcome to " + streamKey + "'s stream!",
+		IsPublic:  true,
+		Actions:   getStringsClaim(claims[getClaimName(environment.JWTActionsClaim, defaultActionsClaim)]),
+		ExpiresAt: time.Unix(int64(expiresAt), 0),
+	}
+
+	if motd, ok := claims[getClaimName(environment.JWTMOTDClaim, defaultMOTDClaim)].(string); ok {
+		identityClaims.MOTD = motd
+	}
+
+	if isPublic, ok := claims[getClaimName(environment.JWTPublicClaim, defaultPublicClaim)].(bool); ok {
+		identityClaims.IsPublic = isPublic
+	}
+
+	if id, ok := claims["jti"].(string); ok {
+		identityClaims.ID = id
+	}
+
+	return identityClaims, nil
+}
+
+// Returns true when the token grants the action
+func (c *IdentityClaims) Allows(action string) bool {
+	return slices.Contains(c.Actions, action)
+}
+
+// The profile a publisher with the identity token streams with
+func (c *IdentityClaims) AsPublicProfile() *PublicProfile {
+	return &PublicProfile{
+		StreamKey: c.StreamKey,
+		IsPublic:  c.IsPublic,
+		MOTD:      c.MOTD,
+	}
+}
+
+// An identity token allowed to watch grants the same access as a viewer token for its stream key
+func (c *IdentityClaims) AsViewerTokenClaims() *ViewerTokenClaims {
+	return &ViewerTokenClaims{
+		StreamKey: c.StreamKey,
+		ID:        c.ID,
+		ExpiresAt: c.ExpiresAt.Unix(),
+	}
+}
+
+func decodeTokenPart(part string, value any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func getClaimName(variable string, defaultName string) string {
+	if name := os.Getenv(variable); name != "" {
+		return name
+	}
+
+	return defaultName
+}
+
+// Claims with several values are either an array of strings or a space separated string, as the OAuth scope claim
+func getStringsClaim(value any) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []any:
+		values := []string{}
+		for _, item := range value {
+			if item, ok := item.(string); ok {
+				values = append(values, item)
+			}
+		}
+
+		return values
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package authorization
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+func signTestIdentityToken(header map[string]any, claims map[string]any, sign func(signingInput []byte) []byte) string {
+	headerData, _ := json.Marshal(header)
+	claimsData, _ := json.Marshal(claims)
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerData) + "." + base64.RawURLEncoding.EncodeToString(claimsData)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func TestIdentityToken(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPublicKey)},
+	}})
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksPath, jwks, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(environment.JWTJWKSPath, jwksPath)
+	t.Setenv(environment.JWTIssuer, "https://id.example.com")
+	t.Setenv(environment.JWTAudience, "broadcast-box")
+
+	signEC := func(signingInput []byte) []byte {
+		digest := sha256.Sum256(signingInput)
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	signEd := func(signingInput []byte) []byte {
+		return ed25519.Sign(edKey, signingInput)
+	}
+
+	claims := map[string]any{
+		"iss":       "https://id.example.com",
+		"aud":       []string{"broadcast-box", "other"},
+		"sub":       "stream",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"motd":      "Hello",
+		"is_public": false,
+		"actions":   "publish watch",
+	}
+
+	identityClaims, err := ParseIdentityToken(signTestIdentityToken(map[string]any{"alg": "ES256", "kid": "ec"}, claims, signEC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identityClaims.StreamKey != "stream" || identityClaims.MOTD != "Hello" || identityClaims.IsPublic || !identityClaims.Allows(IdentityActionWatch) {
+		t.Fatalf("unexpected claims %+v", identityClaims)
+	}
+
+	if _, err := ParseIdentityToken(signTestIdentityToken(map[string]any{"alg": "EdDSA"}, claims, signEd)); err != nil {
+		t.Fatalf("expected a token without key ID to be verified, got %v", err)
+	}
+
+	// Tokens signed by another key, or with another algorithm than the key, are rejected
+	if _, err := ParseIdentityToken(signTestIdentityToken(map[string]any{"alg": "ES256", "kid": "ed"}, claims, signEC)); err == nil {
+		t.Fatal("expected a token with the key ID of another key to be rejected")
+	}
+
+	if _, err := ParseIdentityToken(signTestIdentityToken(map[string]any{"alg": "none"}, claims, func([]byte) []byte { return nil })); err == nil {
+		t.Fatal("expected an unsigned token to be rejected")
+	}
+
+	for name, change := range map[string]func(map[string]any){
+		"expired":       func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"issuer":        func(c map[string]any) { c["iss"] = "https://other.example.com" },
+		"audience":      func(c map[string]any) { c["aud"] = "other" },
+		"no stream key": func(c map[string]any) { delete(c, "sub") },
+	} {
+		changedClaims := maps.Clone(claims)
+		change(changedClaims)
+
+		if _, err := ParseIdentityToken(signTestIdentityToken(map[string]any{"alg": "ES256", "kid": "ec"}, changedClaims, signEC)); err == nil {
+			t.Fatalf("expected the token with %s claims to be rejected", name)
+		}
+	}
+}
+
+func TestIdentityHostProfile(t *testing.T) {
+	t.Setenv(environment.StreamProfilePath, t.TempDir())
+
+	if _, err := CreateProfile("reserved", TokenOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := GetIdentityHostProfile(&IdentityClaims{StreamKey: "stream", MOTD: "Hello", IsPublic: true})
+	if err != nil || profile.StreamKey != "stream" || profile.MOTD != "Hello" || !profile.IsPublic {
+		t.Fatalf("expected the profile of the claims, got %+v, %v", profile, err)
+	}
+
+	// Claims do not override a profile reserving the stream key
+	for _, policy := range []string{StreamPolicyWithReserved, StreamPolicyReservedOnly} {
+		t.Setenv(environment.StreamProfilePolicy, policy)
+
+		if _, err := GetIdentityHostProfile(&IdentityClaims{StreamKey: "Reserved", IsPublic: true}); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("expected %v for a reserved stream key with policy %s, got %v", ErrUnauthorized, policy, err)
+		}
+	}
+}
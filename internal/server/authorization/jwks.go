@@ -0,0 +1,336 @@
+package authorization
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+// Key of a JSON Web Key Set, RFC 7517
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC and OKP
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+
+	// Symmetric
+	K string `json:"k"`
+}
+
+// Verification key parsed from a JSON Web Key
+type verificationKey struct {
+	id        string
+	algorithm string
+	publicKey crypto.PublicKey // *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey or []byte for symmetric keys
+}
+
+var (
+	errNoVerificationKey    = errors.New("no key of the key set verifies the token")
+	errUnsupportedAlgorithm = errors.New("unsupported token algorithm")
+
+	jwksLock     sync.Mutex
+	jwksPath     string
+	jwksModified time.Time
+	jwksInline   string
+	jwksKeys     []verificationKey
+)
+
+// Returns the keys of the key set file, or of the inline key set when no file is configured.
+// The file is read again when it changed, so keys can be rotated without a restart.
+func getVerificationKeys() ([]verificationKey, error) {
+	jwksLock.Lock()
+	defer jwksLock.Unlock()
+
+	if path := os.Getenv(environment.JWTJWKSPath); path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if path == jwksPath && info.ModTime().Equal(jwksModified) {
+			return jwksKeys, nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := parseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("key set %s: %w", path, err)
+		}
+
+		jwksPath, jwksModified, jwksInline, jwksKeys = path, info.ModTime(), "", keys
+		return jwksKeys, nil
+	}
+
+	inline := os.Getenv(environment.JWTJWKS)
+	if jwksPath == "" && inline == jwksInline && jwksKeys != nil {
+		return jwksKeys, nil
+	}
+
+	keys, err := parseJWKS([]byte(inline))
+	if err != nil {
+		return nil, fmt.Errorf("inline key set: %w", err)
+	}
+
+	jwksPath, jwksModified, jwksInline, jwksKeys = "", time.Time{}, inline, keys
+	return jwksKeys, nil
+}
+
+// Parses a JSON Web Key Set, keys that are not used for signatures or of an unsupported type are skipped
+func parseJWKS(data []byte) ([]verificationKey, error) {
+	var keySet struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, err
+	}
+
+	keys := []verificationKey{}
+	for _, key := range keySet.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := key.parse()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.KeyID, err)
+		} else if publicKey == nil {
+			continue
+		}
+
+		keys = append(keys, verificationKey{
+			id:        key.KeyID,
+			algorithm: key.Algorithm,
+			publicKey: publicKey,
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("key set has no signature keys")
+	}
+
+	return keys, nil
+}
+
+func (k *jsonWebKey) parse() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		if n.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curve, ecdhCurve := getCurve(k.Curve)
+		if curve == nil {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, errors.New("invalid EC coordinates")
+		}
+
+		// Validates that the point is on the curve
+		if _, err := ecdhCurve.NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) < 32 {
+			return nil, errors.New("symmetric keys must be at least 256 bits")
+		}
+
+		return secret, nil
+	}
+
+	return nil, nil
+}
+
+// Verifies the signature of the signing input with the keys matching the key ID and algorithm
+func verifySignature(keys []verificationKey, keyID string, algorithm string, signingInput string, signature []byte) error {
+	for _, key := range keys {
+		if (keyID != "" && key.id != "" && key.id != keyID) || (key.algorithm != "" && key.algorithm != algorithm) {
+			continue
+		}
+
+		verified, err := key.verify(algorithm, signingInput, signature)
+		if err != nil {
+			return err
+		} else if verified {
+			return nil
+		}
+	}
+
+	return errNoVerificationKey
+}
+
+func (k *verificationKey) verify(algorithm string, signingInput string, signature []byte) (bool, error) {
+	hashFunc, hashType := getHash(algorithm)
+	if hashFunc == nil && algorithm != "EdDSA" {
+		return false, errUnsupportedAlgorithm
+	}
+
+	switch publicKey := k.publicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm[:2] != "RS" {
+			return false, nil
+		}
+
+		digest := getDigest(hashFunc, signingInput)
+		return rsa.VerifyPKCS1v15(publicKey, hashType, digest, signature) == nil, nil
+
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		if algorithm[:2] != "ES" || len(signature) != 2*size || getECAlgorithm(publicKey.Curve) != algorithm {
+			return false, nil
+		}
+
+		r, s := new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(publicKey, getDigest(hashFunc, signingInput), r, s), nil
+
+	case ed25519.PublicKey:
+		return algorithm == "EdDSA" && ed25519.Verify(publicKey, []byte(signingInput), signature), nil
+
+	case []byte:
+		if algorithm[:2] != "HS" {
+			return false, nil
+		}
+
+		mac := hmac.New(hashFunc, publicKey)
+		mac.Write([]byte(signingInput))
+		return hmac.Equal(mac.Sum(nil), signature), nil
+	}
+
+	return false, nil
+}
+
+func getHash(algorithm string) (func() hash.Hash, crypto.Hash) {
+	if len(algorithm) != 5 {
+		return nil, 0
+	}
+
+	switch algorithm[:2] {
+	case "RS", "ES", "HS":
+	default:
+		return nil, 0
+	}
+
+	switch algorithm[2:] {
+	case "256":
+		return sha256.New, crypto.SHA256
+	case "384":
+		return sha512.New384, crypto.SHA384
+	case "512":
+		return sha512.New, crypto.SHA512
+	}
+
+	return nil, 0
+}
+
+func getDigest(hashFunc func() hash.Hash, signingInput string) []byte {
+	digest := hashFunc()
+	digest.Write([]byte(signingInput))
+	return digest.Sum(nil)
+}
+
+func getCurve(name string) (elliptic.Curve, ecdh.Curve) {
+	switch name {
+	case "P-256":
+		return elliptic.P256(), ecdh.P256()
+	case "P-384":
+		return elliptic.P384(), ecdh.P384()
+	case "P-521":
+		return elliptic.P521(), ecdh.P521()
+	}
+
+	return nil, nil
+}
+
+// Each curve is used with one algorithm, RFC 7518 section 3.4
+func getECAlgorithm(curve elliptic.Curve) string {
+	switch curve {
+	case elliptic.P256():
+		return "ES256"
+	case elliptic.P384():
+		return "ES384"
+	case elliptic.P521():
+		return "ES512"
+	}
+
+	return ""
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid integer")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
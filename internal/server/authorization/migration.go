@@ -0,0 +1,81 @@
+package authorization
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+// Imports the profiles stored as one file per profile, named {streamKey}_{token}, into the profile store.
+// Imported files are removed, so tokens are no longer kept in plaintext. Files that could not be imported are kept.
+func MigrateProfiles() (imported int, err error) {
+	store, err := getProfileStore()
+	if err != nil {
+		return 0, err
+	}
+
+	profilePath := os.Getenv(environment.StreamProfilePath)
+	for _, fileName := range getLegacyProfileFileNames(profilePath) {
+		filePath := filepath.Join(profilePath, fileName)
+		splitIndex := strings.LastIndex(fileName, "_")
+		streamKey, token := fileName[:splitIndex], fileName[splitIndex+1:]
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			slog.Error("Authorization.MigrateProfiles: Error reading profile", "fileName", fileName, "error", err)
+			continue
+		}
+
+		var profile StoredProfile
+		if err := json.Unmarshal(data, &profile); err != nil {
+			slog.Error("Authorization.MigrateProfiles: Profile could not be read, file may be corrupt", "fileName", fileName, "error", err)
+			continue
+		}
+
+		profile.StreamKey = streamKey
+		profile.TokenHash = hashToken(token)
+		profile.upgradeLegacyToken()
+
+		if err := store.Create(profile); errors.Is(err, ErrProfileExists) {
+			slog.Warn("Authorization.MigrateProfiles: Profile already exists in the profile store", "streamKey", streamKey)
+			continue
+		} else if err != nil {
+			return imported, err
+		}
+
+		if err := os.Remove(filePath); err != nil {
+			slog.Warn("Authorization.MigrateProfiles: Error removing migrated profile file", "fileName", fileName, "error", err)
+		}
+
+		slog.Info("Authorization.MigrateProfiles: Imported profile", "streamKey", streamKey)
+		imported++
+	}
+
+	return imported, nil
+}
+
+// Returns the names of the files in the profile path that are profiles named {streamKey}_{token}
+func getLegacyProfileFileNames(profilePath string) (fileNames []string) {
+	files, err := os.ReadDir(profilePath)
+	if err != nil {
+		return nil
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || name == profileStoreFileName {
+			continue
+		}
+
+		if splitIndex := strings.LastIndex(name, "_"); splitIndex > 0 && splitIndex < len(name)-1 && isValidStreamKey(name[:splitIndex]) {
+			fileNames = append(fileNames, name)
+		}
+	}
+
+	return fileNames
+}
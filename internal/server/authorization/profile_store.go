@@ -0,0 +1,98 @@
+package authorization
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+// Name of the profile store file in the stream profile path
+const profileStoreFileName = "profiles.json"
+
+var (
+	ErrProfileNotFound = errors.New("profile was not found")
+	ErrProfileExists   = errors.New("profile already exists")
+)
+
+// Persists stream profiles, indexed by stream key and token hash.
+// Stream keys are matched case-insensitively.
+type ProfileStore interface {
+	GetByStreamKey(streamKey string) (*StoredProfile, error)
+
+	// Returns the profile having a token with the hash
+	GetByTokenHash(tokenHash string) (*StoredProfile, error)
+
+	// Returns all profiles ordered by stream key
+	List() ([]StoredProfile, error)
+
+	// Adds a profile, fails with ErrProfileExists when the stream key or one of its token hashes is in use
+	Create(profile StoredProfile) error
+
+	// Replaces the profile with the same stream key and its tokens, fails with ErrProfileNotFound when there is none
+	Update(profile StoredProfile) error
+
+	Delete(streamKey string) error
+}
+
+var (
+	profileStoreLock sync.Mutex
+	profileStore     ProfileStore
+	profileStorePath string
+	isStoreExplicit  bool
+)
+
+// Replaces the profile store, such as with a store of another backend.
+// A nil store returns to the file in the stream profile path.
+func SetProfileStore(store ProfileStore) {
+	profileStoreLock.Lock()
+	defer profileStoreLock.Unlock()
+
+	profileStore = store
+	profileStorePath = ""
+	isStoreExplicit = store != nil
+}
+
+// Returns the profile store, opening the store file of the stream profile path when it changed
+func getProfileStore() (ProfileStore, error) {
+	profileStoreLock.Lock()
+	defer profileStoreLock.Unlock()
+
+	if isStoreExplicit {
+		return profileStore, nil
+	}
+
+	profilePath := os.Getenv(environment.StreamProfilePath)
+	storePath := filepath.Join(profilePath, profileStoreFileName)
+	if profileStore != nil && profileStorePath == storePath {
+		return profileStore, nil
+	}
+
+	assureProfilePath()
+	store, err := NewJSONProfileStore(storePath)
+	if err != nil {
+		slog.Error("Authorization: Error opening profile store", "path", storePath, "error", err)
+		return nil, err
+	}
+
+	if legacyProfiles := getLegacyProfileFileNames(profilePath); len(legacyProfiles) != 0 {
+		slog.Warn("Authorization: Found stream profiles that are not migrated to the profile store, run with -migrateProfiles to import them", "count", len(legacyProfiles))
+	}
+
+	profileStore = store
+	profileStorePath = storePath
+
+	return profileStore, nil
+}
+
+// Tokens are stored as SHA-256 hashes. Tokens are compared case-insensitively.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(token)))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,230 @@
+package authorization
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const jsonProfileStoreVersion = 2
+
+// Profile store keeping all profiles in a single JSON file.
+// Profiles are held in memory and the file is replaced atomically on every change.
+type jsonProfileStore struct {
+	lock     sync.RWMutex
+	path     string
+	profiles map[string]StoredProfile // By lower case stream key
+	tokens   map[string]string        // Lower case stream key by the hash of each token
+}
+
+type jsonProfileStoreFile struct {
+	Version  int             `json:"version"`
+	Profiles []StoredProfile `json:"profiles"`
+}
+
+// Opens the JSON profile store at the path, the file is created with the first profile
+func NewJSONProfileStore(path string) (ProfileStore, error) {
+	store := &jsonProfileStore{
+		path:     path,
+		profiles: map[string]StoredProfile{},
+		tokens:   map[string]string{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var file jsonProfileStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	for _, profile := range file.Profiles {
+		profile.upgradeLegacyToken()
+		store.addLocked(profile)
+	}
+
+	return store, nil
+}
+
+func (s *jsonProfileStore) GetByStreamKey(streamKey string) (*StoredProfile, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	profile, ok := s.profiles[strings.ToLower(streamKey)]
+	if !ok {
+		return nil, ErrProfileNotFound
+	}
+
+	// Callers may change the returned tokens, the stored profile only changes through Update
+	profile.Tokens = slices.Clone(profile.Tokens)
+	return &profile, nil
+}
+
+func (s *jsonProfileStore) GetByTokenHash(tokenHash string) (*StoredProfile, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	profile, ok := s.profiles[s.tokens[tokenHash]]
+	if !ok {
+		return nil, ErrProfileNotFound
+	}
+
+	profile.Tokens = slices.Clone(profile.Tokens)
+	return &profile, nil
+}
+
+func (s *jsonProfileStore) List() ([]StoredProfile, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.listLocked(), nil
+}
+
+func (s *jsonProfileStore) Create(profile StoredProfile) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.profiles[strings.ToLower(profile.StreamKey)]; ok {
+		return ErrProfileExists
+	}
+
+	if s.hasTokenOfOtherProfileLocked(profile) {
+		return ErrProfileExists
+	}
+
+	s.addLocked(profile)
+	if err := s.saveLocked(); err != nil {
+		s.removeLocked(profile.StreamKey)
+		return err
+	}
+
+	return nil
+}
+
+func (s *jsonProfileStore) Update(profile StoredProfile) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous, ok := s.profiles[strings.ToLower(profile.StreamKey)]
+	if !ok {
+		return ErrProfileNotFound
+	}
+
+	if s.hasTokenOfOtherProfileLocked(profile) {
+		return ErrProfileExists
+	}
+
+	s.removeLocked(previous.StreamKey)
+	s.addLocked(profile)
+	if err := s.saveLocked(); err != nil {
+		s.removeLocked(profile.StreamKey)
+		s.addLocked(previous)
+		return err
+	}
+
+	return nil
+}
+
+func (s *jsonProfileStore) Delete(streamKey string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous, ok := s.profiles[strings.ToLower(streamKey)]
+	if !ok {
+		return ErrProfileNotFound
+	}
+
+	s.removeLocked(streamKey)
+	if err := s.saveLocked(); err != nil {
+		s.addLocked(previous)
+		return err
+	}
+
+	return nil
+}
+
+func (s *jsonProfileStore) addLocked(profile StoredProfile) {
+	streamKey := strings.ToLower(profile.StreamKey)
+	s.profiles[streamKey] = profile
+	for _, token := range profile.Tokens {
+		s.tokens[token.Hash] = streamKey
+	}
+}
+
+func (s *jsonProfileStore) removeLocked(streamKey string) {
+	streamKey = strings.ToLower(streamKey)
+	if profile, ok := s.profiles[streamKey]; ok {
+		for _, token := range profile.Tokens {
+			delete(s.tokens, token.Hash)
+		}
+		delete(s.profiles, streamKey)
+	}
+}
+
+// Returns true if a token hash of the profile belongs to another profile
+func (s *jsonProfileStore) hasTokenOfOtherProfileLocked(profile StoredProfile) bool {
+	for _, token := range profile.Tokens {
+		if streamKey, ok := s.tokens[token.Hash]; ok && streamKey != strings.ToLower(profile.StreamKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *jsonProfileStore) listLocked() []StoredProfile {
+	profiles := make([]StoredProfile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profile.Tokens = slices.Clone(profile.Tokens)
+		profiles = append(profiles, profile)
+	}
+
+	slices.SortFunc(profiles, func(a, b StoredProfile) int {
+		return strings.Compare(strings.ToLower(a.StreamKey), strings.ToLower(b.StreamKey))
+	})
+
+	return profiles
+}
+
+// Writes the profiles to a temporary file that replaces the store file, readers never see a partially written file
+func (s *jsonProfileStore) saveLocked() error {
+	data, err := json.MarshalIndent(jsonProfileStoreFile{
+		Version:  jsonProfileStoreVersion,
+		Profiles: s.listLocked(),
+	}, "", " ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), s.path)
+}
@@ -0,0 +1,139 @@
+package authorization
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+func TestJSONProfileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), profileStoreFileName)
+
+	store, err := NewJSONProfileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Create(StoredProfile{StreamKey: "Stream", Tokens: []StoredToken{{Hash: hashToken("token")}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Create(StoredProfile{StreamKey: "stream", Tokens: []StoredToken{{Hash: hashToken("other")}}}); !errors.Is(err, ErrProfileExists) {
+		t.Fatalf("expected %v for a stream key in use, got %v", ErrProfileExists, err)
+	}
+
+	if err := store.Update(StoredProfile{StreamKey: "Stream", Tokens: []StoredToken{{Hash: hashToken("new")}}, MOTD: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.GetByTokenHash(hashToken("token")); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected the previous token to be removed, got %v", err)
+	}
+
+	// Profiles are persisted and the index is rebuilt when the store is opened again
+	store, err = NewJSONProfileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := store.GetByTokenHash(hashToken("NEW"))
+	if err != nil || profile.StreamKey != "Stream" || profile.MOTD != "Hello" {
+		t.Fatalf("unexpected profile %+v, %v", profile, err)
+	}
+
+	if err := store.Delete("stream"); err != nil {
+		t.Fatal(err)
+	}
+
+	if profiles, _ := store.List(); len(profiles) != 0 {
+		t.Fatalf("expected no profiles, got %+v", profiles)
+	}
+}
+
+func TestMigrateProfiles(t *testing.T) {
+	profilePath := t.TempDir()
+	t.Setenv(environment.StreamProfilePath, profilePath)
+
+	legacyFileName := "my_stream_1f0c9d5e-5c3b-4a53-9d6e-2b7f1b1c9a10"
+	if err := os.WriteFile(filepath.Join(profilePath, legacyFileName), []byte(`{"FileName": "`+legacyFileName+`", "IsPublic": true, "MOTD": "Hi"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := MigrateProfiles()
+	if err != nil || imported != 1 {
+		t.Fatalf("expected one imported profile, got %d, %v", imported, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(profilePath, legacyFileName)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected the migrated profile file to be removed")
+	}
+
+	profile, err := GetPersonalProfile("1f0c9d5e-5c3b-4a53-9d6e-2b7f1b1c9a10")
+	if err != nil || profile.StreamKey != "my_stream" || !profile.IsPublic || profile.MOTD != "Hi" {
+		t.Fatalf("unexpected profile %+v, %v", profile, err)
+	}
+}
+
+func TestProfileTokenScopes(t *testing.T) {
+	t.Setenv(environment.StreamProfilePath, t.TempDir())
+
+	if _, err := CreateProfile("stream", TokenOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	publishToken, err := AddProfileToken("stream", TokenOptions{Label: "encoder", Scopes: []TokenScope{ScopePublish}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetPublicProfile(publishToken); err != nil {
+		t.Fatalf("expected the publish token to publish, got %v", err)
+	}
+
+	if _, err := GetPersonalProfile(publishToken); !errors.Is(err, ErrTokenScope) {
+		t.Fatalf("expected %v for the profile of a publish token, got %v", ErrTokenScope, err)
+	}
+
+	if IsStreamModerator(publishToken, "stream") {
+		t.Fatal("expected the publish token not to moderate")
+	}
+
+	// Tokens expire without being removed from the profile
+	expiresAt := time.Now().Add(time.Hour)
+	expiringToken, err := AddProfileToken("stream", TokenOptions{ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile, err := getProfileByStreamKey("stream")
+	if err != nil || len(profile.Tokens) != 3 {
+		t.Fatalf("expected three tokens, got %+v, %v", profile, err)
+	}
+
+	if err := profile.getToken(hashToken(expiringToken)).authorize(ScopePublish, expiresAt); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("expected %v after the expiry, got %v", ErrTokenExpired, err)
+	}
+
+	// Resetting without an ID replaces every token
+	token, err := ResetProfileToken("stream", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetPublicProfile(publishToken); !errors.Is(err, ErrProfileNotFound) {
+		t.Fatalf("expected the previous tokens to be removed, got %v", err)
+	}
+
+	if !IsStreamModerator(token, "stream") {
+		t.Fatal("expected the reset token to have every scope")
+	}
+
+	// Stream keys are matched case-insensitively, like profiles are looked up
+	if !IsStreamModerator(token, "Stream") || IsStreamModerator(token, "other") {
+		t.Fatal("expected the token to moderate the stream key in any case only")
+	}
+}
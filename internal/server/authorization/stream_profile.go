@@ -1,12 +1,14 @@
 package authorization
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
 )
@@ -17,47 +19,42 @@ const (
 	StreamPolicyReservedOnly = "RESERVED"
 )
 
+var ErrUnauthorized = errors.New("authorization: unauthorized")
+
+// Stream keys consist of letters, numbers, dash and underscore only, so they never contain the dots of a JWT
 func isValidStreamKey(streamKey string) bool {
-	regExp := regexp.MustCompile(`[\p{L}\p{N}_-]+`)
+	regExp := regexp.MustCompile(`^[\p{L}\p{N}_-]+$`)
 	return regExp.MatchString(streamKey)
 }
 
-// Create a new profile for the provided streamkey
-func CreateProfile(streamKey string) (string, error) {
+// Create a new profile for the provided streamkey, the token of the profile is returned
+func CreateProfile(streamKey string, options TokenOptions) (string, error) {
 
 	if !isValidStreamKey(streamKey) {
-		log.Println("Authorization: Create profile failed due to invalid streamkey", streamKey)
+		slog.Warn("Authorization: Create profile failed due to invalid streamkey", "streamKey", streamKey)
 		return "", fmt.Errorf("streamkey has invalid characters, only numbers, letters, dash and underscore allowed")
 	}
 
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	assureProfilePath()
-
-	if hasExistingStreamKey(streamKey) {
-		return "", fmt.Errorf("%s", "A profile with the stream key "+streamKey+" already exists")
-	}
-
-	token := generateToken()
-
-	fileName := streamKey + "_" + token
-	profileFilePath := filepath.Join(profilePath, fileName)
-	profile := profile{
-		FileName: fileName,
-		IsPublic: true,
-		MOTD:     "Welcome to " + streamKey + "!",
+	store, err := getProfileStore()
+	if err != nil {
+		return "", err
 	}
 
-	jsonData, err := json.MarshalIndent(profile, "", " ")
+	token, storedToken, err := newStoredToken(store, options)
 	if err != nil {
-		log.Println("Authorization: Error ocurred while trying to create profile")
-		log.Println(err)
 		return "", err
 	}
 
-	err = os.WriteFile(profileFilePath, jsonData, 0644)
-	if err != nil {
-		log.Println("Authorization: Error ocurred while trying to create profile")
-		log.Println(err)
+	err = store.Create(StoredProfile{
+		StreamKey: streamKey,
+		Tokens:    []StoredToken{storedToken},
+		IsPublic:  true,
+		MOTD:      "Welcome to " + streamKey + "!",
+	})
+	if errors.Is(err, ErrProfileExists) {
+		return "", fmt.Errorf("%s", "A profile with the stream key "+streamKey+" already exists")
+	} else if err != nil {
+		slog.Error("Authorization: Error ocurred while trying to create profile", "streamKey", streamKey, "error", err)
 		return "", err
 	}
 
@@ -66,14 +63,13 @@ func CreateProfile(streamKey string) (string, error) {
 
 // Update a current profile
 func UpdateProfile(token string, motd string, isPublic bool) error {
-	if !hasExistingBearerToken(token) {
-		return fmt.Errorf("profile was not found")
+	store, err := getProfileStore()
+	if err != nil {
+		return err
 	}
 
-	profile, err := GetPersonalProfile(token)
+	profile, err := getProfileByBearerToken(token, ScopeProfile)
 	if err != nil {
-		log.Println("Authorization: Could not find personal profile")
-		log.Println(err)
 		return err
 	}
 
@@ -81,137 +77,172 @@ func UpdateProfile(token string, motd string, isPublic bool) error {
 	profile.MOTD = motd
 	profile.IsPublic = isPublic
 
-	jsonData, err := json.MarshalIndent(profile, "", " ")
-	if err != nil {
-		log.Println("Authorization: Error ocurred while trying to update profile")
-		log.Println(err)
+	if err := store.Update(*profile); err != nil {
+		slog.Error("Authorization: Error ocurred while trying to update profile", "streamKey", profile.StreamKey, "error", err)
 		return err
 	}
 
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	profileFilePath, err := getProfileFileNameByBearerToken(token)
+	slog.Info("Authorization: Updated Profile", "streamKey", profile.StreamKey)
+	return nil
+}
+
+// Set whether streams using the profile of the provided stream key are recorded
+func UpdateProfileRecording(streamKey string, record bool) error {
+	store, err := getProfileStore()
 	if err != nil {
-		log.Println("Authorization: Error ocurred while trying to update profile")
-		log.Println(err)
 		return err
 	}
 
-	log.Println("Authorization: Updated Profile", profile.StreamKey)
-	err = os.WriteFile(filepath.Join(profilePath, profileFilePath), jsonData, 0644)
+	profile, err := store.GetByStreamKey(streamKey)
 	if err != nil {
-		log.Println("Authorization: Error ocurred while trying to update profile")
-		log.Println(err)
 		return err
 	}
 
+	profile.Record = record
+
+	if err := store.Update(*profile); err != nil {
+		slog.Error("Authorization: Error ocurred while trying to update profile recording", "streamKey", streamKey, "error", err)
+		return err
+	}
+
+	slog.Info("Authorization: Updated Profile recording", "streamKey", streamKey, "record", record)
 	return nil
 }
 
 func RemoveProfile(streamKey string) (bool, error) {
 	if !isValidStreamKey(streamKey) {
-		log.Println("Authorization: Remove profile failed due to invalid streamkey", streamKey)
+		slog.Warn("Authorization: Remove profile failed due to invalid streamkey", "streamKey", streamKey)
 		return false, fmt.Errorf("streamkey has invalid characters, only numbers, letters, dash and underscore allowed")
 	}
 
-	fileName, _ := getProfileFileNameByStreamKey(streamKey)
-	if fileName == "" {
-		log.Println("Authorization: RemoveProfile could not find", streamKey)
-		return false, fmt.Errorf("profile could not be found")
+	store, err := getProfileStore()
+	if err != nil {
+		return false, err
 	}
 
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	err := os.Remove(filepath.Join(profilePath, fileName))
-	if err != nil {
+	if err := store.Delete(streamKey); err != nil {
+		slog.Warn("Authorization: RemoveProfile could not remove profile", "streamKey", streamKey, "error", err)
 		return false, err
 	}
 
 	return true, nil
 }
 
-// Returns the publicly available profile
+// Returns the publicly available profile of a token allowed to publish
 func GetPublicProfile(bearerToken string) (*PublicProfile, error) {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	assureProfilePath()
-
-	fileName, err := getProfileFileNameByBearerToken(bearerToken)
+	profile, err := getProfileByBearerToken(bearerToken, ScopePublish)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(filepath.Join(profilePath, fileName))
+	return profile.asPublicProfile(), nil
+}
+
+// Returns the publicly available profile reserved for the stream key
+func GetPublicProfileByStreamKey(streamKey string) (*PublicProfile, error) {
+	profile, err := getProfileByStreamKey(streamKey)
 	if err != nil {
 		return nil, err
 	}
 
-	var profile profile
-	if err := json.Unmarshal(data, &profile); err != nil {
-		log.Println("Authorization: File", bearerToken, "could not read. File may be corrupt.")
-		return nil, err
+	return profile.asPublicProfile(), nil
+}
+
+// Resolve the profile a host streams with according to the stream profile policy.
+// The default profile is used when the token does not belong to a profile, such as a stream key resolved through a webhook.
+func GetHostProfile(token string, defaultProfile *PublicProfile) (*PublicProfile, error) {
+	switch os.Getenv(environment.StreamProfilePolicy) {
+	// Only approved profiles are allowed to stream
+	case StreamPolicyReservedOnly:
+		slog.Debug("Authorization: Policy", "policy", StreamPolicyReservedOnly)
+		profile, err := GetPublicProfile(token)
+		if err != nil {
+			slog.Warn("Authorization: Unauthorized login attempt, no profile found for bearer token")
+			return nil, ErrUnauthorized
+		}
+
+		return profile, nil
+
+	default:
+		slog.Debug("Authorization: Policy", "policy", StreamPolicyWithReserved)
+
+		// If using a streamKey check if it has been reserved
+		if IsProfileReserved(token) {
+			slog.Warn("Authorization: Unauthorized login attempt, stream key has been reserved", "streamKey", token)
+			return nil, ErrUnauthorized
+		}
+
+		// If its a bearer token, validate and use the profile
+		profile, err := GetPublicProfile(token)
+		if errors.Is(err, ErrTokenExpired) || errors.Is(err, ErrTokenScope) {
+			slog.Warn("Authorization: Unauthorized login attempt, token may not be used to publish", "error", err)
+			return nil, ErrUnauthorized
+		} else if profile != nil {
+			return profile, nil
+		}
 	}
-	profile.FileName = fileName
 
-	return profile.asPublicProfile(), nil
+	if defaultProfile != nil {
+		return defaultProfile, nil
+	}
+
+	return &PublicProfile{
+		StreamKey: token,
+		IsPublic:  true,
+		MOTD:      "Welcome to " + token + "'s stream!",
+	}, nil
 }
 
-// Returns the publicly available profile
-func GetPersonalProfile(bearerToken string) (*PersonalProfile, error) {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	assureProfilePath()
+// Resolve the profile a host streams with using an identity token.
+// Stream keys reserved by a profile may only be published with a token of that profile, under either policy.
+func GetIdentityHostProfile(claims *IdentityClaims) (*PublicProfile, error) {
+	if IsProfileReserved(claims.StreamKey) {
+		slog.Warn("Authorization: Unauthorized login attempt, stream key of identity token has been reserved", "streamKey", claims.StreamKey)
+		return nil, ErrUnauthorized
+	}
 
-	fileName, err := getProfileFileNameByBearerToken(bearerToken)
+	return claims.AsPublicProfile(), nil
+}
+
+// Returns the profile for its owner
+func GetPersonalProfile(bearerToken string) (*PersonalProfile, error) {
+	profile, err := getProfileByBearerToken(bearerToken, ScopeProfile)
 	if err != nil {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(filepath.Join(profilePath, fileName))
-	if err != nil {
-		return nil, err
+	return profile.asPersonalProfile(), nil
+}
+
+// Returns true when the token is the admin token, or a moderate token of the profile owning the stream key
+func IsStreamModerator(token string, streamKey string) bool {
+	if token == "" {
+		return false
 	}
 
-	var profile profile
-	if err := json.Unmarshal(data, &profile); err != nil {
-		log.Println("Authorization: File", bearerToken, "could not read. File may be corrupt.")
-		return nil, err
+	if adminToken := os.Getenv(environment.FrontendAdminToken); adminToken != "" && strings.EqualFold(adminToken, token) {
+		return true
 	}
-	profile.FileName = fileName
 
-	return profile.asPersonalProfile(), nil
+	profile, err := getProfileByBearerToken(token, ScopeModerate)
+	return err == nil && strings.EqualFold(profile.StreamKey, streamKey)
 }
 
 // Returns a slice of profiles intended for admin endpoints
 func GetAdminProfilesAll() (profiles []adminProfile, err error) {
-	profilePath := os.Getenv(environment.StreamProfilePath)
-
-	files, err := os.ReadDir(profilePath)
+	store, err := getProfileStore()
 	if err != nil {
-		log.Println("Authorization: Error reading profile directory", err)
 		return nil, err
 	}
 
-	for _, file := range files {
-		data, err := os.ReadFile(filepath.Join(profilePath, file.Name()))
-		if err != nil {
-			profiles = append(profiles, adminProfile{
-				StreamKey: file.Name(),
-				IsPublic:  false,
-				MOTD:      "Error reading profile from file: " + file.Name(),
-			})
-
-			continue
-		}
-
-		var profile profile
-
-		if err := json.Unmarshal(data, &profile); err != nil {
-			profiles = append(profiles, adminProfile{
-				StreamKey: file.Name(),
-				IsPublic:  false,
-				MOTD:      "Invalid JSON in file" + file.Name(),
-			})
-			continue
-		}
+	storedProfiles, err := store.List()
+	if err != nil {
+		slog.Error("Authorization: Error reading profiles", "error", err)
+		return nil, err
+	}
 
-		profile.FileName = file.Name()
+	profiles = []adminProfile{}
+	for _, profile := range storedProfiles {
 		profiles = append(profiles, *profile.asAdminProfile())
 	}
 
@@ -219,27 +250,48 @@ func GetAdminProfilesAll() (profiles []adminProfile, err error) {
 }
 
 func IsProfileReserved(streamKey string) bool {
-	assureProfilePath()
-
-	fileName, _ := getProfileFileNameByStreamKey(streamKey)
-	return fileName != ""
+	profile, _ := getProfileByStreamKey(streamKey)
+	return profile != nil
 }
 
-func ResetProfileToken(streamKey string) error {
-	fileName, _ := getProfileFileNameByStreamKey(streamKey)
+// Replaces the secret of the token with the ID, keeping its label and scopes, the new token is returned.
+// Without an ID all tokens of the profile are replaced by a single token with every scope.
+func ResetProfileToken(streamKey string, tokenID string) (string, error) {
+	store, err := getProfileStore()
+	if err != nil {
+		return "", err
+	}
 
-	if fileName == "" {
-		return fmt.Errorf("authorization: profile could not be found")
+	profile, err := store.GetByStreamKey(streamKey)
+	if err != nil {
+		return "", fmt.Errorf("authorization: profile could not be found")
 	}
 
-	profilePath := os.Getenv(environment.StreamProfilePath)
-	newFileName := streamKey + "_" + generateToken()
-	currentPath := filepath.Join(profilePath, fileName)
-	newPath := filepath.Join(profilePath, newFileName)
+	var token string
+	if tokenID == "" {
+		var storedToken StoredToken
+		token, storedToken, err = newStoredToken(store, TokenOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		profile.Tokens = []StoredToken{storedToken}
+	} else {
+		index := slices.IndexFunc(profile.Tokens, func(token StoredToken) bool {
+			return token.ID == tokenID
+		})
+		if index == -1 {
+			return "", ErrTokenNotFound
+		}
 
-	if err := os.Rename(currentPath, newPath); err != nil {
-		return fmt.Errorf("authorization: error updating profile token for %s", streamKey)
+		token = generateToken(store)
+		profile.Tokens[index].Hash = hashToken(token)
+		profile.Tokens[index].CreatedAt = time.Now().UTC()
 	}
 
-	return nil
+	if err := store.Update(*profile); err != nil {
+		return "", fmt.Errorf("authorization: error updating profile token for %s", streamKey)
+	}
+
+	return token, nil
 }
@@ -1,72 +1,99 @@
 package authorization
 
 import (
-	"strings"
+	"time"
 )
 
-// Internal profile struct, do not use for endpoints
-type profile struct {
-	FileName string
-	IsActive bool
-	IsPublic bool
-	MOTD     string
-}
-
-var separator = "_"
+// Stream profile as persisted by the profile store, do not use for endpoints
+type StoredProfile struct {
+	StreamKey string        `json:"streamKey"`
+	Tokens    []StoredToken `json:"tokens"`
 
-func (p *profile) streamKey() string {
-	splitIndex := strings.LastIndex(p.FileName, separator)
-	return p.FileName[:splitIndex+len(separator)-1]
-}
-func (p *profile) streamToken() string {
-	splitIndex := strings.LastIndex(p.FileName, separator)
-	return p.FileName[splitIndex+len(separator):]
+	// Hash of the single token of profiles stored before tokens had scopes, moved to Tokens when the store is opened
+	TokenHash string            `json:"tokenHash,omitempty"`
+	IsActive  bool              `json:"isActive"`
+	IsPublic  bool              `json:"isPublic"`
+	MOTD      string            `json:"motd"`
+	Record    bool              `json:"record"`
+	Codecs    *CodecPreferences `json:"codecs,omitempty"`
 }
-func (p *profile) asPublicProfile() *PublicProfile {
+
+func (p *StoredProfile) asPublicProfile() *PublicProfile {
 	return &PublicProfile{
-		StreamKey: p.streamKey(),
+		StreamKey: p.StreamKey,
 		IsActive:  p.IsActive,
 		IsPublic:  p.IsPublic,
 		MOTD:      p.MOTD,
+		Record:    p.Record,
+		Codecs:    p.Codecs,
 	}
 }
-func (p *profile) asPersonalProfile() *PersonalProfile {
+func (p *StoredProfile) asPersonalProfile() *PersonalProfile {
 	return &PersonalProfile{
-		StreamKey: p.streamKey(),
+		StreamKey: p.StreamKey,
 		IsActive:  p.IsActive,
 		IsPublic:  p.IsPublic,
 		MOTD:      p.MOTD,
+		Record:    p.Record,
+		Codecs:    p.Codecs,
 	}
 }
-func (p *profile) asAdminProfile() *adminProfile {
+func (p *StoredProfile) asAdminProfile() *adminProfile {
+	now := time.Now()
+	tokens := []TokenInfo{}
+	for _, token := range p.Tokens {
+		tokens = append(tokens, token.asTokenInfo(now))
+	}
+
 	return &adminProfile{
-		StreamKey: p.streamKey(),
-		Token:     p.streamToken(),
+		StreamKey: p.StreamKey,
+		Tokens:    tokens,
 		IsPublic:  p.IsPublic,
 		MOTD:      p.MOTD,
+		Record:    p.Record,
+		Codecs:    p.Codecs,
 	}
 }
 
+// Codec constraints of a profile, empty lists allow every supported codec in the default order
+type CodecPreferences struct {
+	// Allowed video codecs in order of preference, such as "h264", "h265", "vp9" or "av1"
+	Video []string `json:"video,omitempty"`
+
+	// Allowed audio codecs in order of preference, such as "opus"
+	Audio []string `json:"audio,omitempty"`
+
+	// Only allow H264 with this profile-level-id, such as "42e01f"
+	H264ProfileLevel string `json:"h264ProfileLevel,omitempty"`
+}
+
 // Public profile struct for serving to public endpoints
 type PublicProfile struct {
-	StreamKey string `json:"streamKey"`
-	IsActive  bool   `json:"isActive"`
-	IsPublic  bool   `json:"isPublic"`
-	MOTD      string `json:"motd"`
+	StreamKey string            `json:"streamKey"`
+	IsActive  bool              `json:"isActive"`
+	IsPublic  bool              `json:"isPublic"`
+	MOTD      string            `json:"motd"`
+	Record    bool              `json:"record"`
+	Codecs    *CodecPreferences `json:"codecs,omitempty"`
 }
 
 // Personal profile struct for serving to profile owner endpoints
 type PersonalProfile struct {
-	StreamKey string `json:"streamKey"`
-	IsActive  bool   `json:"isActive"`
-	IsPublic  bool   `json:"isPublic"`
-	MOTD      string `json:"motd"`
+	StreamKey string            `json:"streamKey"`
+	IsActive  bool              `json:"isActive"`
+	IsPublic  bool              `json:"isPublic"`
+	MOTD      string            `json:"motd"`
+	Record    bool              `json:"record"`
+	Codecs    *CodecPreferences `json:"codecs,omitempty"`
 }
 
-// Admin profile struct for serving to admin specific endpoints
+// Admin profile struct for serving to admin specific endpoints.
+// Tokens are only stored as hashes, they are returned once when a profile is created or its token is reset.
 type adminProfile struct {
-	StreamKey string `json:"streamKey"`
-	Token     string `json:"token"`
-	IsPublic  bool   `json:"isPublic"`
-	MOTD      string `json:"motd"`
+	StreamKey string            `json:"streamKey"`
+	Tokens    []TokenInfo       `json:"tokens"`
+	IsPublic  bool              `json:"isPublic"`
+	MOTD      string            `json:"motd"`
+	Record    bool              `json:"record"`
+	Codecs    *CodecPreferences `json:"codecs,omitempty"`
 }
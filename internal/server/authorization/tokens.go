@@ -0,0 +1,219 @@
+package authorization
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Actions a profile token may be used for
+type TokenScope string
+
+const (
+	// Publish to the stream key over WHIP or RTMP
+	ScopePublish TokenScope = "publish"
+
+	// Read and edit the profile through the profile endpoint
+	ScopeProfile TokenScope = "profile"
+
+	// Moderate the chat of the stream
+	ScopeModerate TokenScope = "moderate"
+)
+
+// Label of the token created with a profile or by a reset of all tokens
+const defaultTokenLabel = "default"
+
+var (
+	ErrTokenExpired  = errors.New("authorization: token has expired")
+	ErrTokenScope    = errors.New("authorization: token is not allowed for this action")
+	ErrTokenNotFound = errors.New("authorization: token was not found")
+
+	allTokenScopes = []TokenScope{ScopePublish, ScopeProfile, ScopeModerate}
+)
+
+// Token of a stream profile as persisted by the profile store, only the hash of the token is kept
+type StoredToken struct {
+	ID        string       `json:"id"`
+	Label     string       `json:"label"`
+	Hash      string       `json:"hash"`
+	Scopes    []TokenScope `json:"scopes"`
+	CreatedAt time.Time    `json:"createdAt"`
+	ExpiresAt *time.Time   `json:"expiresAt,omitempty"`
+}
+
+// Options of a new token. Without scopes the token has every scope, without expiry it does not expire.
+type TokenOptions struct {
+	Label     string
+	Scopes    []TokenScope
+	ExpiresAt *time.Time
+}
+
+// Token of a profile as served to admin endpoints
+type TokenInfo struct {
+	ID        string       `json:"id"`
+	Label     string       `json:"label"`
+	Scopes    []TokenScope `json:"scopes"`
+	CreatedAt time.Time    `json:"createdAt"`
+	ExpiresAt *time.Time   `json:"expiresAt,omitempty"`
+	IsExpired bool         `json:"isExpired"`
+}
+
+// Parses a comma separated list of scopes, such as "publish,moderate"
+func ParseTokenScopes(value string) (scopes []TokenScope, err error) {
+	for scope := range strings.SplitSeq(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" {
+			continue
+		}
+
+		if !slices.Contains(allTokenScopes, TokenScope(strings.ToLower(scope))) {
+			return nil, fmt.Errorf("unknown token scope %q, allowed are publish, profile and moderate", scope)
+		}
+
+		scopes = append(scopes, TokenScope(strings.ToLower(scope)))
+	}
+
+	return scopes, nil
+}
+
+// Adds a token to the profile of the stream key, the token is returned
+func AddProfileToken(streamKey string, options TokenOptions) (string, error) {
+	store, err := getProfileStore()
+	if err != nil {
+		return "", err
+	}
+
+	profile, err := store.GetByStreamKey(streamKey)
+	if err != nil {
+		return "", err
+	}
+
+	token, storedToken, err := newStoredToken(store, options)
+	if err != nil {
+		return "", err
+	}
+
+	profile.Tokens = append(profile.Tokens, storedToken)
+	if err := store.Update(*profile); err != nil {
+		return "", err
+	}
+
+	slog.Info("Authorization: Added profile token", "streamKey", streamKey, "tokenId", storedToken.ID, "label", storedToken.Label, "scopes", storedToken.Scopes)
+	return token, nil
+}
+
+// Revokes the token with the ID of the profile of the stream key
+func RemoveProfileToken(streamKey string, tokenID string) error {
+	store, err := getProfileStore()
+	if err != nil {
+		return err
+	}
+
+	profile, err := store.GetByStreamKey(streamKey)
+	if err != nil {
+		return err
+	}
+
+	tokenCount := len(profile.Tokens)
+	profile.Tokens = slices.DeleteFunc(profile.Tokens, func(token StoredToken) bool {
+		return token.ID == tokenID
+	})
+	if len(profile.Tokens) == tokenCount {
+		return ErrTokenNotFound
+	}
+
+	if err := store.Update(*profile); err != nil {
+		return err
+	}
+
+	slog.Info("Authorization: Removed profile token", "streamKey", streamKey, "tokenId", tokenID)
+	return nil
+}
+
+func newStoredToken(store ProfileStore, options TokenOptions) (string, StoredToken, error) {
+	if options.ExpiresAt != nil && !options.ExpiresAt.After(time.Now()) {
+		return "", StoredToken{}, fmt.Errorf("token expiry is in the past")
+	}
+
+	scopes := slices.Clone(options.Scopes)
+	if len(scopes) == 0 {
+		scopes = slices.Clone(allTokenScopes)
+	}
+
+	label := options.Label
+	if label == "" {
+		label = defaultTokenLabel
+	}
+
+	token := generateToken(store)
+	return token, StoredToken{
+		ID:        uuid.New().String(),
+		Label:     label,
+		Hash:      hashToken(token),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: options.ExpiresAt,
+	}, nil
+}
+
+// Returns nil when the token may be used for the scope
+func (t *StoredToken) authorize(scope TokenScope, now time.Time) error {
+	if t.isExpired(now) {
+		return ErrTokenExpired
+	}
+
+	if !slices.Contains(t.Scopes, scope) {
+		return ErrTokenScope
+	}
+
+	return nil
+}
+
+func (t *StoredToken) isExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+func (t *StoredToken) asTokenInfo(now time.Time) TokenInfo {
+	return TokenInfo{
+		ID:        t.ID,
+		Label:     t.Label,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		IsExpired: t.isExpired(now),
+	}
+}
+
+// Returns the token of the profile with the hash
+func (p *StoredProfile) getToken(tokenHash string) *StoredToken {
+	for i := range p.Tokens {
+		if p.Tokens[i].Hash == tokenHash {
+			return &p.Tokens[i]
+		}
+	}
+
+	return nil
+}
+
+// Profiles stored before tokens had scopes have a single token with every scope
+func (p *StoredProfile) upgradeLegacyToken() {
+	if p.TokenHash == "" {
+		return
+	}
+
+	if p.getToken(p.TokenHash) == nil {
+		p.Tokens = append(p.Tokens, StoredToken{
+			ID:     uuid.New().String(),
+			Label:  defaultTokenLabel,
+			Hash:   p.TokenHash,
+			Scopes: slices.Clone(allTokenScopes),
+		})
+	}
+
+	p.TokenHash = ""
+}
@@ -0,0 +1,153 @@
+package authorization
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/google/uuid"
+)
+
+// Duration of a viewer token minted without an expiry
+const DefaultViewerTokenDuration = 24 * time.Hour
+
+var (
+	ErrViewerTokenInvalid = errors.New("authorization: viewer token is invalid")
+	ErrViewerTokenExpired = errors.New("authorization: viewer token has expired")
+
+	viewerTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+	viewerTokenSecretOnce sync.Once
+	viewerTokenSecret     []byte
+)
+
+// Claims of a viewer token, a JWT signed with HS256
+type ViewerTokenClaims struct {
+	StreamKey string `json:"sub"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+
+	// Maximum concurrent viewers using the token, unlimited when zero
+	MaxUses int `json:"max,omitempty"`
+}
+
+// Mints a viewer token for the stream key. Without a duration the token expires after DefaultViewerTokenDuration.
+func CreateViewerToken(streamKey string, duration time.Duration, maxUses int) (string, error) {
+	if !isValidStreamKey(streamKey) {
+		return "", errors.New("streamkey has invalid characters, only numbers, letters, dash and underscore allowed")
+	}
+
+	if duration < 0 || maxUses < 0 {
+		return "", errors.New("viewer token duration and max uses can not be negative")
+	}
+
+	if duration == 0 {
+		duration = DefaultViewerTokenDuration
+	}
+
+	now := time.Now()
+	payload, err := json.Marshal(ViewerTokenClaims{
+		StreamKey: streamKey,
+		ID:        uuid.New().String(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(duration).Unix(),
+		MaxUses:   maxUses,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsignedToken := viewerTokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsignedToken + "." + signViewerToken(unsignedToken), nil
+}
+
+// Mints a viewer token for the profile of the bearer token, the token must have the profile scope
+func CreateViewerTokenForProfile(bearerToken string, duration time.Duration, maxUses int) (string, error) {
+	profile, err := getProfileByBearerToken(bearerToken, ScopeProfile)
+	if err != nil {
+		return "", err
+	}
+
+	return CreateViewerToken(profile.StreamKey, duration, maxUses)
+}
+
+// Verifies the signature and expiry of a viewer token and returns its claims
+func ParseViewerToken(token string) (*ViewerTokenClaims, error) {
+	header, payload, signature, ok := splitViewerToken(token)
+	if !ok || header != viewerTokenHeader {
+		return nil, ErrViewerTokenInvalid
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(signViewerToken(header+"."+payload))) {
+		return nil, ErrViewerTokenInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrViewerTokenInvalid
+	}
+
+	var claims ViewerTokenClaims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.StreamKey == "" || claims.ID == "" {
+		return nil, ErrViewerTokenInvalid
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrViewerTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// Returns true if the token has the header of a viewer token, stream keys and profile tokens never contain dots
+func IsViewerToken(token string) bool {
+	header, _, _, ok := splitViewerToken(token)
+	return ok && header == viewerTokenHeader
+}
+
+// Returns true when the stream key is reserved by a private profile, viewers then need a viewer token
+func IsViewerTokenRequired(streamKey string) bool {
+	profile, err := getProfileByStreamKey(streamKey)
+	return err == nil && !profile.IsPublic
+}
+
+func splitViewerToken(token string) (header string, payload string, signature string, ok bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", "", "", false
+	}
+
+	return parts[0], parts[1], parts[2], true
+}
+
+func signViewerToken(unsignedToken string) string {
+	mac := hmac.New(sha256.New, getViewerTokenSecret())
+	mac.Write([]byte(unsignedToken))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the secret viewer tokens are signed with.
+// Without a configured secret a random secret is used, tokens are then invalidated on restart.
+func getViewerTokenSecret() []byte {
+	if secret := os.Getenv(environment.ViewerTokenSecret); secret != "" {
+		return []byte(secret)
+	}
+
+	viewerTokenSecretOnce.Do(func() {
+		viewerTokenSecret = make([]byte, 32)
+		_, _ = rand.Read(viewerTokenSecret)
+		slog.Warn("Authorization: No viewer token secret configured, viewer tokens are invalidated on restart", "variable", environment.ViewerTokenSecret)
+	})
+
+	return viewerTokenSecret
+}
@@ -0,0 +1,56 @@
+package authorization
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+func TestViewerToken(t *testing.T) {
+	t.Setenv(environment.ViewerTokenSecret, "secret")
+
+	token, err := CreateViewerToken("stream", time.Minute, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsViewerToken(token) || IsViewerToken("stream") {
+		t.Fatal("expected only the viewer token to have the shape of a viewer token")
+	}
+
+	// Stream keys can not take the shape of a token
+	if _, err := CreateViewerToken(token, time.Minute, 0); err == nil {
+		t.Fatal("expected a stream key with dots to be rejected")
+	}
+
+	if _, err := CreateProfile("my.stream", TokenOptions{}); err == nil {
+		t.Fatal("expected a profile with dots in the stream key to be rejected")
+	}
+
+	claims, err := ParseViewerToken(token)
+	if err != nil || claims.StreamKey != "stream" || claims.MaxUses != 2 {
+		t.Fatalf("unexpected claims %+v, %v", claims, err)
+	}
+
+	// Changing the claims invalidates the signature
+	header, _, signature, _ := splitViewerToken(token)
+	otherToken, _ := CreateViewerToken("other", time.Minute, 0)
+	_, otherPayload, _, _ := splitViewerToken(otherToken)
+	if _, err := ParseViewerToken(strings.Join([]string{header, otherPayload, signature}, ".")); !errors.Is(err, ErrViewerTokenInvalid) {
+		t.Fatalf("expected %v for changed claims, got %v", ErrViewerTokenInvalid, err)
+	}
+
+	t.Setenv(environment.ViewerTokenSecret, "other secret")
+	if _, err := ParseViewerToken(token); !errors.Is(err, ErrViewerTokenInvalid) {
+		t.Fatalf("expected %v for another secret, got %v", ErrViewerTokenInvalid, err)
+	}
+
+	expiredToken, _ := CreateViewerToken("stream", time.Nanosecond, 0)
+	time.Sleep(time.Second)
+	if _, err := ParseViewerToken(expiredToken); !errors.Is(err, ErrViewerTokenExpired) {
+		t.Fatalf("expected %v, got %v", ErrViewerTokenExpired, err)
+	}
+}
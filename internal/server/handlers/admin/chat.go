@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+const (
+	chatActionDelete       = "delete"
+	chatActionTimeout      = "timeout"
+	chatActionBan          = "ban"
+	chatActionUnban        = "unban"
+	chatActionBanAddress   = "banAddress"
+	chatActionUnbanAddress = "unbanAddress"
+	chatActionSlowMode     = "slowmode"
+	chatActionFilter       = "filter"
+)
+
+var (
+	errMissingAddress = errors.New("address is required")
+	errUnknownAction  = errors.New("unknown action")
+)
+
+type adminChatPayload struct {
+	StreamKey       string   `json:"streamKey"`
+	Action          string   `json:"action"`
+	MessageID       string   `json:"messageId"`
+	UserID          string   `json:"userId"`
+	Address         string   `json:"address"`
+	DurationSeconds int64    `json:"durationSeconds"`
+	ByAddress       bool     `json:"byAddress"`
+	Words           []string `json:"words"`
+}
+
+// Retrieve the moderation state of a stream chat, or apply a moderation action.
+// Available with the admin token or the bearer token of the stream profile.
+func ChatModerationHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		if isValidMethod := verifyValidMethod("GET", responseWriter, request); !isValidMethod {
+			return
+		}
+	}
+
+	chatManager := manager.SessionsManager.ChatManager
+	if chatManager == nil {
+		helpers.LogHTTPError(responseWriter, "Chat is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	token := helpers.ResolveBearerToken(request.Header.Get("Authorization"))
+
+	if request.Method == http.MethodGet {
+		streamKey := request.URL.Query().Get("streamKey")
+		if !authorization.IsStreamModerator(token, streamKey) {
+			helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+			return
+		}
+
+		responseWriter.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(responseWriter).Encode(chatManager.GetModerationState(streamKey)); err != nil {
+			slog.Warn("API.Admin.Chat Error", "error", err)
+		}
+
+		return
+	}
+
+	var payload adminChatPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil || payload.StreamKey == "" {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if !authorization.IsStreamModerator(token, payload.StreamKey) {
+		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+		return
+	}
+
+	slog.Info("API.Admin.Chat", "streamKey", payload.StreamKey, "action", payload.Action)
+
+	if err := applyChatAction(chatManager, payload); err != nil {
+		slog.Warn("API.Admin.Chat Error", "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
+
+func applyChatAction(chatManager *chat.Manager, payload adminChatPayload) error {
+	duration := time.Duration(payload.DurationSeconds) * time.Second
+
+	switch payload.Action {
+	case chatActionDelete:
+		return chatManager.DeleteMessage(payload.StreamKey, payload.MessageID)
+	case chatActionTimeout:
+		return chatManager.TimeoutUser(payload.StreamKey, payload.UserID, duration)
+	case chatActionBan:
+		return chatManager.BanUser(payload.StreamKey, payload.UserID, payload.ByAddress)
+	case chatActionUnban:
+		return chatManager.UnbanUser(payload.StreamKey, payload.UserID)
+	case chatActionBanAddress:
+		if payload.Address == "" {
+			return errMissingAddress
+		}
+
+		chatManager.BanAddress(payload.StreamKey, payload.Address, duration)
+		return nil
+	case chatActionUnbanAddress:
+		chatManager.UnbanAddress(payload.StreamKey, payload.Address)
+		return nil
+	case chatActionSlowMode:
+		return chatManager.SetSlowMode(payload.StreamKey, duration)
+	case chatActionFilter:
+		chatManager.SetWordFilter(payload.StreamKey, payload.Words)
+		return nil
+	default:
+		return errUnknownAction
+	}
+}
@@ -1,8 +1,7 @@
 package admin
 
 import (
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
@@ -20,20 +19,28 @@ func LoggingHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		return
 	}
 
+	filter, err := environment.ParseLogFilter(request.URL.Query())
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	file, err := environment.GetLogFileReader()
 	if err != nil {
-		log.Println("API.Admin.Logging Error:", err)
+		slog.Error("API.Admin.Logging: Could not open log file", "error", err)
+		helpers.LogHTTPError(responseWriter, "Log file unavailable", http.StatusNotFound)
+		return
 	}
 
 	responseWriter.Header().Set("Content-Type", "application/json")
 
-	if _, err := io.Copy(responseWriter, file); err != nil {
-		log.Println("API.Admin.Logging: Error writing file to response", err)
+	if err := environment.FilterLogs(file, responseWriter, filter); err != nil {
+		slog.Error("API.Admin.Logging: Error writing file to response", "error", err)
 		helpers.LogHTTPError(responseWriter, "Invalid request", http.StatusBadRequest)
 	}
 
 	err = file.Close()
 	if err != nil {
-		log.Println("API.Admin.Logging Error:", err)
+		slog.Error("API.Admin.Logging: Error closing log file", "error", err)
 	}
 }
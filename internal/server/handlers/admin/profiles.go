@@ -2,8 +2,9 @@ package admin
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
@@ -30,15 +31,24 @@ func ProfilesHandler(responseWriter http.ResponseWriter, request *http.Request)
 
 	err = json.NewEncoder(responseWriter).Encode(profiles)
 	if err != nil {
-		log.Println("API.Admin.Profiles Error", err)
+		slog.Warn("API.Admin.Profiles Error", "error", err)
 	}
 }
 
 type adminTokenResetPayload struct {
 	StreamKey string `json:"streamKey"`
+
+	// Token to reset, all tokens are replaced by a single token when empty
+	ID string `json:"id"`
+}
+
+// Tokens are only stored as hashes, this response is the only time a token is returned
+type adminProfileTokenResponse struct {
+	StreamKey string `json:"streamKey"`
+	Token     string `json:"token"`
 }
 
-// Reset the token of an existing stream profile
+// Reset a token, or all tokens, of an existing stream profile
 func ProfilesResetTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
 		return
@@ -56,20 +66,24 @@ func ProfilesResetTokenHandler(responseWriter http.ResponseWriter, request *http
 		return
 	}
 
-	if err := authorization.ResetProfileToken(payload.StreamKey); err != nil {
-		log.Println("API.Admin.ProfilesResetTokenHandler", err)
+	token, err := authorization.ResetProfileToken(payload.StreamKey, payload.ID)
+	if err != nil {
+		slog.Error("API.Admin.ProfilesResetTokenHandler", "streamKey", payload.StreamKey, "error", err)
 		helpers.LogHTTPError(responseWriter, "Error updating token", http.StatusBadRequest)
 		return
 	}
 
-	responseWriter.WriteHeader(http.StatusOK)
+	writeProfileToken(responseWriter, payload.StreamKey, token)
 }
 
 type adminAddStreamPayload struct {
-	StreamKey string `json:"streamKey"`
+	StreamKey string     `json:"streamKey"`
+	Label     string     `json:"label"`
+	Scopes    string     `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
-// Reset the token of an existing stream profile
+// Create a stream profile with its first token
 func ProfileAddHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
 		return
@@ -87,20 +101,27 @@ func ProfileAddHandler(responseWriter http.ResponseWriter, request *http.Request
 		return
 	}
 
-	if _, err := authorization.CreateProfile(payload.StreamKey); err != nil {
-		log.Println("API.Admin.CreateProfile", err)
+	options, err := getTokenOptions(payload.Label, payload.Scopes, payload.ExpiresAt)
+	if err != nil {
 		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	responseWriter.WriteHeader(http.StatusOK)
+	token, err := authorization.CreateProfile(payload.StreamKey, options)
+	if err != nil {
+		slog.Error("API.Admin.CreateProfile", "streamKey", payload.StreamKey, "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeProfileToken(responseWriter, payload.StreamKey, token)
 }
 
 type adminRemoveStreamPayload struct {
 	StreamKey string `json:"streamKey"`
 }
 
-// Reset the token of an existing stream profile
+// Remove a stream profile and its tokens
 func ProfileRemoveHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
 		return
@@ -119,10 +140,143 @@ func ProfileRemoveHandler(responseWriter http.ResponseWriter, request *http.Requ
 	}
 
 	if _, err := authorization.RemoveProfile(payload.StreamKey); err != nil {
-		log.Println("API.Admin.RemoveProfile", err)
+		slog.Error("API.Admin.RemoveProfile", "streamKey", payload.StreamKey, "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
+
+type adminAddTokenPayload struct {
+	StreamKey string     `json:"streamKey"`
+	Label     string     `json:"label"`
+	Scopes    string     `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// Add a token to an existing stream profile
+func ProfileAddTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminAddTokenPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	options, err := getTokenOptions(payload.Label, payload.Scopes, payload.ExpiresAt)
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, err := authorization.AddProfileToken(payload.StreamKey, options)
+	if err != nil {
+		slog.Error("API.Admin.AddProfileToken", "streamKey", payload.StreamKey, "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeProfileToken(responseWriter, payload.StreamKey, token)
+}
+
+type adminRemoveTokenPayload struct {
+	StreamKey string `json:"streamKey"`
+	ID        string `json:"id"`
+}
+
+// Revoke a token of an existing stream profile
+func ProfileRemoveTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminRemoveTokenPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	if err := authorization.RemoveProfileToken(payload.StreamKey, payload.ID); err != nil {
+		slog.Error("API.Admin.RemoveProfileToken", "streamKey", payload.StreamKey, "id", payload.ID, "error", err)
 		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	responseWriter.WriteHeader(http.StatusOK)
 }
+
+type adminViewerTokenPayload struct {
+	StreamKey string `json:"streamKey"`
+
+	// Seconds until the token expires, defaults to a day
+	ExpiresIn int `json:"expiresIn"`
+	MaxUses   int `json:"maxUses"`
+}
+
+// Mint a viewer token for a private stream
+func ProfileViewerTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if isValidMethod := verifyValidMethod("POST", responseWriter, request); !isValidMethod {
+		return
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	var payload adminViewerTokenPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	token, err := authorization.CreateViewerToken(payload.StreamKey, time.Duration(payload.ExpiresIn)*time.Second, payload.MaxUses)
+	if err != nil {
+		slog.Error("API.Admin.CreateViewerToken", "streamKey", payload.StreamKey, "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeProfileToken(responseWriter, payload.StreamKey, token)
+}
+
+func getTokenOptions(label string, scopes string, expiresAt *time.Time) (authorization.TokenOptions, error) {
+	tokenScopes, err := authorization.ParseTokenScopes(scopes)
+	if err != nil {
+		return authorization.TokenOptions{}, err
+	}
+
+	return authorization.TokenOptions{
+		Label:     label,
+		Scopes:    tokenScopes,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+func writeProfileToken(responseWriter http.ResponseWriter, streamKey string, token string) {
+	responseWriter.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(responseWriter).Encode(adminProfileTokenResponse{
+		StreamKey: streamKey,
+		Token:     token,
+	}); err != nil {
+		slog.Warn("API.Admin.ProfileToken Error", "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+type adminRecordingPayload struct {
+	StreamKey string `json:"streamKey"`
+	Record    bool   `json:"record"`
+}
+
+// Retrieve active recordings, or start and stop recording a stream
+func RecordingHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		if isValidMethod := verifyValidMethod("GET", responseWriter, request); !isValidMethod {
+			return
+		}
+	}
+
+	sessionResult := verifyAdminSession(request)
+	if !sessionResult.IsValid {
+		helpers.LogHTTPError(responseWriter, sessionResult.ErrorMessage, http.StatusUnauthorized)
+		return
+	}
+
+	if request.Method == http.MethodGet {
+		responseWriter.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(responseWriter).Encode(manager.SessionsManager.GetRecordingStates()); err != nil {
+			slog.Warn("API.Admin.Recording Error", "error", err)
+		}
+
+		return
+	}
+
+	var payload adminRecordingPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil || payload.StreamKey == "" {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	// Persist the setting for reserved stream keys
+	if authorization.IsProfileReserved(payload.StreamKey) {
+		if err := authorization.UpdateProfileRecording(payload.StreamKey, payload.Record); err != nil {
+			slog.Error("API.Admin.Recording", "streamKey", payload.StreamKey, "error", err)
+			helpers.LogHTTPError(responseWriter, "Error updating profile", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	session, ok := manager.SessionsManager.GetSessionByID(payload.StreamKey)
+	if !ok {
+		responseWriter.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !payload.Record {
+		session.StopRecording()
+		responseWriter.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := session.StartRecording(); err != nil {
+		slog.Error("API.Admin.Recording", "streamKey", payload.StreamKey, "error", err)
+		helpers.LogHTTPError(responseWriter, "Error starting recording", http.StatusInternalServerError)
+		return
+	}
+
+	responseWriter.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/hls"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/server/webhook"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+const hlsWebhookCacheDuration = 30 * time.Second
+
+type hlsWebhookResult struct {
+	streamKey string
+	expires   time.Time
+}
+
+var (
+	hlsWebhookCacheLock sync.Mutex
+	hlsWebhookCache     = map[string]hlsWebhookResult{}
+)
+
+// Serves the LL-HLS playlists and segments of a stream.
+// Expected path is /api/hls/{streamKey}/{file}
+func hlsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !hls.IsEnabled() {
+		helpers.LogHTTPError(responseWriter, "HLS is not enabled", http.StatusNotFound)
+		return
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, "/api/hls/")
+	streamKey, fileName, found := strings.Cut(path, "/")
+	if !found || streamKey == "" || fileName == "" {
+		helpers.LogHTTPError(responseWriter, "Invalid path", http.StatusBadRequest)
+		return
+	}
+
+	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" {
+		resolvedStreamKey, err := resolveHLSStreamKey(webhookURL, streamKey, request)
+		if err != nil {
+			slog.Warn("API.HLS.Webhook.Error", "error", err)
+			responseWriter.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		streamKey = resolvedStreamKey
+	}
+
+	viewerTokenClaims, err := getViewerTokenClaims(request)
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, "Viewer token was invalid", http.StatusUnauthorized)
+		return
+	}
+
+	if err := authorizeViewer(streamKey, viewerTokenClaims); err != nil {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	session, ok := manager.SessionsManager.GetSessionByID(streamKey)
+	if !ok || session.GetHLSPackager() == nil {
+		helpers.LogHTTPError(responseWriter, "No active stream found", http.StatusNotFound)
+		return
+	}
+
+	packager := session.GetHLSPackager()
+	ctx := request.Context()
+
+	// Players only send the query of the playlist URL, so the viewer token is passed on to every URI of the playlists
+	playlistQuery := ""
+	if token := request.URL.Query().Get("token"); token != "" {
+		playlistQuery = url.Values{"token": {token}}.Encode()
+	}
+
+	switch {
+	case fileName == "index.m3u8":
+		playlist, ok := packager.GetMasterPlaylist(ctx, playlistQuery)
+		writeHLSPlaylist(responseWriter, playlist, ok)
+
+	case fileName == "stream.m3u8":
+		mediaSequence, partIndex, err := getHLSBlockingParameters(request)
+		if err != nil {
+			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		playlist, ok := packager.GetMediaPlaylist(ctx, mediaSequence, partIndex, playlistQuery)
+		writeHLSPlaylist(responseWriter, playlist, ok)
+
+	case strings.HasPrefix(fileName, "init-"):
+		var version int
+		if _, err := fmt.Sscanf(fileName, "init-%d.mp4", &version); err != nil {
+			helpers.LogHTTPError(responseWriter, "Invalid file", http.StatusNotFound)
+			return
+		}
+
+		data, ok := packager.GetInitSegment(version)
+		writeHLSMedia(responseWriter, "video/mp4", data, ok)
+
+	case strings.HasPrefix(fileName, "segment-"):
+		var sequence uint64
+		if _, err := fmt.Sscanf(fileName, "segment-%d.m4s", &sequence); err != nil {
+			helpers.LogHTTPError(responseWriter, "Invalid file", http.StatusNotFound)
+			return
+		}
+
+		data, ok := packager.GetSegment(sequence)
+		writeHLSMedia(responseWriter, "video/iso.segment", data, ok)
+
+	case strings.HasPrefix(fileName, "part-"):
+		var (
+			sequence  uint64
+			partIndex int
+		)
+		if _, err := fmt.Sscanf(fileName, "part-%d-%d.m4s", &sequence, &partIndex); err != nil {
+			helpers.LogHTTPError(responseWriter, "Invalid file", http.StatusNotFound)
+			return
+		}
+
+		data, ok := getHLSPart(ctx, packager, sequence, partIndex)
+		writeHLSMedia(responseWriter, "video/iso.segment", data, ok)
+
+	default:
+		helpers.LogHTTPError(responseWriter, "Invalid file", http.StatusNotFound)
+	}
+}
+
+func getHLSPart(ctx context.Context, packager *hls.Packager, sequence uint64, partIndex int) ([]byte, bool) {
+	if partIndex < 0 {
+		return nil, false
+	}
+
+	return packager.GetPart(ctx, sequence, partIndex)
+}
+
+// Resolve the _HLS_msn and _HLS_part parameters of a blocking playlist reload, -1 when not provided
+func getHLSBlockingParameters(request *http.Request) (mediaSequence int64, partIndex int64, err error) {
+	mediaSequence, partIndex = -1, -1
+	query := request.URL.Query()
+
+	if value := query.Get("_HLS_msn"); value != "" {
+		if mediaSequence, err = strconv.ParseInt(value, 10, 64); err != nil || mediaSequence < 0 {
+			return 0, 0, fmt.Errorf("invalid _HLS_msn")
+		}
+	}
+
+	if value := query.Get("_HLS_part"); value != "" {
+		if mediaSequence < 0 {
+			return 0, 0, fmt.Errorf("_HLS_part requires _HLS_msn")
+		}
+
+		if partIndex, err = strconv.ParseInt(value, 10, 64); err != nil || partIndex < 0 {
+			return 0, 0, fmt.Errorf("invalid _HLS_part")
+		}
+	}
+
+	return mediaSequence, partIndex, nil
+}
+
+func writeHLSPlaylist(responseWriter http.ResponseWriter, playlist string, ok bool) {
+	if !ok {
+		helpers.LogHTTPError(responseWriter, "Playlist not available", http.StatusNotFound)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	responseWriter.Header().Set("Cache-Control", "no-cache")
+
+	if _, err := fmt.Fprint(responseWriter, playlist); err != nil {
+		slog.Debug("API.HLS.Playlist.Error", "error", err)
+	}
+}
+
+func writeHLSMedia(responseWriter http.ResponseWriter, contentType string, data []byte, ok bool) {
+	if !ok {
+		helpers.LogHTTPError(responseWriter, "Segment not available", http.StatusNotFound)
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", contentType)
+	responseWriter.Header().Set("Cache-Control", "max-age=60")
+
+	if _, err := responseWriter.Write(data); err != nil {
+		slog.Debug("API.HLS.Segment.Error", "error", err)
+	}
+}
+
+// Resolve the stream key of a viewer token through the webhook.
+// Results are cached briefly as players request a new file multiple times per second.
+func resolveHLSStreamKey(webhookURL string, token string, request *http.Request) (string, error) {
+	now := time.Now()
+
+	hlsWebhookCacheLock.Lock()
+	cached, ok := hlsWebhookCache[token]
+	hlsWebhookCacheLock.Unlock()
+
+	if ok && now.Before(cached.expires) {
+		return cached.streamKey, nil
+	}
+
+	streamKey, err := webhook.CallWebhook(webhookURL, webhook.WHEPConnect, token, request)
+	if err != nil {
+		return "", err
+	}
+
+	hlsWebhookCacheLock.Lock()
+	for key, result := range hlsWebhookCache {
+		if now.After(result.expires) {
+			delete(hlsWebhookCache, key)
+		}
+	}
+	hlsWebhookCache[token] = hlsWebhookResult{
+		streamKey: streamKey,
+		expires:   now.Add(hlsWebhookCacheDuration),
+	}
+	hlsWebhookCacheLock.Unlock()
+
+	return streamKey, nil
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/pion/rtp"
+)
+
+func TestHLSHandlerPassesViewerTokenToPlaylistURIs(t *testing.T) {
+	t.Setenv(environment.StreamProfilePath, t.TempDir())
+	t.Setenv(environment.ViewerTokenSecret, "secret")
+	t.Setenv(environment.HLSEnabled, "true")
+	t.Setenv(environment.HLSSegmentDuration, "1s")
+	t.Setenv(environment.HLSPartDuration, "250ms")
+
+	profileToken, err := authorization.CreateProfile("private_hls", authorization.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := authorization.UpdateProfile(profileToken, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	viewerToken, err := authorization.CreateViewerToken("private_hls", time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager.SessionsManager = &manager.SessionManager{}
+	manager.SessionsManager.Setup()
+
+	session, err := manager.SessionsManager.GetOrAddSession(authorization.PublicProfile{StreamKey: "private_hls"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	if _, err := session.AddExternalHost(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three seconds of 30 fps video with a keyframe every second
+	packager := session.GetHLSPackager()
+	for frame := range 90 {
+		payloads := [][]byte{{0x41, 0x9a, 0x00}}
+		if frame%30 == 0 {
+			payloads = [][]byte{
+				{0x18, 0x00, 0x09, 0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xe4, 0x00, 0x04, 0x68, 0xce, 0x38, 0x80},
+				{0x65, 0x88, 0x80},
+			}
+		}
+
+		for _, payload := range payloads {
+			packager.WriteVideo(codecs.TrackPacket{
+				Codec:  codecs.VideoTrackCodecH264,
+				Packet: &rtp.Packet{Header: rtp.Header{Timestamp: uint32(frame * 3000), Marker: true}, Payload: payload},
+			}, 0)
+		}
+	}
+
+	getHLS := func(path string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		hlsHandler(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		return resp
+	}
+
+	// Returns the first URI of the playlist starting with the prefix
+	getPlaylistURI := func(playlist string, prefix string) string {
+		scanner := bufio.NewScanner(strings.NewReader(playlist))
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+				return line
+			}
+		}
+
+		t.Fatalf("expected a URI starting with %q in\n%s", prefix, playlist)
+		return ""
+	}
+
+	master := getHLS("/api/hls/private_hls/index.m3u8?token=" + viewerToken)
+	if master.Code != http.StatusOK {
+		t.Fatalf("expected status %d for the master playlist, got %d", http.StatusOK, master.Code)
+	}
+
+	media := getHLS("/api/hls/private_hls/" + getPlaylistURI(master.Body.String(), "stream.m3u8"))
+	if media.Code != http.StatusOK {
+		t.Fatalf("expected status %d for the media playlist, got %d", http.StatusOK, media.Code)
+	}
+
+	segmentURI := getPlaylistURI(media.Body.String(), "segment-")
+	if segmentURI != "segment-0.m4s?token="+viewerToken {
+		t.Fatalf("expected the viewer token in the segment URI, got %q", segmentURI)
+	}
+
+	if segment := getHLS("/api/hls/private_hls/" + segmentURI); segment.Code != http.StatusOK || segment.Body.Len() == 0 {
+		t.Fatalf("expected status %d with the segment, got %d", http.StatusOK, segment.Code)
+	}
+
+	if segment := getHLS("/api/hls/private_hls/segment-0.m4s"); segment.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d without the viewer token, got %d", http.StatusUnauthorized, segment.Code)
+	}
+}
@@ -2,18 +2,22 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strings"
 
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
 )
 
 type (
 	whepLayerRequestJSON struct {
 		MediaID    string `json:"mediaId"`
 		EncodingID string `json:"encodingId"`
+
+		// Camera angle of a video layer request, and the MID of the viewer video track it is for
+		Angle string `json:"angle"`
+		MID   string `json:"mid"`
 	}
 )
 
@@ -27,26 +31,51 @@ func layerChangeHandler(responseWriter http.ResponseWriter, request *http.Reques
 
 	values := strings.Split(request.URL.RequestURI(), "/")
 	whepSessionID := values[len(values)-1]
-	whepSession, ok := manager.SessionsManager.GetWHEPSessionByID(whepSessionID)
-
-	log.Println("Found WHEP session", whepSession.SessionID)
+	streamSession, whepSession, ok := manager.SessionsManager.GetSessionAndWHEPByID(whepSessionID)
 
 	if !ok {
 		helpers.LogHTTPError(responseWriter, "Could not find WHEP session", http.StatusBadRequest)
 		return
 	}
 
-	if requestContent.MediaID == "1" {
-		log.Println("Setting Video Layer", requestContent.EncodingID)
-		whepSession.SetVideoLayer(requestContent.EncodingID)
-		return
-	}
+	whepSession.Logger.Debug("API.LayerChange: Found WHEP session")
+
+	switch requestContent.MediaID {
+	case whip.VideoMediaID:
+		// A video layer belongs to a camera angle, the angle of the layer is used when none was requested
+		angle := requestContent.Angle
+		host := streamSession.Host.Load()
+		if host != nil && requestContent.EncodingID != "" {
+			if layerAngle, ok := host.GetVideoTrackAngle(requestContent.EncodingID); ok {
+				if angle != "" && angle != layerAngle {
+					helpers.LogHTTPError(responseWriter, "Video layer is not part of the camera angle", http.StatusBadRequest)
+					return
+				}
 
-	if requestContent.MediaID == "2" {
-		log.Println("Setting Audio Layer", requestContent.EncodingID)
+				angle = layerAngle
+			}
+		}
+
+		if angle != "" && (host == nil || !host.HasVideoAngle(angle)) {
+			helpers.LogHTTPError(responseWriter, "Unknown camera angle", http.StatusBadRequest)
+			return
+		}
+
+		whepSession.Logger.Info("API.LayerChange: Setting Video Layer", "mid", requestContent.MID, "angle", angle, "encodingId", requestContent.EncodingID)
+		if err := whepSession.SelectVideo(requestContent.MID, angle, requestContent.EncodingID); err != nil {
+			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case whip.AudioMediaID:
+		// Audio tracks are selected by their encoding ID in the layers event, an empty ID selects the default track
+		if host := streamSession.Host.Load(); requestContent.EncodingID != "" && (host == nil || !host.HasAudioTrack(requestContent.EncodingID)) {
+			helpers.LogHTTPError(responseWriter, "Unknown audio track", http.StatusBadRequest)
+			return
+		}
+
+		whepSession.Logger.Info("API.LayerChange: Setting Audio Layer", "encodingId", requestContent.EncodingID)
 		whepSession.SetAudioLayer(requestContent.EncodingID)
-		return
+	default:
+		helpers.LogHTTPError(responseWriter, "Unknown media type", http.StatusBadRequest)
 	}
-
-	helpers.LogHTTPError(responseWriter, "Unknown media type", http.StatusBadRequest)
 }
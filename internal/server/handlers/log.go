@@ -1,8 +1,7 @@
 package handlers
 
 import (
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -31,20 +30,28 @@ func logHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		}
 	}
 
+	filter, err := environment.ParseLogFilter(request.URL.Query())
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	file, err := environment.GetLogFileReader()
 	if err != nil {
-		log.Println("API.Log Error:", err)
+		slog.Error("API.Log: Could not open log file", "error", err)
+		helpers.LogHTTPError(responseWriter, "Log file unavailable", http.StatusNotFound)
+		return
 	}
 
 	responseWriter.Header().Set("Content-Type", "text/plain")
 
-	if _, err := io.Copy(responseWriter, file); err != nil {
-		log.Println("API.Log: Error writing file to response", err)
+	if err := environment.FilterLogs(file, responseWriter, filter); err != nil {
+		slog.Error("API.Log: Error writing file to response", "error", err)
 		helpers.LogHTTPError(responseWriter, "Invalid request", http.StatusBadRequest)
 	}
 
 	err = file.Close()
 	if err != nil {
-		log.Println("API.Log Error:", err)
+		slog.Error("API.Log: Error closing log file", "error", err)
 	}
 }
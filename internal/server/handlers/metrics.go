@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/metrics"
+	"github.com/glimesh/broadcast-box/internal/server/helpers"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+)
+
+func isMetricsEnabled() bool {
+	return strings.EqualFold(os.Getenv(environment.MetricsEnabled), "true")
+}
+
+// Exposes the state of all streams in the Prometheus text format
+func metricsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if token := os.Getenv(environment.MetricsToken); token != "" {
+		bearerToken, _ := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(bearerToken), []byte(token)) != 1 {
+			helpers.LogHTTPError(responseWriter, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	writer := metrics.NewWriter(responseWriter)
+	writeSessionMetrics(writer, manager.SessionsManager.GetSessionStates(true))
+	metrics.ChatMessages.Write(writer)
+	metrics.ChatMessagesRateLimited.Write(writer)
+	metrics.WebhookLatency.Write(writer)
+
+	if err := writer.Err(); err != nil {
+		slog.Warn("API.Metrics Error", "error", err)
+	}
+}
+
+func writeSessionMetrics(writer *metrics.Writer, states []session.StreamSessionState) {
+	writer.Header("stream_info", "gauge", "Streams with an active session.")
+	for _, state := range states {
+		writer.Sample("stream_info", 1, "stream", state.StreamKey, "public", boolLabel(state.IsPublic), "recording", boolLabel(state.IsRecording))
+	}
+
+	writer.Header("stream_start_time_seconds", "gauge", "Unix time the stream started.")
+	for _, state := range states {
+		if !state.StreamStart.IsZero() {
+			writer.Sample("stream_start_time_seconds", float64(state.StreamStart.Unix()), "stream", state.StreamKey)
+		}
+	}
+
+	writer.Header("stream_viewers", "gauge", "Connected WHEP viewers by video layer.")
+	for _, state := range states {
+		viewers := make(map[string]int)
+		for _, viewer := range state.Sessions {
+			viewers[viewer.VideoLayerCurrent]++
+		}
+
+		for layer, count := range viewers {
+			writer.Sample("stream_viewers", float64(count), "stream", state.StreamKey, "layer", layer)
+		}
+	}
+
+	writer.Header("ingest_video_bitrate_bytes", "gauge", "Incoming video bitrate in bytes per second.")
+	for _, state := range states {
+		for _, track := range state.VideoTracks {
+			writer.Sample("ingest_video_bitrate_bytes", float64(track.Bitrate), "stream", state.StreamKey, "layer", track.Rid)
+		}
+	}
+
+	writer.Header("ingest_video_keyframe_interval_seconds", "gauge", "Time between the last two incoming video keyframes.")
+	for _, state := range states {
+		for _, track := range state.VideoTracks {
+			writer.Sample("ingest_video_keyframe_interval_seconds", float64(track.KeyframeInterval)/1000, "stream", state.StreamKey, "layer", track.Rid)
+		}
+	}
+
+	writer.Header("ingest_video_last_keyframe_seconds", "gauge", "Unix time of the last incoming video keyframe.")
+	for _, state := range states {
+		for _, track := range state.VideoTracks {
+			if !track.LastKeyframe.IsZero() {
+				writer.Sample("ingest_video_last_keyframe_seconds", float64(track.LastKeyframe.UnixMilli())/1000, "stream", state.StreamKey, "layer", track.Rid)
+			}
+		}
+	}
+
+	writer.Header("ingest_packets_received_total", "counter", "Incoming RTP packets.")
+	for _, state := range states {
+		for _, track := range state.VideoTracks {
+			writer.Sample("ingest_packets_received_total", float64(track.PacketsReceived), "stream", state.StreamKey, "kind", "video", "layer", track.Rid)
+		}
+		for _, track := range state.AudioTracks {
+			writer.Sample("ingest_packets_received_total", float64(track.PacketsReceived), "stream", state.StreamKey, "kind", "audio", "layer", track.Rid)
+		}
+	}
+
+	writer.Header("ingest_packets_dropped_total", "counter", "Incoming RTP packets missing from the sequence, lost or arriving out of order.")
+	for _, state := range states {
+		for _, track := range state.VideoTracks {
+			writer.Sample("ingest_packets_dropped_total", float64(track.PacketsDropped), "stream", state.StreamKey, "kind", "video", "layer", track.Rid)
+		}
+		for _, track := range state.AudioTracks {
+			writer.Sample("ingest_packets_dropped_total", float64(track.PacketsDropped), "stream", state.StreamKey, "kind", "audio", "layer", track.Rid)
+		}
+	}
+
+	writer.Header("egress_video_bitrate_bytes", "gauge", "Outgoing video bitrate to all viewers in bytes per second.")
+	for _, state := range states {
+		var bitrate uint64
+		for _, viewer := range state.Sessions {
+			bitrate += viewer.VideoBitrate
+		}
+
+		writer.Sample("egress_video_bitrate_bytes", float64(bitrate), "stream", state.StreamKey)
+	}
+
+	writer.Header("egress_video_packets_written_total", "counter", "Outgoing video packets by viewer.")
+	for _, state := range states {
+		for _, viewer := range state.Sessions {
+			writer.Sample("egress_video_packets_written_total", float64(viewer.VideoPacketsWritten), "stream", state.StreamKey, "viewer", viewer.ID)
+		}
+	}
+
+	writer.Header("egress_video_packets_dropped_total", "counter", "Outgoing video packets that could not be written by viewer.")
+	for _, state := range states {
+		for _, viewer := range state.Sessions {
+			writer.Sample("egress_video_packets_dropped_total", float64(viewer.VideoPacketsDropped), "stream", state.StreamKey, "viewer", viewer.ID)
+		}
+	}
+}
+
+func boolLabel(value bool) string {
+	if value {
+		return "true"
+	}
+
+	return "false"
+}
@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path"
@@ -29,14 +29,22 @@ func GetServeMuxHandler() http.HandlerFunc {
 	serverMux.HandleFunc("/api/whip", corsHandler(whipHandlers.WHIPHandler))
 	serverMux.HandleFunc("/api/whip/", corsHandler(whipHandlers.WHIPHandler))
 	serverMux.HandleFunc("/api/whip/profile", corsHandler(whipHandlers.ProfileHandler))
+	serverMux.HandleFunc("/api/whip/profile/viewer-token", corsHandler(whipHandlers.ViewerTokenHandler))
 
 	// WHEP session endpoints
 	serverMux.HandleFunc("/api/layer/", corsHandler(layerChangeHandler))
 
+	// HLS endpoints
+	serverMux.HandleFunc("/api/hls/", corsHandler(hlsHandler))
+
 	// Logging and status endpoints
 	serverMux.HandleFunc("/api/log", corsHandler(logHandler))
 	serverMux.HandleFunc("/api/status", corsHandler(statusHandler))
 
+	if isMetricsEnabled() {
+		serverMux.HandleFunc("/metrics", metricsHandler)
+	}
+
 	// Admin endpoints
 	serverMux.HandleFunc("/api/admin/login", corsHandler(adminHandlers.LoginHandler))
 	serverMux.HandleFunc("/api/admin/status", corsHandler(adminHandlers.StatusHandler))
@@ -45,18 +53,23 @@ func GetServeMuxHandler() http.HandlerFunc {
 	serverMux.HandleFunc("/api/admin/profiles/reset-token", corsHandler(adminHandlers.ProfilesResetTokenHandler))
 	serverMux.HandleFunc("/api/admin/profiles/add-profile", corsHandler(adminHandlers.ProfileAddHandler))
 	serverMux.HandleFunc("/api/admin/profiles/remove-profile", corsHandler(adminHandlers.ProfileRemoveHandler))
+	serverMux.HandleFunc("/api/admin/profiles/add-token", corsHandler(adminHandlers.ProfileAddTokenHandler))
+	serverMux.HandleFunc("/api/admin/profiles/remove-token", corsHandler(adminHandlers.ProfileRemoveTokenHandler))
+	serverMux.HandleFunc("/api/admin/profiles/viewer-token", corsHandler(adminHandlers.ProfileViewerTokenHandler))
+	serverMux.HandleFunc("/api/admin/recording", corsHandler(adminHandlers.RecordingHandler))
+	serverMux.HandleFunc("/api/admin/chat", corsHandler(adminHandlers.ChatModerationHandler))
 
 	// Path middleware
 	debugOutputWebRequests := os.Getenv(environment.DebugIncomingAPIRequest)
 	handler := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
 		if strings.EqualFold(debugOutputWebRequests, "TRUE") {
-			log.Println("Calling path", request.URL.Path)
+			slog.Debug("API: Calling path", "path", request.URL.Path)
 			_, pattern := serverMux.Handler(request)
 
 			if pattern == "" {
-				log.Println("Unmatched path:", request.URL.Path)
+				slog.Debug("API: Unmatched path", "path", request.URL.Path)
 			} else {
-				log.Println("Found pattern", pattern)
+				slog.Debug("API: Found pattern", "pattern", pattern)
 			}
 		}
 
@@ -3,7 +3,7 @@ package handlers
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -12,6 +12,7 @@ import (
 	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 )
 
 func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
@@ -40,11 +41,11 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		}
 
 		if debugSseMessages {
-			log.Println("API.SSE Sending:", msg)
+			slog.Debug("API.SSE Sending", "message", msg)
 		}
 
 		if err := responseController.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
-			log.Println("API.SSE SetWriteDeadline error:", err)
+			slog.Warn("API.SSE SetWriteDeadline error", "error", err)
 			return false
 		}
 
@@ -54,15 +55,15 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		}
 
 		if deadlineErr := responseController.SetWriteDeadline(time.Time{}); deadlineErr != nil && !errors.Is(deadlineErr, http.ErrNotSupported) {
-			log.Println("API.SSE ClearWriteDeadline error:", deadlineErr)
+			slog.Warn("API.SSE ClearWriteDeadline error", "error", deadlineErr)
 			return false
 		}
 
 		if err != nil {
 			if errors.Is(err, os.ErrDeadlineExceeded) {
-				log.Println("API.SSE Write timeout")
+				slog.Debug("API.SSE Write timeout")
 			} else {
-				log.Println("API.SSE Write error:", err)
+				slog.Debug("API.SSE Write error", "error", err)
 			}
 			return false
 		}
@@ -70,7 +71,29 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		return true
 	}
 
+	// Sends the server candidates the stream has not received yet when trickle ICE is enabled.
+	// Returns a channel that is closed when more candidates are available.
+	writeCandidateEvents := func(candidates *utils.ICECandidates, cursor *utils.ICECandidatesCursor) (<-chan struct{}, bool) {
+		if candidates == nil || !utils.IsTrickleICEEnabled() {
+			return nil, true
+		}
+
+		pending, endOfCandidates, changed := candidates.Next(cursor)
+		for _, candidate := range pending {
+			if !writeEvent(utils.GetCandidateEvent(candidate)) {
+				return nil, false
+			}
+		}
+
+		if endOfCandidates && !writeEvent(utils.GetCandidateEvent(candidates.EndOfCandidates())) {
+			return nil, false
+		}
+
+		return changed, true
+	}
+
 	if streamSession, whepSession, foundSession := manager.SessionsManager.GetSessionAndWHEPByID(sessionID); foundSession {
+		statusChanged := streamSession.StatusChanged()
 		if !writeEvent(streamSession.GetSessionStatsEvent()) {
 			return
 		}
@@ -80,14 +103,53 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 			return
 		}
 
+		var candidatesCursor utils.ICECandidatesCursor
+		candidatesChanged, ok := writeCandidateEvents(whepSession.ICECandidates, &candidatesCursor)
+		if !ok {
+			return
+		}
+
+		// Sends the offer of a server initiated renegotiation when one is waiting for the answer of the viewer
+		writeOfferEvent := func() (<-chan struct{}, bool) {
+			renegotiationChanged := whepSession.RenegotiationChanged()
+			if offer := whepSession.GetRenegotiationEvent(); offer != "" && !writeEvent(offer) {
+				return nil, false
+			}
+
+			return renegotiationChanged, true
+		}
+
+		renegotiationChanged, ok := writeOfferEvent()
+		if !ok {
+			return
+		}
+
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("API.SSE: Client disconnected")
+				slog.Debug("API.SSE: Client disconnected")
 				return
+			case <-candidatesChanged:
+				if candidatesChanged, ok = writeCandidateEvents(whepSession.ICECandidates, &candidatesCursor); !ok {
+					return
+				}
+			case <-renegotiationChanged:
+				if renegotiationChanged, ok = writeOfferEvent(); !ok {
+					return
+				}
+			case <-statusChanged:
+				statusChanged = streamSession.StatusChanged()
+				if !writeEvent(streamSession.GetSessionStatsEvent()) {
+					return
+				}
+
+				host := streamSession.Host.Load()
+				if host != nil && !writeEvent(host.GetAvailableLayersEvent()) {
+					return
+				}
 			case <-ticker.C:
 				if whepSession.IsSessionClosed.Load() {
 					return
@@ -105,19 +167,39 @@ func sseHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		}
 	}
 
-	if streamSession, foundSession := manager.SessionsManager.GetSessionByHostSessionID(sessionID); foundSession {
+	if streamSession, host, foundSession := manager.SessionsManager.GetSessionByHostSessionID(sessionID); foundSession {
+		statusChanged := streamSession.StatusChanged()
 		if !writeEvent(streamSession.GetSessionStatsEvent()) {
 			return
 		}
 
+		host.PeerConnectionLock.RLock()
+		hostCandidates := host.ICECandidates
+		host.PeerConnectionLock.RUnlock()
+
+		var candidatesCursor utils.ICECandidatesCursor
+		candidatesChanged, ok := writeCandidateEvents(hostCandidates, &candidatesCursor)
+		if !ok {
+			return
+		}
+
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ctx.Done():
-				log.Println("API.SSE: Client disconnected")
+				slog.Debug("API.SSE: Client disconnected")
 				return
+			case <-candidatesChanged:
+				if candidatesChanged, ok = writeCandidateEvents(hostCandidates, &candidatesCursor); !ok {
+					return
+				}
+			case <-statusChanged:
+				statusChanged = streamSession.StatusChanged()
+				if !writeEvent(streamSession.GetSessionStatsEvent()) {
+					return
+				}
 			case <-ticker.C:
 				if !writeEvent(streamSession.GetSessionStatsEvent()) {
 					return
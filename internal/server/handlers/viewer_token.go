@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+)
+
+var errViewerTokenRequired = errors.New("a valid viewer token is required for this stream")
+
+// WHEP sessions using a viewer token, by token ID.
+// Pending uses are reserved while their session is being set up.
+type viewerTokenUse struct {
+	pending    int
+	sessionIDs []string
+}
+
+var (
+	viewerTokenUsesLock sync.Mutex
+	viewerTokenUses     = map[string]*viewerTokenUse{}
+)
+
+// Returns the claims of the viewer token of the request, sent as the bearer token or in the token query parameter.
+// Nil claims are returned when the request has no viewer token.
+func getViewerTokenClaims(request *http.Request) (*authorization.ViewerTokenClaims, error) {
+	viewerToken := request.URL.Query().Get("token")
+	if bearerToken, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer "); ok && authorization.IsViewerToken(bearerToken) {
+		viewerToken = bearerToken
+	}
+
+	if viewerToken == "" {
+		return nil, nil
+	}
+
+	return authorization.ParseViewerToken(viewerToken)
+}
+
+// Private streams may only be watched with a viewer token for their stream key
+func authorizeViewer(streamKey string, claims *authorization.ViewerTokenClaims) error {
+	if authorization.IsViewerTokenRequired(streamKey) && (claims == nil || !strings.EqualFold(claims.StreamKey, streamKey)) {
+		return errViewerTokenRequired
+	}
+
+	return nil
+}
+
+// Reserves a use of the viewer token, returns false when all of its uses are taken.
+// The reservation is either completed with its WHEP session or released.
+func reserveViewerTokenUse(claims *authorization.ViewerTokenClaims) bool {
+	if claims == nil || claims.MaxUses == 0 {
+		return true
+	}
+
+	viewerTokenUsesLock.Lock()
+	defer viewerTokenUsesLock.Unlock()
+
+	pruneViewerTokenUsesLocked()
+
+	use, ok := viewerTokenUses[claims.ID]
+	if !ok {
+		use = &viewerTokenUse{}
+		viewerTokenUses[claims.ID] = use
+	}
+
+	if use.pending+len(use.sessionIDs) >= claims.MaxUses {
+		return false
+	}
+
+	use.pending++
+	return true
+}
+
+// Completes a reservation with the WHEP session using the viewer token, an empty session ID releases the reservation
+func completeViewerTokenUse(claims *authorization.ViewerTokenClaims, sessionID string) {
+	if claims == nil || claims.MaxUses == 0 {
+		return
+	}
+
+	viewerTokenUsesLock.Lock()
+	defer viewerTokenUsesLock.Unlock()
+
+	use, ok := viewerTokenUses[claims.ID]
+	if !ok {
+		return
+	}
+
+	use.pending--
+	if sessionID != "" {
+		use.sessionIDs = append(use.sessionIDs, sessionID)
+	}
+}
+
+// Uses end when their WHEP session is closed
+func pruneViewerTokenUsesLocked() {
+	for tokenID, use := range viewerTokenUses {
+		use.sessionIDs = slices.DeleteFunc(use.sessionIDs, func(sessionID string) bool {
+			_, found := manager.SessionsManager.GetWHEPSessionByID(sessionID)
+			return !found
+		})
+
+		if use.pending == 0 && len(use.sessionIDs) == 0 {
+			delete(viewerTokenUses, tokenID)
+		}
+	}
+}
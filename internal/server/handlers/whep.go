@@ -1,18 +1,22 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
 	"strings"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
 	"github.com/glimesh/broadcast-box/internal/server/webhook"
 	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 )
 
@@ -39,27 +43,57 @@ func whepHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		sessionID := strings.TrimSpace(segments[len(segments)-1])
 
 		if sessionID == "" {
-			log.Println("API.WHEP.Patch Error: Missing session id")
+			slog.Warn("API.WHEP.Patch Error: Missing session id")
 			helpers.LogHTTPError(responseWriter, "Missing session id", http.StatusBadRequest)
 			return
 		}
 
-		log.Println("API.WHEP.Patch: Patching session", sessionID)
+		slog.Debug("API.WHEP.Patch: Patching session", "sessionId", sessionID)
 		if err := patchHandler(responseWriter, request, sessionID, string(offer)); err != nil {
-			log.Println("API.WHEP.Patch Error:", err)
+			slog.Warn("API.WHEP.Patch Error", "sessionId", sessionID, "error", err)
 			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		}
 
 		return
 	}
 
+	viewerTokenClaims, err := getViewerTokenClaims(request)
+	if err != nil {
+		slog.Warn("API.WHEP: Invalid viewer token", "error", err)
+		helpers.LogHTTPError(responseWriter, "Viewer token was invalid", http.StatusUnauthorized)
+		return
+	}
+
+	identityClaims, err := authorization.GetIdentityTokenClaims(request.Header.Get("Authorization"))
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+		return
+	}
+
+	// A viewer token sent as the bearer token watches the stream key of its claims
 	token := helpers.ResolveBearerToken(request.Header.Get("Authorization"))
+	if token == "" && viewerTokenClaims != nil {
+		token = viewerTokenClaims.StreamKey
+	}
+
+	// Identity tokens allowed to watch grant the access of a viewer token for their stream key
+	if identityClaims != nil {
+		if !identityClaims.Allows(authorization.IdentityActionWatch) {
+			slog.Warn("API.WHEP: Identity token is not allowed to watch", "streamKey", identityClaims.StreamKey)
+			helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+			return
+		}
+
+		token = identityClaims.StreamKey
+		viewerTokenClaims = identityClaims.AsViewerTokenClaims()
+	}
+
 	if token == "" {
 		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
 		return
 	}
 
-	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" {
+	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" && identityClaims == nil {
 		token, err = webhook.CallWebhook(webhookURL, webhook.WHEPConnect, token, request)
 		if err != nil {
 			responseWriter.WriteHeader(http.StatusUnauthorized)
@@ -67,39 +101,87 @@ func whepHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		}
 	}
 
+	if err := authorizeViewer(token, viewerTokenClaims); err != nil {
+		slog.Warn("API.WHEP: Unauthorized viewer of private stream", "streamKey", token)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if !reserveViewerTokenUse(viewerTokenClaims) {
+		slog.Warn("API.WHEP: Viewer token has no uses left", "streamKey", token, "tokenId", viewerTokenClaims.ID)
+		helpers.LogHTTPError(responseWriter, "Viewer token has no uses left", http.StatusTooManyRequests)
+		return
+	}
+
 	whipAnswer, sessionID, err := webrtc.WHEP(string(offer), token)
-	if err != nil {
-		log.Println("API.WHEP: Setup Error", err.Error())
+	completeViewerTokenUse(viewerTokenClaims, sessionID)
+	if errors.Is(err, codecs.ErrUnsupportedCodec) {
+		slog.Warn("API.WHEP: Unsupported codec", "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusNotAcceptable)
+		return
+	} else if err != nil {
+		slog.Error("API.WHEP: Setup Error", "error", err)
 		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	responseWriter.Header().Add("Link", `<`+"/api/sse/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:server-sent-events"; events="layers"`)
+	sseEvents := "layers,offer"
+	if utils.IsTrickleICEEnabled() {
+		sseEvents += ",candidate"
+	}
+
+	responseWriter.Header().Add("Link", `<`+"/api/sse/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:server-sent-events"; events="`+sseEvents+`"`)
 	responseWriter.Header().Add("Link", `<`+"/api/layer/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:layer"`)
 
 	responseWriter.Header().Add("Location", "/api/whep/"+sessionID)
+	responseWriter.Header().Add("ETag", `"`+utils.GetSDPAttribute(whipAnswer, "ice-ufrag")+`"`)
 	responseWriter.Header().Add("Content-Type", "application/sdp")
 	responseWriter.WriteHeader(http.StatusCreated)
 
 	if _, err = fmt.Fprint(responseWriter, whipAnswer); err != nil {
-		log.Println("API.WHEP:", err)
+		slog.Warn("API.WHEP Error", "error", err)
 	} else {
-		log.Println("API.WHEP: Completed")
+		slog.Debug("API.WHEP: Completed")
 	}
 }
 
 func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body string) error {
 	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	// Answer to an offer sent over SSE when the server renegotiates the session
+	if err == nil && mediaType == "application/sdp" {
+		if err := webrtc.HandleWHEPAnswer(sessionID, body); err != nil {
+			return err
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
 	if err != nil || mediaType != "application/trickle-ice-sdpfrag" {
 		helpers.LogHTTPError(res, "invalid content type", http.StatusUnsupportedMediaType)
 		return err
 	}
 
-	if err = webrtc.HandleWHEPPatch(sessionID, body); err != nil {
+	answer, err := webrtc.HandleWHEPPatch(sessionID, body)
+	if errors.Is(err, whep.ErrRenegotiationPending) {
+		helpers.LogHTTPError(res, err.Error(), http.StatusConflict)
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	res.WriteHeader(http.StatusNoContent)
+	// Trickled candidates are acknowledged without a body unless server candidates are pending,
+	// an ICE restart returns the new credentials
+	if answer == "" {
+		res.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	res.Header().Add("ETag", `"`+utils.GetSDPAttribute(answer, "ice-ufrag")+`"`)
+	res.Header().Add("Content-Type", "application/trickle-ice-sdpfrag")
+	res.WriteHeader(http.StatusOK)
 
-	return nil
+	_, err = fmt.Fprint(res, answer)
+	return err
 }
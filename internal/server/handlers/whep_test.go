@@ -6,8 +6,11 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
 )
 
 type whepWebhookPayload struct {
@@ -64,3 +67,61 @@ func TestWHEPHandlerCallsWebhook(t *testing.T) {
 		t.Fatal("expected webhook to be called")
 	}
 }
+
+func TestWHEPHandlerRequiresViewerTokenForPrivateStreams(t *testing.T) {
+	t.Setenv(environment.StreamProfilePath, t.TempDir())
+	t.Setenv(environment.ViewerTokenSecret, "secret")
+
+	token, err := authorization.CreateProfile("private_stream", authorization.TokenOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := authorization.UpdateProfile(token, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	otherViewerToken, err := authorization.CreateViewerToken("other_stream", time.Minute, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/api/whep", "/api/whep?token=" + otherViewerToken, "/api/whep?token=invalid.viewer.token"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("v=0"))
+		req.Header.Set("Authorization", "Bearer private_stream")
+
+		resp := httptest.NewRecorder()
+		whepHandler(resp, req)
+
+		if resp.Code != http.StatusUnauthorized {
+			t.Fatalf("expected status %d for %s, got %d", http.StatusUnauthorized, path, resp.Code)
+		}
+	}
+}
+
+func TestViewerTokenUses(t *testing.T) {
+	manager.SessionsManager = &manager.SessionManager{}
+	manager.SessionsManager.Setup()
+
+	claims := &authorization.ViewerTokenClaims{ID: "viewer-token-uses", MaxUses: 1}
+
+	if !reserveViewerTokenUse(claims) {
+		t.Fatal("expected the first use to be reserved")
+	}
+
+	if reserveViewerTokenUse(claims) {
+		t.Fatal("expected no use left while the first use is pending")
+	}
+
+	// A failed session releases its reservation
+	completeViewerTokenUse(claims, "")
+	if !reserveViewerTokenUse(claims) {
+		t.Fatal("expected the released use to be reserved again")
+	}
+
+	// Uses of sessions that are no longer active are released
+	completeViewerTokenUse(claims, "closed-session")
+	if !reserveViewerTokenUse(claims) {
+		t.Fatal("expected the use of a closed session to be released")
+	}
+}
@@ -2,9 +2,11 @@ package whip
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
@@ -37,7 +39,7 @@ func ProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
 				responseWriter,
 				"Internal Server Error",
 				http.StatusInternalServerError)
-			log.Println(err.Error())
+			slog.Error("API.WHIP.Profile Error", "error", err)
 		}
 
 		responseWriter.Header().Add("Content-Type", "application/json")
@@ -45,7 +47,7 @@ func ProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
 
 	// Update Profile
 	if request.Method == "POST" {
-		log.Println("Updating Profile")
+		slog.Debug("API.WHIP.Profile: Updating Profile")
 
 		body, _ := io.ReadAll(request.Body)
 		var payload updateProfilePayload
@@ -54,7 +56,7 @@ func ProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
 				responseWriter,
 				"Internal Server Error",
 				http.StatusInternalServerError)
-			log.Println("Profile Update Error:", err)
+			slog.Warn("API.WHIP.Profile Update Error", "error", err)
 			return
 		}
 
@@ -65,7 +67,7 @@ func ProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
 				responseWriter,
 				"Internal Server Error",
 				http.StatusInternalServerError)
-			log.Println(err.Error())
+			slog.Error("API.WHIP.Profile Error", "error", err)
 			return
 		}
 
@@ -77,3 +79,43 @@ func ProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
 
 	responseWriter.Header().Add("Content-Type", "application/json")
 }
+
+type viewerTokenPayload struct {
+	// Seconds until the token expires, defaults to a day
+	ExpiresIn int `json:"expiresIn"`
+	MaxUses   int `json:"maxUses"`
+}
+
+type viewerTokenResponse struct {
+	Token string `json:"token"`
+}
+
+// Mints a viewer token for the private stream of the profile
+func ViewerTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		helpers.LogHTTPError(responseWriter, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload viewerTokenPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); err != nil {
+		helpers.LogHTTPError(responseWriter, "Error resolving request", http.StatusBadRequest)
+		return
+	}
+
+	token := helpers.ResolveBearerToken(request.Header.Get("Authorization"))
+	viewerToken, err := authorization.CreateViewerTokenForProfile(token, time.Duration(payload.ExpiresIn)*time.Second, payload.MaxUses)
+	if errors.Is(err, authorization.ErrProfileNotFound) || errors.Is(err, authorization.ErrTokenExpired) || errors.Is(err, authorization.ErrTokenScope) {
+		helpers.LogHTTPError(responseWriter, "Unauthorized", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		slog.Warn("API.WHIP.Profile.ViewerToken Error", "error", err)
+		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseWriter.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(responseWriter).Encode(viewerTokenResponse{Token: viewerToken}); err != nil {
+		slog.Warn("API.WHIP.Profile.ViewerToken Error", "error", err)
+	}
+}
@@ -3,7 +3,7 @@ package whip
 import (
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
 	"net/http"
 	"os"
@@ -14,6 +14,7 @@ import (
 	"github.com/glimesh/broadcast-box/internal/server/helpers"
 	"github.com/glimesh/broadcast-box/internal/server/webhook"
 	"github.com/glimesh/broadcast-box/internal/webrtc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 )
 
 func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
@@ -25,14 +26,31 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	authHeader := request.Header.Get("Authorization")
 
 	if authHeader == "" {
-		log.Println("Authorization was not set")
+		slog.Warn("API.WHIP: Authorization was not set")
 		helpers.LogHTTPError(responseWriter, "Authorization was not set", http.StatusBadRequest)
 		return
 	}
 
+	// JWTs of the identity provider carry the stream key and the profile
+	identityClaims, err := authorization.GetIdentityTokenClaims(authHeader)
+	if err != nil {
+		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+		return
+	}
+
 	token := helpers.ResolveBearerToken(authHeader)
+	if identityClaims != nil {
+		if !identityClaims.Allows(authorization.IdentityActionPublish) {
+			slog.Warn("API.WHIP: Identity token is not allowed to publish", "streamKey", identityClaims.StreamKey)
+			helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
+			return
+		}
+
+		token = identityClaims.StreamKey
+	}
+
 	if token == "" {
-		log.Println("Authorization was invalid")
+		slog.Warn("API.WHIP: Authorization was invalid")
 		helpers.LogHTTPError(responseWriter, "Authorization was invalid", http.StatusUnauthorized)
 		return
 	}
@@ -41,14 +59,14 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		sessionID := getSessionIDFromWHIPPath(request.URL.Path)
 
 		if sessionID == "" {
-			log.Println("API.WHIP.Delete Error: Missing session id")
+			slog.Warn("API.WHIP.Delete Error: Missing session id")
 			helpers.LogHTTPError(responseWriter, "Missing session id", http.StatusBadRequest)
 			return
 		}
 
-		log.Println("API.WHIP.Delete: Removing session", sessionID)
+		slog.Info("API.WHIP.Delete: Removing session", "sessionId", sessionID)
 		if err := deleteHandler(responseWriter, sessionID); err != nil {
-			log.Println("API.WHIP.Delete Error:", err)
+			slog.Warn("API.WHIP.Delete Error", "sessionId", sessionID, "error", err)
 			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		}
 
@@ -57,71 +75,45 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 
 	offer, err := io.ReadAll(request.Body)
 	if err != nil || string(offer) == "" {
-		log.Println("Error reading offer")
+		slog.Warn("API.WHIP: Error reading offer")
 		helpers.LogHTTPError(responseWriter, "error reading offer", http.StatusBadRequest)
 		return
 	}
 
-	var userProfile authorization.PublicProfile
+	var webhookProfile *authorization.PublicProfile
 
 	// Stream requires webhook validation
-	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" {
+	if webhookURL := os.Getenv(environment.WebhookURL); webhookURL != "" && identityClaims == nil {
 		streamKey, err := webhook.CallWebhook(webhookURL, webhook.WHIPConnect, token, request)
 		if err != nil {
 			responseWriter.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 
-		userProfile = authorization.PublicProfile{
+		webhookProfile = &authorization.PublicProfile{
 			StreamKey: streamKey,
 			IsPublic:  true,
 			MOTD:      "Welcome to " + streamKey + "'s stream!",
 		}
 	}
 
-	// Stream profile policy
-	switch os.Getenv(environment.StreamProfilePolicy) {
-	// Only approved profiles are allowed to stream
-	case authorization.StreamPolicyReservedOnly:
-		log.Println("Policy:", authorization.StreamPolicyReservedOnly)
-		profile, err := authorization.GetPublicProfile(token)
-		if err != nil {
-			log.Println("Unauthorized login attempt with bearer", token)
-			responseWriter.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		userProfile = *profile
-
-	default:
-		log.Println("Policy:", authorization.StreamPolicyWithReserved)
-
-		// If using a streamKey check if it has been reserved
-		if authorization.IsProfileReserved(token) {
-			log.Println("Unauthorized login attempt with bearer", token, " - Streamkey has been reserved")
-			responseWriter.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-
-		// If its a bearer token, validate and use the profile
-		profile, _ := authorization.GetPublicProfile(token)
-		if profile != nil {
-			userProfile = *profile
-		}
+	// Stream profile policy, identity tokens are authorized by the identity provider unless the stream key is reserved
+	var userProfile *authorization.PublicProfile
+	if identityClaims != nil {
+		userProfile, err = authorization.GetIdentityHostProfile(identityClaims)
+	} else {
+		userProfile, err = authorization.GetHostProfile(token, webhookProfile)
 	}
 
-	// Set default profile in case none is set
-	if userProfile == (authorization.PublicProfile{}) {
-		userProfile = authorization.PublicProfile{
-			StreamKey: token,
-			IsPublic:  true,
-			MOTD:      "Welcome to " + token + "'s stream!",
-		}
+	if err != nil {
+		responseWriter.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
 	if request.Method == http.MethodPatch {
 
 		if contentType := request.Header.Get("Content-Type"); contentType != "application/trickle-ice-sdpfrag" {
-			log.Println("API.WHIP.Patch Error: Invalid patch request")
+			slog.Warn("API.WHIP.Patch Error: Invalid patch request")
 			helpers.LogHTTPError(responseWriter, "Invalid patch request", http.StatusBadRequest)
 			return
 		}
@@ -129,35 +121,41 @@ func WHIPHandler(responseWriter http.ResponseWriter, request *http.Request) {
 		sessionID := getSessionIDFromWHIPPath(request.URL.Path)
 
 		if sessionID == "" {
-			log.Println("API.WHIP.Patch Error: Missing session id")
+			slog.Warn("API.WHIP.Patch Error: Missing session id")
 			helpers.LogHTTPError(responseWriter, "Missing session id", http.StatusBadRequest)
 			return
 		}
 
-		log.Println("API.WHIP.Patch: Patching session", sessionID)
+		slog.Debug("API.WHIP.Patch: Patching session", "sessionId", sessionID)
 		if err := patchHandler(responseWriter, request, sessionID, string(offer)); err != nil {
-			log.Println("API.WHIP.Patch Error:", err)
+			slog.Warn("API.WHIP.Patch Error", "sessionId", sessionID, "error", err)
 			helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		}
 
 		return
 	}
 
-	whipAnswer, sessionID, err := webrtc.WHIP(string(offer), userProfile)
+	whipAnswer, sessionID, err := webrtc.WHIP(string(offer), *userProfile)
 	if err != nil {
 		helpers.LogHTTPError(responseWriter, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	responseWriter.Header().Add("Link", `<`+"/api/sse/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:server-sent-events"; events="status"`)
+	sseEvents := "status"
+	if utils.IsTrickleICEEnabled() {
+		sseEvents += ",candidate"
+	}
+
+	responseWriter.Header().Add("Link", `<`+"/api/sse/"+sessionID+`>; rel="urn:ietf:params:whep:ext:core:server-sent-events"; events="`+sseEvents+`"`)
 	responseWriter.Header().Add("Location", "/api/whip/"+sessionID)
+	responseWriter.Header().Add("ETag", `"`+utils.GetSDPAttribute(whipAnswer, "ice-ufrag")+`"`)
 	responseWriter.Header().Add("Content-Type", "application/sdp")
 	responseWriter.WriteHeader(http.StatusCreated)
 
 	if _, err = fmt.Fprint(responseWriter, whipAnswer); err != nil {
-		log.Println("API.WHIP Error", err)
+		slog.Warn("API.WHIP Error", "error", err)
 	} else {
-		log.Println("API.WHIP Completed")
+		slog.Debug("API.WHIP Completed")
 	}
 
 }
@@ -169,13 +167,24 @@ func patchHandler(res http.ResponseWriter, r *http.Request, sessionID, body stri
 		return err
 	}
 
-	if err = webrtc.HandleWHIPPatch(sessionID, body); err != nil {
+	answer, err := webrtc.HandleWHIPPatch(sessionID, body)
+	if err != nil {
 		return err
 	}
 
-	res.WriteHeader(http.StatusNoContent)
+	// Trickled candidates are acknowledged without a body unless server candidates are pending,
+	// an ICE restart returns the new credentials
+	if answer == "" {
+		res.WriteHeader(http.StatusNoContent)
+		return nil
+	}
 
-	return nil
+	res.Header().Add("ETag", `"`+utils.GetSDPAttribute(answer, "ice-ufrag")+`"`)
+	res.Header().Add("Content-Type", "application/trickle-ice-sdpfrag")
+	res.WriteHeader(http.StatusOK)
+
+	_, err = fmt.Fprint(res, answer)
+	return err
 }
 
 func deleteHandler(res http.ResponseWriter, sessionID string) error {
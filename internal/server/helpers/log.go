@@ -1,11 +1,11 @@
 package helpers
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 func LogHTTPError(responseWriter http.ResponseWriter, error string, code int) {
-	log.Println("LogHTTPError", error)
+	slog.Warn("LogHTTPError", "error", error)
 	http.Error(responseWriter, error, code)
 }
@@ -2,7 +2,7 @@ package server
 
 import (
 	"crypto/tls"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 
@@ -18,10 +18,12 @@ func startHTTPSServer(serverMux http.HandlerFunc) {
 	sslCert := os.Getenv(environment.SSLCert)
 
 	if sslKey == "" {
-		log.Fatal("Missing SSL Key")
+		slog.Error("Missing SSL Key")
+		os.Exit(1)
 	}
 	if sslCert == "" {
-		log.Fatal("Missing SSL Certificate")
+		slog.Error("Missing SSL Certificate")
+		os.Exit(1)
 	}
 
 	server := &http.Server{
@@ -31,7 +33,8 @@ func startHTTPSServer(serverMux http.HandlerFunc) {
 
 	cert, err := tls.LoadX509KeyPair(sslCert, sslKey)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("Could not load SSL certificate", "error", err)
+		os.Exit(1)
 	}
 
 	server.TLSConfig = &tls.Config{
@@ -39,8 +42,9 @@ func startHTTPSServer(serverMux http.HandlerFunc) {
 		Certificates: []tls.Certificate{cert},
 	}
 
-	log.Println("Serving HTTPS server at", getHTTPSAddress())
-	log.Fatal(server.ListenAndServeTLS("", ""))
+	slog.Info("Serving HTTPS server", "address", getHTTPSAddress())
+	slog.Error("HTTPS server stopped", "error", server.ListenAndServeTLS("", ""))
+	os.Exit(1)
 }
 
 func getHTTPSAddress() string {
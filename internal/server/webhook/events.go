@@ -0,0 +1,354 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/google/uuid"
+)
+
+// Lifecycle event delivered to the event webhook
+type EventType string
+
+const (
+	EventStreamStarted EventType = "stream-started"
+	EventStreamEnded   EventType = "stream-ended"
+	EventViewerJoined  EventType = "viewer-joined"
+	EventViewerLeft    EventType = "viewer-left"
+	EventKeyframeStall EventType = "keyframe-stall"
+	EventChatMessage   EventType = "chat-message"
+)
+
+const (
+	defaultEventOutboxPath  = "./event-outbox"
+	defaultEventMaxAttempts = 12
+
+	defaultKeyframeStallTimeout = 10 * time.Second
+
+	initialEventRetryDelay = time.Second
+	maxEventRetryDelay     = 5 * time.Minute
+)
+
+var allEventTypes = []EventType{EventStreamStarted, EventStreamEnded, EventViewerJoined, EventViewerLeft, EventKeyframeStall, EventChatMessage}
+
+// Payload of an event webhook request. Events are delivered at least once and not necessarily in order,
+// receivers can use the ID to ignore repeated deliveries.
+type Event struct {
+	ID        string         `json:"id"`
+	Type      EventType      `json:"type"`
+	StreamKey string         `json:"streamKey"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// Delivers events from the outbox to the event webhook, retrying failed deliveries with backoff
+type eventDelivery struct {
+	url         string
+	secret      string
+	eventTypes  []EventType
+	maxAttempts int
+	client      *http.Client
+	outbox      *eventOutbox
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+var (
+	eventDeliveryLock sync.RWMutex
+	activeDelivery    *eventDelivery
+)
+
+// Starts delivering events when EVENT_WEBHOOK_URL is set.
+// Events left in the outbox by a previous run are delivered as well.
+func StartEventDelivery() error {
+	url := os.Getenv(environment.EventWebhookURL)
+	if url == "" {
+		return nil
+	}
+
+	eventTypes, err := parseEventTypes(os.Getenv(environment.EventWebhookEvents))
+	if err != nil {
+		return err
+	}
+
+	outboxPath := os.Getenv(environment.EventWebhookOutboxPath)
+	if outboxPath == "" {
+		outboxPath = defaultEventOutboxPath
+	}
+
+	maxAttempts := defaultEventMaxAttempts
+	if value := os.Getenv(environment.EventWebhookMaxAttempts); value != "" {
+		if maxAttempts, err = strconv.Atoi(value); err != nil || maxAttempts < 1 {
+			return fmt.Errorf("invalid %s %q", environment.EventWebhookMaxAttempts, value)
+		}
+	}
+
+	delivery, err := newEventDelivery(url, os.Getenv(environment.EventWebhookSecret), eventTypes, maxAttempts, outboxPath)
+	if err != nil {
+		return err
+	}
+
+	eventDeliveryLock.Lock()
+	if activeDelivery != nil {
+		activeDelivery.stop()
+	}
+	activeDelivery = delivery
+	eventDeliveryLock.Unlock()
+
+	slog.Info("Webhook.Events: Delivering events", "events", eventTypes, "pending", delivery.outbox.count())
+	go delivery.run()
+	return nil
+}
+
+// Returns true when events of the type are delivered
+func IsEventEnabled(eventType EventType) bool {
+	eventDeliveryLock.RLock()
+	defer eventDeliveryLock.RUnlock()
+
+	return activeDelivery != nil && slices.Contains(activeDelivery.eventTypes, eventType)
+}
+
+// Adds an event to the outbox, it is delivered in the background. Events are dropped when delivery is disabled.
+func SendEvent(eventType EventType, streamKey string, data map[string]any) {
+	eventDeliveryLock.RLock()
+	delivery := activeDelivery
+	eventDeliveryLock.RUnlock()
+
+	if delivery != nil {
+		delivery.send(eventType, streamKey, data)
+	}
+}
+
+// Sends the event of a message sent in the chat of a stream
+func SendChatMessageEvent(streamKey string, userID string, displayName string, text string) {
+	SendEvent(EventChatMessage, streamKey, map[string]any{
+		"userId":      userID,
+		"displayName": displayName,
+		"text":        text,
+	})
+}
+
+// Sends the lifecycle events of WebRTC sessions
+type SessionEvents struct{}
+
+func (SessionEvents) StreamStarted(streamKey string, hostID string) {
+	SendEvent(EventStreamStarted, streamKey, map[string]any{
+		"sessionId": hostID,
+	})
+}
+
+func (SessionEvents) StreamEnded(streamKey string, duration time.Duration) {
+	SendEvent(EventStreamEnded, streamKey, map[string]any{
+		"durationSeconds": int64(duration.Seconds()),
+	})
+}
+
+func (SessionEvents) ViewerJoined(streamKey string, viewerID string) {
+	SendEvent(EventViewerJoined, streamKey, map[string]any{
+		"sessionId": viewerID,
+	})
+}
+
+func (SessionEvents) ViewerLeft(streamKey string, viewerID string, duration time.Duration) {
+	SendEvent(EventViewerLeft, streamKey, map[string]any{
+		"sessionId":       viewerID,
+		"durationSeconds": int64(duration.Seconds()),
+	})
+}
+
+func (SessionEvents) KeyframeStall(streamKey string, hostID string, layer string, angle string, sinceKeyframe time.Duration) {
+	SendEvent(EventKeyframeStall, streamKey, map[string]any{
+		"sessionId":            hostID,
+		"layer":                layer,
+		"angle":                angle,
+		"secondsSinceKeyframe": int64(sinceKeyframe.Seconds()),
+	})
+}
+
+// Returns the time without keyframes after which a video track is reported as stalled, zero when stalls are not reported
+func (SessionEvents) KeyframeStallTimeout() time.Duration {
+	if !IsEventEnabled(EventKeyframeStall) {
+		return 0
+	}
+
+	timeout, err := time.ParseDuration(os.Getenv(environment.KeyframeStallTimeout))
+	if err != nil || timeout <= 0 {
+		return defaultKeyframeStallTimeout
+	}
+
+	return timeout
+}
+
+func newEventDelivery(url string, secret string, eventTypes []EventType, maxAttempts int, outboxPath string) (*eventDelivery, error) {
+	outbox, err := openEventOutbox(outboxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventDelivery{
+		url:         url,
+		secret:      secret,
+		eventTypes:  eventTypes,
+		maxAttempts: maxAttempts,
+		client:      &http.Client{Timeout: defaultTimeout},
+		outbox:      outbox,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+func (d *eventDelivery) send(eventType EventType, streamKey string, data map[string]any) {
+	if !slices.Contains(d.eventTypes, eventType) {
+		return
+	}
+
+	event := Event{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		StreamKey: streamKey,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	if err := d.outbox.add(event); err != nil {
+		slog.Error("Webhook.Events: Event could not be added to the outbox", "type", eventType, "streamKey", streamKey, "error", err)
+		return
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Delivers due events one at a time, waiting for new events or the next retry in between
+func (d *eventDelivery) run() {
+	for {
+		event, nextAttempt := d.outbox.next(time.Now())
+		if event != nil {
+			d.deliver(event)
+			continue
+		}
+
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if !nextAttempt.IsZero() {
+			timer = time.NewTimer(time.Until(nextAttempt))
+			retry = timer.C
+		}
+
+		select {
+		case <-d.done:
+			return
+		case <-d.wake:
+		case <-retry:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func (d *eventDelivery) stop() {
+	close(d.done)
+}
+
+func (d *eventDelivery) deliver(event *outboxEvent) {
+	err := d.post(event.Event)
+	if err == nil {
+		d.outbox.complete(event)
+		return
+	}
+
+	attempts := event.Attempts + 1
+	if attempts >= d.maxAttempts {
+		slog.Error("Webhook.Events: Event dropped after failed deliveries", "id", event.Event.ID, "type", event.Event.Type, "attempts", attempts, "error", err)
+		d.outbox.complete(event)
+		return
+	}
+
+	delay := getEventRetryDelay(attempts)
+	slog.Warn("Webhook.Events: Delivery failed, retrying", "id", event.Event.ID, "type", event.Event.Type, "attempts", attempts, "retryIn", delay, "error", err)
+	d.outbox.retry(event, attempts, time.Now().Add(delay))
+}
+
+// Posts the event, the body is signed with the secret in the X-Broadcast-Box-Signature header when configured
+func (d *eventDelivery) post(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Broadcast-Box-Event", string(event.Type))
+	if d.secret != "" {
+		mac := hmac.New(sha256.New, []byte(d.secret))
+		mac.Write(body)
+		request.Header.Set("X-Broadcast-Box-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	if err := response.Body.Close(); err != nil {
+		slog.Warn("Webhook.Events: Error closing response body", "error", err)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("event webhook returned status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// Doubles the delay of each retry up to the maximum, with jitter so retries of several events spread out
+func getEventRetryDelay(attempts int) time.Duration {
+	delay := maxEventRetryDelay
+	if attempts < 20 {
+		delay = min(initialEventRetryDelay<<(attempts-1), maxEventRetryDelay)
+	}
+
+	return delay - time.Duration(rand.Int64N(int64(delay)/5+1))
+}
+
+// Parses a comma separated list of event types, an empty list selects every event type
+func parseEventTypes(value string) ([]EventType, error) {
+	if strings.TrimSpace(value) == "" {
+		return slices.Clone(allEventTypes), nil
+	}
+
+	eventTypes := []EventType{}
+	for eventType := range strings.SplitSeq(value, ",") {
+		eventType := EventType(strings.ToLower(strings.TrimSpace(eventType)))
+		if !slices.Contains(allEventTypes, eventType) {
+			return nil, fmt.Errorf("unknown event type %q", eventType)
+		}
+
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	return eventTypes, nil
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEventDelivery(t *testing.T) {
+	isFailing := true
+	events := make(chan Event, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get("X-Broadcast-Box-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("unexpected signature %q", r.Header.Get("X-Broadcast-Box-Signature"))
+		}
+
+		if isFailing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var event Event
+		_ = json.Unmarshal(body, &event)
+		events <- event
+	}))
+	defer server.Close()
+
+	outboxPath := t.TempDir()
+	delivery, err := newEventDelivery(server.URL, "secret", []EventType{EventStreamEnded}, 3, outboxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delivery.send(EventStreamStarted, "stream", nil)
+	delivery.send(EventStreamEnded, "stream", map[string]any{"durationSeconds": 42})
+
+	// Events are kept in the outbox until they are delivered, also over a restart
+	delivery, err = newEventDelivery(server.URL, "secret", []EventType{EventStreamEnded}, 3, outboxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	event, _ := delivery.outbox.next(now)
+	if event == nil || event.Event.Type != EventStreamEnded || delivery.outbox.count() != 1 {
+		t.Fatalf("expected only the stream ended event in the outbox, got %+v", event)
+	}
+
+	delivery.deliver(event)
+	if event.Attempts != 1 {
+		t.Fatalf("expected one failed attempt, got %d", event.Attempts)
+	}
+
+	if due, nextAttempt := delivery.outbox.next(now); due != nil || !nextAttempt.After(now) {
+		t.Fatalf("expected the event to be retried later, got %+v at %v", due, nextAttempt)
+	}
+
+	isFailing = false
+	event, _ = delivery.outbox.next(now.Add(maxEventRetryDelay))
+	delivery.deliver(event)
+
+	select {
+	case delivered := <-events:
+		if delivered.StreamKey != "stream" || delivered.Data["durationSeconds"] != float64(42) {
+			t.Fatalf("unexpected event %+v", delivered)
+		}
+	default:
+		t.Fatal("expected the event to be delivered")
+	}
+
+	if files, _ := os.ReadDir(outboxPath); len(files) != 0 || delivery.outbox.count() != 0 {
+		t.Fatalf("expected the outbox to be empty, got %d files", len(files))
+	}
+}
@@ -0,0 +1,174 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events beyond this count are dropped until the outbox is delivered
+const maxOutboxEvents = 10000
+
+var errOutboxFull = errors.New("event outbox is full")
+
+// Event waiting for delivery, persisted until it is delivered or dropped
+type outboxEvent struct {
+	Event       Event     `json:"event"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// Keeps each pending event as a file in the outbox folder, so events survive a restart
+type eventOutbox struct {
+	lock   sync.Mutex
+	path   string
+	events []*outboxEvent // Ordered by creation
+}
+
+func openEventOutbox(path string) (*eventOutbox, error) {
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	outbox := &eventOutbox{path: path}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(path, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var event outboxEvent
+		if err := json.Unmarshal(data, &event); err != nil || event.Event.ID+".json" != file.Name() {
+			slog.Warn("Webhook.Events: Skipping unreadable outbox event", "fileName", file.Name(), "error", err)
+			continue
+		}
+
+		outbox.events = append(outbox.events, &event)
+	}
+
+	slices.SortFunc(outbox.events, func(a, b *outboxEvent) int {
+		return a.Event.CreatedAt.Compare(b.Event.CreatedAt)
+	})
+
+	return outbox, nil
+}
+
+func (o *eventOutbox) add(event Event) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if len(o.events) >= maxOutboxEvents {
+		return errOutboxFull
+	}
+
+	outboxEvent := &outboxEvent{Event: event}
+	if err := o.writeLocked(outboxEvent); err != nil {
+		return err
+	}
+
+	o.events = append(o.events, outboxEvent)
+	return nil
+}
+
+// Returns the oldest event that is due, or when there is none the time the next event is due
+func (o *eventOutbox) next(now time.Time) (*outboxEvent, time.Time) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	nextAttempt := time.Time{}
+	for _, event := range o.events {
+		if !event.NextAttempt.After(now) {
+			return event, time.Time{}
+		}
+
+		if nextAttempt.IsZero() || event.NextAttempt.Before(nextAttempt) {
+			nextAttempt = event.NextAttempt
+		}
+	}
+
+	return nil, nextAttempt
+}
+
+// Removes a delivered or dropped event
+func (o *eventOutbox) complete(event *outboxEvent) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.events = slices.DeleteFunc(o.events, func(e *outboxEvent) bool {
+		return e == event
+	})
+
+	if err := os.Remove(o.getFilePath(event)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Webhook.Events: Error removing outbox event", "id", event.Event.ID, "error", err)
+	}
+}
+
+// Schedules the next delivery attempt of an event
+func (o *eventOutbox) retry(event *outboxEvent, attempts int, nextAttempt time.Time) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	event.Attempts = attempts
+	event.NextAttempt = nextAttempt
+	if err := o.writeLocked(event); err != nil {
+		slog.Warn("Webhook.Events: Error updating outbox event", "id", event.Event.ID, "error", err)
+	}
+}
+
+func (o *eventOutbox) count() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return len(o.events)
+}
+
+// Writes the event to a temporary file that replaces the event file, a restart never reads a partially written event
+func (o *eventOutbox) writeLocked(event *outboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(o.path, ".event-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), o.getFilePath(event))
+}
+
+func (o *eventOutbox) getFilePath(event *outboxEvent) string {
+	return filepath.Join(o.path, event.Event.ID+".json")
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/glimesh/broadcast-box/internal/metrics"
 )
 
 const defaultTimeout = time.Second * 5
@@ -30,8 +32,16 @@ const (
 	WHEPConnect action = "whep-connect"
 )
 
-func CallWebhook(url string, action action, bearerToken string, request *http.Request) (string, error) {
+func CallWebhook(url string, action action, bearerToken string, request *http.Request) (streamKey string, err error) {
 	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+
+		metrics.WebhookLatency.Observe(time.Since(start), string(action), result)
+	}()
 
 	queryParams := make(map[string]string)
 	for k, v := range request.URL.Query() {
@@ -70,7 +80,7 @@ func CallWebhook(url string, action action, bearerToken string, request *http.Re
 	defer func() {
 		err := resp.Body.Close()
 		if err != nil {
-			log.Println("webhook request failed closing response body")
+			slog.Warn("webhook request failed closing response body", "error", err)
 		}
 	}()
 
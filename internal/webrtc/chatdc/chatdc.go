@@ -2,11 +2,16 @@ package chatdc
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -23,27 +28,55 @@ const DataChannelLabel = "bb-chat-v1"
 const (
 	inboundTypeSend = "chat.send"
 
-	outboundTypeConnected = "chat.connected"
-	outboundTypeHistory   = "chat.history"
-	outboundTypeMessage   = "chat.message"
-	outboundTypeAck       = "chat.ack"
-	outboundTypeError     = "chat.error"
+	// Moderation commands, available after authenticating with the admin token or the token of the stream profile
+	inboundTypeAuth     = "chat.auth"
+	inboundTypeDelete   = "chat.delete"
+	inboundTypeTimeout  = "chat.timeout"
+	inboundTypeBan      = "chat.ban"
+	inboundTypeUnban    = "chat.unban"
+	inboundTypeSlowMode = "chat.slowmode"
+	inboundTypeFilter   = "chat.filter"
+
+	outboundTypeConnected     = "chat.connected"
+	outboundTypeHistory       = "chat.history"
+	outboundTypeMessage       = "chat.message"
+	outboundTypeDelete        = "chat.delete"
+	outboundTypeModeration    = "chat.moderation"
+	outboundTypeAuthenticated = "chat.authenticated"
+	outboundTypeAck           = "chat.ack"
+	outboundTypeError         = "chat.error"
+
+	// Codes of chat.error messages that clients can react to
+	errorCodeRateLimited = "rate_limited"
+	errorCodeBanned      = "banned"
+	errorCodeFiltered    = "filtered"
+	errorCodeWait        = "wait"
 )
 
 type inboundMessage struct {
-	Type          string `json:"type"`
-	ClientMessage string `json:"clientMsgId,omitempty"`
-	Text          string `json:"text,omitempty"`
-	DisplayName   string `json:"displayName,omitempty"`
+	Type            string   `json:"type"`
+	ClientMessage   string   `json:"clientMsgId,omitempty"`
+	Text            string   `json:"text,omitempty"`
+	DisplayName     string   `json:"displayName,omitempty"`
+	Token           string   `json:"token,omitempty"`
+	MessageID       string   `json:"messageId,omitempty"`
+	UserID          string   `json:"userId,omitempty"`
+	DurationSeconds int64    `json:"durationSeconds,omitempty"`
+	ByAddress       bool     `json:"byAddress,omitempty"`
+	Words           []string `json:"words,omitempty"`
 }
 
 type outboundMessage struct {
-	Type          string       `json:"type"`
-	ClientMessage string       `json:"clientMsgId,omitempty"`
-	Error         string       `json:"error,omitempty"`
-	EventID       uint64       `json:"eventId,omitempty"`
-	Message       chat.Message `json:"message,omitempty"`
-	Events        []chat.Event `json:"events,omitempty"`
+	Type          string                `json:"type"`
+	ClientMessage string                `json:"clientMsgId,omitempty"`
+	Error         string                `json:"error,omitempty"`
+	Code          string                `json:"code,omitempty"`
+	EventID       uint64                `json:"eventId,omitempty"`
+	UserID        string                `json:"userId,omitempty"`
+	Action        string                `json:"action,omitempty"`
+	Message       chat.Message          `json:"message,omitempty"`
+	Moderation    *chat.ModerationEvent `json:"moderation,omitempty"`
+	Events        []chat.Event          `json:"events,omitempty"`
 }
 
 func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.DataChannel) {
@@ -51,8 +84,10 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 		return
 	}
 
+	logger := slog.With("streamKey", streamKey, "sessionId", peerID)
+
 	if h.manager == nil {
-		log.Println("ChatDC.Bind: chat manager not configured")
+		logger.Warn("ChatDC.Bind: chat manager not configured")
 		return
 	}
 
@@ -60,7 +95,10 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 		closeSubscription func()
 		closeLock         sync.Mutex
 		writeLock         sync.Mutex
+		chatSessionID     atomic.Value
+		isModerator       atomic.Bool
 	)
+	chatSessionID.Store("")
 	closeSubscription = func() {}
 
 	runCloseSubscription := func() {
@@ -72,7 +110,7 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 	send := func(payload outboundMessage) bool {
 		data, err := json.Marshal(payload)
 		if err != nil {
-			log.Println("ChatDC.Bind: marshal error", err)
+			logger.Error("ChatDC.Bind: marshal error", "error", err)
 			return false
 		}
 
@@ -80,7 +118,7 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 		defer writeLock.Unlock()
 
 		if err := dataChannel.SendText(string(data)); err != nil {
-			log.Println("ChatDC.Bind: send error", err)
+			logger.Debug("ChatDC.Bind: send error", "error", err)
 			return false
 		}
 
@@ -88,7 +126,10 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 	}
 
 	dataChannel.OnOpen(func() {
-		log.Println("ChatDC.Bind: open", streamKey, peerID)
+		logger.Info("ChatDC.Bind: open")
+
+		sessionID := h.manager.ConnectFrom(streamKey, getRemoteAddress(dataChannel))
+		chatSessionID.Store(sessionID)
 
 		ch, unsubscribe, history, err := h.manager.SubscribeStream(streamKey, 0)
 		if err != nil {
@@ -99,7 +140,7 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 		closeLock.Lock()
 		closeSubscription = sync.OnceFunc(unsubscribe)
 		closeLock.Unlock()
-		if !send(outboundMessage{Type: outboundTypeConnected}) {
+		if !send(outboundMessage{Type: outboundTypeConnected, UserID: chat.UserIDForSession(sessionID)}) {
 			runCloseSubscription()
 			return
 		}
@@ -113,12 +154,21 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 
 		go func() {
 			for event := range ch {
+				var payload outboundMessage
 				switch event.Type {
 				case chat.EventTypeMessage:
-					if !send(outboundMessage{Type: outboundTypeMessage, EventID: event.ID, Message: event.Message}) {
-						runCloseSubscription()
-						return
-					}
+					payload = outboundMessage{Type: outboundTypeMessage, EventID: event.ID, Message: event.Message}
+				case chat.EventTypeDelete:
+					payload = outboundMessage{Type: outboundTypeDelete, Moderation: event.Moderation}
+				case chat.EventTypeTimeout, chat.EventTypeBan, chat.EventTypeUnban, chat.EventTypeSlowMode:
+					payload = outboundMessage{Type: outboundTypeModeration, Action: event.Type, Moderation: event.Moderation}
+				default:
+					continue
+				}
+
+				if !send(payload) {
+					runCloseSubscription()
+					return
 				}
 			}
 		}()
@@ -146,7 +196,33 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 				return
 			}
 
-			if err := h.manager.SendToStream(streamKey, text, displayName); err != nil {
+			sessionID, _ := chatSessionID.Load().(string)
+			if sessionID == "" {
+				_ = send(outboundMessage{Type: outboundTypeError, Error: "chat is not connected", ClientMessage: inbound.ClientMessage})
+				return
+			}
+
+			if err := h.manager.Send(sessionID, text, displayName); err != nil {
+				_ = send(outboundMessage{Type: outboundTypeError, Error: err.Error(), Code: getErrorCode(err), ClientMessage: inbound.ClientMessage})
+				return
+			}
+
+			_ = send(outboundMessage{Type: outboundTypeAck, ClientMessage: inbound.ClientMessage})
+		case inboundTypeAuth:
+			if !authorization.IsStreamModerator(inbound.Token, streamKey) {
+				_ = send(outboundMessage{Type: outboundTypeError, Error: "unauthorized", ClientMessage: inbound.ClientMessage})
+				return
+			}
+
+			isModerator.Store(true)
+			_ = send(outboundMessage{Type: outboundTypeAuthenticated, ClientMessage: inbound.ClientMessage})
+		case inboundTypeDelete, inboundTypeTimeout, inboundTypeBan, inboundTypeUnban, inboundTypeSlowMode, inboundTypeFilter:
+			if !isModerator.Load() {
+				_ = send(outboundMessage{Type: outboundTypeError, Error: "unauthorized", ClientMessage: inbound.ClientMessage})
+				return
+			}
+
+			if err := h.moderate(streamKey, inbound); err != nil {
 				_ = send(outboundMessage{Type: outboundTypeError, Error: err.Error(), ClientMessage: inbound.ClientMessage})
 				return
 			}
@@ -158,12 +234,70 @@ func (h *Handler) Bind(streamKey string, peerID string, dataChannel *webrtc.Data
 	})
 
 	dataChannel.OnClose(func() {
-		log.Println("ChatDC.Bind: closed", streamKey, peerID)
+		logger.Info("ChatDC.Bind: closed")
 		runCloseSubscription()
 	})
 
 	dataChannel.OnError(func(err error) {
-		log.Println("ChatDC.Bind: error", streamKey, peerID, err)
+		logger.Warn("ChatDC.Bind: error", "error", err)
 		runCloseSubscription()
 	})
 }
+
+// Apply a moderation command to the chat of the stream
+func (h *Handler) moderate(streamKey string, inbound inboundMessage) error {
+	slog.Info("ChatDC.Moderate", "streamKey", streamKey, "type", inbound.Type)
+
+	duration := time.Duration(inbound.DurationSeconds) * time.Second
+
+	switch inbound.Type {
+	case inboundTypeDelete:
+		return h.manager.DeleteMessage(streamKey, inbound.MessageID)
+	case inboundTypeTimeout:
+		return h.manager.TimeoutUser(streamKey, inbound.UserID, duration)
+	case inboundTypeBan:
+		return h.manager.BanUser(streamKey, inbound.UserID, inbound.ByAddress)
+	case inboundTypeUnban:
+		return h.manager.UnbanUser(streamKey, inbound.UserID)
+	case inboundTypeSlowMode:
+		return h.manager.SetSlowMode(streamKey, duration)
+	case inboundTypeFilter:
+		h.manager.SetWordFilter(streamKey, inbound.Words)
+		return nil
+	default:
+		return fmt.Errorf("unsupported message type")
+	}
+}
+
+// Returns the chat.error code of errors returned when sending a message
+func getErrorCode(err error) string {
+	var waitError *chat.WaitError
+
+	switch {
+	case errors.Is(err, chat.ErrRateLimited):
+		return errorCodeRateLimited
+	case errors.Is(err, chat.ErrBanned):
+		return errorCodeBanned
+	case errors.Is(err, chat.ErrFiltered):
+		return errorCodeFiltered
+	case errors.As(err, &waitError):
+		return errorCodeWait
+	default:
+		return ""
+	}
+}
+
+// Returns the address of the remote candidate the data channel is connected through
+func getRemoteAddress(dataChannel *webrtc.DataChannel) string {
+	sctpTransport := dataChannel.Transport()
+	if sctpTransport == nil || sctpTransport.Transport() == nil {
+		return ""
+	}
+
+	pair, err := sctpTransport.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil || pair.Remote == nil {
+		return ""
+	}
+
+	return pair.Remote.Address
+}
@@ -19,7 +19,7 @@ const (
 	VideoTrackCodecVP9
 	VideoTrackCodecAV1
 
-	audioTrackCodecOpus
+	AudioTrackCodecOpus
 )
 
 var videoRTCPFeedback = []webrtc.RTCPFeedback{
@@ -162,12 +162,26 @@ func GetDefaultTracks(streamKey string) (audioTrack *TrackMultiCodec, videoTrack
 	return audioTrack, videoTrack
 }
 
+// Orders camera angles by their label, the default angle first
+func CompareVideoAngles(a string, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == VideoTrackLabelDefault:
+		return -1
+	case b == VideoTrackLabelDefault:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
+
 func GetAudioTrackCodec(codec string) TrackCodeType {
 	lowerCase := strings.ToLower(codec)
 
 	switch {
 	case strings.Contains(lowerCase, strings.ToLower(webrtc.MimeTypeOpus)):
-		return audioTrackCodecOpus
+		return AudioTrackCodecOpus
 	}
 
 	return 0
@@ -0,0 +1,75 @@
+package codecs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/sdp/v3"
+	"github.com/pion/webrtc/v4"
+)
+
+var ErrUnsupportedCodec = errors.New("offer does not support the codec of the stream")
+
+// Returns the mime type of the codec, empty for unknown codecs
+func GetMimeType(codec TrackCodeType) string {
+	switch codec {
+	case VideoTrackCodecH264:
+		return webrtc.MimeTypeH264
+	case VideoTrackCodecH265:
+		return webrtc.MimeTypeH265
+	case VideoTrackCodecVP8:
+		return webrtc.MimeTypeVP8
+	case VideoTrackCodecVP9:
+		return webrtc.MimeTypeVP9
+	case VideoTrackCodecAV1:
+		return webrtc.MimeTypeAV1
+	case AudioTrackCodecOpus:
+		return webrtc.MimeTypeOpus
+	}
+
+	return ""
+}
+
+// Returns an error wrapping ErrUnsupportedCodec when the offer has media of the kind, but none of its formats use the codec.
+// Offers without media of the kind and unknown codecs are accepted.
+func ValidateOfferCodec(offer string, kind webrtc.RTPCodecType, codec TrackCodeType) error {
+	if codec == 0 {
+		return nil
+	}
+
+	var parsed sdp.SessionDescription
+	if err := parsed.Unmarshal([]byte(offer)); err != nil {
+		return err
+	}
+
+	hasMedia := false
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media != kind.String() || media.MediaName.Port.Value == 0 {
+			continue
+		}
+		hasMedia = true
+
+		for _, attribute := range media.Attributes {
+			if attribute.Key != "rtpmap" {
+				continue
+			}
+
+			// a=rtpmap:<payload type> <encoding name>/<clock rate>[/<channels>]
+			_, encoding, _ := strings.Cut(attribute.Value, " ")
+			name, _, _ := strings.Cut(encoding, "/")
+			mimeType := kind.String() + "/" + name
+
+			if (kind == webrtc.RTPCodecTypeVideo && GetVideoTrackCodec(mimeType) == codec) ||
+				(kind == webrtc.RTPCodecTypeAudio && GetAudioTrackCodec(mimeType) == codec) {
+				return nil
+			}
+		}
+	}
+
+	if !hasMedia {
+		return nil
+	}
+
+	return fmt.Errorf("%w, the stream is sent as %s", ErrUnsupportedCodec, GetMimeType(codec))
+}
@@ -0,0 +1,50 @@
+package codecs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+const testOfferHeader = "v=0\r\n" +
+	"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+	"s=-\r\n" +
+	"t=0 0\r\n"
+
+const testOfferAudio = "m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"a=rtpmap:111 opus/48000/2\r\n"
+
+func TestValidateOfferCodec(t *testing.T) {
+	vp8Offer := testOfferHeader + testOfferAudio +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96 97\r\n" +
+		"c=IN IP4 0.0.0.0\r\n" +
+		"a=rtpmap:96 VP8/90000\r\n" +
+		"a=rtpmap:97 rtx/90000\r\n"
+
+	for _, test := range []struct {
+		name          string
+		offer         string
+		kind          webrtc.RTPCodecType
+		codec         TrackCodeType
+		isUnsupported bool
+	}{
+		{"offered video codec", vp8Offer, webrtc.RTPCodecTypeVideo, VideoTrackCodecVP8, false},
+		{"missing video codec", vp8Offer, webrtc.RTPCodecTypeVideo, VideoTrackCodecH264, true},
+		{"offered audio codec", vp8Offer, webrtc.RTPCodecTypeAudio, AudioTrackCodecOpus, false},
+		{"audio only offer", testOfferHeader + testOfferAudio, webrtc.RTPCodecTypeVideo, VideoTrackCodecH264, false},
+		{"unknown codec", vp8Offer, webrtc.RTPCodecTypeVideo, 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateOfferCodec(test.offer, test.kind, test.codec)
+			if errors.Is(err, ErrUnsupportedCodec) != test.isUnsupported {
+				t.Fatalf("expected unsupported %t, got %v", test.isUnsupported, err)
+			}
+
+			if !test.isUnsupported && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package codecs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+var ErrNoAllowedCodec = errors.New("no supported codec is allowed")
+
+// Feedback that interceptors add to the registered codecs. Transceivers keep the feedback both sides have,
+// so the preferred codecs list everything the media engine may have registered.
+var interceptorRTCPFeedback = []webrtc.RTCPFeedback{
+	{Type: webrtc.TypeRTCPFBTransportCC},
+}
+
+// Codec constraints of a stream profile.
+// Empty lists allow every supported codec in the default order.
+type Preferences struct {
+	// Allowed video codecs in order of preference, such as "h264", "h265", "vp9" or "av1"
+	Video []string `json:"video,omitempty"`
+
+	// Allowed audio codecs in order of preference, such as "opus"
+	Audio []string `json:"audio,omitempty"`
+
+	// Only allow H264 with this profile-level-id, such as "42e01f"
+	H264ProfileLevel string `json:"h264ProfileLevel,omitempty"`
+}
+
+// Returns the supported codecs of the kind allowed by the preferences, in order of preference
+func (p *Preferences) GetCodecs(kind webrtc.RTPCodecType) []webrtc.RTPCodecParameters {
+	supportedCodecs, allowedCodecs := videoCodecs, []string(nil)
+	if kind == webrtc.RTPCodecTypeAudio {
+		supportedCodecs = audioCodecs
+	}
+
+	if p != nil {
+		allowedCodecs = p.Video
+		if kind == webrtc.RTPCodecTypeAudio {
+			allowedCodecs = p.Audio
+		}
+	}
+
+	codecs := []webrtc.RTPCodecParameters{}
+	for _, codec := range supportedCodecs {
+		if !p.isAllowed(codec, allowedCodecs) {
+			continue
+		}
+
+		codec.RTCPFeedback = append(slices.Clone(codec.RTCPFeedback), interceptorRTCPFeedback...)
+		codecs = append(codecs, codec)
+	}
+
+	// Stable sort keeps the default order of codecs with the same name, such as the H264 variants
+	slices.SortStableFunc(codecs, func(a, b webrtc.RTPCodecParameters) int {
+		return getPreferenceIndex(a, allowedCodecs) - getPreferenceIndex(b, allowedCodecs)
+	})
+
+	return codecs
+}
+
+// Restricts the codecs the transceivers of the peer connection negotiate to the allowed codecs.
+// Must be called before the answer or offer is created.
+func (p *Preferences) ApplyToPeerConnection(peerConnection *webrtc.PeerConnection) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, transceiver := range peerConnection.GetTransceivers() {
+		codecs := p.GetCodecs(transceiver.Kind())
+		if len(codecs) == 0 {
+			return fmt.Errorf("%w for %s", ErrNoAllowedCodec, transceiver.Kind())
+		}
+
+		if err := transceiver.SetCodecPreferences(codecs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Preferences) isAllowed(codec webrtc.RTPCodecParameters, allowedCodecs []string) bool {
+	if len(allowedCodecs) != 0 && getPreferenceIndex(codec, allowedCodecs) == len(allowedCodecs) {
+		return false
+	}
+
+	if p != nil && p.H264ProfileLevel != "" && strings.EqualFold(codec.MimeType, webrtc.MimeTypeH264) {
+		return strings.EqualFold(getFmtpValue(codec.SDPFmtpLine, "profile-level-id"), p.H264ProfileLevel)
+	}
+
+	return true
+}
+
+// Returns the position of the codec in the allowed codecs, or the length of the list when it is not included
+func getPreferenceIndex(codec webrtc.RTPCodecParameters, allowedCodecs []string) int {
+	_, name, _ := strings.Cut(codec.MimeType, "/")
+	for i, allowedCodec := range allowedCodecs {
+		if strings.EqualFold(allowedCodec, name) || strings.EqualFold(allowedCodec, codec.MimeType) {
+			return i
+		}
+	}
+
+	return len(allowedCodecs)
+}
+
+func getFmtpValue(fmtpLine string, key string) string {
+	for parameter := range strings.SplitSeq(fmtpLine, ";") {
+		if name, value, found := strings.Cut(strings.TrimSpace(parameter), "="); found && strings.EqualFold(name, key) {
+			return value
+		}
+	}
+
+	return ""
+}
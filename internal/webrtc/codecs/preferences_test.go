@@ -0,0 +1,48 @@
+package codecs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v4"
+)
+
+func TestPreferencesWithoutConstraints(t *testing.T) {
+	var preferences *Preferences
+
+	if codecs := preferences.GetCodecs(webrtc.RTPCodecTypeVideo); len(codecs) != len(videoCodecs) {
+		t.Fatalf("expected all %d video codecs, got %d", len(videoCodecs), len(codecs))
+	}
+}
+
+func TestPreferencesOrder(t *testing.T) {
+	preferences := &Preferences{Video: []string{"av1", "H264"}}
+
+	codecs := preferences.GetCodecs(webrtc.RTPCodecTypeVideo)
+	if len(codecs) == 0 || codecs[0].MimeType != webrtc.MimeTypeAV1 {
+		t.Fatalf("expected AV1 first, got %v", codecs)
+	}
+
+	for _, codec := range codecs[1:] {
+		if codec.MimeType != webrtc.MimeTypeH264 {
+			t.Fatalf("expected only H264 after AV1, got %s", codec.MimeType)
+		}
+	}
+}
+
+func TestPreferencesH264ProfileLevel(t *testing.T) {
+	preferences := &Preferences{Video: []string{"h264"}, H264ProfileLevel: "4d001f"}
+
+	codecs := preferences.GetCodecs(webrtc.RTPCodecTypeVideo)
+	if len(codecs) != 1 || !strings.Contains(codecs[0].SDPFmtpLine, "profile-level-id=4d001f") {
+		t.Fatalf("expected the 4d001f H264 codec only, got %v", codecs)
+	}
+}
+
+func TestPreferencesUnknownCodec(t *testing.T) {
+	preferences := &Preferences{Audio: []string{"pcmu"}}
+
+	if codecs := preferences.GetCodecs(webrtc.RTPCodecTypeAudio); len(codecs) != 0 {
+		t.Fatalf("expected no audio codecs, got %v", codecs)
+	}
+}
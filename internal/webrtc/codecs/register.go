@@ -1,18 +1,21 @@
 package codecs
 
 import (
-	"log"
+	"log/slog"
+	"os"
 
 	"github.com/pion/webrtc/v4"
 )
 
 func RegisterCodecs(mediaEngine *webrtc.MediaEngine) {
 	if err := registerVideoCodecs(mediaEngine); err != nil {
-		log.Fatal(err)
+		slog.Error("Codecs.RegisterVideoCodecs.Error", "errors", err)
+		os.Exit(1)
 	}
 
 	if err := registerAudioCodecs(mediaEngine); err != nil {
-		log.Fatal(err)
+		slog.Error("Codecs.RegisterAudioCodecs.Error", "errors", err)
+		os.Exit(1)
 	}
 }
 
@@ -20,13 +23,12 @@ func registerAudioCodecs(mediaEngine *webrtc.MediaEngine) []error {
 	errors := []error{}
 	for _, codec := range audioCodecs {
 		if err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeAudio); err != nil {
-			log.Println("Error registering codec", codec.MimeType)
+			slog.Error("Codecs.RegisterCodec.Error", "mimeType", codec.MimeType, "error", err)
 			errors = append(errors, err)
 		}
 	}
 
 	if len(errors) != 0 {
-		log.Println("Errors registering codecs", len(errors))
 		return errors
 	}
 
@@ -37,13 +39,12 @@ func registerVideoCodecs(mediaEngine *webrtc.MediaEngine) []error {
 	errors := []error{}
 	for _, codec := range videoCodecs {
 		if err := mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeVideo); err != nil {
-			log.Println("Error registering codec", codec.MimeType)
+			slog.Error("Codecs.RegisterCodec.Error", "mimeType", codec.MimeType, "error", err)
 			errors = append(errors, err)
 		}
 	}
 
 	if len(errors) != 0 {
-		log.Println("Errors registering codecs", len(errors))
 		return errors
 	}
 
@@ -1,14 +1,18 @@
 package codecs
 
 import (
-	"log"
+	"log/slog"
+	"sync"
 
 	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 )
 
 type TrackPacket struct {
-	Layer        string
+	Layer string
+
+	// Camera angle of a video layer, empty for audio
+	Angle        string
 	Packet       *rtp.Packet
 	TimeDiff     int64
 	SequenceDiff int
@@ -17,6 +21,9 @@ type TrackPacket struct {
 }
 
 type TrackMultiCodec struct {
+	// Protects codec, the payload types and currentPayloadType, which change when the track is bound again after a renegotiation
+	lock sync.Mutex
+
 	id         string
 	rid        string
 	streamID   string
@@ -42,6 +49,49 @@ func (t *TrackMultiCodec) RID() string               { return t.rid }
 func (t *TrackMultiCodec) StreamID() string          { return t.streamID }
 func (t *TrackMultiCodec) Kind() webrtc.RTPCodecType { return t.kind }
 
+// Returns the codec of the track
+func (t *TrackMultiCodec) Codec() TrackCodeType {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.codec
+}
+
+// Returns true when the viewer negotiated a payload type for the codec. Unknown codecs are written with the current payload type.
+func (t *TrackMultiCodec) HasCodec(codec TrackCodeType) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return codec == 0 || t.getPayloadTypeLocked(codec) != 0
+}
+
+// Returns true once the track was bound to a negotiated transceiver
+func (t *TrackMultiCodec) IsBound() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.writeStream != nil
+}
+
+func (t *TrackMultiCodec) getPayloadTypeLocked(codec TrackCodeType) uint8 {
+	switch codec {
+	case VideoTrackCodecH264:
+		return t.payloadTypeH264
+	case VideoTrackCodecH265:
+		return t.payloadTypeH265
+	case VideoTrackCodecVP8:
+		return t.payloadTypeVP8
+	case VideoTrackCodecVP9:
+		return t.payloadTypeVP9
+	case VideoTrackCodecAV1:
+		return t.payloadTypeAV1
+	case AudioTrackCodecOpus:
+		return t.payloadTypeOpus
+	}
+
+	return 0
+}
+
 func CreateTrackMultiCodec(id string, rid string, streamID string, kind webrtc.RTPCodecType, codec TrackCodeType) *TrackMultiCodec {
 	return &TrackMultiCodec{
 		id:       id,
@@ -53,6 +103,9 @@ func CreateTrackMultiCodec(id string, rid string, streamID string, kind webrtc.R
 }
 
 func (t *TrackMultiCodec) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
 	t.ssrc = ctx.SSRC()
 	t.writeStream = ctx.WriteStream()
 
@@ -60,13 +113,13 @@ func (t *TrackMultiCodec) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecPar
 	codecParameters := ctx.CodecParameters()
 	for parameters := range codecParameters {
 		switch GetAudioTrackCodec(codecParameters[parameters].MimeType) {
-		case audioTrackCodecOpus:
+		case AudioTrackCodecOpus:
 			t.payloadTypeOpus = uint8(codecParameters[parameters].PayloadType)
 			t.currentPayloadType = t.payloadTypeOpus
 		}
 
 		if t.payloadTypeOpus != 0 {
-			log.Println("WHIPSession.TrackMultiCodec: Binding AudioTrack Type for", t.streamID, "-", t.currentPayloadType)
+			slog.Debug("TrackMultiCodec.Bind: Binding AudioTrack", "streamKey", t.streamID, "payloadType", t.currentPayloadType)
 
 			t.kind = webrtc.RTPCodecTypeAudio
 			return webrtc.RTPCodecParameters{
@@ -108,7 +161,7 @@ func (t *TrackMultiCodec) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecPar
 		}
 	}
 
-	log.Println("WHEPSession.TrackMultiCodec: Binding VideoTrack Type for", t.streamID, "-", t.currentPayloadType)
+	slog.Debug("TrackMultiCodec.Bind: Binding VideoTrack", "streamKey", t.streamID, "payloadType", t.currentPayloadType)
 	t.kind = webrtc.RTPCodecTypeVideo
 	return webrtc.RTPCodecParameters{
 		RTPCodecCapability: webrtc.RTPCodecCapability{
@@ -126,35 +179,28 @@ func (t *TrackMultiCodec) Unbind(context webrtc.TrackLocalContext) error {
 }
 
 func (t *TrackMultiCodec) WriteRTP(packet *rtp.Packet, codec TrackCodeType) error {
+	t.lock.Lock()
 	packet.SSRC = uint32(t.ssrc)
 
 	if codec != t.codec {
-		log.Println("WHEPSession.TrackMultiCodec.WriteRTP: Setting Codec on", t.streamID, "(", t.RID(), ")", "from", t.codec, "to", codec)
+		slog.Info("TrackMultiCodec.WriteRTP: Setting Codec", "streamKey", t.streamID, "rid", t.RID(), "from", t.codec, "to", codec)
 		t.codec = codec
+	}
 
-		switch t.codec {
-		case VideoTrackCodecH264:
-			t.currentPayloadType = t.payloadTypeH264
-		case VideoTrackCodecH265:
-			t.currentPayloadType = t.payloadTypeH265
-		case VideoTrackCodecVP8:
-			t.currentPayloadType = t.payloadTypeVP8
-		case VideoTrackCodecVP9:
-			t.currentPayloadType = t.payloadTypeVP9
-		case VideoTrackCodecAV1:
-			t.currentPayloadType = t.payloadTypeAV1
-		case audioTrackCodecOpus:
-			t.currentPayloadType = t.payloadTypeOpus
-		}
+	// Payload types of codecs the viewer did not negotiate are only known after a renegotiation
+	if payloadType := t.getPayloadTypeLocked(t.codec); payloadType != 0 {
+		t.currentPayloadType = payloadType
 	}
 
 	packet.PayloadType = t.currentPayloadType
+	writeStream := t.writeStream
+	t.lock.Unlock()
 
-	if _, err := t.writeStream.WriteRTP(&packet.Header, packet.Payload); err != nil {
+	if _, err := writeStream.WriteRTP(&packet.Header, packet.Payload); err != nil {
 		t.errorCount += 1
 
 		if t.errorCount%50 == 0 {
-			log.Println("WHIPSession.TrackMultiCodec.WriteRTP.Error(", t.errorCount, ")", err)
+			slog.Warn("TrackMultiCodec.WriteRTP.Error", "streamKey", t.streamID, "rid", t.RID(), "errorCount", t.errorCount, "error", err)
 			return err
 		}
 	}
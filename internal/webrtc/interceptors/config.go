@@ -0,0 +1,110 @@
+package interceptors
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+const (
+	bandwidthEstimatorGCC  = "gcc"
+	bandwidthEstimatorNone = "none"
+
+	defaultInitialBitrate     = 10_000_000
+	defaultMinBitrate         = 100_000
+	defaultMaxBitrate         = 50_000_000
+	defaultNACKGeneratorSize  = 512
+	defaultNACKResponderSize  = 1024
+	defaultRTCPReportInterval = time.Second
+	defaultTWCCInterval       = 100 * time.Millisecond
+)
+
+// Interceptor pipeline settings read from the environment
+type config struct {
+	BandwidthEstimator string
+	Pacing             bool
+	InitialBitrate     int
+	MinBitrate         int
+	MaxBitrate         int
+
+	TWCCEnabled  bool
+	TWCCInterval time.Duration
+
+	NACKGeneratorSize uint16
+	NACKResponderSize uint16
+
+	RTCPReportInterval time.Duration
+}
+
+func getConfig() config {
+	c := config{
+		BandwidthEstimator: bandwidthEstimatorGCC,
+		Pacing:             strings.EqualFold(os.Getenv(environment.BandwidthEstimatorPacing), "true"),
+		InitialBitrate:     getBitrateSetting(environment.BandwidthEstimatorInitialBitrate, defaultInitialBitrate),
+		MinBitrate:         getBitrateSetting(environment.BandwidthEstimatorMinBitrate, defaultMinBitrate),
+		MaxBitrate:         getBitrateSetting(environment.BandwidthEstimatorMaxBitrate, defaultMaxBitrate),
+		TWCCEnabled:        !strings.EqualFold(os.Getenv(environment.TWCCEnabled), "false"),
+		TWCCInterval:       getDurationSetting(environment.TWCCInterval, defaultTWCCInterval),
+		NACKGeneratorSize:  getBufferSizeSetting(environment.NACKGeneratorSize, defaultNACKGeneratorSize),
+		NACKResponderSize:  getBufferSizeSetting(environment.NACKResponderSize, defaultNACKResponderSize),
+		RTCPReportInterval: getDurationSetting(environment.RTCPReportInterval, defaultRTCPReportInterval),
+	}
+
+	switch estimator := strings.ToLower(os.Getenv(environment.BandwidthEstimator)); estimator {
+	case "", bandwidthEstimatorGCC:
+	case bandwidthEstimatorNone:
+		c.BandwidthEstimator = bandwidthEstimatorNone
+	default:
+		slog.Warn("Interceptors.Config: Unknown bandwidth estimator, using gcc", "estimator", estimator)
+	}
+
+	// GCC estimates from TWCC feedback, which viewers only send when the header extension is added
+	if c.BandwidthEstimator == bandwidthEstimatorGCC && !c.TWCCEnabled {
+		slog.Warn("Interceptors.Config: Bandwidth estimator requires TWCC, disabling bandwidth estimation")
+		c.BandwidthEstimator = bandwidthEstimatorNone
+	}
+
+	if c.MinBitrate > c.MaxBitrate {
+		slog.Warn("Interceptors.Config: Minimum bitrate is above maximum bitrate, using defaults", "min", c.MinBitrate, "max", c.MaxBitrate)
+		c.MinBitrate, c.MaxBitrate = defaultMinBitrate, defaultMaxBitrate
+	}
+	c.InitialBitrate = min(max(c.InitialBitrate, c.MinBitrate), c.MaxBitrate)
+
+	return c
+}
+
+func getBitrateSetting(key string, defaultValue int) int {
+	if bitrate, err := strconv.Atoi(os.Getenv(key)); err == nil && bitrate > 0 {
+		return bitrate
+	}
+
+	return defaultValue
+}
+
+func getDurationSetting(key string, defaultValue time.Duration) time.Duration {
+	if duration, err := time.ParseDuration(os.Getenv(key)); err == nil && duration > 0 {
+		return duration
+	}
+
+	return defaultValue
+}
+
+// NACK buffers hold a power of two packets, up to 32768
+func getBufferSizeSetting(key string, defaultValue uint16) uint16 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	size, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || size == 0 || size&(size-1) != 0 {
+		slog.Warn("Interceptors.Config: Buffer size must be a power of two up to 32768", "variable", key, "value", value)
+		return defaultValue
+	}
+
+	return uint16(size)
+}
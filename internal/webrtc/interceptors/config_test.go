@@ -0,0 +1,41 @@
+package interceptors
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	c := getConfig()
+
+	if c.BandwidthEstimator != bandwidthEstimatorGCC || !c.TWCCEnabled || c.Pacing {
+		t.Fatalf("unexpected defaults: %+v", c)
+	}
+
+	if c.NACKGeneratorSize != defaultNACKGeneratorSize || c.NACKResponderSize != defaultNACKResponderSize {
+		t.Fatalf("unexpected NACK buffer sizes: %+v", c)
+	}
+}
+
+func TestConfigInvalidNACKSize(t *testing.T) {
+	t.Setenv(environment.NACKResponderSize, "1000")
+	t.Setenv(environment.NACKGeneratorSize, "2048")
+
+	c := getConfig()
+	if c.NACKResponderSize != defaultNACKResponderSize {
+		t.Fatalf("expected default responder size for invalid value, got %d", c.NACKResponderSize)
+	}
+
+	if c.NACKGeneratorSize != 2048 {
+		t.Fatalf("expected generator size 2048, got %d", c.NACKGeneratorSize)
+	}
+}
+
+func TestConfigEstimatorRequiresTWCC(t *testing.T) {
+	t.Setenv(environment.TWCCEnabled, "FALSE")
+
+	if c := getConfig(); c.BandwidthEstimator != bandwidthEstimatorNone {
+		t.Fatalf("expected bandwidth estimation to be disabled without TWCC, got %s", c.BandwidthEstimator)
+	}
+}
@@ -1,16 +1,120 @@
 package interceptors
 
 import (
+	"log/slog"
+	"os"
+	"sync"
+
 	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/interceptor/pkg/report"
+	"github.com/pion/interceptor/pkg/twcc"
 	"github.com/pion/webrtc/v4"
-	"log"
 )
 
+// Bandwidth estimators of new WHEP peer connections by peer connection ID
+var bandwidthEstimators sync.Map
+
+// Returns the registry for WHIP peer connections
 func GetRegistry(mediaEngine *webrtc.MediaEngine) interceptor.Registry {
 	interceptorRegistry := &interceptor.Registry{}
-	if err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry); err != nil {
-		log.Fatal(err)
+	if err := registerInterceptors(mediaEngine, interceptorRegistry, getConfig()); err != nil {
+		slog.Error("Interceptors.RegisterInterceptors.Error", "error", err)
+		os.Exit(1)
+	}
+
+	return *interceptorRegistry
+}
+
+// Returns the registry for WHEP peer connections.
+// Unless disabled every viewer gets a send side bandwidth estimator fed by TWCC feedback.
+func GetWHEPRegistry(mediaEngine *webrtc.MediaEngine) interceptor.Registry {
+	interceptorRegistry := &interceptor.Registry{}
+	config := getConfig()
+
+	if config.BandwidthEstimator == bandwidthEstimatorGCC {
+		congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+			options := []gcc.Option{
+				gcc.SendSideBWEInitialBitrate(config.InitialBitrate),
+				gcc.SendSideBWEMinBitrate(config.MinBitrate),
+				gcc.SendSideBWEMaxBitrate(config.MaxBitrate),
+			}
+
+			// Without pacing media is forwarded as it is received, the estimate is only used to select video layers
+			if !config.Pacing {
+				options = append(options, gcc.SendSideBWEPacer(gcc.NewNoOpPacer()))
+			}
+
+			return gcc.NewSendSideBWE(options...)
+		})
+		if err != nil {
+			slog.Error("Interceptors.CongestionController.Error", "error", err)
+			os.Exit(1)
+		}
+
+		congestionController.OnNewPeerConnection(func(id string, estimator cc.BandwidthEstimator) {
+			bandwidthEstimators.Store(id, estimator)
+		})
+		interceptorRegistry.Add(congestionController)
+	}
+
+	if config.TWCCEnabled {
+		if err := webrtc.ConfigureTWCCHeaderExtensionSender(mediaEngine, interceptorRegistry); err != nil {
+			slog.Error("Interceptors.ConfigureTWCCHeaderExtensionSender.Error", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := registerInterceptors(mediaEngine, interceptorRegistry, config); err != nil {
+		slog.Error("Interceptors.RegisterInterceptors.Error", "error", err)
+		os.Exit(1)
 	}
 
 	return *interceptorRegistry
 }
+
+// Returns the bandwidth estimator created for the peer connection and forgets about it
+func TakeBandwidthEstimator(peerConnectionID string) (cc.BandwidthEstimator, bool) {
+	estimator, ok := bandwidthEstimators.LoadAndDelete(peerConnectionID)
+	if !ok {
+		return nil, false
+	}
+
+	return estimator.(cc.BandwidthEstimator), true
+}
+
+// Registers the interceptors of webrtc.RegisterDefaultInterceptors with the configured settings
+func registerInterceptors(mediaEngine *webrtc.MediaEngine, interceptorRegistry *interceptor.Registry, config config) error {
+	if err := webrtc.ConfigureNackWithOptions(
+		mediaEngine,
+		interceptorRegistry,
+		[]nack.GeneratorOption{nack.GeneratorSize(config.NACKGeneratorSize)},
+		nack.ResponderSize(config.NACKResponderSize),
+	); err != nil {
+		return err
+	}
+
+	if err := webrtc.ConfigureRTCPReportsWithOptions(
+		interceptorRegistry,
+		[]report.ReceiverOption{report.ReceiverInterval(config.RTCPReportInterval)},
+		report.SenderInterval(config.RTCPReportInterval),
+	); err != nil {
+		return err
+	}
+
+	if err := webrtc.ConfigureSimulcastExtensionHeaders(mediaEngine); err != nil {
+		return err
+	}
+
+	if err := webrtc.ConfigureStatsInterceptor(interceptorRegistry); err != nil {
+		return err
+	}
+
+	if !config.TWCCEnabled {
+		return nil
+	}
+
+	return webrtc.ConfigureTWCCSenderWithOptions(mediaEngine, interceptorRegistry, twcc.SendInterval(config.TWCCInterval))
+}
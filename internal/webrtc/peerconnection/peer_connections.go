@@ -1,9 +1,11 @@
 package peerconnection
 
 import (
-	"log"
+	"log/slog"
 
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -11,8 +13,9 @@ func CreateWHEPPeerConnection() (*webrtc.PeerConnection, error) {
 	return manager.APIWHEP.NewPeerConnection(getPeerConnectionConfig())
 }
 
-func CreateWHIPPeerConnection(offer string) (*webrtc.PeerConnection, error) {
-	log.Println("CreateWHIPPeerConnection.CreateWHIPPeerConnection")
+// Create the peer connection of a host and answer its offer with the codecs allowed by the preferences
+func CreateWHIPPeerConnection(offer string, codecPreferences *codecs.Preferences) (*webrtc.PeerConnection, error) {
+	slog.Debug("PeerConnection.CreateWHIPPeerConnection")
 
 	peerConnection, err := manager.APIWHIP.NewPeerConnection(getPeerConnectionConfig())
 	if err != nil {
@@ -29,6 +32,10 @@ func CreateWHIPPeerConnection(offer string) (*webrtc.PeerConnection, error) {
 		return nil, err
 	}
 
+	if err := codecPreferences.ApplyToPeerConnection(peerConnection); err != nil {
+		return peerConnection, err
+	}
+
 	gatheringCompleteResult := webrtc.GatheringCompletePromise(peerConnection)
 
 	answer, err := peerConnection.CreateAnswer(nil)
@@ -40,9 +47,14 @@ func CreateWHIPPeerConnection(offer string) (*webrtc.PeerConnection, error) {
 		return nil, err
 	}
 
+	// Candidates gathered after the answer is sent are trickled to the client
+	if utils.IsTrickleICEEnabled() {
+		return peerConnection, nil
+	}
+
 	// Await gathering trickle
 	<-gatheringCompleteResult
-	log.Println("PeerConnection.CreateWHIPPeerConnection.GatheringCompleteResult")
+	slog.Debug("PeerConnection.CreateWHIPPeerConnection.GatheringCompleteResult")
 
 	return peerConnection, nil
 }
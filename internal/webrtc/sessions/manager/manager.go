@@ -1,43 +1,65 @@
 package manager
 
 import (
-	"log"
+	"log/slog"
 	"maps"
 	"time"
 
+	"github.com/glimesh/broadcast-box/internal/hls"
+	"github.com/glimesh/broadcast-box/internal/recording"
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
 )
 
 // Prepare the WHIP Session Manager
 func (m *SessionManager) Setup() {
-	log.Println("WHIPSessionManager.Setup")
+	slog.Debug("SessionManager.Setup")
 
 	m.sessions = make(map[string]*session.Session)
 }
 
 // Add new session
 func (m *SessionManager) addSession(profile authorization.PublicProfile) (s *session.Session, err error) {
-	log.Println("SessionManager.AddWHIPSession")
+	logger := slog.With("streamKey", profile.StreamKey)
+	logger.Info("SessionManager.AddSession")
 
 	s = &session.Session{
 
 		StreamKey:   profile.StreamKey,
+		Logger:      logger,
 		IsPublic:    profile.IsPublic,
 		MOTD:        profile.MOTD,
 		StreamStart: time.Now(),
 
 		WHEPSessions: map[string]*whep.WHEPSession{},
 		ChatManager:  m.ChatManager,
+		Events:       m.Events,
 	}
 	s.SetOnClose(func() {
-		log.Println("SessionManager.Session.Done")
+		logger.Info("SessionManager.Session.Done")
 		m.sessionsLock.Lock()
 		delete(m.sessions, profile.StreamKey)
 		m.sessionsLock.Unlock()
 	})
 
+	if hls.IsEnabled() {
+		s.EnableHLS()
+	}
+
+	s.SetReconnectGracePeriod(session.GetReconnectGracePeriod())
+
+	if session.IsBackupIngestEnabled() {
+		s.EnableBackupIngest(session.GetBackupIngestTimeout())
+	}
+
+	if profile.Record || recording.IsRecordingAllStreams() {
+		if err := s.StartRecording(); err != nil {
+			logger.Error("SessionManager.AddSession.StartRecording.Error", "error", err)
+		}
+	}
+
 	m.sessionsLock.Lock()
 	m.sessions[profile.StreamKey] = s
 	m.sessionsLock.Unlock()
@@ -50,10 +72,10 @@ func (m *SessionManager) GetOrAddSession(profile authorization.PublicProfile, is
 	session, ok := m.GetSessionByID(profile.StreamKey)
 
 	if !ok {
-		log.Println("SessionManager.GetOrAddStream: Adding", profile.StreamKey)
+		slog.Debug("SessionManager.GetOrAddSession: Adding", "streamKey", profile.StreamKey)
 		session, err = m.addSession(profile)
 	} else if isWHIP {
-		log.Println("SessionManager.GetOrAddStream: Updating", profile.StreamKey)
+		session.Logger.Debug("SessionManager.GetOrAddSession: Updating")
 		session.UpdateStreamStatus(profile)
 	}
 
@@ -62,7 +84,7 @@ func (m *SessionManager) GetOrAddSession(profile authorization.PublicProfile, is
 
 // Get Session by id
 func (m *SessionManager) GetSessionByID(streamKey string) (session *session.Session, foundSession bool) {
-	log.Println("SessionManager.GetSessionByID", streamKey)
+	slog.Debug("SessionManager.GetSessionByID", "streamKey", streamKey)
 
 	m.sessionsLock.RLock()
 	defer m.sessionsLock.RUnlock()
@@ -73,7 +95,7 @@ func (m *SessionManager) GetSessionByID(streamKey string) (session *session.Sess
 
 // Gets the current state of all sessions
 func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []session.StreamSessionState) {
-	log.Println("SessionManager.GetSessionStates: IsAdmin", includePrivateStreams)
+	slog.Debug("SessionManager.GetSessionStates", "isAdmin", includePrivateStreams)
 	m.sessionsLock.RLock()
 	copiedSessions := make(map[string]*session.Session)
 	maps.Copy(copiedSessions, m.sessions)
@@ -88,13 +110,16 @@ func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []
 		}
 
 		streamSession := session.StreamSessionState{
-			StreamKey:   s.StreamKey,
-			StreamStart: s.StreamStart,
-			IsPublic:    s.IsPublic,
-			MOTD:        s.MOTD,
-			Sessions:    []whep.SessionState{},
-			VideoTracks: []session.VideoTrackState{},
-			AudioTracks: []session.AudioTrackState{},
+			StreamKey:      s.StreamKey,
+			StreamStart:    s.StreamStart,
+			IsPublic:       s.IsPublic,
+			IsRecording:    s.IsRecording(),
+			HasStandby:     s.Standby.Load() != nil,
+			IsReconnecting: s.IsReconnecting(),
+			MOTD:           s.MOTD,
+			Sessions:       []whep.SessionState{},
+			VideoTracks:    []session.VideoTrackState{},
+			AudioTracks:    []session.AudioTrackState{},
 		}
 
 		s.StatusLock.RUnlock()
@@ -122,11 +147,12 @@ func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []
 				streamSession.VideoTracks = append(
 					streamSession.VideoTracks,
 					session.VideoTrackState{
-						Rid:             videoTrack.Rid,
-						Bitrate:         videoTrack.Bitrate.Load(),
-						PacketsReceived: videoTrack.PacketsReceived.Load(),
-						PacketsDropped:  videoTrack.PacketsDropped.Load(),
-						LastKeyframe:    lastKeyFrame,
+						Rid:              videoTrack.Rid,
+						Bitrate:          videoTrack.Bitrate.Load(),
+						PacketsReceived:  videoTrack.PacketsReceived.Load(),
+						PacketsDropped:   videoTrack.PacketsDropped.Load(),
+						LastKeyframe:     lastKeyFrame,
+						KeyframeInterval: time.Duration(videoTrack.KeyFrameInterval.Load()).Milliseconds(),
 					})
 			}
 
@@ -141,15 +167,40 @@ func (m *SessionManager) GetSessionStates(includePrivateStreams bool) (result []
 		}
 		s.WHEPSessionsLock.RUnlock()
 
+		if includePrivateStreams && m.ChatManager != nil {
+			chatRateLimits := m.ChatManager.GetRateLimitStats(streamSession.StreamKey)
+			streamSession.ChatRateLimits = &chatRateLimits
+		}
+
 		result = append(result, streamSession)
 	}
 
 	return
 }
 
+// Gets the state of all sessions currently writing a recording
+func (m *SessionManager) GetRecordingStates() (result []recording.RecordingState) {
+	m.sessionsLock.RLock()
+	defer m.sessionsLock.RUnlock()
+
+	result = []recording.RecordingState{}
+	for _, s := range m.sessions {
+		host := s.Host.Load()
+		if host == nil {
+			continue
+		}
+
+		if recorder := host.Recorder.Load(); recorder != nil {
+			result = append(result, recorder.GetRecordingState())
+		}
+	}
+
+	return result
+}
+
 // Update the provided session information
 func (m *SessionManager) UpdateProfile(profile *authorization.PersonalProfile) {
-	log.Println("WHIPSessionManager.UpdateProfile")
+	slog.Info("SessionManager.UpdateProfile", "streamKey", profile.StreamKey)
 	m.sessionsLock.RLock()
 	whipSession, ok := m.sessions[profile.StreamKey]
 	m.sessionsLock.RUnlock()
@@ -171,17 +222,13 @@ func (m *SessionManager) GetWHEPSessionByID(sessionID string) (whep *whep.WHEPSe
 func (m *SessionManager) SendPLIByWHEPSessionID(sessionID string) {
 	streamSession, _, foundSession := m.GetSessionAndWHEPByID(sessionID)
 	if !foundSession {
-		log.Println("SessionManager.SendPLIByWHEPSessionID: WHEP session not found", sessionID)
+		slog.Warn("SessionManager.SendPLIByWHEPSessionID: WHEP session not found", "sessionId", sessionID)
 		return
 	}
 
 	host := streamSession.Host.Load()
 	if host == nil {
-		log.Println(
-			"SessionManager.SendPLIByWHEPSessionID: WHIP session not found",
-			"whepSessionID", sessionID,
-			"streamKey", streamSession.StreamKey,
-		)
+		streamSession.Logger.Warn("SessionManager.SendPLIByWHEPSessionID: WHIP session not found", "sessionId", sessionID)
 		return
 	}
 
@@ -204,20 +251,20 @@ func (m *SessionManager) GetSessionAndWHEPByID(sessionID string) (streamSession
 	return nil, nil, false
 }
 
-func (m *SessionManager) GetSessionByHostSessionID(sessionID string) (session *session.Session, foundSession bool) {
+// Get the session and the host or standby with the WHIP session id
+func (m *SessionManager) GetSessionByHostSessionID(sessionID string) (session *session.Session, host *whip.WHIPSession, foundSession bool) {
 	m.sessionsLock.RLock()
 	defer m.sessionsLock.RUnlock()
 
 	for _, session := range m.sessions {
-		host := session.Host.Load()
-		if host == nil {
-			continue
+		if host := session.Host.Load(); host != nil && sessionID == host.ID {
+			return session, host, true
 		}
 
-		if sessionID == host.ID {
-			return session, true
+		if standby := session.Standby.Load(); standby != nil && sessionID == standby.ID {
+			return session, standby, true
 		}
 	}
 
-	return nil, false
+	return nil, nil, false
 }
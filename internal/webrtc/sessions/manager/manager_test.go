@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+)
+
+func TestRecordingStates(t *testing.T) {
+	t.Setenv(environment.RecordingPath, t.TempDir())
+
+	m := &SessionManager{}
+	m.Setup()
+
+	s, err := m.GetOrAddSession(authorization.PublicProfile{StreamKey: "stream", Record: true}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	host, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host.Recorder.Load().WriteAudio("audio", &rtp.Packet{Header: rtp.Header{Version: 2}, Payload: []byte{0xfc}}, codecs.AudioTrackCodecOpus)
+
+	// Files are created by the writer goroutine of the recorder
+	states := m.GetRecordingStates()
+	for deadline := time.Now().Add(time.Second); len(states) == 1 && len(states[0].Files) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		states = m.GetRecordingStates()
+	}
+
+	if len(states) != 1 || states[0].StreamKey != "stream" || len(states[0].Files) != 1 {
+		t.Fatalf("expected the recording of the stream to be listed, got %+v", states)
+	}
+
+	s.StopRecording()
+	if states := m.GetRecordingStates(); len(states) != 0 {
+		t.Fatalf("expected no recordings after stopping, got %+v", states)
+	}
+}
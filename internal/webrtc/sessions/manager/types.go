@@ -19,4 +19,5 @@ type SessionManager struct {
 	sessionsLock sync.RWMutex
 	sessions     map[string]*session.Session
 	ChatManager  *chat.Manager
+	Events       session.EventSink
 }
@@ -0,0 +1,25 @@
+package session
+
+import (
+	"time"
+)
+
+// Receives the lifecycle events of sessions, such as the event webhook
+type EventSink interface {
+	StreamStarted(streamKey string, hostID string)
+	StreamEnded(streamKey string, duration time.Duration)
+	ViewerJoined(streamKey string, viewerID string)
+	ViewerLeft(streamKey string, viewerID string, duration time.Duration)
+	KeyframeStall(streamKey string, hostID string, layer string, angle string, sinceKeyframe time.Duration)
+
+	// Time without keyframes after which a video track is reported as stalled, zero when stalls are not reported
+	KeyframeStallTimeout() time.Duration
+}
+
+func (s *Session) getKeyframeStallTimeout() time.Duration {
+	if s.Events == nil {
+		return 0
+	}
+
+	return s.Events.KeyframeStallTimeout()
+}
@@ -0,0 +1,50 @@
+package session
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records the names of the events it receives
+type recordingEventSink struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recordingEventSink) record(event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingEventSink) StreamStarted(string, string)                                { r.record("stream-started") }
+func (r *recordingEventSink) StreamEnded(string, time.Duration)                           { r.record("stream-ended") }
+func (r *recordingEventSink) ViewerJoined(string, string)                                 { r.record("viewer-joined") }
+func (r *recordingEventSink) ViewerLeft(string, string, time.Duration)                    { r.record("viewer-left") }
+func (r *recordingEventSink) KeyframeStall(string, string, string, string, time.Duration) {}
+func (r *recordingEventSink) KeyframeStallTimeout() time.Duration                         { return 0 }
+
+func TestStreamEventsAcrossReconnect(t *testing.T) {
+	events := &recordingEventSink{}
+	s := newTestSession()
+	s.Events = events
+	s.SetReconnectGracePeriod(time.Minute)
+
+	host, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.Close()
+
+	if _, err := s.AddExternalHost(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	events.lock.Lock()
+	defer events.lock.Unlock()
+	if len(events.events) != 2 || events.events[0] != "stream-started" || events.events[1] != "stream-ended" {
+		t.Fatalf("expected the stream to start and end once, got %v", events.events)
+	}
+}
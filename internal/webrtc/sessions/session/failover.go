@@ -0,0 +1,116 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+)
+
+const defaultBackupIngestTimeout = 3 * time.Second
+
+// Returns true if a second host of a stream is accepted as standby
+func IsBackupIngestEnabled() bool {
+	return strings.EqualFold(os.Getenv(environment.BackupIngestEnabled), "true")
+}
+
+// Returns the time without packets before the host is replaced by the standby
+func GetBackupIngestTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv(environment.BackupIngestTimeout)); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	return defaultBackupIngestTimeout
+}
+
+// Accept a standby host and fail over to it when the host closes or stops sending media for the timeout
+func (s *Session) EnableBackupIngest(timeout time.Duration) {
+	s.backupIngestTimeout = timeout
+	s.monitorDone = make(chan struct{})
+
+	go s.monitorHost()
+}
+
+// Keep the host as standby, its media is not forwarded until it takes over
+func (s *Session) setStandby(host *whip.WHIPSession) error {
+	if s.backupIngestTimeout == 0 {
+		return fmt.Errorf("session already has a host")
+	}
+
+	for {
+		standby := s.Standby.Load()
+		if standby != nil && !standby.IsClosed() {
+			return fmt.Errorf("session already has a host and a standby")
+		}
+
+		if s.Standby.CompareAndSwap(standby, host) {
+			break
+		}
+	}
+
+	s.Logger.Info("Session.SetStandby", "sessionId", host.ID)
+	host.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+	return nil
+}
+
+// Replace the host with the standby, returns false if there is no standby to take over
+func (s *Session) failover(host *whip.WHIPSession) bool {
+	standby := s.Standby.Swap(nil)
+	if standby == nil {
+		return false
+	}
+
+	if standby.IsClosed() {
+		releaseHost(standby)
+		return false
+	}
+
+	if !s.Host.CompareAndSwap(host, standby) {
+		s.Standby.CompareAndSwap(nil, standby)
+		return false
+	}
+
+	s.Logger.Warn("Session.Failover", "from", host.ID, "to", standby.ID)
+	releaseHost(host)
+	s.activateHost(standby)
+	standby.SendPLI()
+	return true
+}
+
+// Fail over when the host stops sending media while the standby is still receiving
+func (s *Session) monitorHost() {
+	ticker := time.NewTicker(s.backupIngestTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.monitorDone:
+			return
+		case <-ticker.C:
+		}
+
+		host := s.Host.Load()
+		standby := s.Standby.Load()
+		if host == nil || standby == nil {
+			continue
+		}
+
+		lastActive := host.LastPacketReceived()
+		if activeSince := time.Unix(0, s.hostActiveSince.Load()); activeSince.After(lastActive) {
+			lastActive = activeSince
+		}
+
+		if time.Since(lastActive) < s.backupIngestTimeout || time.Since(standby.LastPacketReceived()) >= s.backupIngestTimeout {
+			continue
+		}
+
+		s.Logger.Warn("Session.MonitorHost: Host stopped sending media", "sessionId", host.ID)
+		if s.failover(host) {
+			host.Close()
+		}
+	}
+}
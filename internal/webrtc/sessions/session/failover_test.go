@@ -0,0 +1,129 @@
+package session
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// Produces a video packet every 10ms until done is closed
+type packetReader struct {
+	done           chan struct{}
+	sequenceNumber uint16
+}
+
+func (r *packetReader) Read(b []byte) (int, interceptor.Attributes, error) {
+	select {
+	case <-r.done:
+		return 0, nil, io.EOF
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	r.sequenceNumber++
+	packet := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: r.sequenceNumber,
+			Timestamp:      uint32(r.sequenceNumber) * 900,
+		},
+		Payload: []byte{0x65, 0x88, 0x00, 0x00, 0x00, 0x00},
+	}
+
+	n, err := packet.MarshalTo(b)
+	return n, nil, err
+}
+
+func newTestSession() *Session {
+	return &Session{
+		StreamKey:    "failover-test",
+		Logger:       slog.Default(),
+		WHEPSessions: map[string]*whep.WHEPSession{},
+	}
+}
+
+func TestSecondHostRejectedWithoutBackupIngest(t *testing.T) {
+	s := newTestSession()
+
+	if _, err := s.AddExternalHost(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.AddExternalHost(); err == nil {
+		t.Fatal("second host was accepted")
+	}
+}
+
+func TestFailoverWhenHostCloses(t *testing.T) {
+	s := newTestSession()
+	s.EnableBackupIngest(time.Minute)
+
+	isClosed := false
+	s.SetOnClose(func() { isClosed = true })
+	defer s.Close()
+
+	primary, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standby, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Host.Load() != primary || s.Standby.Load() != standby {
+		t.Fatal("second host was not added as standby")
+	}
+
+	if _, err := s.AddExternalHost(); err == nil {
+		t.Fatal("third host was accepted")
+	}
+
+	primary.Close()
+	if s.Host.Load() != standby || s.Standby.Load() != nil {
+		t.Fatal("standby did not take over")
+	}
+
+	standby.Close()
+	if s.Host.Load() != nil || !isClosed {
+		t.Fatal("session was not closed after the last host")
+	}
+}
+
+func TestFailoverWhenHostStopsSendingMedia(t *testing.T) {
+	s := newTestSession()
+	s.EnableBackupIngest(200 * time.Millisecond)
+	defer s.Close()
+
+	primary, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	standby, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := &packetReader{done: make(chan struct{})}
+	defer close(reader.done)
+	go standby.IngestVideo(reader, codecs.VideoTrackCodecH264, s.StreamKey)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Host.Load() != standby {
+		if time.Now().After(deadline) {
+			t.Fatal("standby did not take over from the stalled host")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !primary.IsClosed() {
+		t.Fatal("stalled host was not closed")
+	}
+}
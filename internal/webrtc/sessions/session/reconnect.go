@@ -0,0 +1,92 @@
+package session
+
+import (
+	"os"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+const defaultReconnectGracePeriod = 10 * time.Second
+
+// Returns the time a session waits for the broadcaster to reconnect, zero disables waiting
+func GetReconnectGracePeriod() time.Duration {
+	value := os.Getenv(environment.ReconnectGracePeriod)
+	if value == "" {
+		return defaultReconnectGracePeriod
+	}
+
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultReconnectGracePeriod
+	}
+
+	return max(gracePeriod, 0)
+}
+
+// Keep the session and its viewers when the host is removed, until a new host is added or the grace period ends
+func (s *Session) SetReconnectGracePeriod(gracePeriod time.Duration) {
+	s.reconnectGracePeriod = gracePeriod
+}
+
+// Returns true while the session waits for the broadcaster to reconnect
+func (s *Session) IsReconnecting() bool {
+	return s.isReconnecting.Load()
+}
+
+// Start waiting for the broadcaster to reconnect, returns false if the session does not wait
+func (s *Session) startReconnecting() bool {
+	if s.reconnectGracePeriod <= 0 {
+		return false
+	}
+
+	s.reconnectLock.Lock()
+	defer s.reconnectLock.Unlock()
+
+	// A new host was added meanwhile
+	if s.Host.Load() != nil {
+		return true
+	}
+
+	if s.reconnectTimer != nil {
+		s.reconnectTimer.Stop()
+	}
+
+	s.Logger.Info("Session.Reconnecting", "gracePeriod", s.reconnectGracePeriod)
+	s.isReconnecting.Store(true)
+	s.reconnectTimer = time.AfterFunc(s.reconnectGracePeriod, s.handleReconnectTimeout)
+	s.notifyStatusChanged()
+
+	return true
+}
+
+// Stop waiting for the broadcaster, returns true if the session was waiting
+func (s *Session) stopReconnecting() bool {
+	s.reconnectLock.Lock()
+	defer s.reconnectLock.Unlock()
+
+	if s.reconnectTimer != nil {
+		s.reconnectTimer.Stop()
+		s.reconnectTimer = nil
+	}
+
+	return s.isReconnecting.Swap(false)
+}
+
+func (s *Session) handleReconnectTimeout() {
+	s.reconnectLock.Lock()
+	if s.Host.Load() != nil || !s.isReconnecting.Swap(false) {
+		s.reconnectLock.Unlock()
+		return
+	}
+	s.reconnectTimer = nil
+	s.reconnectLock.Unlock()
+
+	s.Logger.Info("Session.ReconnectTimeout")
+	s.endStream()
+	s.notifyStatusChanged()
+
+	if s.isEmpty() {
+		s.close()
+	}
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconnectWithinGracePeriod(t *testing.T) {
+	s := newTestSession()
+	s.SetReconnectGracePeriod(time.Minute)
+
+	isClosed := false
+	s.SetOnClose(func() { isClosed = true })
+	defer s.Close()
+
+	host, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statusChanged := s.StatusChanged()
+	host.Close()
+
+	if isClosed || !s.IsReconnecting() || !s.GetStreamStatus().IsReconnecting {
+		t.Fatal("session is not waiting for the host to reconnect")
+	}
+
+	select {
+	case <-statusChanged:
+	default:
+		t.Fatal("status change was not notified")
+	}
+
+	if _, err := s.AddExternalHost(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.IsReconnecting() || !s.GetStreamStatus().IsOnline {
+		t.Fatal("session is still reconnecting after a host was added")
+	}
+}
+
+func TestReconnectGracePeriodEnds(t *testing.T) {
+	s := newTestSession()
+	s.SetReconnectGracePeriod(50 * time.Millisecond)
+
+	closed := make(chan struct{})
+	s.SetOnClose(func() { close(closed) })
+
+	host, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	host.Close()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not closed after the grace period")
+	}
+
+	if s.IsReconnecting() {
+		t.Fatal("session is still reconnecting after the grace period")
+	}
+}
@@ -0,0 +1,37 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/server/authorization"
+)
+
+func TestRecordingFollowsProfile(t *testing.T) {
+	t.Setenv(environment.RecordingPath, t.TempDir())
+
+	s := newTestSession()
+	host, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.UpdateStreamStatus(authorization.PublicProfile{Record: true})
+	if !s.IsRecording() || host.Recorder.Load() == nil {
+		t.Fatal("recording was not started")
+	}
+
+	s.UpdateStreamStatus(authorization.PublicProfile{Record: false})
+	if s.IsRecording() || host.Recorder.Load() != nil {
+		t.Fatal("recording was not stopped")
+	}
+
+	// Streams are kept recording when every stream is recorded
+	t.Setenv(environment.RecordAllStreams, "true")
+	s.UpdateStreamStatus(authorization.PublicProfile{Record: true})
+	s.UpdateStreamStatus(authorization.PublicProfile{Record: false})
+	if !s.IsRecording() || host.Recorder.Load() == nil {
+		t.Fatal("recording was stopped while every stream is recorded")
+	}
+}
@@ -1,8 +1,6 @@
 package session
 
 import (
-	"log"
-
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
@@ -26,13 +24,16 @@ func (s *Session) handleWHEPVideoRTCPSender(whepSession *whep.WHEPSession, rtcpS
 	for {
 		rtcpPackets, _, rtcpErr := rtcpSender.ReadRTCP()
 		if rtcpErr != nil {
-			log.Println("WHEPSession.ReadRTCP.Error:", rtcpErr)
+			whepSession.Logger.Debug("WHEPSession.ReadRTCP.Error", "error", rtcpErr)
 			return
 		}
 
 		for _, packet := range rtcpPackets {
-			if _, isPLI := packet.(*rtcp.PictureLossIndication); isPLI {
+			switch packet := packet.(type) {
+			case *rtcp.PictureLossIndication:
 				whepSession.SendPLI()
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				whepSession.SetREMBEstimate(uint64(packet.Bitrate))
 			}
 		}
 	}
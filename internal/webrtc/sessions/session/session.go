@@ -1,14 +1,16 @@
 package session
 
 import (
-	"fmt"
-	"log"
+	"time"
 
+	"github.com/glimesh/broadcast-box/internal/hls"
+	"github.com/glimesh/broadcast-box/internal/recording"
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
 	"github.com/google/uuid"
+	"github.com/pion/interceptor/pkg/cc"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -19,6 +21,14 @@ func (s *Session) UpdateStreamStatus(profile authorization.PublicProfile) {
 	s.IsPublic = profile.IsPublic
 
 	s.StatusLock.Unlock()
+
+	if profile.Record {
+		if err := s.StartRecording(); err != nil {
+			s.Logger.Error("Session.UpdateStreamStatus.StartRecording.Error", "error", err)
+		}
+	} else if s.IsRecording() && !recording.IsRecordingAllStreams() {
+		s.StopRecording()
+	}
 }
 
 func (session *Session) SetOnClose(onClose func()) {
@@ -26,8 +36,8 @@ func (session *Session) SetOnClose(onClose func()) {
 }
 
 // Add WHEP viewer session
-func (s *Session) AddWHEP(whepSessionID string, peerConnection *webrtc.PeerConnection, audioTrack *codecs.TrackMultiCodec, videoTrack *codecs.TrackMultiCodec, videoRTCPSender *webrtc.RTPSender, pliSender func()) (err error) {
-	log.Println("WHIPSessionManager.WHIPSession.AddWHEPSession")
+func (s *Session) AddWHEP(whepSessionID string, peerConnection *webrtc.PeerConnection, audioTrack *codecs.TrackMultiCodec, videoTrack *codecs.TrackMultiCodec, videoRTCPSender *webrtc.RTPSender, videoAngleSenders []*webrtc.RTPSender, bandwidthEstimator cc.BandwidthEstimator, pliSender func()) (err error) {
+	s.Logger.Info("Session.AddWHEP", "sessionId", whepSessionID)
 
 	whepSession := whep.CreateNewWHEP(
 		whepSessionID,
@@ -41,77 +51,226 @@ func (s *Session) AddWHEP(whepSessionID string, peerConnection *webrtc.PeerConne
 
 	whepSession.SetOnClose(s.handleWHEPClose)
 
+	if bandwidthEstimator != nil {
+		whepSession.SetBandwidthEstimator(bandwidthEstimator)
+	}
+
+	for _, sender := range videoAngleSenders {
+		if track, ok := sender.Track().(*codecs.TrackMultiCodec); ok {
+			whepSession.AddVideoAngleTrack(getSenderMID(peerConnection, sender), track)
+		}
+	}
+
 	s.WHEPSessionsLock.Lock()
 	s.WHEPSessions[whepSessionID] = whepSession
 	s.WHEPSessionsLock.Unlock()
 	s.updateHostWHEPSessionsSnapshot()
+	if s.Events != nil {
+		s.Events.ViewerJoined(s.StreamKey, whepSessionID)
+	}
 	whepSession.RegisterWHEPHandlers(peerConnection)
 	go s.handleWHEPVideoRTCPSender(whepSession, videoRTCPSender)
+	for _, sender := range videoAngleSenders {
+		go s.handleWHEPVideoRTCPSender(whepSession, sender)
+	}
 
 	return nil
 }
 
-// Add host
-func (s *Session) AddHost(peerConnection *webrtc.PeerConnection) (err error) {
-	log.Println("Session.AddHost")
+// Add host, or a standby when the session already has a host and backup ingest is enabled
+func (s *Session) AddHost(peerConnection *webrtc.PeerConnection) (host *whip.WHIPSession, err error) {
+	s.Logger.Info("Session.AddHost")
+
+	host = s.newHost()
+	host.AddPeerConnection(peerConnection, s.StreamKey)
+
+	if err := s.setHost(host); err != nil {
+		host.RemovePeerConnection()
+		host.RemoveTracks()
+		return nil, err
+	}
+
+	return host, nil
+}
+
+// Add a host that is not connected through WebRTC.
+// Media is provided through the ingest functions of the returned host.
+func (s *Session) AddExternalHost() (host *whip.WHIPSession, err error) {
+	s.Logger.Info("Session.AddExternalHost")
+
+	host = s.newHost()
+	if err := s.setHost(host); err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
+func (s *Session) newHost() *whip.WHIPSession {
+	id := uuid.New().String()
+	host := &whip.WHIPSession{
+		ID:          id,
+		Logger:      s.Logger.With("sessionId", id),
+		AudioTracks: make(map[string]*whip.AudioTrack),
+		VideoTracks: make(map[string]*whip.VideoTrack),
+		ChatManager: s.ChatManager,
+
+		KeyframeStallTimeout: s.getKeyframeStallTimeout(),
+	}
+	host.SetOnClosed(func() {
+		s.handleHostClosed(host)
+	})
+	host.SetOnTracksChanged(func() {
+		s.handleHostTracksChanged(host)
+	})
+	if s.Events != nil {
+		host.SetOnKeyframeStall(func(layer string, angle string, sinceKeyframe time.Duration) {
+			s.Events.KeyframeStall(s.StreamKey, host.ID, layer, angle, sinceKeyframe)
+		})
+	}
+
+	return host
+}
 
+// Set the host of the session, replacing a previous host that has been closed
+func (s *Session) setHost(host *whip.WHIPSession) error {
 	for {
-		host := s.Host.Load()
-		if host == nil {
+		currentHost := s.Host.Load()
+		if currentHost == nil {
 			break
 		}
 
-		if host.PeerConnection.ConnectionState() != webrtc.PeerConnectionStateClosed {
-			return fmt.Errorf("session already has a host")
+		if !currentHost.IsClosed() {
+			return s.setStandby(host)
 		}
 
-		if s.Host.CompareAndSwap(host, nil) {
+		if s.Host.CompareAndSwap(currentHost, nil) {
 			break
 		}
 	}
 
-	host := &whip.WHIPSession{
-		ID:          uuid.New().String(),
-		AudioTracks: make(map[string]*whip.AudioTrack),
-		VideoTracks: make(map[string]*whip.VideoTrack),
-		ChatManager: s.ChatManager,
+	if !s.Host.CompareAndSwap(nil, host) {
+		return s.setStandby(host)
 	}
-	host.SetOnClosed(s.handleHostClosed)
 
-	host.AddPeerConnection(peerConnection, s.StreamKey)
-	if !s.Host.CompareAndSwap(nil, host) {
-		host.RemovePeerConnection()
-		host.RemoveTracks()
-		return fmt.Errorf("session already has a host")
+	s.activateHost(host)
+	return nil
+}
+
+// Forward the media of the host to viewers, recordings and HLS
+func (s *Session) activateHost(host *whip.WHIPSession) {
+	if s.stopReconnecting() {
+		s.Logger.Info("Session.Reconnected", "sessionId", host.ID)
+	}
+
+	s.hostActiveSince.Store(time.Now().UnixNano())
+	if s.liveSince.CompareAndSwap(0, time.Now().UnixNano()) && s.Events != nil {
+		s.Events.StreamStarted(s.StreamKey, host.ID)
+	}
+
+	// Viewers continue from the media of the previous host
+	s.WHEPSessionsLock.RLock()
+	for _, whepSession := range s.WHEPSessions {
+		whepSession.ResetSource()
 	}
+	s.WHEPSessionsLock.RUnlock()
+
 	host.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
 	s.updateHostWHEPSessionsSnapshot()
 	s.HasHost.Store(true)
+	s.notifyStatusChanged()
 
-	return nil
+	// A standby taking over already has its tracks
+	go s.updateWHEPTracks(host, false)
+
+	if s.isRecording.Load() {
+		if err := host.StartRecording(s.StreamKey); err != nil {
+			s.Logger.Error("Session.AddHost.StartRecording.Error", "error", err)
+		}
+	}
+
+	if s.hlsPackager != nil {
+		s.hlsPackager.Reset()
+		host.HLSPackager.Store(s.hlsPackager)
+	}
 }
 
 func (s *Session) RemoveHost() {
 
 	host := s.Host.Swap(nil)
 	if host == nil {
-		log.Println("Session.RemoveHost", s.StreamKey, "- No host to remove")
+		s.Logger.Debug("Session.RemoveHost: No host to remove")
 		return
 	}
 
-	log.Println("Session.RemoveHost", s.StreamKey)
+	s.Logger.Info("Session.RemoveHost", "sessionId", host.ID)
 	s.HasHost.Store(false)
 
+	releaseHost(host)
+	s.notifyStatusChanged()
+}
+
+// Stop forwarding the media of a host and close its connection
+func releaseHost(host *whip.WHIPSession) {
 	host.WHEPSessionsSnapshot.Store(make(map[string]*whep.WHEPSession))
+	host.HLSPackager.Store(nil)
+	host.StopRecording()
 	host.RemovePeerConnection()
 	host.RemoveTracks()
 }
 
+// Returns true if the host is the host or the standby of the session
+func (s *Session) IsHostOrStandby(host *whip.WHIPSession) bool {
+	return host != nil && (s.Host.Load() == host || s.Standby.Load() == host)
+}
+
+// Start recording the current and any following hosts of the session
+func (s *Session) StartRecording() error {
+	s.Logger.Info("Session.StartRecording")
+	s.isRecording.Store(true)
+
+	host := s.Host.Load()
+	if host == nil {
+		return nil
+	}
+
+	return host.StartRecording(s.StreamKey)
+}
+
+// Stop recording the session
+func (s *Session) StopRecording() {
+	s.Logger.Info("Session.StopRecording")
+	s.isRecording.Store(false)
+
+	if host := s.Host.Load(); host != nil {
+		host.StopRecording()
+	}
+}
+
+// Returns true if the session is set to be recorded
+func (s *Session) IsRecording() bool {
+	return s.isRecording.Load()
+}
+
+// Enable HLS packaging of the media of the session
+func (s *Session) EnableHLS() {
+	s.hlsPackager = hls.NewPackager(s.StreamKey, func() {
+		if host := s.Host.Load(); host != nil {
+			host.SendPLI()
+		}
+	})
+}
+
+// Returns the HLS packager of the session, nil if HLS is disabled
+func (s *Session) GetHLSPackager() *hls.Packager {
+	return s.hlsPackager
+}
+
 func (s *Session) handleWHEPClose(whepSessionID string) {
-	log.Println("Session.HandleWHEPClose:", s.StreamKey, " - ", whepSessionID)
+	s.Logger.Info("Session.HandleWHEPClose", "sessionId", whepSessionID)
 
 	s.WHEPSessionsLock.Lock()
-	_, ok := s.WHEPSessions[whepSessionID]
+	whepSession, ok := s.WHEPSessions[whepSessionID]
 	if ok {
 		delete(s.WHEPSessions, whepSessionID)
 	}
@@ -122,15 +281,39 @@ func (s *Session) handleWHEPClose(whepSessionID string) {
 	}
 
 	s.updateHostWHEPSessionsSnapshot()
+	if s.Events != nil {
+		s.Events.ViewerLeft(s.StreamKey, whepSessionID, time.Since(whepSession.ConnectedAt))
+	}
 
 	if s.isEmpty() {
 		s.close()
 	}
 }
 
-func (s *Session) handleHostClosed() {
+func (s *Session) handleHostClosed(host *whip.WHIPSession) {
+	if s.Standby.CompareAndSwap(host, nil) {
+		s.Logger.Info("Session.RemoveStandby", "sessionId", host.ID)
+		releaseHost(host)
+		return
+	}
+
+	// Host was never added or has already been replaced
+	if s.Host.Load() != host {
+		return
+	}
+
+	if s.failover(host) || s.Host.Load() != host {
+		return
+	}
+
 	s.RemoveHost()
 
+	if s.startReconnecting() {
+		return
+	}
+
+	s.endStream()
+
 	if s.isEmpty() {
 		s.close()
 	}
@@ -153,6 +336,21 @@ func (s *Session) close() {
 		s.updateHostWHEPSessionsSnapshot()
 
 		s.RemoveHost()
+		s.endStream()
+
+		if standby := s.Standby.Swap(nil); standby != nil {
+			releaseHost(standby)
+		}
+
+		if s.monitorDone != nil {
+			close(s.monitorDone)
+		}
+
+		s.stopReconnecting()
+
+		if s.hlsPackager != nil {
+			s.hlsPackager.Close()
+		}
 
 		if s.onClose != nil {
 			s.onClose()
@@ -160,24 +358,39 @@ func (s *Session) close() {
 	})
 }
 
+// The stream ended when its host is removed without reconnecting
+func (s *Session) endStream() {
+	liveSince := s.liveSince.Swap(0)
+	if liveSince == 0 || s.Events == nil {
+		return
+	}
+
+	s.Events.StreamEnded(s.StreamKey, time.Since(time.Unix(0, liveSince)))
+}
+
 func (s *Session) Close() {
-	log.Println("Session.Close", s.StreamKey)
+	s.Logger.Info("Session.Close")
 	s.close()
 }
 
 // Returns true is no WHIP tracks are present, and no WHEP sessions are waiting for incoming streams
 func (s *Session) isEmpty() bool {
+	if s.isReconnecting.Load() {
+		s.Logger.Debug("Session.IsEmpty.IsReconnecting", "isEmpty", false)
+		return false
+	}
+
 	if s.hasWHEPSessions() {
-		log.Println("Session.IsEmpty.HasWHEPSessions (false):", s.StreamKey)
+		s.Logger.Debug("Session.IsEmpty.HasWHEPSessions", "isEmpty", false)
 		return false
 	}
 
 	if s.isStreaming() {
-		log.Println("Session.IsEmpty.IsActive (false):", s.StreamKey)
+		s.Logger.Debug("Session.IsEmpty.IsActive", "isEmpty", false)
 		return false
 	}
 
-	log.Println("Session.IsEmpty (true):", s.StreamKey)
+	s.Logger.Debug("Session.IsEmpty", "isEmpty", true)
 	return true
 }
 
@@ -192,12 +405,12 @@ func (s *Session) isStreaming() bool {
 	host.TracksLock.RLock()
 
 	if len(host.AudioTracks) != 0 {
-		log.Println("Session.IsActive.AudioTracks", len(host.AudioTracks))
+		s.Logger.Debug("Session.IsActive.AudioTracks", "count", len(host.AudioTracks))
 		host.TracksLock.RUnlock()
 		return true
 	}
 	if len(host.VideoTracks) != 0 {
-		log.Println("Session.IsActive.VideoTracks", len(host.VideoTracks))
+		s.Logger.Debug("Session.IsActive.VideoTracks", "count", len(host.VideoTracks))
 		host.TracksLock.RUnlock()
 		return true
 	}
@@ -208,7 +421,7 @@ func (s *Session) isStreaming() bool {
 
 func (s *Session) hasWHEPSessions() bool {
 	s.WHEPSessionsLock.RLock()
-	log.Println("Session.HasWHEPSessions:", len(s.WHEPSessions))
+	s.Logger.Debug("Session.HasWHEPSessions", "count", len(s.WHEPSessions))
 
 	if len(s.WHEPSessions) == 0 {
 		s.WHEPSessionsLock.RUnlock()
@@ -251,9 +464,21 @@ func (s *Session) GetStreamStatus() (status whipSessionStatus) {
 		ViewerCount: whepSessionsCount,
 		IsOnline:    s.HasHost.Load(),
 		StreamStart: s.StreamStart,
+
+		IsReconnecting: s.isReconnecting.Load(),
 	}
 
 	s.StatusLock.RUnlock()
 
 	return
 }
+
+func getSenderMID(peerConnection *webrtc.PeerConnection, sender *webrtc.RTPSender) string {
+	for _, transceiver := range peerConnection.GetTransceivers() {
+		if transceiver.Sender() == sender {
+			return transceiver.Mid()
+		}
+	}
+
+	return ""
+}
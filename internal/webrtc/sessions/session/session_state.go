@@ -1,8 +1,10 @@
 package session
 
 import (
-	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 )
 
 // Status for an individual streaming session
@@ -12,19 +14,28 @@ type whipSessionStatus struct {
 	ViewerCount int       `json:"viewers"`
 	IsOnline    bool      `json:"isOnline"`
 	StreamStart time.Time `json:"streamStart"`
+
+	// Set while the session waits for the broadcaster to reconnect
+	IsReconnecting bool `json:"isReconnecting"`
 }
 
 // Information for a whip session
 type StreamSessionState struct {
-	StreamKey   string    `json:"streamKey"`
-	IsPublic    bool      `json:"isPublic"`
-	MOTD        string    `json:"motd"`
-	StreamStart time.Time `json:"streamStart"`
+	StreamKey      string    `json:"streamKey"`
+	IsPublic       bool      `json:"isPublic"`
+	IsRecording    bool      `json:"isRecording"`
+	HasStandby     bool      `json:"hasStandby"`
+	IsReconnecting bool      `json:"isReconnecting"`
+	MOTD           string    `json:"motd"`
+	StreamStart    time.Time `json:"streamStart"`
 
 	AudioTracks []AudioTrackState `json:"audioTracks"`
 	VideoTracks []VideoTrackState `json:"videoTracks"`
 
 	Sessions []whep.SessionState `json:"sessions"`
+
+	// Chat rate limit counters, only included for admins
+	ChatRateLimits *chat.RateLimitStats `json:"chatRateLimits,omitempty"`
 }
 
 type AudioTrackState struct {
@@ -39,4 +50,7 @@ type VideoTrackState struct {
 	PacketsReceived uint64    `json:"packetsReceived"`
 	PacketsDropped  uint64    `json:"packetsDropped"`
 	LastKeyframe    time.Time `json:"lastKeyframe"`
+
+	// Time between the last two keyframes in milliseconds
+	KeyframeInterval int64 `json:"keyframeInterval"`
 }
@@ -1,8 +1,6 @@
 package session
 
 import (
-	"log"
-
 	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 )
 
@@ -11,9 +9,31 @@ func (s *Session) GetSessionStatsEvent() string {
 
 	status, err := utils.ToJSONString(s.GetStreamStatus())
 	if err != nil {
-		log.Println("GetSessionStatsJsonString Error:", err)
+		s.Logger.Error("Session.GetSessionStatsEvent.Error", "error", err)
 		return ""
 	}
 
 	return "event: status\ndata: " + status + "\n\n"
 }
+
+// Returns a channel that is closed when the status of the session changes
+func (s *Session) StatusChanged() <-chan struct{} {
+	s.statusChangedLock.Lock()
+	defer s.statusChangedLock.Unlock()
+
+	if s.statusChanged == nil {
+		s.statusChanged = make(chan struct{})
+	}
+
+	return s.statusChanged
+}
+
+func (s *Session) notifyStatusChanged() {
+	s.statusChangedLock.Lock()
+	defer s.statusChangedLock.Unlock()
+
+	if s.statusChanged != nil {
+		close(s.statusChanged)
+		s.statusChanged = nil
+	}
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
+)
+
+// Viewers are updated when the host adds tracks, or when a host is replaced by a host with other tracks.
+// Tracks of a standby are not forwarded, and viewers keep their tracks while the broadcaster reconnects.
+func (s *Session) handleHostTracksChanged(host *whip.WHIPSession) {
+	currentHost := s.Host.Load()
+	if currentHost == nil || s.Standby.Load() == host {
+		return
+	}
+
+	// Tracks of a replaced host were removed, viewers no longer need tracks the current host does not send
+	go s.updateWHEPTracks(currentHost, currentHost != host)
+}
+
+// Updates the tracks of every viewer for the tracks of the host, changes are offered through a renegotiation
+func (s *Session) updateWHEPTracks(host *whip.WHIPSession, removeUnused bool) {
+	hasAudio, videoAngleCount := host.HasAudioTracks(), host.GetVideoAngleCount()
+
+	s.WHEPSessionsLock.RLock()
+	whepSessions := slices.Collect(maps.Values(s.WHEPSessions))
+	s.WHEPSessionsLock.RUnlock()
+
+	for _, whepSession := range whepSessions {
+		senders, err := whepSession.UpdateTracks(hasAudio, videoAngleCount, removeUnused)
+		if err != nil && !errors.Is(err, whep.ErrSessionClosed) {
+			whepSession.Logger.Warn("Session.UpdateWHEPTracks.Error", "error", err)
+		}
+
+		for _, sender := range senders {
+			go s.handleWHEPVideoRTCPSender(whepSession, sender)
+		}
+	}
+}
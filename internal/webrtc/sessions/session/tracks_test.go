@@ -0,0 +1,127 @@
+package session
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestViewerRenegotiatedWhenHostAddsAudio(t *testing.T) {
+	mediaEngine := &webrtc.MediaEngine{}
+	codecs.RegisterCodecs(mediaEngine)
+
+	server, err := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	// The viewer joins a stream without audio, so it only negotiates video
+	if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	audioTrack, videoTrack := codecs.GetDefaultTracks("test")
+	if _, err := server.AddTrack(audioTrack); err != nil {
+		t.Fatal(err)
+	}
+
+	videoSender, err := server.AddTrack(videoTrack)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := server.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestSession()
+	defer s.Close()
+
+	if err := s.AddWHEP("viewer", server, audioTrack, videoTrack, videoSender, nil, nil, func() {}); err != nil {
+		t.Fatal(err)
+	}
+	whepSession := s.WHEPSessions["viewer"]
+
+	host, err := s.AddExternalHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renegotiationChanged := whepSession.RenegotiationChanged()
+
+	reader := &packetReader{done: make(chan struct{})}
+	defer close(reader.done)
+	go host.IngestAudio(reader, codecs.AudioTrackCodecOpus, s.StreamKey)
+
+	select {
+	case <-renegotiationChanged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("audio of the host was not offered to the viewer")
+	}
+
+	data, found := strings.CutPrefix(strings.TrimSpace(whepSession.GetRenegotiationEvent()), "event: offer\ndata: ")
+	if !found {
+		t.Fatal("expected a pending offer")
+	}
+
+	var serverOffer webrtc.SessionDescription
+	if err := json.Unmarshal([]byte(data), &serverOffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(serverOffer.SDP, "m=audio") {
+		t.Fatalf("expected the offer to add audio:\n%s", serverOffer.SDP)
+	}
+
+	if err := client.SetRemoteDescription(serverOffer); err != nil {
+		t.Fatal(err)
+	}
+
+	clientAnswer, err := client.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetLocalDescription(clientAnswer); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := whepSession.SetRenegotiationAnswer(clientAnswer.SDP); err != nil {
+		t.Fatal(err)
+	}
+
+	if !audioTrack.IsBound() || !audioTrack.HasCodec(codecs.AudioTrackCodecOpus) {
+		t.Fatal("expected the viewer to receive audio after the renegotiation")
+	}
+}
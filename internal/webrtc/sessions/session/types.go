@@ -1,11 +1,13 @@
 package session
 
 import (
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/glimesh/broadcast-box/internal/hls"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
 )
@@ -16,6 +18,9 @@ type Session struct {
 	StatusLock sync.RWMutex
 	StreamKey  string
 
+	// Logger with the stream key of the session
+	Logger *slog.Logger
+
 	MOTD        string
 	HasHost     atomic.Bool
 	IsPublic    bool
@@ -23,6 +28,35 @@ type Session struct {
 
 	Host atomic.Pointer[whip.WHIPSession]
 
+	// Host accepted while another host is active, takes over when the host fails
+	Standby atomic.Pointer[whip.WHIPSession]
+
+	// Time without packets before the host is replaced by the standby, zero when backup ingest is disabled
+	backupIngestTimeout time.Duration
+	hostActiveSince     atomic.Int64
+	monitorDone         chan struct{}
+
+	// Unix nanoseconds the stream went live, zero while it is not live. Reconnects and failovers continue the stream.
+	liveSince atomic.Int64
+
+	// Time the session waits for the broadcaster to reconnect after the host was removed
+	reconnectGracePeriod time.Duration
+
+	// Protects reconnectTimer
+	reconnectLock  sync.Mutex
+	reconnectTimer *time.Timer
+	isReconnecting atomic.Bool
+
+	// Protects statusChanged, which is closed and replaced whenever the status changes
+	statusChangedLock sync.Mutex
+	statusChanged     chan struct{}
+
+	// Hosts added while set will have their media recorded
+	isRecording atomic.Bool
+
+	// Packages the media of all hosts for HLS viewers, nil when HLS is disabled
+	hlsPackager *hls.Packager
+
 	closeOnce sync.Once
 	onClose   func()
 
@@ -31,4 +65,7 @@ type Session struct {
 	WHEPSessions     map[string]*whep.WHEPSession
 
 	ChatManager *chat.Manager
+
+	// Receives the lifecycle events of the session, nil when events are not reported
+	Events EventSink
 }
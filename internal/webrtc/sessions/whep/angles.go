@@ -0,0 +1,313 @@
+package whep
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+var ErrUnknownMID = errors.New("viewer has no video track with the MID")
+
+// Additional video track of a viewer, forwarding a camera angle besides the one of VideoTrack.
+// The best layer of the angle is forwarded unless a layer was requested.
+type videoAngleTrack struct {
+	mid   string
+	track *codecs.TrackMultiCodec
+
+	// Sender of tracks added through a renegotiation, which are removed again when the host stops sending the camera angle.
+	// Their MID is known once the offer of the renegotiation was created.
+	sender *webrtc.RTPSender
+
+	angle         string
+	angleExplicit bool
+	layer         string
+	layerPriority int
+	layerExplicit bool
+
+	timestamp            uint32
+	sequenceNumber       uint16
+	packetsWritten       uint64
+	lastWritten          time.Time
+	sourceReset          bool
+	isWaitingForKeyframe bool
+}
+
+// Timestamp and sequence number a packet is written with
+type videoAngleWrite struct {
+	track          *codecs.TrackMultiCodec
+	timestamp      uint32
+	sequenceNumber uint16
+}
+
+// Adds a video track the viewer negotiated besides VideoTrack, mid is the MID of its transceiver.
+// Tracks without a requested angle forward the camera angles other than the default angle, in order.
+func (w *WHEPSession) AddVideoAngleTrack(mid string, track *codecs.TrackMultiCodec) {
+	w.Logger.Info("WHEPSession.AddVideoAngleTrack", "mid", mid)
+	w.addVideoAngleTrack(&videoAngleTrack{mid: mid, track: track})
+}
+
+func (w *WHEPSession) addVideoAngleTrack(angleTrack *videoAngleTrack) {
+	angleTrack.timestamp = 5000
+	angleTrack.isWaitingForKeyframe = true
+
+	w.videoAngleLock.Lock()
+	defer w.videoAngleLock.Unlock()
+
+	w.videoAngleTracks = append(w.videoAngleTracks, angleTrack)
+	w.assignVideoAnglesLocked()
+}
+
+// Removes the last additional video track if it was added through a renegotiation, returns nil otherwise
+func (w *WHEPSession) removeAddedVideoAngleTrack() *videoAngleTrack {
+	w.videoAngleLock.Lock()
+	defer w.videoAngleLock.Unlock()
+
+	if len(w.videoAngleTracks) == 0 || w.videoAngleTracks[len(w.videoAngleTracks)-1].sender == nil {
+		return nil
+	}
+
+	angleTrack := w.videoAngleTracks[len(w.videoAngleTracks)-1]
+	w.videoAngleTracks = w.videoAngleTracks[:len(w.videoAngleTracks)-1]
+	w.assignVideoAnglesLocked()
+
+	return angleTrack
+}
+
+// Selects the camera angle and layer of the viewer video track with the MID.
+// An empty MID selects for VideoTrack. An empty angle or encoding ID is selected automatically.
+func (w *WHEPSession) SelectVideo(mid string, angle string, encodingID string) error {
+	w.videoAngleLock.Lock()
+	index := slices.IndexFunc(w.videoAngleTracks, func(angleTrack *videoAngleTrack) bool {
+		return mid != "" && angleTrack.getMID(w.PeerConnection) == mid
+	})
+	if index == -1 {
+		w.videoAngleLock.Unlock()
+
+		if mid != "" && !w.isVideoTrackMID(mid) {
+			return ErrUnknownMID
+		}
+
+		w.SetVideoLayer(angle, encodingID)
+		return nil
+	}
+
+	w.Logger.Info("WHEPSession.SelectVideo", "mid", mid, "angle", angle, "layer", encodingID)
+
+	angleTrack := w.videoAngleTracks[index]
+	angleTrack.layer = encodingID
+	angleTrack.layerPriority = 0
+	angleTrack.layerExplicit = encodingID != ""
+	angleTrack.isWaitingForKeyframe = true
+	angleTrack.angleExplicit = angle != ""
+	if angleTrack.angleExplicit {
+		angleTrack.setAngle(angle)
+	} else {
+		w.assignVideoAnglesLocked()
+	}
+	w.videoAngleLock.Unlock()
+
+	w.SendPLI()
+	return nil
+}
+
+// Sends the provided video packet to the additional video tracks forwarding its camera angle
+func (w *WHEPSession) SendVideoAnglePacket(packet codecs.TrackPacket, priority int) {
+	if w.IsSessionClosed.Load() {
+		return
+	}
+
+	now := time.Now()
+	requestKeyframe := false
+	writes := []videoAngleWrite{}
+
+	w.videoAngleLock.Lock()
+	if len(w.videoAngleTracks) == 0 {
+		w.videoAngleLock.Unlock()
+		return
+	}
+
+	if !slices.Contains(w.videoAngles, packet.Angle) {
+		w.videoAngles = append(w.videoAngles, packet.Angle)
+		slices.SortFunc(w.videoAngles, codecs.CompareVideoAngles)
+		w.assignVideoAnglesLocked()
+	}
+
+	for _, angleTrack := range w.videoAngleTracks {
+		if angleTrack.angle != packet.Angle || !angleTrack.selectLayer(packet.Layer, priority) {
+			continue
+		}
+
+		// Playback continues at a keyframe once the viewer negotiated the codec
+		if !angleTrack.track.IsBound() || !w.isCodecNegotiated(angleTrack.track, packet.Codec) {
+			angleTrack.isWaitingForKeyframe = true
+			continue
+		}
+
+		if angleTrack.isWaitingForKeyframe {
+			if !packet.IsKeyframe {
+				requestKeyframe = true
+				continue
+			}
+
+			angleTrack.isWaitingForKeyframe = false
+		}
+
+		timeDiff, sequenceDiff := packet.TimeDiff, packet.SequenceDiff
+		if angleTrack.sourceReset {
+			timeDiff = getSourceResetTimeDiff(angleTrack.lastWritten, now, videoClockRate)
+			sequenceDiff = 1
+			angleTrack.sourceReset = false
+		}
+
+		angleTrack.packetsWritten += 1
+		angleTrack.sequenceNumber = angleTrack.sequenceNumber + uint16(sequenceDiff)
+		angleTrack.timestamp = uint32(int64(angleTrack.timestamp) + timeDiff)
+		angleTrack.lastWritten = now
+
+		writes = append(writes, videoAngleWrite{
+			track:          angleTrack.track,
+			timestamp:      angleTrack.timestamp,
+			sequenceNumber: angleTrack.sequenceNumber,
+		})
+	}
+	w.videoAngleLock.Unlock()
+
+	if requestKeyframe {
+		w.SendPLI()
+	}
+
+	for _, write := range writes {
+		packet.Packet.SequenceNumber = write.sequenceNumber
+		packet.Packet.Timestamp = write.timestamp
+
+		if err := write.track.WriteRTP(packet.Packet, packet.Codec); err != nil {
+			if errors.Is(err, io.ErrClosedPipe) {
+				w.Logger.Info("WHEPSession.SendVideoAnglePacket.ConnectionDropped")
+				w.Close()
+				return
+			}
+
+			w.Logger.Debug("WHEPSession.SendVideoAnglePacket.Error", "error", err)
+		}
+	}
+}
+
+// Returns true if the transceiver with the MID sends VideoTrack
+func (w *WHEPSession) isVideoTrackMID(mid string) bool {
+	w.VideoLock.RLock()
+	videoTrack := w.VideoTrack
+	w.VideoLock.RUnlock()
+
+	if videoTrack == nil {
+		return false
+	}
+
+	for _, transceiver := range w.PeerConnection.GetTransceivers() {
+		if transceiver.Mid() == mid && transceiver.Sender() != nil {
+			return transceiver.Sender().Track() == webrtc.TrackLocal(videoTrack)
+		}
+	}
+
+	return false
+}
+
+// Assigns the camera angles other than the default angle to the tracks without a requested angle, in order
+func (w *WHEPSession) assignVideoAnglesLocked() {
+	angles := slices.DeleteFunc(slices.Clone(w.videoAngles), func(angle string) bool {
+		return angle == codecs.VideoTrackLabelDefault
+	})
+
+	for i, angleTrack := range w.videoAngleTracks {
+		if angleTrack.angleExplicit {
+			continue
+		}
+
+		if i < len(angles) {
+			angleTrack.setAngle(angles[i])
+		} else {
+			angleTrack.setAngle("")
+		}
+	}
+}
+
+// Prepare the additional video tracks for media from a new host, angles and layers are selected again
+func (w *WHEPSession) resetVideoAngleTracks() {
+	w.videoAngleLock.Lock()
+	defer w.videoAngleLock.Unlock()
+
+	w.videoAngles = nil
+	for _, angleTrack := range w.videoAngleTracks {
+		angleTrack.angleExplicit = false
+		angleTrack.layer = ""
+		angleTrack.layerPriority = 0
+		angleTrack.layerExplicit = false
+		angleTrack.sourceReset = true
+		angleTrack.isWaitingForKeyframe = true
+	}
+	w.assignVideoAnglesLocked()
+}
+
+func (w *WHEPSession) getVideoAngleTracksState() []VideoAngleTrackState {
+	w.videoAngleLock.Lock()
+	defer w.videoAngleLock.Unlock()
+
+	states := []VideoAngleTrackState{}
+	for _, angleTrack := range w.videoAngleTracks {
+		states = append(states, VideoAngleTrackState{
+			MID:                  angleTrack.getMID(w.PeerConnection),
+			Angle:                angleTrack.angle,
+			LayerCurrent:         angleTrack.layer,
+			PacketsWritten:       angleTrack.packetsWritten,
+			IsWaitingForKeyframe: angleTrack.isWaitingForKeyframe,
+		})
+	}
+
+	return states
+}
+
+func (t *videoAngleTrack) getMID(peerConnection *webrtc.PeerConnection) string {
+	if t.mid == "" && t.sender != nil {
+		for _, transceiver := range peerConnection.GetTransceivers() {
+			if transceiver.Sender() == t.sender {
+				t.mid = transceiver.Mid()
+			}
+		}
+	}
+
+	return t.mid
+}
+
+func (t *videoAngleTrack) setAngle(angle string) {
+	if angle == t.angle {
+		return
+	}
+
+	t.angle = angle
+	if !t.layerExplicit {
+		t.layer = ""
+		t.layerPriority = 0
+	}
+	t.isWaitingForKeyframe = true
+}
+
+// Returns true if packets of the layer should be forwarded, the layer with the best priority is used
+func (t *videoAngleTrack) selectLayer(layer string, priority int) bool {
+	if t.layer == layer {
+		t.layerPriority = priority
+		return true
+	}
+
+	// Lower numeric priority value means a better simulcast layer.
+	if t.layerExplicit || (t.layer != "" && priority >= t.layerPriority) {
+		return false
+	}
+
+	t.layer = layer
+	t.layerPriority = priority
+	t.isWaitingForKeyframe = true
+	return true
+}
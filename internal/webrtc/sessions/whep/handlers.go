@@ -1,14 +1,12 @@
 package whep
 
 import (
-	"log"
-
 	"github.com/glimesh/broadcast-box/internal/webrtc/chatdc"
 	"github.com/pion/webrtc/v4"
 )
 
 func (w *WHEPSession) RegisterWHEPHandlers(peerConnection *webrtc.PeerConnection) {
-	log.Println("WHEPSession.RegisterHandlers")
+	w.Logger.Debug("WHEPSession.RegisterHandlers")
 
 	peerConnection.OnICEConnectionStateChange(onWHEPICEConnectionStateChangeHandler(w))
 
@@ -20,7 +18,7 @@ func (w *WHEPSession) RegisterWHEPHandlers(peerConnection *webrtc.PeerConnection
 
 func onWHEPICEConnectionStateChangeHandler(w *WHEPSession) func(webrtc.ICEConnectionState) {
 	return func(state webrtc.ICEConnectionState) {
-		log.Println("WHEPSession.OnICEConnectionStateChange:", state)
+		w.Logger.Info("WHEPSession.OnICEConnectionStateChange", "state", state)
 		switch state {
 		case
 			webrtc.ICEConnectionStateConnected:
@@ -30,7 +28,7 @@ func onWHEPICEConnectionStateChangeHandler(w *WHEPSession) func(webrtc.ICEConnec
 			webrtc.ICEConnectionStateClosed:
 			w.Close()
 		default:
-			log.Println("WHEPSession.OnICEConnectionStateChange.Default", state)
+			w.Logger.Debug("WHEPSession.OnICEConnectionStateChange.Default", "state", state)
 		}
 	}
 }
@@ -0,0 +1,252 @@
+package whep
+
+import (
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/interceptor/pkg/cc"
+)
+
+const (
+	// Layers without packets for this long are not selected
+	videoLayerStaleTimeout = 2 * time.Second
+
+	// The estimate has to exceed the bitrate of the current layer by this factor before a better layer is tried
+	videoLayerUpgradeHeadroom = 1.3
+
+	// Minimum time between trying better layers, doubled each time a better layer had to be left again shortly after
+	videoLayerUpgradeHold    = 5 * time.Second
+	videoLayerUpgradeHoldMax = time.Minute
+
+	// A keyframe is requested again when the pending layer did not send one in time
+	videoLayerKeyframeTimeout = time.Second
+)
+
+// Simulcast layer as last seen by the WHEP session
+type videoLayerInfo struct {
+	priority int
+	bitrate  uint64 // Bits per second
+	lastSeen time.Time
+}
+
+// Uses the TWCC estimates of the estimator and reports its state in the session status
+func (w *WHEPSession) SetBandwidthEstimator(estimator cc.BandwidthEstimator) {
+	estimator.OnTargetBitrateChange(w.SetTWCCEstimate)
+	w.bandwidthEstimator.Store(&estimator)
+}
+
+// Sets the latest REMB estimate of the viewer in bits per second
+func (w *WHEPSession) SetREMBEstimate(bitrate uint64) {
+	w.rembEstimate.Store(bitrate)
+}
+
+// Sets the latest estimate calculated from the TWCC feedback of the viewer in bits per second
+func (w *WHEPSession) SetTWCCEstimate(bitrate int) {
+	w.twccEstimate.Store(uint64(max(bitrate, 0)))
+}
+
+// Returns the lower of the REMB and TWCC estimates in bits per second, zero when the viewer sent no feedback
+func (w *WHEPSession) GetBandwidthEstimate() uint64 {
+	rembEstimate, twccEstimate := w.rembEstimate.Load(), w.twccEstimate.Load()
+	if rembEstimate == 0 || (twccEstimate != 0 && twccEstimate < rembEstimate) {
+		return twccEstimate
+	}
+
+	return rembEstimate
+}
+
+// Returns the state of the TWCC bandwidth estimator, nil when the session has none
+func (w *WHEPSession) getBandwidthEstimatorState() *BandwidthEstimatorState {
+	estimator := w.bandwidthEstimator.Load()
+	if estimator == nil {
+		return nil
+	}
+
+	stats := (*estimator).GetStats()
+	state := &BandwidthEstimatorState{}
+	state.LossTargetBitrate, _ = stats["lossTargetBitrate"].(int)
+	state.DelayTargetBitrate, _ = stats["delayTargetBitrate"].(int)
+	state.AverageLoss, _ = stats["averageLoss"].(float64)
+	state.State, _ = stats["state"].(string)
+
+	return state
+}
+
+// Returns the video layer the WHEP session currently forwards, given a packet of the provided layer.
+// Bitrate is the ingest bitrate of the layer in bytes per second. Only layers of the selected camera angle are forwarded.
+//
+// An explicitly requested layer is always kept. Without a bandwidth estimate the layer with the best priority is used,
+// otherwise the best layer fitting the estimate. Switching because of the estimate happens at the next keyframe of the new layer,
+// the current layer is forwarded until then.
+func (w *WHEPSession) GetVideoLayerOrDefault(angle string, layer string, priority int, bitrate uint64, isKeyframe bool) string {
+	w.VideoLock.Lock()
+	if angle != w.videoAngle {
+		currentLayer, _ := w.VideoLayerCurrent.Load().(string)
+		w.VideoLock.Unlock()
+		return currentLayer
+	}
+
+	selectedLayer, requestKeyframe := w.selectVideoLayerLocked(layer, priority, bitrate, isKeyframe, w.GetBandwidthEstimate(), time.Now())
+	w.VideoLock.Unlock()
+
+	if requestKeyframe {
+		w.SendPLI()
+	}
+
+	return selectedLayer
+}
+
+// Returns the selected layer and whether a keyframe should be requested for a pending layer switch
+func (w *WHEPSession) selectVideoLayerLocked(layer string, priority int, bitrate uint64, isKeyframe bool, estimate uint64, now time.Time) (string, bool) {
+	w.videoLayers[layer] = videoLayerInfo{
+		priority: priority,
+		bitrate:  bitrate * 8,
+		lastSeen: now,
+	}
+
+	currentLayer, _ := w.VideoLayerCurrent.Load().(string)
+	if w.videoLayerExplicit {
+		return currentLayer, false
+	}
+
+	if currentLayer == "" {
+		w.VideoLayerCurrent.Store(layer)
+		w.videoLayerPriority = priority
+		w.IsWaitingForKeyframe.Store(true)
+		return layer, false
+	}
+
+	if estimate == 0 {
+		return w.selectVideoLayerByPriorityLocked(currentLayer, layer, priority), false
+	}
+
+	if layer == w.videoLayerPending && isKeyframe {
+		w.switchVideoLayerLocked(layer, priority, now)
+		return layer, false
+	}
+
+	targetLayer := w.getTargetVideoLayerLocked(currentLayer, estimate, now)
+	switch {
+	case targetLayer == currentLayer:
+		w.videoLayerPending = ""
+	case targetLayer != w.videoLayerPending:
+		w.Logger.Info("WHEPSession.SelectVideoLayer", "layer", targetLayer, "currentLayer", currentLayer, "bandwidthEstimate", estimate)
+		if w.videoLayers[targetLayer].priority > w.videoLayerPriority {
+			w.holdVideoLayerUpgradesLocked(now)
+		}
+		w.videoLayerPending = targetLayer
+		w.videoLayerPendingSince = now
+		return currentLayer, true
+	case now.Sub(w.videoLayerPendingSince) >= videoLayerKeyframeTimeout:
+		w.videoLayerPendingSince = now
+		return currentLayer, true
+	}
+
+	return currentLayer, false
+}
+
+func (w *WHEPSession) selectVideoLayerByPriorityLocked(currentLayer string, layer string, priority int) string {
+	if currentLayer == layer {
+		w.videoLayerPriority = priority
+		return currentLayer
+	}
+
+	// Lower numeric priority value means a better simulcast layer.
+	if w.videoLayerPriority == 0 || priority < w.videoLayerPriority {
+		w.VideoLayerCurrent.Store(layer)
+		w.videoLayerPriority = priority
+		w.IsWaitingForKeyframe.Store(true)
+		return layer
+	}
+
+	return currentLayer
+}
+
+// Returns the layer that should be forwarded for the bandwidth estimate.
+// A layer that no longer fits is left for the best layer that does, or the lowest layer when none fits.
+// Better layers are only tried one at a time, when the estimate leaves headroom and upgrades are not on hold.
+func (w *WHEPSession) getTargetVideoLayerLocked(currentLayer string, estimate uint64, now time.Time) string {
+	current, isCurrentSeen := w.videoLayers[currentLayer]
+	isCurrentActive := isCurrentSeen && now.Sub(current.lastSeen) < videoLayerStaleTimeout
+
+	var fittingLayer, lowestLayer, upgradeLayer string
+	var fitting, lowest, upgrade videoLayerInfo
+	for id, info := range w.videoLayers {
+		if now.Sub(info.lastSeen) >= videoLayerStaleTimeout {
+			continue
+		}
+
+		if lowestLayer == "" || info.priority > lowest.priority {
+			lowestLayer, lowest = id, info
+		}
+
+		if info.bitrate <= estimate && (fittingLayer == "" || info.priority < fitting.priority) {
+			fittingLayer, fitting = id, info
+		}
+
+		if isCurrentActive && info.priority < current.priority && (upgradeLayer == "" || info.priority > upgrade.priority) {
+			upgradeLayer, upgrade = id, info
+		}
+	}
+
+	if !isCurrentActive || current.bitrate > estimate {
+		if fittingLayer != "" {
+			return fittingLayer
+		}
+
+		if lowestLayer != "" {
+			return lowestLayer
+		}
+
+		return currentLayer
+	}
+
+	if upgradeLayer != "" && !now.Before(w.videoLayerUpgradeAfter) && float64(estimate) >= float64(current.bitrate)*videoLayerUpgradeHeadroom {
+		return upgradeLayer
+	}
+
+	return currentLayer
+}
+
+// Delays the next upgrade after switching down. Leaving a layer shortly after upgrading to it doubles the delay.
+func (w *WHEPSession) holdVideoLayerUpgradesLocked(now time.Time) {
+	if now.Sub(w.videoLayerUpgradedAt) < w.videoLayerUpgradeHold {
+		w.videoLayerUpgradeHold = min(w.videoLayerUpgradeHold*2, videoLayerUpgradeHoldMax)
+	} else {
+		w.videoLayerUpgradeHold = videoLayerUpgradeHold
+	}
+
+	w.videoLayerUpgradeAfter = now.Add(w.videoLayerUpgradeHold)
+}
+
+func (w *WHEPSession) switchVideoLayerLocked(layer string, priority int, now time.Time) {
+	w.Logger.Info("WHEPSession.SwitchVideoLayer", "layer", layer)
+
+	if priority < w.videoLayerPriority {
+		w.videoLayerUpgradedAt = now
+		w.videoLayerUpgradeAfter = now.Add(w.videoLayerUpgradeHold)
+	}
+
+	w.VideoLayerCurrent.Store(layer)
+	w.videoLayerPriority = priority
+	w.videoLayerPending = ""
+}
+
+// Returns true if packets of the audio track should be forwarded.
+// Viewers receive one audio track, the selected one or else the default audio track. The first audio track seen is used until
+// the default audio track sends.
+func (w *WHEPSession) selectAudioLayerLocked(layer string) bool {
+	currentLayer := w.AudioLayerCurrent.Load().(string)
+
+	switch {
+	case layer == currentLayer:
+		return true
+	case w.audioLayerExplicit:
+		return false
+	case currentLayer == "" || layer == codecs.AudioTrackLabelDefault:
+		w.AudioLayerCurrent.Store(layer)
+		return true
+	}
+
+	return false
+}
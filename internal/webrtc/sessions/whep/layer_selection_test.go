@@ -0,0 +1,167 @@
+package whep
+
+import (
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// Ingest bitrates of the test layers in bytes per second
+const (
+	highBitrate = 250_000
+	lowBitrate  = 50_000
+)
+
+func newTestWHEPSession() *WHEPSession {
+	w := &WHEPSession{
+		Logger:                slog.Default(),
+		videoLayers:           map[string]videoLayerInfo{},
+		videoLayerUpgradeHold: videoLayerUpgradeHold,
+	}
+	w.VideoLayerCurrent.Store("")
+
+	return w
+}
+
+// Sends a packet of both layers and returns the layer selected for the last one
+func sendLayerPackets(w *WHEPSession, estimate uint64, isKeyframe bool, now time.Time) string {
+	w.selectVideoLayerLocked("high", 1, highBitrate, isKeyframe, estimate, now)
+	layer, _ := w.selectVideoLayerLocked("low", 2, lowBitrate, isKeyframe, estimate, now)
+	return layer
+}
+
+func TestVideoLayerSwitchesDownAtKeyframe(t *testing.T) {
+	w := newTestWHEPSession()
+	now := time.Now()
+
+	if layer := sendLayerPackets(w, 0, true, now); layer != "high" {
+		t.Fatalf("expected high layer without estimate, got %s", layer)
+	}
+
+	if layer := sendLayerPackets(w, 1_000_000, false, now); layer != "high" {
+		t.Fatalf("expected high layer to be kept until a keyframe, got %s", layer)
+	}
+
+	if w.videoLayerPending != "low" {
+		t.Fatalf("expected low layer to be pending, got %q", w.videoLayerPending)
+	}
+
+	if layer := sendLayerPackets(w, 1_000_000, true, now); layer != "low" {
+		t.Fatalf("expected low layer after keyframe, got %s", layer)
+	}
+}
+
+func TestVideoLayerUpgradeHold(t *testing.T) {
+	w := newTestWHEPSession()
+	now := time.Now()
+
+	sendLayerPackets(w, 0, true, now)
+	sendLayerPackets(w, 1_000_000, true, now)
+	sendLayerPackets(w, 1_000_000, true, now)
+
+	// Enough headroom for the high layer, but upgrades are on hold after the downgrade
+	if sendLayerPackets(w, 3_000_000, true, now.Add(time.Second)); w.VideoLayerCurrent.Load() != "low" {
+		t.Fatal("upgraded while on hold")
+	}
+
+	now = now.Add(videoLayerUpgradeHold)
+	sendLayerPackets(w, 3_000_000, true, now)
+	if layer := sendLayerPackets(w, 3_000_000, true, now); layer != "high" {
+		t.Fatalf("expected high layer after hold, got %s", layer)
+	}
+
+	// The upgrade does not hold, the next one is delayed longer
+	sendLayerPackets(w, 1_000_000, true, now.Add(time.Second))
+	sendLayerPackets(w, 1_000_000, true, now.Add(time.Second))
+	if w.VideoLayerCurrent.Load() != "low" || w.videoLayerUpgradeHold != 2*videoLayerUpgradeHold {
+		t.Fatalf("expected low layer with doubled hold, got %v and %s", w.VideoLayerCurrent.Load(), w.videoLayerUpgradeHold)
+	}
+}
+
+func TestExplicitVideoLayerIsKept(t *testing.T) {
+	w := newTestWHEPSession()
+	w.pliSender = func() {}
+	w.SetVideoLayer("", "high")
+
+	if layer := sendLayerPackets(w, 1_000_000, true, time.Now()); layer != "high" {
+		t.Fatalf("expected explicit high layer, got %s", layer)
+	}
+}
+
+func TestAudioLayerSelection(t *testing.T) {
+	w := newTestWHEPSession()
+	w.AudioLayerCurrent.Store("")
+
+	if !w.selectAudioLayerLocked("Audio-3") || !w.selectAudioLayerLocked(codecs.AudioTrackLabelDefault) {
+		t.Fatal("expected the first audio track until the default audio track sends")
+	}
+
+	if w.selectAudioLayerLocked("Audio-3") {
+		t.Fatal("expected only the default audio track to be forwarded")
+	}
+
+	w.SetAudioLayer("Audio-3")
+	if w.selectAudioLayerLocked(codecs.AudioTrackLabelDefault) || !w.selectAudioLayerLocked("Audio-3") {
+		t.Fatal("expected only the selected audio track to be forwarded")
+	}
+}
+
+func TestVideoAngleTracks(t *testing.T) {
+	w := newTestWHEPSession()
+	w.pliSender = func() {}
+	w.AddVideoAngleTrack("1", codecs.CreateTrackMultiCodec("video-1", "pion", "test", webrtc.RTPCodecTypeVideo, 0))
+	w.AddVideoAngleTrack("2", codecs.CreateTrackMultiCodec("video-2", "pion", "test", webrtc.RTPCodecTypeVideo, 0))
+
+	sendAnglePacket := func(angle string, layer string, priority int) {
+		w.SendVideoAnglePacket(codecs.TrackPacket{
+			Layer:      layer,
+			Angle:      angle,
+			Packet:     &rtp.Packet{},
+			IsKeyframe: true,
+		}, priority)
+	}
+
+	getAngles := func() (angles []string) {
+		for _, state := range w.getVideoAngleTracksState() {
+			angles = append(angles, state.Angle+"/"+state.LayerCurrent)
+		}
+		return angles
+	}
+
+	// Angles other than the default angle are assigned in order, with the best layer of each angle
+	sendAnglePacket("Video-5", "Video-5", 100)
+	sendAnglePacket(codecs.VideoTrackLabelDefault, "h", 1)
+	sendAnglePacket("Video-3", "Video-3-l", 2)
+	sendAnglePacket("Video-3", "Video-3-h", 1)
+	sendAnglePacket("Video-3", "Video-3-l", 2)
+	sendAnglePacket("Video-5", "Video-5", 100)
+	if angles := getAngles(); !slices.Equal(angles, []string{"Video-3/Video-3-h", "Video-5/Video-5"}) {
+		t.Fatalf("unexpected angles %v", angles)
+	}
+
+	if err := w.SelectVideo("2", codecs.VideoTrackLabelDefault, ""); err != nil {
+		t.Fatal(err)
+	}
+	sendAnglePacket(codecs.VideoTrackLabelDefault, "h", 1)
+	if angles := getAngles(); !slices.Equal(angles, []string{"Video-3/Video-3-h", "Video/h"}) {
+		t.Fatalf("unexpected angles after selection %v", angles)
+	}
+
+	if err := w.SelectVideo("3", "", ""); err != ErrUnknownMID {
+		t.Fatalf("expected %v, got %v", ErrUnknownMID, err)
+	}
+
+	// The primary video track only forwards layers of its angle
+	w.SetVideoLayer("Video-3", "")
+	if layer := w.GetVideoLayerOrDefault(codecs.VideoTrackLabelDefault, "h", 1, highBitrate, true); layer == "h" {
+		t.Fatal("expected layer of another angle not to be forwarded")
+	}
+	if layer := w.GetVideoLayerOrDefault("Video-3", "Video-3-h", 1, highBitrate, true); layer != "Video-3-h" {
+		t.Fatalf("expected layer of the selected angle, got %s", layer)
+	}
+}
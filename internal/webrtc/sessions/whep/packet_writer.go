@@ -3,35 +3,64 @@ package whep
 import (
 	"errors"
 	"io"
-	"log"
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 )
 
+// RTP clock rates of the supported audio and video codecs
+const (
+	audioClockRate = 48000
+	videoClockRate = 90000
+)
+
+// Returns the timestamp difference to continue from the last written packet after the host changed
+func getSourceResetTimeDiff(lastWritten time.Time, now time.Time, clockRate float64) int64 {
+	if lastWritten.IsZero() {
+		return 1
+	}
+
+	return max(int64(now.Sub(lastWritten).Seconds()*clockRate), 1)
+}
+
 // Sends provided audio packet to the WHEP session
 func (w *WHEPSession) SendAudioPacket(packet codecs.TrackPacket) {
 	if w.IsSessionClosed.Load() {
 		return
 	}
 
+	now := time.Now()
+
 	w.AudioLock.Lock()
-	if w.AudioTrack == nil {
+	if w.AudioTrack == nil || !w.selectAudioLayerLocked(packet.Layer) || !w.isCodecNegotiated(w.AudioTrack, packet.Codec) {
 		w.AudioLock.Unlock()
 		return
 	}
 
+	if w.audioSourceReset {
+		packet.TimeDiff = getSourceResetTimeDiff(w.audioLastWritten, now, audioClockRate)
+		packet.SequenceDiff = 1
+		w.audioSourceReset = false
+	}
+
 	w.AudioPacketsWritten += 1
+	w.AudioSequenceNumber = uint16(w.AudioSequenceNumber) + uint16(packet.SequenceDiff)
 	w.AudioTimestamp = uint32(int64(w.AudioTimestamp) + packet.TimeDiff)
+	w.audioLastWritten = now
+	audioSequenceNumber := w.AudioSequenceNumber
+	audioTimestamp := w.AudioTimestamp
 	audioTrack := w.AudioTrack
 	w.AudioLock.Unlock()
 
+	packet.Packet.SequenceNumber = audioSequenceNumber
+	packet.Packet.Timestamp = audioTimestamp
+
 	if err := audioTrack.WriteRTP(packet.Packet, packet.Codec); err != nil {
 		if errors.Is(err, io.ErrClosedPipe) {
-			log.Println("WHEPSession.SendAudioPacket.ConnectionDropped")
+			w.Logger.Info("WHEPSession.SendAudioPacket.ConnectionDropped")
 			w.Close()
 		} else {
-			log.Println("WHEPSession.SendAudioPacket.Error", err)
+			w.Logger.Debug("WHEPSession.SendAudioPacket.Error", "error", err)
 		}
 	}
 }
@@ -42,6 +71,16 @@ func (w *WHEPSession) SendVideoPacket(packet codecs.TrackPacket) {
 		return
 	}
 
+	w.VideoLock.RLock()
+	isCodecNegotiated := w.VideoTrack != nil && w.isCodecNegotiated(w.VideoTrack, packet.Codec)
+	w.VideoLock.RUnlock()
+
+	// Playback continues at a keyframe once the viewer negotiated the codec
+	if !isCodecNegotiated {
+		w.IsWaitingForKeyframe.Store(true)
+		return
+	}
+
 	if w.IsWaitingForKeyframe.Load() {
 		if !packet.IsKeyframe {
 			w.SendPLI()
@@ -51,12 +90,22 @@ func (w *WHEPSession) SendVideoPacket(packet codecs.TrackPacket) {
 		w.IsWaitingForKeyframe.Store(false)
 	}
 
+	now := time.Now()
+
 	w.VideoLock.Lock()
+	if w.videoSourceReset {
+		// The new host has its own timestamps and sequence numbers, continue from the last written packet
+		packet.TimeDiff = getSourceResetTimeDiff(w.videoLastWritten, now, videoClockRate)
+		packet.SequenceDiff = 1
+		w.videoSourceReset = false
+	}
+
 	w.VideoBytesWritten += len(packet.Packet.Payload)
 	w.VideoPacketsWritten += 1
 	w.VideoSequenceNumber = uint16(w.VideoSequenceNumber) + uint16(packet.SequenceDiff)
 	w.VideoTimestamp = uint32(int64(w.VideoTimestamp) + packet.TimeDiff)
-	w.updateVideoBitrateLocked(time.Now())
+	w.videoLastWritten = now
+	w.updateVideoBitrateLocked(now)
 	videoSequenceNumber := w.VideoSequenceNumber
 	videoTimestamp := w.VideoTimestamp
 	videoTrack := w.VideoTrack
@@ -73,10 +122,10 @@ func (w *WHEPSession) SendVideoPacket(packet codecs.TrackPacket) {
 		w.VideoPacketsDropped.Add(1)
 
 		if errors.Is(err, io.ErrClosedPipe) {
-			log.Println("WHEPSession.SendVideoPacket.ConnectionDropped")
+			w.Logger.Info("WHEPSession.SendVideoPacket.ConnectionDropped")
 			w.Close()
 		} else {
-			log.Println("WHEPSession.SendVideoPacket.Error", err)
+			w.Logger.Debug("WHEPSession.SendVideoPacket.Error", "error", err)
 		}
 	}
 }
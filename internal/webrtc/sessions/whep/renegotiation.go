@@ -0,0 +1,273 @@
+package whep
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/pion/webrtc/v4"
+)
+
+var (
+	ErrSessionClosed        = errors.New("session is closed")
+	ErrNoPendingOffer       = errors.New("no renegotiation offer is pending")
+	ErrRenegotiationPending = errors.New("ice restart is not possible while a renegotiation offer is pending")
+	errTrackNotFound        = errors.New("track is not sent to the viewer")
+)
+
+// Adds a track for the viewer and offers it through a renegotiation
+func (w *WHEPSession) AddTrack(track *codecs.TrackMultiCodec) (sender *webrtc.RTPSender, err error) {
+	err = w.Renegotiate(func(peerConnection *webrtc.PeerConnection) (err error) {
+		sender, err = peerConnection.AddTrack(track)
+		return err
+	})
+
+	return sender, err
+}
+
+// Stops sending the track to the viewer and offers the change through a renegotiation
+func (w *WHEPSession) RemoveTrack(track *codecs.TrackMultiCodec) error {
+	return w.Renegotiate(func(peerConnection *webrtc.PeerConnection) error {
+		for _, sender := range peerConnection.GetSenders() {
+			if sender.Track() == track {
+				return peerConnection.RemoveTrack(sender)
+			}
+		}
+
+		return errTrackNotFound
+	})
+}
+
+// Updates the tracks of the viewer after the host added or removed tracks, changes are offered through a renegotiation.
+// Audio the viewer did not negotiate is offered once the host sends audio. Viewers receiving several camera angles
+// get a video track for every camera angle of the host, with removeUnused the video tracks added this way are removed
+// again when the host has fewer camera angles. Returns the senders of the added video tracks.
+func (w *WHEPSession) UpdateTracks(hasAudio bool, videoAngleCount int, removeUnused bool) (senders []*webrtc.RTPSender, err error) {
+	w.updateTracksLock.Lock()
+	defer w.updateTracksLock.Unlock()
+
+	w.AudioLock.RLock()
+	audioTrack := w.AudioTrack
+	w.AudioLock.RUnlock()
+
+	if hasAudio && audioTrack != nil && !audioTrack.IsBound() && !w.isAudioOffered {
+		w.Logger.Info("WHEPSession.UpdateTracks.OfferAudio")
+		w.isAudioOffered = true
+
+		if err := w.Renegotiate(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	w.videoAngleLock.Lock()
+	videoTrackCount := 1 + len(w.videoAngleTracks)
+	w.videoAngleLock.Unlock()
+
+	if videoTrackCount == 1 {
+		return nil, nil
+	}
+
+	for ; videoTrackCount < videoAngleCount; videoTrackCount++ {
+		track := codecs.CreateTrackMultiCodec("video-"+strconv.Itoa(videoTrackCount), "pion", w.StreamKey, webrtc.RTPCodecTypeVideo, 0)
+
+		sender, err := w.AddTrack(track)
+		if err != nil {
+			return senders, err
+		}
+
+		w.Logger.Info("WHEPSession.UpdateTracks.AddVideoAngleTrack")
+		w.addVideoAngleTrack(&videoAngleTrack{sender: sender, track: track})
+		senders = append(senders, sender)
+	}
+
+	for removeUnused && videoTrackCount > max(videoAngleCount, 1) {
+		angleTrack := w.removeAddedVideoAngleTrack()
+		if angleTrack == nil {
+			break
+		}
+
+		w.Logger.Info("WHEPSession.UpdateTracks.RemoveVideoAngleTrack")
+		if err := w.RemoveTrack(angleTrack.track); err != nil {
+			return senders, err
+		}
+		videoTrackCount--
+	}
+
+	return senders, nil
+}
+
+// Creates a new offer for the viewer after update changed the transceivers of the peer connection, update may be nil.
+// The offer is sent over the SSE channel and the viewer answers it with a PATCH.
+// Renegotiations requested while an offer is pending are offered after the answer was applied.
+func (w *WHEPSession) Renegotiate(update func(peerConnection *webrtc.PeerConnection) error) error {
+	if w.IsSessionClosed.Load() {
+		return ErrSessionClosed
+	}
+
+	w.PeerConnectionLock.Lock()
+	defer w.PeerConnectionLock.Unlock()
+
+	if update != nil {
+		if err := update(w.PeerConnection); err != nil {
+			return err
+		}
+	}
+
+	w.renegotiationLock.Lock()
+	defer w.renegotiationLock.Unlock()
+
+	if w.renegotiationOffer != "" {
+		w.renegotiationNeeded = true
+		return nil
+	}
+
+	return w.createRenegotiationOfferLocked()
+}
+
+// Applies the answer of the viewer to the pending offer.
+// Tracks are bound again so packets use the payload types of newly negotiated codecs.
+func (w *WHEPSession) SetRenegotiationAnswer(answer string) error {
+	w.PeerConnectionLock.Lock()
+	defer w.PeerConnectionLock.Unlock()
+
+	w.renegotiationLock.Lock()
+	defer w.renegotiationLock.Unlock()
+
+	if w.renegotiationOffer == "" {
+		return ErrNoPendingOffer
+	}
+
+	w.renegotiationOffer = ""
+	w.notifyRenegotiationChangedLocked()
+
+	if err := w.PeerConnection.SetRemoteDescription(webrtc.SessionDescription{
+		SDP:  answer,
+		Type: webrtc.SDPTypeAnswer,
+	}); err != nil {
+		// Return to the previous description so later renegotiations can create a new offer
+		if rollbackErr := w.PeerConnection.SetLocalDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeRollback}); rollbackErr != nil {
+			w.Logger.Warn("WHEPSession.SetRenegotiationAnswer.Rollback.Error", "error", rollbackErr)
+		}
+
+		return err
+	}
+
+	for _, sender := range w.PeerConnection.GetSenders() {
+		if track := sender.Track(); track != nil {
+			if err := sender.ReplaceTrack(track); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.Logger.Info("WHEPSession.SetRenegotiationAnswer")
+	w.IsWaitingForKeyframe.Store(true)
+	w.SendPLI()
+
+	if w.renegotiationNeeded {
+		return w.createRenegotiationOfferLocked()
+	}
+
+	return nil
+}
+
+// Returns SSE string with the pending offer, empty when no offer is pending
+func (w *WHEPSession) GetRenegotiationEvent() string {
+	w.renegotiationLock.Lock()
+	offer := w.renegotiationOffer
+	w.renegotiationLock.Unlock()
+
+	if offer == "" {
+		return ""
+	}
+
+	jsonResult, err := json.Marshal(webrtc.SessionDescription{
+		Type: webrtc.SDPTypeOffer,
+		SDP:  offer,
+	})
+	if err != nil {
+		w.Logger.Error("WHEPSession.GetRenegotiationEvent.Error", "error", err)
+		return ""
+	}
+
+	return "event: offer\ndata: " + string(jsonResult) + "\n\n"
+}
+
+// Returns true while an offer of the server waits for the answer of the viewer
+func (w *WHEPSession) IsRenegotiationPending() bool {
+	w.renegotiationLock.Lock()
+	defer w.renegotiationLock.Unlock()
+
+	return w.renegotiationOffer != ""
+}
+
+// Returns a channel that is closed when an offer is created or answered
+func (w *WHEPSession) RenegotiationChanged() <-chan struct{} {
+	w.renegotiationLock.Lock()
+	defer w.renegotiationLock.Unlock()
+
+	if w.renegotiationChanged == nil {
+		w.renegotiationChanged = make(chan struct{})
+	}
+
+	return w.renegotiationChanged
+}
+
+func (w *WHEPSession) createRenegotiationOfferLocked() error {
+	offer, err := w.PeerConnection.CreateOffer(nil)
+	if err != nil {
+		return err
+	}
+
+	if err := w.PeerConnection.SetLocalDescription(offer); err != nil {
+		return err
+	}
+
+	w.Logger.Info("WHEPSession.Renegotiate")
+
+	// Candidates were gathered for the first answer and are included in the offer
+	w.renegotiationOffer = utils.AppendCandidateToAnswer(w.PeerConnection.LocalDescription().SDP)
+	w.renegotiationNeeded = false
+	w.notifyRenegotiationChangedLocked()
+
+	return nil
+}
+
+func (w *WHEPSession) notifyRenegotiationChangedLocked() {
+	if w.renegotiationChanged != nil {
+		close(w.renegotiationChanged)
+		w.renegotiationChanged = nil
+	}
+}
+
+// Returns true when the viewer negotiated the codec for the track.
+// Otherwise the codec is offered once through a renegotiation, packets are dropped until the viewer accepted it.
+// Packets of tracks that are not bound are dropped, the viewer did not negotiate a transceiver for them.
+func (w *WHEPSession) isCodecNegotiated(track *codecs.TrackMultiCodec, codec codecs.TrackCodeType) bool {
+	if track.HasCodec(codec) {
+		return true
+	}
+
+	if !track.IsBound() {
+		return false
+	}
+
+	w.renegotiationLock.Lock()
+	isRenegotiated := w.renegotiatedCodecs[codec]
+	w.renegotiatedCodecs[codec] = true
+	w.renegotiationLock.Unlock()
+
+	if !isRenegotiated {
+		w.Logger.Info("WHEPSession.RenegotiateCodec", "codec", codecs.GetMimeType(codec))
+
+		go func() {
+			if err := w.Renegotiate(nil); err != nil {
+				w.Logger.Warn("WHEPSession.RenegotiateCodec.Error", "error", err)
+			}
+		}()
+	}
+
+	return false
+}
@@ -0,0 +1,224 @@
+package whep
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/webrtc/v4"
+)
+
+func TestRenegotiation(t *testing.T) {
+	mediaEngine := &webrtc.MediaEngine{}
+	codecs.RegisterCodecs(mediaEngine)
+
+	server, err := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	// The viewer only receives H264 video
+	transceiver, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h264 := &codecs.Preferences{Video: []string{"h264"}}
+	if err := transceiver.SetCodecPreferences(h264.GetCodecs(webrtc.RTPCodecTypeVideo)); err != nil {
+		t.Fatal(err)
+	}
+
+	audioTrack, videoTrack := codecs.GetDefaultTracks("test")
+	if _, err := server.AddTrack(videoTrack); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := server.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	w := CreateNewWHEP("test", "test", audioTrack, videoTrack, server, func() {}, nil)
+	defer w.Close()
+
+	// Answers the pending offer of the server like a viewer would
+	answerOffer := func() {
+		t.Helper()
+
+		event := w.GetRenegotiationEvent()
+		data, found := strings.CutPrefix(strings.TrimSpace(event), "event: offer\ndata: ")
+		if !found {
+			t.Fatalf("unexpected offer event %q", event)
+		}
+
+		var serverOffer webrtc.SessionDescription
+		if err := json.Unmarshal([]byte(data), &serverOffer); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := client.SetRemoteDescription(serverOffer); err != nil {
+			t.Fatal(err)
+		}
+
+		clientAnswer, err := client.CreateAnswer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.SetLocalDescription(clientAnswer); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.SetRenegotiationAnswer(clientAnswer.SDP); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A codec the viewer did not negotiate is offered again in the background, only once
+	renegotiationChanged := w.RenegotiationChanged()
+	if w.isCodecNegotiated(videoTrack, codecs.VideoTrackCodecVP9) {
+		t.Fatal("expected VP9 not to be negotiated")
+	}
+	<-renegotiationChanged
+
+	if w.isCodecNegotiated(videoTrack, codecs.VideoTrackCodecVP9) {
+		t.Fatal("expected VP9 not to be negotiated")
+	}
+	answerOffer()
+
+	if err := w.SetRenegotiationAnswer(""); err != ErrNoPendingOffer {
+		t.Fatalf("expected %v, got %v", ErrNoPendingOffer, err)
+	}
+
+	if audioTrack.IsBound() || w.isCodecNegotiated(audioTrack, codecs.AudioTrackCodecOpus) {
+		t.Fatal("expected audio track not to be sent before it was added")
+	}
+
+	if _, err := w.AddTrack(audioTrack); err != nil {
+		t.Fatal(err)
+	}
+	answerOffer()
+
+	if !audioTrack.IsBound() || !audioTrack.HasCodec(codecs.AudioTrackCodecOpus) {
+		t.Fatal("expected audio track to be negotiated after it was added")
+	}
+}
+
+func TestUpdateTracksForCameraAngles(t *testing.T) {
+	mediaEngine := &webrtc.MediaEngine{}
+	codecs.RegisterCodecs(mediaEngine)
+
+	server, err := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	// The viewer receives two camera angles
+	for range 2 {
+		if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	audioTrack, videoTrack := codecs.GetDefaultTracks("test")
+	angleTrack := codecs.CreateTrackMultiCodec("video-1", "pion", "test", webrtc.RTPCodecTypeVideo, 0)
+	for _, track := range []*codecs.TrackMultiCodec{videoTrack, angleTrack} {
+		if _, err := server.AddTrack(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := server.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetRemoteDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	w := CreateNewWHEP("test", "test", audioTrack, videoTrack, server, func() {}, nil)
+	defer w.Close()
+	w.AddVideoAngleTrack("1", angleTrack)
+
+	// The host adds a third camera angle
+	senders, err := w.UpdateTracks(false, 3, false)
+	if err != nil || len(senders) != 1 || w.GetRenegotiationEvent() == "" {
+		t.Fatalf("expected a video track to be offered, got %d senders, %v", len(senders), err)
+	}
+
+	states := w.getVideoAngleTracksState()
+	if len(states) != 2 || states[1].MID == "" {
+		t.Fatalf("expected the added video track to have a MID, got %+v", states)
+	}
+
+	// Without removing unused tracks, the track is kept for a host with fewer camera angles
+	if senders, err := w.UpdateTracks(false, 1, false); err != nil || len(senders) != 0 || len(w.getVideoAngleTracksState()) != 2 {
+		t.Fatalf("expected the video tracks to be kept, got %d senders, %v", len(senders), err)
+	}
+
+	// Only the added video track is removed, the tracks of the offer of the viewer are kept
+	if _, err := w.UpdateTracks(false, 1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if states := w.getVideoAngleTracksState(); len(states) != 1 || states[0].MID != "1" {
+		t.Fatalf("expected only the video track of the offer to be kept, got %+v", states)
+	}
+
+	for _, sender := range server.GetSenders() {
+		if track := sender.Track(); track != nil && track.ID() == "video-2" {
+			t.Fatal("expected the added video track to be removed from the peer connection")
+		}
+	}
+}
@@ -8,10 +8,36 @@ type SessionState struct {
 	AudioPacketsWritten uint64 `json:"audioPacketsWritten"`
 	AudioSequenceNumber uint64 `json:"audioSequenceNumber"`
 
+	VideoAngleCurrent   string `json:"videoAngleCurrent"`
 	VideoLayerCurrent   string `json:"videoLayerCurrent"`
+	VideoLayerPending   string `json:"videoLayerPending"`
 	VideoTimestamp      uint32 `json:"videoTimestamp"`
 	VideoBitrate        uint64 `json:"videoBitrate"`
 	VideoPacketsDropped uint64 `json:"videoPacketsDropped"`
 	VideoPacketsWritten uint64 `json:"videoPacketsWritten"`
 	VideoSequenceNumber uint64 `json:"videoSequenceNumber"`
+
+	// Additional video tracks of the viewer, each forwarding its own camera angle
+	VideoAngleTracks []VideoAngleTrackState `json:"videoAngleTracks,omitempty"`
+
+	// Bandwidth estimate of the viewer in bits per second, zero when the viewer sends no REMB or TWCC feedback
+	BandwidthEstimate  uint64                   `json:"bandwidthEstimate"`
+	BandwidthEstimator *BandwidthEstimatorState `json:"bandwidthEstimator,omitempty"`
+}
+
+// Internal state of the TWCC bandwidth estimator of a viewer, bitrates are in bits per second
+type BandwidthEstimatorState struct {
+	LossTargetBitrate  int     `json:"lossTargetBitrate"`
+	DelayTargetBitrate int     `json:"delayTargetBitrate"`
+	AverageLoss        float64 `json:"averageLoss"`
+	State              string  `json:"state"`
+}
+
+// State of an additional video track of a viewer
+type VideoAngleTrackState struct {
+	MID                  string `json:"mid"`
+	Angle                string `json:"angle"`
+	LayerCurrent         string `json:"layerCurrent"`
+	PacketsWritten       uint64 `json:"packetsWritten"`
+	IsWaitingForKeyframe bool   `json:"isWaitingForKeyframe"`
 }
@@ -1,12 +1,15 @@
 package whep
 
 import (
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/pion/interceptor/pkg/cc"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -14,6 +17,8 @@ type (
 	WHEPSession struct {
 		SessionID            string
 		StreamKey            string
+		ConnectedAt          time.Time
+		Logger               *slog.Logger
 		IsWaitingForKeyframe atomic.Bool
 		IsSessionClosed      atomic.Bool
 
@@ -23,11 +28,31 @@ type (
 
 		PeerConnectionLock sync.RWMutex
 		PeerConnection     *webrtc.PeerConnection
+		ICECandidates      *utils.ICECandidates
+
+		// Protects the server initiated renegotiation state. Lock after PeerConnectionLock.
+		renegotiationLock    sync.Mutex
+		renegotiationOffer   string
+		renegotiationNeeded  bool
+		renegotiationChanged chan struct{}
+
+		// Codecs that were offered again because the viewer did not negotiate them
+		renegotiatedCodecs map[codecs.TrackCodeType]bool
+
+		// Serializes updates of the tracks for the tracks of the host, protects isAudioOffered
+		updateTracksLock sync.Mutex
+		isAudioOffered   bool
+
+		// Latest bandwidth estimates of the viewer in bits per second, zero when none was received
+		rembEstimate       atomic.Uint64
+		twccEstimate       atomic.Uint64
+		bandwidthEstimator atomic.Pointer[cc.BandwidthEstimator]
 
 		// Protects VideoTrack, VideoTimestamp, VideoPacketsWritten, VideoSequenceNumber,
-		// and auto video layer selection state.
+		// the video source reset, the camera angle and auto video layer selection state.
 		VideoLock               sync.RWMutex
 		VideoTrack              *codecs.TrackMultiCodec
+		videoAngle              string
 		VideoTimestamp          uint32
 		VideoBitrate            atomic.Uint64
 		VideoBytesWritten       int
@@ -39,14 +64,31 @@ type (
 		VideoLayerCurrent       atomic.Value
 		videoLayerPriority      int
 		videoLayerExplicit      bool
+		videoLayers             map[string]videoLayerInfo
+		videoLayerPending       string
+		videoLayerPendingSince  time.Time
+		videoLayerUpgradedAt    time.Time
+		videoLayerUpgradeAfter  time.Time
+		videoLayerUpgradeHold   time.Duration
+		videoLastWritten        time.Time
+		videoSourceReset        bool
 
-		// Protects AudioTrack, AudioTimestamp, AudioPacketsWritten, AudioSequenceNumber
+		// Protects AudioTrack, AudioTimestamp, AudioPacketsWritten, AudioSequenceNumber,
+		// the audio source reset and the audio track selection.
 		AudioLock           sync.RWMutex
 		AudioTrack          *codecs.TrackMultiCodec
 		AudioTimestamp      uint32
 		AudioPacketsWritten uint64
 		AudioSequenceNumber uint16
 		AudioLayerCurrent   atomic.Value
+		audioLayerExplicit  bool
+		audioLastWritten    time.Time
+		audioSourceReset    bool
+
+		// Protects the additional video tracks of the viewer and the camera angles seen
+		videoAngleLock   sync.Mutex
+		videoAngleTracks []*videoAngleTrack
+		videoAngles      []string
 
 		ChatManager *chat.Manager
 	}
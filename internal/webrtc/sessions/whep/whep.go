@@ -1,11 +1,12 @@
 package whep
 
 import (
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -19,18 +20,23 @@ func CreateNewWHEP(
 	pliSender func(),
 	chatManager *chat.Manager,
 ) (w *WHEPSession) {
-	log.Println("WHEPSession.CreateNewWHEP", whepSessionID)
-
 	w = &WHEPSession{
 		SessionID:               whepSessionID,
 		StreamKey:               streamKey,
+		ConnectedAt:             time.Now(),
+		Logger:                  slog.With("streamKey", streamKey, "sessionId", whepSessionID),
 		AudioTrack:              audioTrack,
 		VideoTrack:              videoTrack,
+		videoAngle:              codecs.VideoTrackLabelDefault,
 		AudioTimestamp:          5000,
 		VideoTimestamp:          5000,
 		PeerConnection:          peerConnection,
+		ICECandidates:           utils.NewICECandidates(peerConnection),
+		renegotiatedCodecs:      map[codecs.TrackCodeType]bool{},
 		pliSender:               pliSender,
 		videoBitrateWindowStart: time.Now(),
+		videoLayers:             map[string]videoLayerInfo{},
+		videoLayerUpgradeHold:   videoLayerUpgradeHold,
 		ChatManager:             chatManager,
 	}
 
@@ -38,6 +44,8 @@ func CreateNewWHEP(
 	w.VideoLayerCurrent.Store("")
 	w.IsWaitingForKeyframe.Store(true)
 	w.IsSessionClosed.Store(false)
+
+	w.Logger.Info("WHEPSession.CreateNewWHEP")
 	return w
 }
 
@@ -45,16 +53,16 @@ func CreateNewWHEP(
 func (w *WHEPSession) Close() {
 	// Close WHEP channels
 	w.SessionClose.Do(func() {
-		log.Println("WHEPSession.Close")
+		w.Logger.Info("WHEPSession.Close")
 		w.IsSessionClosed.Store(true)
 
 		// Close PeerConnection
-		log.Println("WHEPSession.Close.PeerConnection.GracefulClose")
+		w.Logger.Debug("WHEPSession.Close.PeerConnection.GracefulClose")
 		err := w.PeerConnection.Close()
 		if err != nil {
-			log.Println("WHEPSession.Close.PeerConnection.Error", err)
+			w.Logger.Error("WHEPSession.Close.PeerConnection.Error", "error", err)
 		}
-		log.Println("WHEPSession.Close.PeerConnection.GracefulClose.Completed")
+		w.Logger.Debug("WHEPSession.Close.PeerConnection.GracefulClose.Completed")
 
 		// Empty tracks
 		w.AudioLock.Lock()
@@ -66,6 +74,10 @@ func (w *WHEPSession) Close() {
 		w.VideoLock.Unlock()
 		w.AudioLock.Unlock()
 
+		w.videoAngleLock.Lock()
+		w.videoAngleTracks = nil
+		w.videoAngleLock.Unlock()
+
 		if w.onClose != nil {
 			w.onClose(w.SessionID)
 		}
@@ -84,6 +96,7 @@ func (w *WHEPSession) GetWHEPSessionStatus() (state SessionState) {
 
 	currentAudioLayer := w.AudioLayerCurrent.Load().(string)
 	currentVideoLayer := w.VideoLayerCurrent.Load().(string)
+	currentVideoAngle := w.videoAngle
 
 	state = SessionState{
 		ID: w.SessionID,
@@ -93,42 +106,88 @@ func (w *WHEPSession) GetWHEPSessionStatus() (state SessionState) {
 		AudioPacketsWritten: w.AudioPacketsWritten,
 		AudioSequenceNumber: uint64(w.AudioSequenceNumber),
 
+		VideoAngleCurrent:   currentVideoAngle,
 		VideoLayerCurrent:   currentVideoLayer,
+		VideoLayerPending:   w.videoLayerPending,
 		VideoTimestamp:      w.VideoTimestamp,
 		VideoBitrate:        w.VideoBitrate.Load(),
 		VideoPacketsWritten: w.VideoPacketsWritten,
 		VideoPacketsDropped: w.VideoPacketsDropped.Load(),
 		VideoSequenceNumber: uint64(w.VideoSequenceNumber),
+
+		BandwidthEstimate:  w.GetBandwidthEstimate(),
+		BandwidthEstimator: w.getBandwidthEstimatorState(),
 	}
 
 	w.VideoLock.Unlock()
 	w.AudioLock.RUnlock()
 
+	state.VideoAngleTracks = w.getVideoAngleTracksState()
+
 	return
 }
 
-// Sets the requested audio layer for this WHEP session.
+// Sets the audio track forwarded to this WHEP session, an empty encoding ID selects the default audio track.
 func (w *WHEPSession) SetAudioLayer(encodingID string) {
-	log.Println("Setting Audio Layer")
+	w.Logger.Info("WHEPSession.SetAudioLayer", "layer", encodingID)
+
+	w.AudioLock.Lock()
 	w.AudioLayerCurrent.Store(encodingID)
-	w.IsWaitingForKeyframe.Store(true)
-	w.SendPLI()
+	w.audioLayerExplicit = encodingID != ""
+	w.AudioLock.Unlock()
 }
 
-// Sets the requested video layer for this WHEP session.
-func (w *WHEPSession) SetVideoLayer(encodingID string) {
-	log.Println("Setting Video Layer")
+// Sets the requested camera angle and video layer for this WHEP session.
+// An empty angle selects the default camera angle, an empty encoding ID selects layers of the angle automatically.
+func (w *WHEPSession) SetVideoLayer(angle string, encodingID string) {
+	w.Logger.Info("WHEPSession.SetVideoLayer", "angle", angle, "layer", encodingID)
+
+	if angle == "" {
+		angle = codecs.VideoTrackLabelDefault
+	}
 
 	w.VideoLock.Lock()
+	if angle != w.videoAngle {
+		w.videoAngle = angle
+		clear(w.videoLayers)
+	}
 	w.VideoLayerCurrent.Store(encodingID)
 	w.videoLayerPriority = 0
 	w.videoLayerExplicit = encodingID != ""
+	w.videoLayerPending = ""
 	w.VideoLock.Unlock()
 
 	w.IsWaitingForKeyframe.Store(true)
 	w.SendPLI()
 }
 
+// Prepare for media from a new host. Timestamps and sequence numbers continue from the last written packets,
+// video layers are selected again and playback resumes at the next keyframe.
+func (w *WHEPSession) ResetSource() {
+	w.Logger.Info("WHEPSession.ResetSource")
+
+	w.AudioLock.Lock()
+	w.audioSourceReset = true
+	if !w.audioLayerExplicit {
+		w.AudioLayerCurrent.Store("")
+	}
+	w.AudioLock.Unlock()
+
+	w.VideoLock.Lock()
+	w.VideoLayerCurrent.Store("")
+	w.videoAngle = codecs.VideoTrackLabelDefault
+	w.videoLayerPriority = 0
+	w.videoLayerExplicit = false
+	w.videoLayerPending = ""
+	clear(w.videoLayers)
+	w.videoSourceReset = true
+	w.VideoLock.Unlock()
+
+	w.resetVideoAngleTracks()
+
+	w.IsWaitingForKeyframe.Store(true)
+}
+
 func (w *WHEPSession) SendPLI() {
 	if w.IsSessionClosed.Load() {
 		return
@@ -157,35 +216,3 @@ func (w *WHEPSession) updateVideoBitrateLocked(now time.Time) {
 	w.videoBitrateWindowStart = now
 	w.videoBitrateWindowBytes = w.VideoBytesWritten
 }
-
-func (w *WHEPSession) GetVideoLayerOrDefault(defaultLayer string, defaultPriority int) string {
-	w.VideoLock.Lock()
-	defer w.VideoLock.Unlock()
-
-	currentLayer, _ := w.VideoLayerCurrent.Load().(string)
-	if w.videoLayerExplicit {
-		return currentLayer
-	}
-
-	if currentLayer == "" {
-		w.VideoLayerCurrent.Store(defaultLayer)
-		w.videoLayerPriority = defaultPriority
-		w.IsWaitingForKeyframe.Store(true)
-		return defaultLayer
-	}
-
-	if currentLayer == defaultLayer {
-		w.videoLayerPriority = defaultPriority
-		return currentLayer
-	}
-
-	// Lower numeric priority value means a better simulcast layer.
-	if w.videoLayerPriority == 0 || defaultPriority < w.videoLayerPriority {
-		w.VideoLayerCurrent.Store(defaultLayer)
-		w.videoLayerPriority = defaultPriority
-		w.IsWaitingForKeyframe.Store(true)
-		return defaultLayer
-	}
-
-	return currentLayer
-}
@@ -1,15 +1,16 @@
 package whip
 
 import (
-	"log"
 	"strings"
 
 	"github.com/glimesh/broadcast-box/internal/webrtc/chatdc"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/sdp/v3"
 	"github.com/pion/webrtc/v4"
 )
 
 func (w *WHIPSession) registerWHIPHandlers(peerConnection *webrtc.PeerConnection, streamKey string) {
-	log.Println("WHIPSession.RegisterHandlers")
+	w.Logger.Debug("WHIPSession.RegisterHandlers")
 
 	// PeerConnection OnTrack handler
 	w.PeerConnection.OnTrack(w.onTrackHandler(peerConnection, streamKey))
@@ -30,7 +31,7 @@ func (w *WHIPSession) registerWHIPHandlers(peerConnection *webrtc.PeerConnection
 func (w *WHIPSession) onICEConnectionStateChangeHandler() func(webrtc.ICEConnectionState) {
 	return func(state webrtc.ICEConnectionState) {
 		if state == webrtc.ICEConnectionStateFailed || state == webrtc.ICEConnectionStateClosed {
-			log.Println("WHIPSession.PeerConnection.OnICEConnectionStateChange", w.ID)
+			w.Logger.Info("WHIPSession.PeerConnection.OnICEConnectionStateChange", "state", state)
 			w.notifyClosed()
 		}
 	}
@@ -38,34 +39,106 @@ func (w *WHIPSession) onICEConnectionStateChangeHandler() func(webrtc.ICEConnect
 
 func (w *WHIPSession) onTrackHandler(peerConnection *webrtc.PeerConnection, streamKey string) func(*webrtc.TrackRemote, *webrtc.RTPReceiver) {
 	return func(remoteTrack *webrtc.TrackRemote, rtpReceiver *webrtc.RTPReceiver) {
-		log.Println("WHIPSession.PeerConnection.OnTrackHandler", w.ID)
+		rid := remoteTrack.RID()
+		w.Logger.Info("WHIPSession.PeerConnection.OnTrackHandler", "rid", rid, "codec", remoteTrack.Codec().MimeType)
+
+		mid := getTransceiverMID(peerConnection, rtpReceiver)
+		msid := strings.TrimSpace(remoteTrack.StreamID() + " " + remoteTrack.ID())
+		remoteDescription := peerConnection.CurrentRemoteDescription().SDP
 
 		if strings.HasPrefix(remoteTrack.Codec().MimeType, "audio") {
 			// Handle audio stream
-			w.audioWriter(remoteTrack, streamKey)
+			w.audioWriter(
+				remoteTrack,
+				getMediaSectionLabel("audio", mid, remoteDescription, codecs.AudioTrackLabelDefault),
+				mid,
+				msid,
+				codecs.GetAudioTrackCodec(remoteTrack.Codec().MimeType),
+				streamKey)
 		} else {
+			// Every video media section is a camera angle, simulcast layers of an angle share its media section
+			angle := getMediaSectionLabel("video", mid, remoteDescription, codecs.VideoTrackLabelDefault)
+
 			// Handle video stream
-			w.videoWriter(remoteTrack, streamKey, peerConnection)
+			w.videoWriter(
+				remoteTrack,
+				getVideoTrackID(angle, rid),
+				angle,
+				mid,
+				msid,
+				codecs.GetVideoTrackCodec(remoteTrack.Codec().MimeType),
+				w.getPrioritizedStreamingLayer(rid, mid, remoteDescription),
+				uint32(remoteTrack.SSRC()),
+				streamKey)
 		}
 
-		log.Println("WHIPSession.OnTrackHandler.TrackStopped", remoteTrack.RID())
+		w.Logger.Info("WHIPSession.OnTrackHandler.TrackStopped", "rid", remoteTrack.RID())
 	}
 }
 
 func (w *WHIPSession) onConnectionStateChange() func(webrtc.PeerConnectionState) {
 	return func(state webrtc.PeerConnectionState) {
-		log.Println("WHIPSession.PeerConnection.OnConnectionStateChange", state)
+		w.Logger.Info("WHIPSession.PeerConnection.OnConnectionStateChange", "state", state)
 
 		switch state {
 		case webrtc.PeerConnectionStateClosed:
 			w.notifyClosed()
 		case webrtc.PeerConnectionStateFailed:
-			log.Println("WHIPSession.PeerConnection.OnConnectionStateChange: Host removed", w.ID)
+			w.Logger.Warn("WHIPSession.PeerConnection.OnConnectionStateChange: Host removed")
 			w.notifyClosed()
 
 		case webrtc.PeerConnectionStateConnected:
-			log.Println("WHIPSession.PeerConnection.OnConnectionStateChange: Host connected", w.ID)
+			w.Logger.Info("WHIPSession.PeerConnection.OnConnectionStateChange: Host connected")
+
+		}
+	}
+}
 
+func getTransceiverMID(peerConnection *webrtc.PeerConnection, rtpReceiver *webrtc.RTPReceiver) string {
+	for _, transceiver := range peerConnection.GetTransceivers() {
+		if transceiver.Receiver() == rtpReceiver {
+			return transceiver.Mid()
 		}
 	}
+
+	return ""
+}
+
+// Returns the label of the media section with the MID, such as the audio track or the camera angle of a video track.
+// The first media section of the kind keeps the default label, so streams with a single track of the kind are unchanged.
+func getMediaSectionLabel(kind string, mid string, sdpDescription string, defaultLabel string) string {
+	if mid == "" {
+		return defaultLabel
+	}
+
+	var sessionDescription sdp.SessionDescription
+	if err := sessionDescription.Unmarshal([]byte(sdpDescription)); err != nil {
+		return defaultLabel
+	}
+
+	for _, description := range sessionDescription.MediaDescriptions {
+		if description.MediaName.Media != kind {
+			continue
+		}
+
+		if firstMID, _ := description.Attribute("mid"); firstMID != mid {
+			return defaultLabel + "-" + mid
+		}
+
+		break
+	}
+
+	return defaultLabel
+}
+
+// Video tracks of the first camera angle are identified by their RID, tracks of other angles are prefixed with the angle
+func getVideoTrackID(angle string, rid string) string {
+	switch {
+	case rid == "":
+		return angle
+	case angle == codecs.VideoTrackLabelDefault:
+		return rid
+	}
+
+	return angle + "-" + rid
 }
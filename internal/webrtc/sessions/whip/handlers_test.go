@@ -0,0 +1,52 @@
+package whip
+
+import "testing"
+
+func TestGetMediaSectionLabel(t *testing.T) {
+	offer := "v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=-\r\n" +
+		"t=0 0\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"a=mid:1\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\n" +
+		"a=mid:2\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\n" +
+		"a=mid:3\r\n"
+
+	for _, test := range []struct {
+		kind     string
+		mid      string
+		label    string
+		expected string
+	}{
+		{"audio", "1", "Audio", "Audio"},
+		{"audio", "2", "Audio", "Audio-2"},
+		{"audio", "", "Audio", "Audio"},
+		{"video", "0", "Video", "Video"},
+		{"video", "3", "Video", "Video-3"},
+	} {
+		if label := getMediaSectionLabel(test.kind, test.mid, offer, test.label); label != test.expected {
+			t.Fatalf("expected %q for %s mid %q, got %q", test.expected, test.kind, test.mid, label)
+		}
+	}
+}
+
+func TestGetVideoTrackID(t *testing.T) {
+	for _, test := range []struct {
+		angle    string
+		rid      string
+		expected string
+	}{
+		{"Video", "", "Video"},
+		{"Video", "h", "h"},
+		{"Video-3", "", "Video-3"},
+		{"Video-3", "h", "Video-3-h"},
+	} {
+		if id := getVideoTrackID(test.angle, test.rid); id != test.expected {
+			t.Fatalf("expected %q for angle %q and rid %q, got %q", test.expected, test.angle, test.rid, id)
+		}
+	}
+}
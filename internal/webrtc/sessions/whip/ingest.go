@@ -0,0 +1,45 @@
+package whip
+
+import (
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/interceptor"
+	"github.com/pion/webrtc/v4"
+)
+
+// Source of RTP packets for a host track, implemented by webrtc.TrackRemote.
+// Read must return io.EOF once the source has ended.
+type RTPReader interface {
+	Read(b []byte) (n int, attributes interceptor.Attributes, err error)
+}
+
+// Forward audio from a source that is not a WebRTC peer, such as an RTMP connection.
+// Blocks until the reader has ended.
+func (w *WHIPSession) IngestAudio(reader RTPReader, codec codecs.TrackCodeType, streamKey string) {
+	w.Logger.Info("WHIPSession.IngestAudio", "codec", codec)
+	w.audioWriter(reader, codecs.AudioTrackLabelDefault, "", "", codec, streamKey)
+}
+
+// Forward video from a source that is not a WebRTC peer, such as an RTMP connection.
+// Blocks until the reader has ended, which closes the host.
+func (w *WHIPSession) IngestVideo(reader RTPReader, codec codecs.TrackCodeType, streamKey string) {
+	w.Logger.Info("WHIPSession.IngestVideo", "codec", codec)
+	w.videoWriter(reader, codecs.VideoTrackLabelDefault, codecs.VideoTrackLabelDefault, "", "", codec, 0, 0, streamKey)
+}
+
+// Close the host and remove it from its session
+func (w *WHIPSession) Close() {
+	w.Logger.Info("WHIPSession.Close")
+	w.notifyClosed()
+}
+
+// Returns true once the host has been closed
+func (w *WHIPSession) IsClosed() bool {
+	if w.isClosed.Load() {
+		return true
+	}
+
+	w.PeerConnectionLock.RLock()
+	defer w.PeerConnectionLock.RUnlock()
+
+	return w.PeerConnection != nil && w.PeerConnection.ConnectionState() == webrtc.PeerConnectionStateClosed
+}
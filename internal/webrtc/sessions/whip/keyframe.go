@@ -0,0 +1,100 @@
+package whip
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+const (
+	h264NALUTypeBitmask = 0x1f
+
+	h264IDRNALUType = 5
+	h264SPSNALUType = 7
+	h264PPSNALUType = 8
+
+	h265NALUTypeBitmask = 0x3f
+
+	// IRAP pictures range from BLA_W_LP to CRA_NUT
+	h265BLAWLPNALUType   = 16
+	h265CRANALUType      = 21
+	h265VPSNALUType      = 32
+	h265SPSNALUType      = 33
+	h265PPSNALUType      = 34
+	h265NALUTypeShift    = 1
+	vp8InterframeBitmask = 0x01
+)
+
+// Returns true when the packet starts or belongs to a keyframe.
+// H264 and H265 packets carrying parameter sets count as keyframe, as encoders send them right before the keyframe.
+// Codecs without a depacketizer are treated as keyframe for every packet.
+func isPacketKeyframe(pkt *rtp.Packet, depacketizer rtp.Depacketizer) bool {
+	switch depacketizer := depacketizer.(type) {
+	case *pionCodecs.H264Packet:
+		nalus, err := depacketizer.Unmarshal(pkt.Payload)
+		return err == nil && containsNALU(nalus, func(header byte) bool {
+			naluType := header & h264NALUTypeBitmask
+			return naluType == h264IDRNALUType || naluType == h264SPSNALUType || naluType == h264PPSNALUType
+		})
+	case *pionCodecs.H265Depacketizer:
+		nalus, err := depacketizer.Unmarshal(pkt.Payload)
+		return err == nil && containsNALU(nalus, func(header byte) bool {
+			naluType := (header >> h265NALUTypeShift) & h265NALUTypeBitmask
+			return (naluType >= h265BLAWLPNALUType && naluType <= h265CRANALUType) ||
+				naluType == h265VPSNALUType || naluType == h265SPSNALUType || naluType == h265PPSNALUType
+		})
+	case *pionCodecs.VP8Packet:
+		if _, err := depacketizer.Unmarshal(pkt.Payload); err != nil {
+			return false
+		}
+
+		// The frame tag at the start of the first partition has the inverse keyframe bit
+		return depacketizer.S == 1 && depacketizer.PID == 0 && len(depacketizer.Payload) > 0 && depacketizer.Payload[0]&vp8InterframeBitmask == 0
+	case *pionCodecs.VP9Packet:
+		if _, err := depacketizer.Unmarshal(pkt.Payload); err != nil {
+			return false
+		}
+
+		// Start of a picture of the base spatial layer that is not inter predicted
+		return depacketizer.B && !depacketizer.P && depacketizer.SID == 0
+	case *pionCodecs.AV1Depacketizer:
+		if _, err := depacketizer.Unmarshal(pkt.Payload); err != nil {
+			return false
+		}
+
+		// First packet of a coded video sequence, which starts with a keyframe
+		return depacketizer.N
+	}
+
+	return true
+}
+
+// Returns true when match returns true for the header byte of any NAL unit in the Annex-B byte stream
+func containsNALU(stream []byte, match func(header byte) bool) bool {
+	for i := 0; i+3 < len(stream); i++ {
+		if stream[i] != 0 || stream[i+1] != 0 || stream[i+2] != 1 {
+			continue
+		}
+
+		if match(stream[i+3]) {
+			return true
+		}
+
+		i += 2
+	}
+
+	return false
+}
+
+// Set the function called when a video track has not received a keyframe within the KeyframeStallTimeout
+func (w *WHIPSession) SetOnKeyframeStall(onKeyframeStall func(layer string, angle string, sinceKeyframe time.Duration)) {
+	w.onKeyframeStall = onKeyframeStall
+}
+
+func (w *WHIPSession) notifyKeyframeStall(layer string, angle string, sinceKeyframe time.Duration) {
+	if w.onKeyframeStall != nil {
+		w.onKeyframeStall(layer, angle, sinceKeyframe)
+	}
+}
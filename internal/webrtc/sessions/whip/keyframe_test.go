@@ -0,0 +1,188 @@
+package whip
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+
+	pionCodecs "github.com/pion/rtp/codecs"
+)
+
+// RTP payloads in the layout browsers and OBS send, truncated after the bytes needed for detection
+var keyframeTests = []struct {
+	name         string
+	depacketizer func() rtp.Depacketizer
+	payload      []byte
+	isKeyframe   bool
+}{
+	{
+		name:         "H264 STAP-A with SPS and PPS",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.H264Packet{} },
+		payload: []byte{
+			0x78,
+			0x00, 0x0d, 0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xec, 0x04, 0x40, 0x00, 0x00,
+			0x00, 0x04, 0x68, 0xce, 0x3c, 0x80,
+		},
+		isKeyframe: true,
+	},
+	{
+		name:         "H264 IDR slice",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.H264Packet{} },
+		payload:      []byte{0x65, 0x88, 0x84, 0x00, 0x33, 0xff, 0xfe, 0xf6},
+		isKeyframe:   true,
+	},
+	{
+		name:         "H264 non-IDR slice",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.H264Packet{} },
+		payload:      []byte{0x41, 0x9a, 0x24, 0x6c, 0x41, 0x2f, 0xfe, 0xd6},
+		isKeyframe:   false,
+	},
+	{
+		name:         "H265 aggregation packet with VPS, SPS and PPS",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.H265Depacketizer{} },
+		payload: []byte{
+			0x60, 0x01,
+			0x00, 0x06, 0x40, 0x01, 0x0c, 0x01, 0xff, 0xff,
+			0x00, 0x06, 0x42, 0x01, 0x01, 0x01, 0x60, 0x00,
+			0x00, 0x05, 0x44, 0x01, 0xc1, 0x72, 0xb4,
+		},
+		isKeyframe: true,
+	},
+	{
+		name:         "H265 IDR_W_RADL slice",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.H265Depacketizer{} },
+		payload:      []byte{0x26, 0x01, 0xaf, 0x06, 0xb8, 0x13, 0x0c, 0x4e},
+		isKeyframe:   true,
+	},
+	{
+		name:         "H265 TRAIL_R slice",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.H265Depacketizer{} },
+		payload:      []byte{0x02, 0x01, 0xd0, 0x09, 0x7e, 0x10, 0xc5, 0x80},
+		isKeyframe:   false,
+	},
+	{
+		name:         "VP8 keyframe start",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.VP8Packet{} },
+		payload:      []byte{0x90, 0x80, 0x80, 0x01, 0x50, 0x42, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01},
+		isKeyframe:   true,
+	},
+	{
+		name:         "VP8 interframe start",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.VP8Packet{} },
+		payload:      []byte{0x90, 0x80, 0x80, 0x02, 0x31, 0x12, 0x00, 0x11, 0x10, 0x0a},
+		isKeyframe:   false,
+	},
+	{
+		name:         "VP8 keyframe continuation",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.VP8Packet{} },
+		payload:      []byte{0x80, 0x80, 0x80, 0x01, 0x3c, 0x17, 0x4d, 0x0a, 0xd5, 0x11},
+		isKeyframe:   false,
+	},
+	{
+		name:         "VP9 keyframe start",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.VP9Packet{} },
+		payload:      []byte{0x88, 0x80, 0x01, 0x82, 0x49, 0x83, 0x42, 0x00, 0x27, 0xf0},
+		isKeyframe:   true,
+	},
+	{
+		name:         "VP9 interframe start",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.VP9Packet{} },
+		payload:      []byte{0xc8, 0x80, 0x02, 0x86, 0x00, 0x40, 0x92, 0xe0},
+		isKeyframe:   false,
+	},
+	{
+		name:         "AV1 new coded video sequence",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.AV1Depacketizer{} },
+		payload:      []byte{0x28, 0x0b, 0x08, 0x00, 0x00, 0x00, 0x2c, 0xa7, 0xdf, 0xe3, 0xf8, 0x87, 0x40, 0x32, 0x10, 0x00, 0x00},
+		isKeyframe:   true,
+	},
+	{
+		name:         "AV1 frame",
+		depacketizer: func() rtp.Depacketizer { return &pionCodecs.AV1Depacketizer{} },
+		payload:      []byte{0x10, 0x32, 0x00, 0x08, 0xd4, 0xc1, 0x02, 0x00, 0x05},
+		isKeyframe:   false,
+	},
+}
+
+func TestIsPacketKeyframe(t *testing.T) {
+	for _, test := range keyframeTests {
+		t.Run(test.name, func(t *testing.T) {
+			packet := &rtp.Packet{Payload: test.payload}
+			if isKeyframe := isPacketKeyframe(packet, test.depacketizer()); isKeyframe != test.isKeyframe {
+				t.Fatalf("expected keyframe %t, got %t", test.isKeyframe, isKeyframe)
+			}
+		})
+	}
+}
+
+// Produces H264 slices without keyframes every 5ms until done is closed
+type interframeReader struct {
+	done           chan struct{}
+	sequenceNumber uint16
+}
+
+func (r *interframeReader) Read(b []byte) (int, interceptor.Attributes, error) {
+	select {
+	case <-r.done:
+		return 0, nil, io.EOF
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	r.sequenceNumber++
+	packet := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: r.sequenceNumber,
+			Timestamp:      uint32(r.sequenceNumber) * 450,
+		},
+		Payload: []byte{0x41, 0x9a, 0x00, 0x00},
+	}
+
+	n, err := packet.MarshalTo(b)
+	return n, nil, err
+}
+
+func TestKeyframeStall(t *testing.T) {
+	host := &WHIPSession{
+		ID:          "host",
+		Logger:      slog.Default(),
+		AudioTracks: make(map[string]*AudioTrack),
+		VideoTracks: make(map[string]*VideoTrack),
+
+		KeyframeStallTimeout: 20 * time.Millisecond,
+	}
+
+	stalls := make(chan time.Duration, 2)
+	host.SetOnKeyframeStall(func(layer string, angle string, sinceKeyframe time.Duration) {
+		if layer != codecs.VideoTrackLabelDefault || angle != codecs.VideoTrackLabelDefault {
+			t.Errorf("unexpected stalled track %s of angle %s", layer, angle)
+		}
+
+		stalls <- sinceKeyframe
+	})
+
+	reader := &interframeReader{done: make(chan struct{})}
+	go host.IngestVideo(reader, codecs.VideoTrackCodecH264, "stream")
+
+	select {
+	case sinceKeyframe := <-stalls:
+		if sinceKeyframe < host.KeyframeStallTimeout {
+			t.Fatalf("expected the stall after %v, got %v", host.KeyframeStallTimeout, sinceKeyframe)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the keyframe stall to be reported")
+	}
+
+	// A stall is reported once until the next keyframe
+	time.Sleep(5 * host.KeyframeStallTimeout)
+	close(reader.done)
+
+	if len(stalls) != 0 {
+		t.Fatal("expected the stall to be reported once")
+	}
+}
@@ -1,7 +1,35 @@
 package whip
 
+// Media IDs of the video and audio layers in the layers event and layer requests
+const (
+	VideoMediaID = "1"
+	AudioMediaID = "2"
+)
+
 type (
 	simulcastLayerResponse struct {
 		EncodingID string `json:"encodingId"`
+
+		// Camera angle of a video layer
+		Angle string `json:"angle,omitempty"`
+
+		// MID and msid of the media section of the track
+		MID  string `json:"mid,omitempty"`
+		MSID string `json:"msid,omitempty"`
+	}
+
+	// Video layer with the simulcast priority it is sorted by
+	videoTrackResponse struct {
+		simulcastLayerResponse
+		priority int
+	}
+
+	videoAngleResponse struct {
+		Angle string `json:"angle"`
+		MID   string `json:"mid,omitempty"`
+		MSID  string `json:"msid,omitempty"`
+
+		// Encoding IDs of the layers of the angle, best layer first
+		Layers []string `json:"layers"`
 	}
 )
@@ -1,8 +1,7 @@
 package whip
 
 import (
-	"log"
-
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v4"
 )
@@ -13,6 +12,8 @@ func (w *WHIPSession) SetOnClosed(onClosed func()) {
 
 func (w *WHIPSession) notifyClosed() {
 	w.closeOnce.Do(func() {
+		w.isClosed.Store(true)
+
 		if w.onClosed != nil {
 			w.onClosed()
 		}
@@ -20,17 +21,18 @@ func (w *WHIPSession) notifyClosed() {
 }
 
 func (w *WHIPSession) AddPeerConnection(peerConnection *webrtc.PeerConnection, streamKey string) {
-	log.Println("WHIPSession.AddPeerConnection")
+	w.Logger.Info("WHIPSession.AddPeerConnection")
 
 	w.PeerConnectionLock.Lock()
 	existingPeerConnection := w.PeerConnection
 	w.PeerConnection = peerConnection
+	w.ICECandidates = utils.NewICECandidates(peerConnection)
 	w.PeerConnectionLock.Unlock()
 
 	if existingPeerConnection != nil && existingPeerConnection != peerConnection {
-		log.Println("WHIPSession.AddPeerConnection: Replacing existing peerconnection")
+		w.Logger.Info("WHIPSession.AddPeerConnection: Replacing existing peerconnection")
 		if err := existingPeerConnection.GracefulClose(); err != nil {
-			log.Println("WHIPSession.AddPeerConnection.Close.Error", err)
+			w.Logger.Error("WHIPSession.AddPeerConnection.Close.Error", "error", err)
 		}
 	}
 
@@ -38,11 +40,12 @@ func (w *WHIPSession) AddPeerConnection(peerConnection *webrtc.PeerConnection, s
 }
 
 func (w *WHIPSession) RemovePeerConnection() {
-	log.Println("WHIPSession.RemovePeerConnection", w.ID)
+	w.Logger.Info("WHIPSession.RemovePeerConnection")
 
 	w.PeerConnectionLock.Lock()
 	peerConnection := w.PeerConnection
 	w.PeerConnection = nil
+	w.ICECandidates = nil
 	w.PeerConnectionLock.Unlock()
 
 	if peerConnection == nil {
@@ -50,10 +53,10 @@ func (w *WHIPSession) RemovePeerConnection() {
 	}
 
 	if err := peerConnection.Close(); err != nil {
-		log.Println("WHIPSession.RemovePeerConnection.Error", err)
+		w.Logger.Error("WHIPSession.RemovePeerConnection.Error", "error", err)
 	}
 
-	log.Println("WHIPSession.RemovePeerConnection.Completed", w.ID)
+	w.Logger.Debug("WHIPSession.RemovePeerConnection.Completed")
 }
 
 func (w *WHIPSession) SendPLI() {
@@ -70,7 +73,7 @@ func (w *WHIPSession) SendPLI() {
 	}
 
 	if err := peerConnection.WriteRTCP(packets); err != nil {
-		log.Println("WHIPSession.SendPLI.WriteRTCP.Error", err)
+		w.Logger.Warn("WHIPSession.SendPLI.WriteRTCP.Error", "error", err)
 	}
 }
 
@@ -0,0 +1,42 @@
+package whip
+
+import (
+	"github.com/glimesh/broadcast-box/internal/recording"
+)
+
+// Start recording the incoming media of the WHIP session to disk
+func (w *WHIPSession) StartRecording(streamKey string) error {
+	if w.Recorder.Load() != nil {
+		return nil
+	}
+
+	recorder, err := recording.NewRecorder(streamKey)
+	if err != nil {
+		return err
+	}
+
+	// A recording that can not be written is stopped without blocking ingest
+	recorder.SetOnFailed(func() {
+		if w.Recorder.CompareAndSwap(recorder, nil) {
+			w.Logger.Warn("WHIPSession.StopRecording: Recording failed")
+		}
+	})
+
+	if !w.Recorder.CompareAndSwap(nil, recorder) {
+		recorder.Close()
+	}
+
+	w.Logger.Info("WHIPSession.StartRecording")
+	return nil
+}
+
+// Stop recording and close all recorded files
+func (w *WHIPSession) StopRecording() {
+	recorder := w.Recorder.Swap(nil)
+	if recorder == nil {
+		return
+	}
+
+	w.Logger.Info("WHIPSession.StopRecording")
+	recorder.Close()
+}
@@ -1,45 +1,85 @@
 package whip
 
 import (
+	"cmp"
 	"encoding/json"
-	"log"
+	"slices"
+	"strings"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 )
 
 // Returns all available Video and Audio layers of the provided stream key
 func (w *WHIPSession) GetAvailableLayersEvent() string {
-	videoLayers := []simulcastLayerResponse{}
+	videoTracks := []videoTrackResponse{}
 	audioLayers := []simulcastLayerResponse{}
 
 	w.TracksLock.RLock()
 
 	// Add available video layers
-	for track := range w.VideoTracks {
-		videoLayers = append(videoLayers, simulcastLayerResponse{
-			EncodingID: w.VideoTracks[track].Rid,
+	for _, track := range w.VideoTracks {
+		videoTracks = append(videoTracks, videoTrackResponse{
+			simulcastLayerResponse: simulcastLayerResponse{
+				EncodingID: track.Rid,
+				Angle:      track.Angle,
+				MID:        track.MID,
+				MSID:       track.MSID,
+			},
+			priority: track.Priority,
 		})
 	}
 
-	// Add available audio layers
+	// Add available audio tracks, the default audio track first
 	for track := range w.AudioTracks {
 		audioLayers = append(audioLayers, simulcastLayerResponse{
 			EncodingID: w.AudioTracks[track].Rid,
+			MID:        w.AudioTracks[track].MID,
+			MSID:       w.AudioTracks[track].MSID,
 		})
 	}
 
 	w.TracksLock.RUnlock()
 
-	resp := map[string]map[string][]simulcastLayerResponse{
-		"1": {
+	slices.SortFunc(audioLayers, func(a, b simulcastLayerResponse) int {
+		return strings.Compare(a.EncodingID, b.EncodingID)
+	})
+
+	// Video layers are grouped by camera angle, the default angle first and the best layer of each angle first
+	slices.SortFunc(videoTracks, func(a, b videoTrackResponse) int {
+		return cmp.Or(codecs.CompareVideoAngles(a.Angle, b.Angle), cmp.Compare(a.priority, b.priority), strings.Compare(a.EncodingID, b.EncodingID))
+	})
+
+	videoLayers := []simulcastLayerResponse{}
+	videoAngles := []videoAngleResponse{}
+	for _, track := range videoTracks {
+		videoLayers = append(videoLayers, track.simulcastLayerResponse)
+
+		if len(videoAngles) == 0 || videoAngles[len(videoAngles)-1].Angle != track.Angle {
+			videoAngles = append(videoAngles, videoAngleResponse{
+				Angle:  track.Angle,
+				MID:    track.MID,
+				MSID:   track.MSID,
+				Layers: []string{},
+			})
+		}
+
+		angle := &videoAngles[len(videoAngles)-1]
+		angle.Layers = append(angle.Layers, track.EncodingID)
+	}
+
+	resp := map[string]map[string]any{
+		VideoMediaID: {
 			"layers": videoLayers,
+			"angles": videoAngles,
 		},
-		"2": {
+		AudioMediaID: {
 			"layers": audioLayers,
 		},
 	}
 
 	jsonResult, err := json.Marshal(resp)
 	if err != nil {
-		log.Println("Error converting response", resp, "to Json")
+		w.Logger.Error("WHIPSession.GetAvailableLayersEvent.Error", "error", err)
 	}
 
 	return "event: layers\ndata: " + string(jsonResult) + "\n\n"
@@ -1,7 +1,6 @@
 package whip
 
 import (
-	"log"
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
@@ -10,17 +9,19 @@ import (
 )
 
 // Add a new AudioTrack to the WHIP session
-func (w *WHIPSession) addAudioTrack(rid string, streamKey string, codec codecs.TrackCodeType) (*AudioTrack, error) {
-	log.Println("WHIPSession.AddAudioTrack:", streamKey, "(", rid, ")")
+func (w *WHIPSession) addAudioTrack(rid string, mid string, msid string, streamKey string, codec codecs.TrackCodeType) (*AudioTrack, error) {
+	w.Logger.Info("WHIPSession.AddAudioTrack", "rid", rid, "mid", mid, "msid", msid, "codec", codec)
 	w.TracksLock.Lock()
-	defer w.TracksLock.Unlock()
 
 	if existingTrack, ok := w.AudioTracks[rid]; ok {
+		w.TracksLock.Unlock()
 		return existingTrack, nil
 	}
 
 	track := &AudioTrack{
-		Rid: rid,
+		Rid:  rid,
+		MID:  mid,
+		MSID: msid,
 		Track: codecs.CreateTrackMultiCodec(
 			"audio-"+uuid.New().String(),
 			rid,
@@ -31,22 +32,29 @@ func (w *WHIPSession) addAudioTrack(rid string, streamKey string, codec codecs.T
 	track.LastReceived.Store(time.Time{})
 
 	w.AudioTracks[track.Rid] = track
+	w.TracksLock.Unlock()
 
+	w.notifyTracksChanged()
 	return track, nil
 }
 
 // Add a new VideoTrack to the WHIP session
-func (w *WHIPSession) addVideoTrack(rid string, streamKey string, codec codecs.TrackCodeType) (*VideoTrack, error) {
-	log.Println("WHIPSession.AddVideoTrack:", "(", rid, ")")
+func (w *WHIPSession) addVideoTrack(rid string, angle string, mid string, msid string, priority int, streamKey string, codec codecs.TrackCodeType) (*VideoTrack, error) {
+	w.Logger.Info("WHIPSession.AddVideoTrack", "rid", rid, "angle", angle, "mid", mid, "msid", msid, "priority", priority, "codec", codec)
 	w.TracksLock.Lock()
-	defer w.TracksLock.Unlock()
 
 	if existingTrack, ok := w.VideoTracks[rid]; ok {
+		existingTrack.Priority = priority
+		w.TracksLock.Unlock()
 		return existingTrack, nil
 	}
 
 	track := &VideoTrack{
-		Rid: rid,
+		Rid:      rid,
+		Angle:    angle,
+		MID:      mid,
+		MSID:     msid,
+		Priority: priority,
 		Track: codecs.CreateTrackMultiCodec(
 			"video-"+uuid.New().String(),
 			rid,
@@ -57,16 +65,107 @@ func (w *WHIPSession) addVideoTrack(rid string, streamKey string, codec codecs.T
 	track.LastReceived.Store(time.Time{})
 
 	w.VideoTracks[rid] = track
+	w.TracksLock.Unlock()
 
+	w.notifyTracksChanged()
 	return track, nil
 }
 
+// Returns the time a packet was last received on any track
+func (w *WHIPSession) LastPacketReceived() (lastReceived time.Time) {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	for _, track := range w.VideoTracks {
+		if received, ok := track.LastReceived.Load().(time.Time); ok && received.After(lastReceived) {
+			lastReceived = received
+		}
+	}
+
+	for _, track := range w.AudioTracks {
+		if received, ok := track.LastReceived.Load().(time.Time); ok && received.After(lastReceived) {
+			lastReceived = received
+		}
+	}
+
+	return lastReceived
+}
+
 // Remove Audio and Video tracks coming from the whip session id
 func (w *WHIPSession) RemoveTracks() {
-	log.Println("WHIPSession.RemoveTracks")
+	w.Logger.Debug("WHIPSession.RemoveTracks")
 
 	w.TracksLock.Lock()
 	w.AudioTracks = make(map[string]*AudioTrack)
 	w.VideoTracks = make(map[string]*VideoTrack)
 	w.TracksLock.Unlock()
+
+	w.notifyTracksChanged()
+}
+
+// Set the function called after a track was added to or removed from the host
+func (w *WHIPSession) SetOnTracksChanged(onTracksChanged func()) {
+	w.onTracksChanged = onTracksChanged
+}
+
+func (w *WHIPSession) notifyTracksChanged() {
+	if w.onTracksChanged != nil {
+		w.onTracksChanged()
+	}
+}
+
+// Returns true if the host has any audio track
+func (w *WHIPSession) HasAudioTracks() bool {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	return len(w.AudioTracks) != 0
+}
+
+// Returns the number of camera angles of the host
+func (w *WHIPSession) GetVideoAngleCount() int {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	angles := map[string]bool{}
+	for _, track := range w.VideoTracks {
+		angles[track.Angle] = true
+	}
+
+	return len(angles)
+}
+
+// Returns true if the host has an audio track with the ID
+func (w *WHIPSession) HasAudioTrack(id string) bool {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	_, ok := w.AudioTracks[id]
+	return ok
+}
+
+// Returns the camera angle of the video track with the ID
+func (w *WHIPSession) GetVideoTrackAngle(id string) (angle string, ok bool) {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	if track, ok := w.VideoTracks[id]; ok {
+		return track.Angle, true
+	}
+
+	return "", false
+}
+
+// Returns true if the host has a video track with the camera angle
+func (w *WHIPSession) HasVideoAngle(angle string) bool {
+	w.TracksLock.RLock()
+	defer w.TracksLock.RUnlock()
+
+	for _, track := range w.VideoTracks {
+		if track.Angle == angle {
+			return true
+		}
+	}
+
+	return false
 }
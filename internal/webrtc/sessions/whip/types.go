@@ -1,20 +1,30 @@
 package whip
 
 import (
+	"log/slog"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/glimesh/broadcast-box/internal/hls"
+	"github.com/glimesh/broadcast-box/internal/recording"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/webrtc/v4"
 )
 
 type (
 	WHIPSession struct {
 		ID                 string
+		Logger             *slog.Logger
 		PeerConnection     *webrtc.PeerConnection
+		ICECandidates      *utils.ICECandidates
 		closeOnce          sync.Once
+		isClosed           atomic.Bool
 		onClosed           func()
+		onTracksChanged    func()
+		onKeyframeStall    func(layer string, angle string, sinceKeyframe time.Duration)
 		PeerConnectionLock sync.RWMutex
 
 		// Protects AudioTrack, VideoTracks
@@ -25,22 +35,44 @@ type (
 		// TODO: WHEPSessionsSnapshot should contain serializable state, not runtime references.
 		WHEPSessionsSnapshot atomic.Value
 
+		// Set while the incoming media is being recorded to disk
+		Recorder atomic.Pointer[recording.Recorder]
+
+		// Set when the incoming media is packaged for HLS
+		HLSPackager atomic.Pointer[hls.Packager]
+
 		ChatManager *chat.Manager
+
+		// Time without keyframes after which a video track is reported as stalled, zero when stalls are not reported
+		KeyframeStallTimeout time.Duration
 	}
 
 	VideoTrack struct {
-		Rid             string
+		Rid string
+
+		// Camera angle of the track, one per video media section. MID and msid of the media section,
+		// empty for tracks not received over WebRTC.
+		Angle           string
+		MID             string
+		MSID            string
 		Priority        int
 		Bitrate         atomic.Uint64
 		PacketsReceived atomic.Uint64
 		PacketsDropped  atomic.Uint64
 		LastReceived    atomic.Value
 		LastKeyFrame    atomic.Value
-		MediaSSRC       atomic.Uint32
-		Track           *codecs.TrackMultiCodec
+
+		// Time between the last two keyframes in nanoseconds
+		KeyFrameInterval atomic.Int64
+		MediaSSRC        atomic.Uint32
+		Track            *codecs.TrackMultiCodec
 	}
 	AudioTrack struct {
-		Rid             string
+		Rid string
+
+		// MID and msid of the media section of the track, empty for tracks not received over WebRTC
+		MID             string
+		MSID            string
 		Priority        int
 		PacketsReceived atomic.Uint64
 		PacketsDropped  atomic.Uint64
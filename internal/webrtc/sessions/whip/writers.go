@@ -3,7 +3,6 @@ package whip
 import (
 	"errors"
 	"io"
-	"log"
 	"math"
 	"strings"
 	"time"
@@ -12,55 +11,65 @@ import (
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
 	"github.com/pion/rtp"
 	"github.com/pion/sdp/v3"
-	"github.com/pion/webrtc/v4"
 
 	pionCodecs "github.com/pion/rtp/codecs"
 )
 
-func (w *WHIPSession) audioWriter(remoteTrack *webrtc.TrackRemote, streamKey string) {
-	id := remoteTrack.RID()
-
-	if id == "" {
-		id = codecs.AudioTrackLabelDefault
-	}
-
-	codec := codecs.GetAudioTrackCodec(remoteTrack.Codec().MimeType)
-	track, err := w.addAudioTrack(id, streamKey, codec)
+func (w *WHIPSession) audioWriter(reader RTPReader, id string, mid string, msid string, codec codecs.TrackCodeType, streamKey string) {
+	track, err := w.addAudioTrack(id, mid, msid, streamKey, codec)
 	if err != nil {
-		log.Println("AudioWriter.AddTrack.Error:", err)
+		w.Logger.Error("WHIPSession.AudioWriter.AddTrack.Error", "error", err)
 		return
 	}
 
+	var sequence rtpSequence
+	var loss rtpLoss
+
 	rtpPkt := &rtp.Packet{}
 	rtpBuf := make([]byte, 1500)
 	for {
-		rtpRead, _, err := remoteTrack.Read(rtpBuf)
+		rtpRead, _, err := reader.Read(rtpBuf)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				log.Println("WHIPSession.AudioWriter.RtpPkt.EndOfStream")
+				w.Logger.Info("WHIPSession.AudioWriter.RtpPkt.EndOfStream", "rid", id)
 				return
 			} else {
-				log.Println("WHIPSession.AudioWriter.RtpPkt.Err", err)
+				w.Logger.Debug("WHIPSession.AudioWriter.RtpPkt.Err", "rid", id, "error", err)
 			}
 		}
 
 		track.PacketsReceived.Add(1)
+		track.LastReceived.Store(time.Now())
 
 		err = rtpPkt.Unmarshal(rtpBuf[:rtpRead])
 		if err != nil {
-			log.Println("WHIPSession.AudioWriter.RtpPkt.Error", err)
+			w.Logger.Debug("WHIPSession.AudioWriter.RtpPkt.Unmarshal", "rid", id, "error", err)
 			continue
 		}
 
+		if recorder := w.Recorder.Load(); recorder != nil {
+			recorder.WriteAudio(id, rtpPkt, codec)
+		}
+
 		var sessions map[string]*whep.WHEPSession
 		if sessionsAny := w.WHEPSessionsSnapshot.Load(); sessionsAny != nil {
 			sessions = sessionsAny.(map[string]*whep.WHEPSession)
 		}
 
+		timeDiff, sequenceDiff := sequence.next(rtpPkt)
+		track.PacketsDropped.Add(loss.next(rtpPkt))
 		packet := codecs.TrackPacket{
-			Layer:  id,
-			Packet: rtpPkt,
-			Codec:  codec,
+			Layer:        id,
+			Packet:       rtpPkt,
+			Codec:        codec,
+			TimeDiff:     timeDiff,
+			SequenceDiff: sequenceDiff,
+		}
+
+		// Package before fan-out, WHEP sessions rewrite the packet headers.
+		// HLS has a single audio rendition, the default audio track.
+		if packager := w.HLSPackager.Load(); packager != nil && id == codecs.AudioTrackLabelDefault {
+			packager.WriteAudio(packet)
 		}
 
 		for _, whepSession := range sessions {
@@ -69,21 +78,13 @@ func (w *WHIPSession) audioWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 	}
 }
 
-func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey string, peerConnection *webrtc.PeerConnection) {
-	id := remoteTrack.RID()
-
-	if id == "" {
-		id = codecs.VideoTrackLabelDefault
-	}
-
-	codec := codecs.GetVideoTrackCodec(remoteTrack.Codec().MimeType)
-	track, err := w.addVideoTrack(id, streamKey, codec)
+func (w *WHIPSession) videoWriter(reader RTPReader, id string, angle string, mid string, msid string, codec codecs.TrackCodeType, priority int, mediaSSRC uint32, streamKey string) {
+	track, err := w.addVideoTrack(id, angle, mid, msid, priority, streamKey, codec)
 	if err != nil {
-		log.Println("WHIPSession.VideoWriter.AddTrack.Error:", err)
+		w.Logger.Error("WHIPSession.VideoWriter.AddTrack.Error", "error", err)
 		return
 	}
-	track.Priority = w.getPrioritizedStreamingLayer(id, peerConnection.CurrentRemoteDescription().SDP)
-	track.MediaSSRC.Store(uint32(remoteTrack.SSRC()))
+	track.MediaSSRC.Store(mediaSSRC)
 
 	var depacketizer rtp.Depacketizer
 	switch codec {
@@ -100,14 +101,19 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 	}
 
 	if depacketizer == nil {
-		log.Println("WHIPSession.VideoWriter.Depacketizer: No depacketizer was found for codec", codec)
+		w.Logger.Warn("WHIPSession.VideoWriter.Depacketizer: No depacketizer was found", "codec", codec)
 	}
 
-	lastTimestamp := uint32(0)
-	lastTimestampSet := false
+	var sequence rtpSequence
+	var loss rtpLoss
+
+	lastKeyFrameTimestamp := uint32(0)
+	lastKeyFrameTimestampSet := false
 
-	lastSequenceNumber := uint16(0)
-	lastSequenceNumberSet := false
+	// Media that keeps arriving without keyframes leaves new viewers without a picture
+	keyframeStallTimeout := w.KeyframeStallTimeout
+	lastKeyFrameReceived := time.Now()
+	isKeyFrameStalled := false
 
 	bitrateWindowStart := time.Now()
 	bitrateWindowBytes := uint64(0)
@@ -115,14 +121,14 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 	rtpPkt := &rtp.Packet{}
 	pktBuf := make([]byte, 1500)
 	for {
-		rtpRead, _, err := remoteTrack.Read(pktBuf)
+		rtpRead, _, err := reader.Read(pktBuf)
 		if err != nil {
 			if errors.Is(err, io.EOF) {
-				log.Println("WHIPSession.VideoWriter.RtpPkt.EndOfStream")
+				w.Logger.Info("WHIPSession.VideoWriter.RtpPkt.EndOfStream", "rid", id)
 				w.notifyClosed()
 				return
 			} else {
-				log.Println("WHIPSession.VideoWriter.RtpPkt.Err", err)
+				w.Logger.Debug("WHIPSession.VideoWriter.RtpPkt.Err", "rid", id, "error", err)
 			}
 		}
 
@@ -132,48 +138,66 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 
 		err = rtpPkt.Unmarshal(pktBuf[:rtpRead])
 		if err != nil {
-			log.Println("WHIPSession.VideoWriter.RtpPkt.Unmarshal", err)
+			w.Logger.Debug("WHIPSession.VideoWriter.RtpPkt.Unmarshal", "rid", id, "error", err)
 			continue
 		}
 
 		rtpPkt.Extension = false
 		rtpPkt.Extensions = nil
 
+		now := time.Now()
 		track.PacketsReceived.Add(1)
+		track.LastReceived.Store(now)
 		bitrateWindowBytes += uint64(rtpRead)
 
-		isKeyframe := isPacketKeyframe(rtpPkt, codec, depacketizer)
+		isKeyframe := isPacketKeyframe(rtpPkt, depacketizer)
 		if isKeyframe {
-			track.LastKeyFrame.Store(time.Now())
+			// A keyframe spans several packets with the same timestamp, only the first one starts an interval
+			if !lastKeyFrameTimestampSet || rtpPkt.Timestamp != lastKeyFrameTimestamp {
+				if lastKeyFrame, ok := track.LastKeyFrame.Load().(time.Time); ok {
+					track.KeyFrameInterval.Store(int64(now.Sub(lastKeyFrame)))
+				}
+
+				lastKeyFrameTimestamp = rtpPkt.Timestamp
+				lastKeyFrameTimestampSet = true
+			}
+
+			track.LastKeyFrame.Store(now)
+			lastKeyFrameReceived = now
+			isKeyFrameStalled = false
+		} else if keyframeStallTimeout > 0 && !isKeyFrameStalled && now.Sub(lastKeyFrameReceived) >= keyframeStallTimeout {
+			isKeyFrameStalled = true
+			w.Logger.Warn("WHIPSession.VideoWriter.KeyframeStall", "rid", id, "angle", angle, "sinceKeyframe", now.Sub(lastKeyFrameReceived))
+			w.notifyKeyframeStall(id, angle, now.Sub(lastKeyFrameReceived))
 		}
 
-		now := time.Now()
 		if elapsed := now.Sub(bitrateWindowStart); elapsed >= time.Second {
 			track.Bitrate.Store(uint64(float64(bitrateWindowBytes) / elapsed.Seconds()))
 			bitrateWindowStart = now
 			bitrateWindowBytes = 0
 		}
 
-		timeDiff := int64(rtpPkt.Timestamp) - int64(lastTimestamp)
-		switch {
-		case !lastTimestampSet:
-			timeDiff = 0
-			lastTimestampSet = true
-		case timeDiff < -(math.MaxUint32 / 10):
-			timeDiff += (math.MaxUint32 + 1)
+		timeDiff, sequenceDiff := sequence.next(rtpPkt)
+		track.PacketsDropped.Add(loss.next(rtpPkt))
+		packet := codecs.TrackPacket{
+			Layer:        id,
+			Angle:        angle,
+			Packet:       rtpPkt,
+			Codec:        codec,
+			IsKeyframe:   isKeyframe,
+			TimeDiff:     timeDiff,
+			SequenceDiff: sequenceDiff,
 		}
 
-		sequenceDiff := int(rtpPkt.SequenceNumber) - int(lastSequenceNumber)
-		switch {
-		case !lastSequenceNumberSet:
-			lastSequenceNumberSet = true
-			sequenceDiff = 0
-		case sequenceDiff < -(math.MaxUint16 / 10):
-			sequenceDiff += (math.MaxUint16 + 1)
+		// Record and package before fan-out, WHEP sessions rewrite the packet headers
+		if recorder := w.Recorder.Load(); recorder != nil {
+			recorder.WriteVideo(id, rtpPkt, codec)
 		}
 
-		lastTimestamp = rtpPkt.Timestamp
-		lastSequenceNumber = rtpPkt.SequenceNumber
+		// HLS has a single video rendition, the layers of the default camera angle
+		if packager := w.HLSPackager.Load(); packager != nil && angle == codecs.VideoTrackLabelDefault {
+			packager.WriteVideo(packet, track.Priority)
+		}
 
 		var sessions map[string]*whep.WHEPSession
 		if sessionsAny := w.WHEPSessionsSnapshot.Load(); sessionsAny != nil {
@@ -181,65 +205,96 @@ func (w *WHIPSession) videoWriter(remoteTrack *webrtc.TrackRemote, streamKey str
 		}
 
 		for _, whepSession := range sessions {
-			if whepSession.GetVideoLayerOrDefault(id, track.Priority) != id {
+			// Additional video tracks of the viewer forward their own camera angles
+			whepSession.SendVideoAnglePacket(packet, track.Priority)
+
+			if whepSession.GetVideoLayerOrDefault(angle, id, track.Priority, track.Bitrate.Load(), isKeyframe) != id {
 				continue
 			}
 
-			whepSession.SendVideoPacket(codecs.TrackPacket{
-				Layer:        id,
-				Packet:       rtpPkt,
-				Codec:        codec,
-				IsKeyframe:   isKeyframe,
-				TimeDiff:     timeDiff,
-				SequenceDiff: sequenceDiff,
-			})
+			whepSession.SendVideoPacket(packet)
 		}
 	}
 }
 
-const (
-	naluTypeBitmask = 0x1f
-
-	idrNALUType = 5
-	spsNALUType = 7
-	ppsNALUType = 8
-)
+// Timestamp and sequence number of the previous packet of a track
+type rtpSequence struct {
+	lastTimestamp      uint32
+	lastSequenceNumber uint16
+	isSet              bool
+}
 
-func isPacketKeyframe(pkt *rtp.Packet, codec codecs.TrackCodeType, depacketizer rtp.Depacketizer) bool {
-	if codec == codecs.VideoTrackCodecH264 {
-		nalu, err := depacketizer.Unmarshal(pkt.Payload)
+// Returns the timestamp and sequence number difference to the previous packet, zero for the first packet
+func (r *rtpSequence) next(packet *rtp.Packet) (timeDiff int64, sequenceDiff int) {
+	if r.isSet {
+		timeDiff = int64(packet.Timestamp) - int64(r.lastTimestamp)
+		if timeDiff < -(math.MaxUint32 / 10) {
+			timeDiff += (math.MaxUint32 + 1)
+		}
 
-		if err != nil || len(nalu) < 6 {
-			return false
+		sequenceDiff = int(packet.SequenceNumber) - int(r.lastSequenceNumber)
+		if sequenceDiff < -(math.MaxUint16 / 10) {
+			sequenceDiff += (math.MaxUint16 + 1)
 		}
+	}
 
-		firstNaluType := nalu[4] & naluTypeBitmask
-		return firstNaluType == idrNALUType || firstNaluType == spsNALUType || firstNaluType == ppsNALUType
+	r.lastTimestamp = packet.Timestamp
+	r.lastSequenceNumber = packet.SequenceNumber
+	r.isSet = true
+
+	return timeDiff, sequenceDiff
+}
+
+// Highest sequence number received on a track
+type rtpLoss struct {
+	highestSequenceNumber uint16
+	isSet                 bool
+}
+
+// Returns the packets missing from the sequence before the packet, lost or arriving out of order.
+// Packets arriving late do not count again.
+func (r *rtpLoss) next(packet *rtp.Packet) uint64 {
+	if !r.isSet {
+		r.highestSequenceNumber = packet.SequenceNumber
+		r.isSet = true
+		return 0
 	}
 
-	return true
+	// Wraps around, a packet arriving late has a negative difference
+	sequenceDiff := int16(packet.SequenceNumber - r.highestSequenceNumber)
+	if sequenceDiff <= 0 {
+		return 0
+	}
+
+	r.highestSequenceNumber = packet.SequenceNumber
+	return uint64(sequenceDiff - 1)
 }
 
 // Helper function for getting the simulcast order and using as priority for consumers
 // This example will order from left to right with highest to lowest priority
 // a=simulcast:send High,Mid,Low
-func (w *WHIPSession) getPrioritizedStreamingLayer(layer string, sdpDescription string) int {
+// Only the media section with the MID is used when it is set, each camera angle has its own simulcast layers.
+func (w *WHIPSession) getPrioritizedStreamingLayer(layer string, mid string, sdpDescription string) int {
 	var sessionDescription sdp.SessionDescription
 	err := sessionDescription.Unmarshal([]byte(sdpDescription))
 	if err != nil {
-		log.Println("Track.getPrioritizedStreamingLayer Error: (Layer "+layer+")", err)
+		w.Logger.Error("WHIPSession.GetPrioritizedStreamingLayer.Error", "rid", layer, "error", err)
 		return 100
 	}
 
 	var priority = 1
 	for _, description := range sessionDescription.MediaDescriptions {
+		if descriptionMID, _ := description.Attribute("mid"); mid != "" && descriptionMID != mid {
+			continue
+		}
+
 		for _, attribute := range description.Attributes {
 			if attribute.Key == "simulcast" && strings.HasPrefix(attribute.Value, "send ") {
 				layers := strings.TrimPrefix(attribute.Value, "send")
-				log.Println("WHIPSession.VideoWriter.TrackPriority:", layers)
+				w.Logger.Debug("WHIPSession.VideoWriter.TrackPriority", "layers", layers)
 				for simulcastLayer := range strings.SplitSeq(strings.TrimSpace(layers), ";") {
 					if simulcastLayer != "" && strings.EqualFold(simulcastLayer, layer) {
-						log.Println("WHIPSession.VideoWriter.TrackPriority:", layer)
+						w.Logger.Debug("WHIPSession.VideoWriter.TrackPriority", "rid", layer, "priority", priority)
 						return priority
 					} else {
 						priority++
@@ -0,0 +1,47 @@
+package whip
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// Produces a packet for each sequence number, then the end of the stream
+type sequenceReader struct {
+	sequenceNumbers []uint16
+}
+
+func (r *sequenceReader) Read(b []byte) (int, interceptor.Attributes, error) {
+	if len(r.sequenceNumbers) == 0 {
+		return 0, nil, io.EOF
+	}
+
+	packet := &rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: r.sequenceNumbers[0]},
+		Payload: []byte{0xfc},
+	}
+	r.sequenceNumbers = r.sequenceNumbers[1:]
+
+	n, err := packet.MarshalTo(b)
+	return n, nil, err
+}
+
+func TestPacketsDropped(t *testing.T) {
+	host := &WHIPSession{
+		Logger:      slog.Default(),
+		AudioTracks: make(map[string]*AudioTrack),
+		VideoTracks: make(map[string]*VideoTrack),
+	}
+
+	// Packets 0 and 1 are missing when 2 arrives, packet 1 arriving late and the repeated packet do not count again
+	host.IngestAudio(&sequenceReader{sequenceNumbers: []uint16{65534, 65535, 2, 1, 3, 3}}, codecs.AudioTrackCodecOpus, "stream")
+
+	track := host.AudioTracks[codecs.AudioTrackLabelDefault]
+	if track == nil || track.PacketsDropped.Load() != 2 {
+		t.Fatalf("expected two dropped packets, got %+v", track)
+	}
+}
@@ -7,12 +7,36 @@ import (
 	"github.com/glimesh/broadcast-box/internal/environment"
 )
 
-// Appends a candidate to the list of candidates that are sent back to the client in the answer
+// Appends a candidate to the list of candidates that are sent back to the client in the answer.
+// When gathering has not completed there is no end-of-candidates, and the candidate is added to the
+// end of the first media section where the gathered candidates are placed.
 func AppendCandidateToAnswer(localDescriptionSFP string) string {
-	if appendCandidate := os.Getenv(environment.AppendCandidate); appendCandidate != "" {
-		index := strings.Index(localDescriptionSFP, "a=end-of-candidates")
-		localDescriptionSFP = localDescriptionSFP[:index] + appendCandidate + localDescriptionSFP[index:]
+	appendCandidate := os.Getenv(environment.AppendCandidate)
+	if appendCandidate == "" {
+		return localDescriptionSFP
 	}
 
-	return localDescriptionSFP
+	if index := strings.Index(localDescriptionSFP, "a=end-of-candidates"); index != -1 {
+		return localDescriptionSFP[:index] + appendCandidate + localDescriptionSFP[index:]
+	}
+
+	firstMedia := strings.Index(localDescriptionSFP, "m=")
+	if firstMedia == -1 {
+		return localDescriptionSFP
+	}
+
+	if !strings.HasSuffix(appendCandidate, "\n") {
+		appendCandidate += "\r\n"
+	}
+
+	if nextMedia := strings.Index(localDescriptionSFP[firstMedia+2:], "\nm="); nextMedia != -1 {
+		index := firstMedia + 2 + nextMedia + 1
+		return localDescriptionSFP[:index] + appendCandidate + localDescriptionSFP[index:]
+	}
+
+	if !strings.HasSuffix(localDescriptionSFP, "\n") {
+		localDescriptionSFP += "\r\n"
+	}
+
+	return localDescriptionSFP + appendCandidate
 }
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+)
+
+func TestAppendCandidateToAnswer(t *testing.T) {
+	candidate := "a=candidate:1 1 udp 2130706431 203.0.113.1 8443 typ host\r\n"
+	t.Setenv(environment.AppendCandidate, candidate)
+
+	tests := []struct {
+		name     string
+		answer   string
+		expected string
+	}{
+		{
+			name:     "before end of candidates",
+			answer:   "v=0\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\na=end-of-candidates\r\n",
+			expected: "v=0\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\n" + candidate + "a=end-of-candidates\r\n",
+		},
+		{
+			name:     "end of first media section while gathering",
+			answer:   "v=0\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\nm=video 9 UDP/TLS/RTP/SAVPF 96\r\na=mid:1\r\n",
+			expected: "v=0\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\n" + candidate + "m=video 9 UDP/TLS/RTP/SAVPF 96\r\na=mid:1\r\n",
+		},
+		{
+			name:     "end of single media section while gathering",
+			answer:   "v=0\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\n",
+			expected: "v=0\r\nm=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\n" + candidate,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := AppendCandidateToAnswer(test.answer); result != test.expected {
+				t.Fatalf("AppendCandidateToAnswer() = %q, expected %q", result, test.expected)
+			}
+		})
+	}
+}
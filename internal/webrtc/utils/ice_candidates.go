@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/pion/webrtc/v4"
+)
+
+// Collects the local candidates of a PeerConnection so they can be trickled to the client
+// through PATCH responses and server sent events.
+type ICECandidates struct {
+	// Media is bundled, so all candidates belong to the first media section
+	mid string
+
+	lock       sync.Mutex
+	candidates []webrtc.ICECandidateInit
+	isComplete bool
+	generation int
+
+	// Candidates already returned in PATCH responses
+	patchCursor ICECandidatesCursor
+
+	// Closed and replaced whenever a candidate is added or gathering completes
+	changed chan struct{}
+}
+
+// Position of a server sent event stream in the collected candidates
+type ICECandidatesCursor struct {
+	generation        int
+	index             int
+	isCompleteHandled bool
+}
+
+// Returns true when answers are sent before candidate gathering has completed
+func IsTrickleICEEnabled() bool {
+	return strings.EqualFold(os.Getenv(environment.TrickleICE), "true")
+}
+
+// Start collecting the local candidates of the PeerConnection, including the ones already gathered
+func NewICECandidates(peerConnection *webrtc.PeerConnection) *ICECandidates {
+	c := &ICECandidates{
+		changed: make(chan struct{}),
+	}
+
+	if localDescription := peerConnection.LocalDescription(); localDescription != nil {
+		c.mid = GetSDPAttribute(localDescription.SDP, "mid")
+	}
+
+	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			c.complete()
+			return
+		}
+
+		c.add(candidate.ToJSON())
+	})
+
+	// Candidates gathered before the handler was registered are part of the local description
+	if localDescription := peerConnection.LocalDescription(); localDescription != nil {
+		for line := range strings.SplitSeq(localDescription.SDP, "\n") {
+			if candidate, ok := strings.CutPrefix(strings.TrimSpace(line), "a=candidate:"); ok {
+				c.add(webrtc.ICECandidateInit{Candidate: "candidate:" + candidate})
+			}
+		}
+	}
+
+	if peerConnection.ICEGatheringState() == webrtc.ICEGatheringStateComplete {
+		c.complete()
+	}
+
+	return c
+}
+
+// Discard the collected candidates when ICE is restarted and a new gathering begins
+func (c *ICECandidates) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.candidates = nil
+	c.isComplete = false
+	c.generation++
+	c.notifyLocked()
+}
+
+// Returns the candidates that have not been returned in a previous PATCH response
+func (c *ICECandidates) Pending() (candidates []webrtc.ICECandidateInit, endOfCandidates bool) {
+	candidates, endOfCandidates, _ = c.Next(&c.patchCursor)
+	return candidates, endOfCandidates
+}
+
+// Returns the candidates the cursor has not seen yet and a channel that is closed when more are available.
+// End of candidates is reported once per ICE generation.
+func (c *ICECandidates) Next(cursor *ICECandidatesCursor) (candidates []webrtc.ICECandidateInit, endOfCandidates bool, changed <-chan struct{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cursor.generation != c.generation {
+		*cursor = ICECandidatesCursor{generation: c.generation}
+	}
+
+	candidates = append(candidates, c.candidates[cursor.index:]...)
+	cursor.index = len(c.candidates)
+
+	if c.isComplete && !cursor.isCompleteHandled {
+		cursor.isCompleteHandled = true
+		endOfCandidates = true
+	}
+
+	return candidates, endOfCandidates, c.changed
+}
+
+// Returns the candidate signaling that no more candidates will be gathered
+func (c *ICECandidates) EndOfCandidates() webrtc.ICECandidateInit {
+	return c.withMediaSection(webrtc.ICECandidateInit{})
+}
+
+// Returns SSE string with a candidate, an empty candidate signals the end of candidates
+func GetCandidateEvent(candidate webrtc.ICECandidateInit) string {
+	jsonResult, err := json.Marshal(candidate)
+	if err != nil {
+		return ""
+	}
+
+	return "event: candidate\ndata: " + string(jsonResult) + "\n\n"
+}
+
+func (c *ICECandidates) add(candidate webrtc.ICECandidateInit) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, existing := range c.candidates {
+		if existing.Candidate == candidate.Candidate {
+			return
+		}
+	}
+
+	c.candidates = append(c.candidates, c.withMediaSection(candidate))
+	c.notifyLocked()
+}
+
+func (c *ICECandidates) complete() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.isComplete {
+		return
+	}
+
+	c.isComplete = true
+	c.notifyLocked()
+}
+
+func (c *ICECandidates) notifyLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *ICECandidates) withMediaSection(candidate webrtc.ICECandidateInit) webrtc.ICECandidateInit {
+	mid, mLineIndex := c.mid, uint16(0)
+	candidate.SDPMid = &mid
+	candidate.SDPMLineIndex = &mLineIndex
+
+	return candidate
+}
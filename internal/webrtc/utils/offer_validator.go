@@ -6,3 +6,19 @@ func ValidateOffer(offer string) error {
 	var parsed sdp.SessionDescription
 	return parsed.Unmarshal([]byte(offer))
 }
+
+// Returns the number of media sections of the kind, such as "video", that are not rejected
+func GetOfferMediaCount(offer string, kind string) (count int) {
+	var parsed sdp.SessionDescription
+	if err := parsed.Unmarshal([]byte(offer)); err != nil {
+		return 0
+	}
+
+	for _, media := range parsed.MediaDescriptions {
+		if media.MediaName.Media == kind && media.MediaName.Port.Value != 0 {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Retrieve the first value of an SDP attribute
+func GetSDPAttribute(sdp string, key string) string {
+	for line := range strings.SplitSeq(sdp, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "a="+key+":"); ok {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// Replace the ICE credentials of a session description and remove its candidates.
+// Used to apply an ICE restart requested through a trickle ICE sdpfrag.
+func ReplaceICECredentials(sdp string, ufrag string, pwd string) string {
+	var result strings.Builder
+	for line := range strings.SplitSeq(strings.TrimSpace(sdp), "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "a=ice-ufrag:"):
+			line = "a=ice-ufrag:" + ufrag
+		case strings.HasPrefix(line, "a=ice-pwd:"):
+			line = "a=ice-pwd:" + pwd
+		case strings.HasPrefix(line, "a=candidate:"), line == "a=end-of-candidates":
+			continue
+		}
+
+		result.WriteString(line + "\r\n")
+	}
+
+	return result.String()
+}
+
+// Create a trickle ICE sdpfrag from a session description as described in RFC 8840 and RFC 9725 4.3.
+// Media is bundled, so only the candidates of the first media section are included.
+func CreateSDPFragment(sdp string) string {
+	var candidates []string
+	endOfCandidates := false
+
+	forEachFirstMediaLine(sdp, func(line string) {
+		if strings.HasPrefix(line, "a=candidate:") {
+			candidates = append(candidates, line)
+		} else if line == "a=end-of-candidates" {
+			endOfCandidates = true
+		}
+	})
+
+	return createSDPFragment(sdp, candidates, endOfCandidates)
+}
+
+// Create a trickle ICE sdpfrag with the provided candidates for the ICE session of a session description
+func CreateCandidateSDPFragment(sdp string, candidates []webrtc.ICECandidateInit, endOfCandidates bool) string {
+	candidateLines := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		candidateLines = append(candidateLines, "a="+candidate.Candidate)
+	}
+
+	return createSDPFragment(sdp, candidateLines, endOfCandidates)
+}
+
+func createSDPFragment(sdp string, candidates []string, endOfCandidates bool) string {
+	var result strings.Builder
+
+	result.WriteString("a=ice-ufrag:" + GetSDPAttribute(sdp, "ice-ufrag") + "\r\n")
+	result.WriteString("a=ice-pwd:" + GetSDPAttribute(sdp, "ice-pwd") + "\r\n")
+	if bundleGroup := GetSDPAttribute(sdp, "group"); bundleGroup != "" {
+		result.WriteString("a=group:" + bundleGroup + "\r\n")
+	}
+
+	forEachFirstMediaLine(sdp, func(line string) {
+		if strings.HasPrefix(line, "m=") || strings.HasPrefix(line, "a=mid:") {
+			result.WriteString(line + "\r\n")
+		}
+	})
+
+	for _, candidate := range candidates {
+		result.WriteString(candidate + "\r\n")
+	}
+
+	if endOfCandidates {
+		result.WriteString("a=end-of-candidates\r\n")
+	}
+
+	return result.String()
+}
+
+// Call handler with every line of the first media section, starting with its m= line
+func forEachFirstMediaLine(sdp string, handler func(line string)) {
+	mediaCount := 0
+
+	for line := range strings.SplitSeq(sdp, "\n") {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "m=") {
+			mediaCount++
+		}
+
+		if mediaCount == 1 {
+			handler(line)
+		}
+	}
+}
@@ -2,20 +2,25 @@ package webrtc
 
 import (
 	"errors"
+	"log/slog"
 	"strings"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/interceptors"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/session"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/pion/ice/v4"
 	"github.com/pion/interceptor"
 	"github.com/pion/webrtc/v4"
 )
 
-func Setup(chatManager *chat.Manager) {
+func Setup(chatManager *chat.Manager, events session.EventSink) {
 	manager.SessionsManager = &manager.SessionManager{
 		ChatManager: chatManager,
+		Events:      events,
 	}
 	manager.SessionsManager.Setup()
 
@@ -23,12 +28,13 @@ func Setup(chatManager *chat.Manager) {
 	mediaEngine := &webrtc.MediaEngine{}
 	codecs.RegisterCodecs(mediaEngine)
 
-	interceptorRegistry := interceptors.GetRegistry(mediaEngine)
+	whipInterceptorRegistry := interceptors.GetRegistry(mediaEngine)
+	whepInterceptorRegistry := interceptors.GetWHEPRegistry(mediaEngine)
 	udpMuxCache := map[int]*ice.MultiUDPMuxDefault{}
 	tcpMuxCache := map[string]ice.TCPMux{}
 
-	initializeAPIWHIP(mediaEngine, udpMuxCache, tcpMuxCache, &interceptorRegistry)
-	initializeAPIWHEP(mediaEngine, udpMuxCache, tcpMuxCache, &interceptorRegistry)
+	initializeAPIWHIP(mediaEngine, udpMuxCache, tcpMuxCache, &whipInterceptorRegistry)
+	initializeAPIWHEP(mediaEngine, udpMuxCache, tcpMuxCache, &whepInterceptorRegistry)
 }
 
 func initializeAPIWHIP(mediaEngine *webrtc.MediaEngine, udpMuxCache map[int]*ice.MultiUDPMuxDefault, tcpMuxCache map[string]ice.TCPMux, registry *interceptor.Registry) {
@@ -47,71 +53,198 @@ func initializeAPIWHEP(mediaEngine *webrtc.MediaEngine, udpMuxCache map[int]*ice
 	)
 }
 
-func HandleWHEPPatch(sessionID, body string) error {
+// Apply a trickle ICE or ICE restart patch to a WHEP session.
+// Returns the sdpfrag answer when the ICE session was restarted or server candidates are trickled.
+// ICE is not restarted while an offer of a server initiated renegotiation is pending.
+func HandleWHEPPatch(sessionID, body string) (string, error) {
 	session, isFound := manager.SessionsManager.GetWHEPSessionByID(sessionID)
 
 	if !isFound {
-		return errors.New("no session found")
+		return "", errors.New("no session found")
 	}
 
 	session.PeerConnectionLock.Lock()
-	if err := patchPeerConnection(session.PeerConnection, body); err != nil {
-		session.PeerConnectionLock.Unlock()
-		return err
-	}
+	answer, gatherComplete, err := patchPeerConnection(session.PeerConnection, session.ICECandidates, body, session.IsRenegotiationPending())
 	session.PeerConnectionLock.Unlock()
 
-	return nil
+	return getPatchAnswer(session.PeerConnection, answer, gatherComplete, err)
 }
 
-func HandleWHIPPatch(sessionID, body string) error {
-	session, isFound := manager.SessionsManager.GetSessionByID(sessionID)
+// Apply the answer of a viewer to the offer of a server initiated renegotiation
+func HandleWHEPAnswer(sessionID, answer string) error {
+	session, isFound := manager.SessionsManager.GetWHEPSessionByID(sessionID)
 
 	if !isFound {
 		return errors.New("no session found")
 	}
 
-	host := session.Host.Load()
-	if host == nil {
-		return errors.New("no host found")
+	return session.SetRenegotiationAnswer(answer)
+}
+
+// Apply a trickle ICE or ICE restart patch to a WHIP session.
+// Returns the sdpfrag answer when the ICE session was restarted or server candidates are trickled.
+func HandleWHIPPatch(sessionID, body string) (string, error) {
+	_, host, isFound := manager.SessionsManager.GetSessionByHostSessionID(sessionID)
+
+	if !isFound {
+		return "", errors.New("no session found")
 	}
 
 	host.PeerConnectionLock.Lock()
-	if err := patchPeerConnection(host.PeerConnection, body); err != nil {
+	peerConnection := host.PeerConnection
+	if peerConnection == nil {
 		host.PeerConnectionLock.Unlock()
-		return err
+		return "", errors.New("host is not connected through WebRTC")
 	}
+
+	answer, gatherComplete, err := patchPeerConnection(peerConnection, host.ICECandidates, body, false)
 	host.PeerConnectionLock.Unlock()
 
-	return nil
+	return getPatchAnswer(peerConnection, answer, gatherComplete, err)
 }
 
 func HandleWHIPDelete(sessionID string) error {
-	session, isFound := manager.SessionsManager.GetSessionByHostSessionID(sessionID)
+	_, host, isFound := manager.SessionsManager.GetSessionByHostSessionID(sessionID)
 
 	if !isFound {
 		return errors.New("no session found")
 	}
 
-	session.RemoveHost()
-	if session.GetStreamStatus().ViewerCount == 0 {
-		session.Close()
-	}
+	// Closing the host removes it from its session, a standby takes over if available
+	host.Close()
 
 	return nil
 }
 
-func patchPeerConnection(peerConnection *webrtc.PeerConnection, body string) error {
-	oldUfrag := getSdpKeyValue(peerConnection.CurrentRemoteDescription().SDP, "ice-ufrag")
-	oldPwd := getSdpKeyValue(peerConnection.CurrentRemoteDescription().SDP, "ice-pwd")
-	newUfrag, newPwd := getSdpKeyValue(body, "ice-ufrag"), getSdpKeyValue(body, "ice-pwd")
+// Applies the patch, the caller holds the lock of the peer connection.
+// When the ICE session was restarted without trickle ICE, the answer is created by getPatchAnswer once gatherComplete is closed.
+func patchPeerConnection(peerConnection *webrtc.PeerConnection, candidates *utils.ICECandidates, body string, isRenegotiating bool) (answer string, gatherComplete <-chan struct{}, err error) {
+	remoteDescription := peerConnection.CurrentRemoteDescription()
+	if remoteDescription == nil {
+		return "", nil, errors.New("session has no remote description")
+	}
+
+	oldUfrag := utils.GetSDPAttribute(remoteDescription.SDP, "ice-ufrag")
+	oldPwd := utils.GetSDPAttribute(remoteDescription.SDP, "ice-pwd")
+	newUfrag, newPwd := utils.GetSDPAttribute(body, "ice-ufrag"), utils.GetSDPAttribute(body, "ice-pwd")
 
-	isICERestart := oldUfrag != newUfrag || oldPwd != newPwd
+	// Fragments containing only candidates belong to the current ICE session
+	isICERestart := (newUfrag != "" && newUfrag != oldUfrag) || (newPwd != "" && newPwd != oldPwd)
 
 	if isICERestart {
-		return errors.New("ice restart not supported")
+		if isRenegotiating {
+			return "", nil, whep.ErrRenegotiationPending
+		}
+
+		return restartICE(peerConnection, candidates, *remoteDescription, newUfrag, newPwd, body)
 	}
 
+	if err := addICECandidates(peerConnection, body); err != nil {
+		return "", nil, err
+	}
+
+	return getPendingCandidatesFragment(peerConnection, candidates), nil, nil
+}
+
+// Waits for the candidates of a restarted ICE session and returns the answer of the patch.
+// Called after the lock of the peer connection was released, so the session is not blocked while gathering.
+func getPatchAnswer(peerConnection *webrtc.PeerConnection, answer string, gatherComplete <-chan struct{}, err error) (string, error) {
+	if err != nil || gatherComplete == nil {
+		return answer, err
+	}
+
+	<-gatherComplete
+
+	return utils.AppendCandidateToAnswer(utils.CreateSDPFragment(peerConnection.LocalDescription().SDP)), nil
+}
+
+// Restart ICE with the credentials of the patch as described in RFC 9725 4.3.2.
+// The session description is otherwise unchanged, so the tracks of the session are kept.
+// When the server offered last in a renegotiation, the remote description is the answer of the client
+// and the restart is negotiated as a new server offer.
+func restartICE(peerConnection *webrtc.PeerConnection, candidates *utils.ICECandidates, remoteDescription webrtc.SessionDescription, ufrag string, pwd string, body string) (string, <-chan struct{}, error) {
+	if ufrag == "" || pwd == "" {
+		return "", nil, errors.New("ice restart requires both ice-ufrag and ice-pwd")
+	}
+
+	slog.Info("PeerConnection.RestartICE", "remoteDescription", remoteDescription.Type)
+
+	// Candidates of the previous ICE session are no longer valid
+	if candidates != nil {
+		candidates.Reset()
+	}
+
+	var gatherComplete <-chan struct{}
+	remoteSDP := utils.ReplaceICECredentials(remoteDescription.SDP, ufrag, pwd)
+
+	if remoteDescription.Type == webrtc.SDPTypeAnswer {
+		offer, err := peerConnection.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+		if err != nil {
+			return "", nil, err
+		}
+
+		gatherComplete = webrtc.GatheringCompletePromise(peerConnection)
+		if err := peerConnection.SetLocalDescription(offer); err != nil {
+			return "", nil, err
+		}
+
+		if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{
+			SDP:  remoteSDP,
+			Type: webrtc.SDPTypeAnswer,
+		}); err != nil {
+			return "", nil, err
+		}
+	} else {
+		if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{
+			SDP:  remoteSDP,
+			Type: webrtc.SDPTypeOffer,
+		}); err != nil {
+			return "", nil, err
+		}
+
+		gatherComplete = webrtc.GatheringCompletePromise(peerConnection)
+		answer, err := peerConnection.CreateAnswer(nil)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if err := peerConnection.SetLocalDescription(answer); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if err := addICECandidates(peerConnection, body); err != nil {
+		return "", nil, err
+	}
+
+	if utils.IsTrickleICEEnabled() && candidates != nil {
+		pending, endOfCandidates := candidates.Pending()
+		return utils.AppendCandidateToAnswer(utils.CreateCandidateSDPFragment(peerConnection.LocalDescription().SDP, pending, endOfCandidates)), nil, nil
+	}
+
+	return "", gatherComplete, nil
+}
+
+// Returns an sdpfrag with the server candidates gathered since the previous PATCH when trickle ICE is enabled
+func getPendingCandidatesFragment(peerConnection *webrtc.PeerConnection, candidates *utils.ICECandidates) string {
+	if !utils.IsTrickleICEEnabled() || candidates == nil {
+		return ""
+	}
+
+	localDescription := peerConnection.LocalDescription()
+	if localDescription == nil {
+		return ""
+	}
+
+	pending, endOfCandidates := candidates.Pending()
+	if len(pending) == 0 && !endOfCandidates {
+		return ""
+	}
+
+	return utils.CreateCandidateSDPFragment(localDescription.SDP, pending, endOfCandidates)
+}
+
+func addICECandidates(peerConnection *webrtc.PeerConnection, body string) error {
 	for line := range strings.SplitSeq(body, "\n") {
 		expectedPrefix := "a=candidate:"
 
@@ -126,15 +259,3 @@ func patchPeerConnection(peerConnection *webrtc.PeerConnection, body string) err
 
 	return nil
 }
-
-// Retrieve value by SDP key from SDP body
-func getSdpKeyValue(sdp string, key string) string {
-	for l := range strings.SplitSeq(sdp, "\n") {
-		expectedPrefix := "a=" + key + ":"
-		if after, ok := strings.CutPrefix(l, expectedPrefix); ok {
-			return after
-		}
-	}
-
-	return ""
-}
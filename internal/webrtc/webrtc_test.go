@@ -0,0 +1,259 @@
+package webrtc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/environment"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whep"
+	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
+	"github.com/pion/webrtc/v4"
+)
+
+func patch(peerConnection *webrtc.PeerConnection, candidates *utils.ICECandidates, body string) (string, error) {
+	answer, gatherComplete, err := patchPeerConnection(peerConnection, candidates, body, false)
+	return getPatchAnswer(peerConnection, answer, gatherComplete, err)
+}
+
+func TestPatchPeerConnectionICERestart(t *testing.T) {
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	server, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+
+	if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	negotiate := func(options *webrtc.OfferOptions) webrtc.SessionDescription {
+		t.Helper()
+
+		offer, err := client.CreateOffer(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		gatherComplete := webrtc.GatheringCompletePromise(client)
+		if err := client.SetLocalDescription(offer); err != nil {
+			t.Fatal(err)
+		}
+		<-gatherComplete
+
+		return *client.LocalDescription()
+	}
+
+	offer := negotiate(nil)
+	if err := server.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := server.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gatherComplete := webrtc.GatheringCompletePromise(server)
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gatherComplete
+
+	if err := client.SetRemoteDescription(*server.LocalDescription()); err != nil {
+		t.Fatal(err)
+	}
+
+	serverUfrag := utils.GetSDPAttribute(server.LocalDescription().SDP, "ice-ufrag")
+
+	// Trickled candidates of the current ICE session are not a restart
+	fragment, err := patch(server, nil, "a=ice-ufrag:"+utils.GetSDPAttribute(offer.SDP, "ice-ufrag")+"\r\n")
+	if err != nil || fragment != "" {
+		t.Fatalf("patchPeerConnection() = %q, %v, expected no answer", fragment, err)
+	}
+
+	restartOffer := negotiate(&webrtc.OfferOptions{ICERestart: true})
+	fragment, err = patch(server, nil, utils.CreateSDPFragment(restartOffer.SDP))
+	if err != nil {
+		t.Fatalf("patchPeerConnection() error = %v", err)
+	}
+
+	newUfrag := utils.GetSDPAttribute(fragment, "ice-ufrag")
+	if newUfrag == "" || newUfrag == serverUfrag {
+		t.Fatalf("expected new server credentials, got %q", fragment)
+	}
+
+	if !strings.Contains(fragment, "a=mid:") || !strings.Contains(fragment, "a=end-of-candidates") {
+		t.Fatalf("fragment is missing media section details:\n%s", fragment)
+	}
+
+	if utils.GetSDPAttribute(server.CurrentRemoteDescription().SDP, "ice-ufrag") != utils.GetSDPAttribute(restartOffer.SDP, "ice-ufrag") {
+		t.Fatal("remote credentials were not updated")
+	}
+}
+
+func TestPatchPeerConnectionTrickleCandidates(t *testing.T) {
+	t.Setenv(environment.TrickleICE, "true")
+
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	server, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+
+	if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	offer, err := client.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SetRemoteDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := server.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gatherComplete := webrtc.GatheringCompletePromise(server)
+	if err := server.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := utils.NewICECandidates(server)
+	<-gatherComplete
+
+	clientUfrag := "a=ice-ufrag:" + utils.GetSDPAttribute(offer.SDP, "ice-ufrag") + "\r\n"
+
+	fragment, err := patch(server, candidates, clientUfrag)
+	if err != nil {
+		t.Fatalf("patchPeerConnection() error = %v", err)
+	}
+
+	if !strings.Contains(fragment, "a=candidate:") || !strings.HasSuffix(fragment, "a=end-of-candidates\r\n") {
+		t.Fatalf("expected server candidates, got:\n%s", fragment)
+	}
+
+	if utils.GetSDPAttribute(fragment, "ice-ufrag") != utils.GetSDPAttribute(server.LocalDescription().SDP, "ice-ufrag") {
+		t.Fatalf("fragment has wrong credentials:\n%s", fragment)
+	}
+
+	// Candidates are only returned once
+	if fragment, err = patch(server, candidates, clientUfrag); err != nil || fragment != "" {
+		t.Fatalf("patchPeerConnection() = %q, %v, expected no answer", fragment, err)
+	}
+}
+
+func TestPatchPeerConnectionICERestartAfterRenegotiation(t *testing.T) {
+	client, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	server, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = server.Close()
+	}()
+
+	if _, err := client.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Applies the offer of one peer and returns the answer of the other
+	negotiate := func(offerer *webrtc.PeerConnection, answerer *webrtc.PeerConnection, options *webrtc.OfferOptions) {
+		t.Helper()
+
+		offer, err := offerer.CreateOffer(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := offerer.SetLocalDescription(offer); err != nil {
+			t.Fatal(err)
+		}
+		if err := answerer.SetRemoteDescription(offer); err != nil {
+			t.Fatal(err)
+		}
+
+		answer, err := answerer.CreateAnswer(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := answerer.SetLocalDescription(answer); err != nil {
+			t.Fatal(err)
+		}
+		if err := offerer.SetRemoteDescription(answer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	negotiate(client, server, nil)
+
+	// The server renegotiated, so its remote description is the answer of the client
+	negotiate(server, client, nil)
+	if server.CurrentRemoteDescription().Type != webrtc.SDPTypeAnswer {
+		t.Fatal("expected the remote description to be an answer")
+	}
+
+	serverUfrag := utils.GetSDPAttribute(server.LocalDescription().SDP, "ice-ufrag")
+	restartFragment := "a=ice-ufrag:restartufrag\r\na=ice-pwd:restartpasswordrestartpassword\r\n"
+
+	if _, _, err := patchPeerConnection(server, nil, restartFragment, true); !errors.Is(err, whep.ErrRenegotiationPending) {
+		t.Fatalf("expected %v while a renegotiation is pending, got %v", whep.ErrRenegotiationPending, err)
+	}
+
+	fragment, err := patch(server, nil, restartFragment)
+	if err != nil {
+		t.Fatalf("patchPeerConnection() error = %v", err)
+	}
+
+	newUfrag := utils.GetSDPAttribute(fragment, "ice-ufrag")
+	if newUfrag == "" || newUfrag == serverUfrag || !strings.Contains(fragment, "a=end-of-candidates") {
+		t.Fatalf("expected new server credentials and candidates, got %q", fragment)
+	}
+
+	if server.SignalingState() != webrtc.SignalingStateStable || server.CurrentLocalDescription().Type != webrtc.SDPTypeOffer {
+		t.Fatal("expected the restart to be negotiated as a server offer")
+	}
+
+	if utils.GetSDPAttribute(server.CurrentRemoteDescription().SDP, "ice-ufrag") != "restartufrag" {
+		t.Fatal("remote credentials were not updated")
+	}
+}
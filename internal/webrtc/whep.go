@@ -1,12 +1,15 @@
 package webrtc
 
 import (
-	"log"
+	"log/slog"
+	"strconv"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
 	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
+	"github.com/glimesh/broadcast-box/internal/webrtc/interceptors"
 	"github.com/glimesh/broadcast-box/internal/webrtc/peerconnection"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
+	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/whip"
 	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
 	"github.com/google/uuid"
 	"github.com/pion/webrtc/v4"
@@ -24,6 +27,10 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 		return "", "", err
 	}
 
+	if err := validateHostCodecs(offer, session.Host.Load()); err != nil {
+		return "", "", err
+	}
+
 	whepSessionID := uuid.New().String()
 
 	peerConnection, err := peerconnection.CreateWHEPPeerConnection()
@@ -31,6 +38,8 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 		return "", "", err
 	}
 
+	bandwidthEstimator, _ := interceptors.TakeBandwidthEstimator(peerConnection.ID())
+
 	audioTrack, videoTrack := codecs.GetDefaultTracks(streamKey)
 
 	_, err = peerConnection.AddTrack(audioTrack)
@@ -43,6 +52,29 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 		return "", "", err
 	}
 
+	// Every further video section of the offer receives another camera angle
+	videoAngleSenders := []*webrtc.RTPSender{}
+	for i := 1; i < utils.GetOfferMediaCount(offer, "video"); i++ {
+		videoAngleSender, err := peerConnection.AddTrack(codecs.CreateTrackMultiCodec(
+			"video-"+strconv.Itoa(i),
+			"pion",
+			streamKey,
+			webrtc.RTPCodecTypeVideo,
+			0))
+		if err != nil {
+			return "", "", err
+		}
+
+		videoAngleSenders = append(videoAngleSenders, videoAngleSender)
+	}
+
+	// Viewers are limited to the codecs of the profile reserved for the stream
+	if streamProfile, err := authorization.GetPublicProfileByStreamKey(streamKey); err == nil {
+		if err := getCodecPreferences(streamProfile).ApplyToPeerConnection(peerConnection); err != nil {
+			return "", "", err
+		}
+	}
+
 	if err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{
 		SDP:  offer,
 		Type: webrtc.SDPTypeOffer,
@@ -66,6 +98,8 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 		audioTrack,
 		videoTrack,
 		videoRTCPSender,
+		videoAngleSenders,
+		bandwidthEstimator,
 		func() {
 			manager.SessionsManager.SendPLIByWHEPSessionID(whepSessionID)
 		},
@@ -73,10 +107,37 @@ func WHEP(offer string, streamKey string) (string, string, error) {
 		return "", "", err
 	}
 
-	<-gatherComplete
-	log.Println("WHEPSession.GatheringCompletePromise: Completed Gathering for", streamKey)
+	// Candidates gathered after the answer is sent are trickled to the client
+	if !utils.IsTrickleICEEnabled() {
+		<-gatherComplete
+		slog.Debug("WHEPSession.GatheringCompletePromise: Completed Gathering", "streamKey", streamKey, "sessionId", whepSessionID)
+	}
 
 	return utils.DebugOutputAnswer(utils.AppendCandidateToAnswer(peerConnection.LocalDescription().SDP)),
 		whepSessionID,
 		nil
 }
+
+// Packets are forwarded without transcoding, so viewers have to decode the codecs the host currently sends
+func validateHostCodecs(offer string, host *whip.WHIPSession) error {
+	if host == nil {
+		return nil
+	}
+
+	host.TracksLock.RLock()
+	defer host.TracksLock.RUnlock()
+
+	for _, track := range host.VideoTracks {
+		if err := codecs.ValidateOfferCodec(offer, webrtc.RTPCodecTypeVideo, track.Track.Codec()); err != nil {
+			return err
+		}
+	}
+
+	for _, track := range host.AudioTracks {
+		if err := codecs.ValidateOfferCodec(offer, webrtc.RTPCodecTypeAudio, track.Track.Codec()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
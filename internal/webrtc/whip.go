@@ -2,9 +2,10 @@ package webrtc
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 
 	"github.com/glimesh/broadcast-box/internal/server/authorization"
+	"github.com/glimesh/broadcast-box/internal/webrtc/codecs"
 	"github.com/glimesh/broadcast-box/internal/webrtc/peerconnection"
 	"github.com/glimesh/broadcast-box/internal/webrtc/sessions/manager"
 	"github.com/glimesh/broadcast-box/internal/webrtc/utils"
@@ -12,7 +13,8 @@ import (
 
 // Initialize WHIP session for incoming stream
 func WHIP(offer string, profile authorization.PublicProfile) (sdp string, sessionID string, err error) {
-	log.Println("WHIP.Offer.Requested", profile.StreamKey, profile.MOTD)
+	logger := slog.With("streamKey", profile.StreamKey)
+	logger.Info("WHIP.Offer.Requested")
 
 	if err := utils.ValidateOffer(offer); err != nil {
 		return "", "", errors.New("invalid offer: " + err.Error())
@@ -23,29 +25,38 @@ func WHIP(offer string, profile authorization.PublicProfile) (sdp string, sessio
 		return "", "", err
 	}
 
-	peerConnection, err := peerconnection.CreateWHIPPeerConnection(offer)
+	peerConnection, err := peerconnection.CreateWHIPPeerConnection(offer, getCodecPreferences(&profile))
 	if err != nil || peerConnection == nil {
-		log.Println("WHIP.CreateWHIPPeerConnection.Failed", err)
+		logger.Error("WHIP.CreateWHIPPeerConnection.Failed", "error", err)
 		if peerConnection != nil {
 			if closeErr := peerConnection.Close(); closeErr != nil {
-				log.Println("WHIP.CreateWHIPPeerConnection.Close.Failed", closeErr)
+				logger.Error("WHIP.CreateWHIPPeerConnection.Close.Failed", "error", closeErr)
 			}
 		}
 		return "", "", err
 	}
 
-	if err := session.AddHost(peerConnection); err != nil {
+	host, err := session.AddHost(peerConnection)
+	if err != nil {
 		return "", "", err
 	}
 
-	host := session.Host.Load()
-	if host == nil {
-		return "", "", errors.New("host session not available")
-	}
-
 	sdp = utils.DebugOutputAnswer(utils.AppendCandidateToAnswer(peerConnection.LocalDescription().SDP))
 	sessionID = host.ID
 	err = nil
-	log.Println("WHIP.Offer.Accepted", profile.StreamKey, profile.MOTD)
+	logger.Info("WHIP.Offer.Accepted", "sessionId", sessionID)
 	return
 }
+
+// Returns the codec preferences of the profile, nil when the profile does not constrain codecs
+func getCodecPreferences(profile *authorization.PublicProfile) *codecs.Preferences {
+	if profile.Codecs == nil {
+		return nil
+	}
+
+	return &codecs.Preferences{
+		Video:            profile.Codecs.Video,
+		Audio:            profile.Codecs.Audio,
+		H264ProfileLevel: profile.Codecs.H264ProfileLevel,
+	}
+}
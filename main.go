@@ -1,17 +1,18 @@
 package main
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"runtime"
 	"strings"
-	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
 	"github.com/glimesh/broadcast-box/internal/console"
 	"github.com/glimesh/broadcast-box/internal/environment"
 	"github.com/glimesh/broadcast-box/internal/networktest"
+	"github.com/glimesh/broadcast-box/internal/rtmp"
 	"github.com/glimesh/broadcast-box/internal/server"
+	"github.com/glimesh/broadcast-box/internal/server/webhook"
 	"github.com/glimesh/broadcast-box/internal/webrtc"
 
 	"net/http"
@@ -19,22 +20,29 @@ import (
 )
 
 func main() {
-	environment.SetupLogger()
 	environment.LoadEnvironmentVariables()
+	environment.SetupLogger()
 	console.HandleConsoleFlags()
 
 	if shouldProfileApplication := os.Getenv(environment.EnableProfiling); strings.EqualFold(shouldProfileApplication, "true") {
 		go func() {
 			runtime.SetBlockProfileRate(1)
 			runtime.SetMutexProfileFraction(1)
-			log.Println(http.ListenAndServe("localhost:6060", nil))
+			slog.Error("Profiling server stopped", "error", http.ListenAndServe("localhost:6060", nil))
 		}()
 	}
 
-	log.Println("Booting up Broadcast", time.Now().Format("2006-01-02 15:04:05"))
+	slog.Info("Booting up Broadcast Box")
+
+	if err := webhook.StartEventDelivery(); err != nil {
+		slog.Error("Event webhook could not be started", "error", err)
+		os.Exit(1)
+	}
 
 	chatManager := chat.NewManager()
-	webrtc.Setup(chatManager)
+	chatManager.SetOnMessage(webhook.SendChatMessageEvent)
+	webrtc.Setup(chatManager, webhook.SessionEvents{})
+	rtmp.Setup()
 
 	if shouldNetworkTest := os.Getenv(environment.NetworkTestOnStart); strings.EqualFold(shouldNetworkTest, "true") {
 		networktest.RunNetworkTest()
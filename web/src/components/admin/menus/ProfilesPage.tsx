@@ -11,9 +11,23 @@ const ADMIN_TOKEN = "adminToken";
 
 interface Profile {
   streamKey: string;
-  token: string;
   isPublic: boolean;
   motd: string;
+  tokens: ProfileTokenInfo[];
+}
+
+interface ProfileTokenInfo {
+  id: string;
+  label: string;
+  scopes: string[];
+  expiresAt?: string;
+  isExpired: boolean;
+}
+
+// Tokens are only returned when a profile is created or its token is reset
+interface ProfileToken {
+  streamKey: string;
+  token: string;
 }
 
 const ProfilesPage = () => {
@@ -22,12 +36,14 @@ const ProfilesPage = () => {
   const [isAddProfileModalOpen, setIsAddProfileModalOpen] = useState<boolean>(false);
   const [isRemoveProfileModalOpen, setIsRemoveProfileModalOpen] = useState<string>("");
   const [errorMessage, setErrorMessage] = useState<string>();
+  const [tokens, setTokens] = useState<Record<string, string>>({});
 
   useEffect(() => {
     refreshProfiles();
   }, []);
 
   const copyTokenToClipboard = (token: string) => navigator.clipboard.writeText(token)
+  const addToken = (result: ProfileToken) => setTokens((current) => ({ ...current, [result.streamKey]: result.token }))
 
   const refreshProfiles = () => {
     fetch(`/api/admin/profiles`, {
@@ -61,6 +77,10 @@ const ProfilesPage = () => {
         return;
       }
 
+      if (result.ok) {
+        result.json().then(addToken);
+      }
+
       refreshProfiles();
     });
   };
@@ -83,6 +103,7 @@ const ProfilesPage = () => {
         return;
       }
 
+      result.json().then(addToken);
       setIsAddProfileModalOpen(() => false);
       refreshProfiles();
     });
@@ -162,12 +183,26 @@ const ProfilesPage = () => {
                   </td>
                   <td className="px-4 py-2">{profile.motd}</td>
                   <td className="px-4 py-2 flex flex-row justify-between items-center">
-                    <div
-                      title="Copy to clipboard"
-                      className="flex flex-row gap-1 cursor-pointer"
-                      onClick={() => copyTokenToClipboard(profile.token)} >
-                      {getIcon("Copy")}
-                      {profile.token}
+                    <div className="flex flex-col">
+                    {profile.tokens?.map((token) => (
+                      <div
+                        key={token.id}
+                        title={token.expiresAt}
+                        className={`text-sm ${token.isExpired ? "line-through text-gray-500" : ""}`}>
+                        {token.label} ({token.scopes.join(", ")})
+                      </div>
+                    ))}
+                    {tokens[profile.streamKey] ? (
+                      <div
+                        title="Copy to clipboard"
+                        className="flex flex-row gap-1 cursor-pointer"
+                        onClick={() => copyTokenToClipboard(tokens[profile.streamKey])} >
+                        {getIcon("Copy")}
+                        {tokens[profile.streamKey]}
+                      </div>
+                    ) : (
+                      <div>••••••••</div>
+                    )}
                     </div>
 
                     <ArrowPathIcon
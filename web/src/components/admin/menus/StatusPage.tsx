@@ -88,10 +88,13 @@ interface WhepSession {
   audioSequenceNumber: number;
 
   videoLayerCurrent: string;
+  videoLayerPending: string;
   videoTimestamp: string;
   videoPacketsWritten: number;
   videoSequenceNumber: number;
 
+  bandwidthEstimate: number;
+
   sequenceNumber: number;
   timestamp: number;
 }
@@ -115,6 +115,8 @@ function BrowserBroadcaster() {
 				}
 			}
 
+			const pendingCandidates: RTCIceCandidateInit[] = []
+
 			peerConnectionRef
 				.current!
 				.createOffer()
@@ -148,12 +150,26 @@ function BrowserBroadcaster() {
 						// Receive current status of the stream
 						// evtSource.addEventListener("status", (event: MessageEvent) => setCurrentStreamStatus(JSON.parse(event.data)))
 
+						// Receive server candidates when the server trickles ICE
+						evtSource.addEventListener("candidate", (event: MessageEvent) => {
+							const candidate = JSON.parse(event.data) as RTCIceCandidateInit
+
+							if (peerConnectionRef.current!.remoteDescription === null) {
+								pendingCandidates.push(candidate)
+								return
+							}
+
+							peerConnectionRef.current!.addIceCandidate(candidate).catch((err) => console.error("AddIceCandidate", err))
+						})
+
 						return r.text()
 					}).then(answer => {
 						peerConnectionRef.current!.setRemoteDescription({
 							sdp: answer,
 							type: 'answer'
-						}).catch((err) => console.error("SetRemoteDescription", err))
+						})
+							.then(() => pendingCandidates.forEach((candidate) => peerConnectionRef.current!.addIceCandidate(candidate).catch((err) => console.error("AddIceCandidate", err))))
+							.catch((err) => console.error("SetRemoteDescription", err))
 					})
 				})
 		}, (reason: ErrorMessageEnum) => {
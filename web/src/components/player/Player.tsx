@@ -36,7 +36,7 @@ const Player = (props: PlayerProps) => {
 	const [currentLayersStatus, setCurrentLayersStatus] = useState<CurrentLayersMessage | undefined>()
 	const [audioLayers, setAudioLayers] = useState([]);
 	const [videoLayers, setVideoLayers] = useState([]);
-	const [streamState, setStreamState] = useState<"Loading" | "Playing" | "Offline" | "Error">("Loading");
+	const [streamState, setStreamState] = useState<"Loading" | "Playing" | "Reconnecting" | "Offline" | "Error">("Loading");
 	const [videoOverlayVisible, setVideoOverlayVisible] = useState<boolean>(false)
 
 	const [resetCounter, setResetCounter] = useState(0)
@@ -62,7 +62,7 @@ const Player = (props: PlayerProps) => {
 			setCurrentStreamStatus(() => status)
 
 			if (!status.isOnline) {
-				setStreamState("Offline")
+				setStreamState(status.isReconnecting ? "Reconnecting" : "Offline")
 				return
 			}
 
@@ -220,7 +220,7 @@ const Player = (props: PlayerProps) => {
 								<CurrentViewersComponent currentViewersCount={currentStreamStatus?.viewers ?? 0} />
 								<VideoLayerSelectorComponent layers={videoLayers} layerEndpoint={layerEndpointRef.current} hasPacketLoss={false} currentLayer={currentLayersStatus?.videoLayerCurrent ?? ""} />
 								{audioLayers.length > 1 && (
-									<AudioLayerSelectorComponent layers={audioLayers} layerEndpoint={layerEndpointRef.current} hasPacketLoss={false} currentLayer={currentLayersStatus?.videoLayerCurrent ?? ""} />
+									<AudioLayerSelectorComponent layers={audioLayers} layerEndpoint={layerEndpointRef.current} hasPacketLoss={false} currentLayer={currentLayersStatus?.audioLayerCurrent ?? ""} />
 								)}
 								<Square2StackIcon onClick={() => videoRef.current?.requestPictureInPicture()} />
 								<ArrowsPointingOutIcon onClick={handleEnterFullscreen} />
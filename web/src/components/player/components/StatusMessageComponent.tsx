@@ -4,7 +4,7 @@ import { LocaleContext } from "../../../providers/LocaleProvider";
 
 interface StatusMessageComponentProps{ 
   streamKey: string;
-  state: "Loading" | "Playing" | "Offline" | "Error"
+  state: "Loading" | "Playing" | "Reconnecting" | "Offline" | "Error"
 }
 
 export const StatusMessageComponent = (props: StatusMessageComponentProps) => {
@@ -32,6 +32,14 @@ export const StatusMessageComponent = (props: StatusMessageComponentProps) => {
 							</div>
 						</div>
 					)}
+					{state === "Reconnecting" && (
+						<div className="relative flex z-25 w-full h-full font-light leading-tight text-4xl text-center justify-center">
+							<div className='flex flex-col justify-center items-center'>
+								<VideoCameraIcon className="w-32 h-32" />
+								{streamKey} {locale.player.message_reconnecting}
+							</div>
+						</div>
+					)}
 					{state === "Loading" && (
 						<div className="relative flex z-25 w-full h-full font-light leading-tight text-4xl text-center justify-center">
 							<div className='flex flex-col justify-center items-center'>
@@ -98,7 +98,11 @@ export async function PeerConnectionSetup(props: SetupPeerConnectionProps): Prom
 		.setLocalDescription(offer)
 		.catch((err) => console.error("PeerConnection.SetLocalDescription", err));
 
-	const whepResponse = await fetch(`/api/whep`, {
+	// Private streams are watched with a viewer token shared in the page URL
+	const viewerToken = new URLSearchParams(window.location.search).get("token")
+	const whepUrl = viewerToken ? `/api/whep?token=${encodeURIComponent(viewerToken)}` : `/api/whep`
+
+	const whepResponse = await fetch(whepUrl, {
 		method: 'POST',
 		headers: {
 			Authorization: `Bearer ${streamKey}`,
@@ -154,12 +158,53 @@ export async function PeerConnectionSetup(props: SetupPeerConnectionProps): Prom
 		onAudioLayerChange(parsed['2']['layers'].map((layer: any) => layer.encodingId))
 	})
 
+	// Receive server candidates when the server trickles ICE
+	const pendingCandidates: RTCIceCandidateInit[] = []
+	evtSource.addEventListener("candidate", (event: MessageEvent) => {
+		const candidate = JSON.parse(event.data) as RTCIceCandidateInit
+
+		if (peerConnection.remoteDescription === null) {
+			pendingCandidates.push(candidate)
+			return
+		}
+
+		peerConnection.addIceCandidate(candidate).catch((err) => console.error("PeerConnection.AddIceCandidate", err))
+	})
+
+	// Answer offers of the server when it renegotiates the session, such as when the broadcaster changes codec
+	const whepLocation = whepResponse.headers.get('Location')
+	evtSource.addEventListener("offer", async (event: MessageEvent) => {
+		if (whepLocation === null) {
+			return
+		}
+
+		try {
+			await peerConnection.setRemoteDescription(JSON.parse(event.data) as RTCSessionDescriptionInit)
+
+			const renegotiationAnswer = await peerConnection.createAnswer()
+			renegotiationAnswer["sdp"] = renegotiationAnswer["sdp"]!.replace("useinbandfec=1", "useinbandfec=1;stereo=1")
+			await peerConnection.setLocalDescription(renegotiationAnswer)
+
+			await fetch(whepLocation, {
+				method: 'PATCH',
+				headers: {
+					'Content-Type': 'application/sdp'
+				},
+				body: renegotiationAnswer.sdp,
+			})
+		} catch (err) {
+			console.error("PeerConnection.Renegotiate", err)
+		}
+	})
+
 	const answer = await whepResponse.text()
 	await peerConnection.setRemoteDescription({
 		sdp: answer,
 		type: 'answer'
 	}).catch((err) => console.error("PeerConnection.RemoteDescription", err))
 
+	pendingCandidates.forEach((candidate) => peerConnection.addIceCandidate(candidate).catch((err) => console.error("PeerConnection.AddIceCandidate", err)))
+
 	return peerConnection;
 }
 
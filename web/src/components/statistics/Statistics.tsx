@@ -122,6 +122,7 @@ const Statistics = () => {
                             <div><strong>{locale.statistics.layer}:</strong> {session.videoLayerCurrent}</div>
                             <div><strong>{locale.statistics.timestamp}:</strong> {session.videoTimestamp}</div>
                             <div><strong>{locale.statistics.video_bitrate}:</strong> {bytesToMbps(session.videoBitrate)} Mbps</div>
+                            <div><strong>{locale.statistics.bandwidth_estimate}:</strong> {session.bandwidthEstimate > 0 ? `${(session.bandwidthEstimate / 1_000_000).toFixed(2)} Mbps` : "-"}</div>
                             <div><strong>{locale.statistics.packets_written}:</strong> {session.videoPacketsWritten}</div>
                             <div><strong>{locale.statistics.sequence_number}:</strong> {session.videoSequenceNumber}</div>
                           </div>
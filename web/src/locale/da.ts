@@ -35,6 +35,7 @@ const locale_da: localeInterface = {
     video_track_not_available: "Ingen videospor",
     video_bitrate: "Bitrate",
     video_bitrate_total_out: "Bitrate ud",
+    bandwidth_estimate: "Estimeret båndbredde",
 
     audio: "Lyd",
     audio_tracks: "Lydspor",
@@ -86,6 +87,7 @@ const locale_da: localeInterface = {
   player: {
     message_is_not_online: "streamer ikke i øjeblikket",
     message_loading_video: "Indlæser video",
+    message_reconnecting: "genopretter forbindelsen",
     message_error: "Fejl ved indlæsning af video",
 
     stream_status_offline: "Offline"
@@ -35,6 +35,7 @@ const locale_en: localeInterface = {
     video_track_not_available: "No video tracks",
     video_bitrate: "Bitrate",
     video_bitrate_total_out: "Bitrate outgoing",
+    bandwidth_estimate: "Bandwidth estimate",
 
     audio: "Audio",
     audio_tracks: "Audio tracks",
@@ -85,6 +86,7 @@ const locale_en: localeInterface = {
   player: {
     message_is_not_online: "is not currently streaming",
     message_loading_video: "Loading video",
+    message_reconnecting: "is reconnecting",
     message_error: "Error loading video",
 
     stream_status_offline: "Offline"
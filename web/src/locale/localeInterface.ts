@@ -35,6 +35,7 @@ export interface localeInterface {
     video_track_not_available: string,
     video_bitrate: string,
     video_bitrate_total_out: string,
+    bandwidth_estimate: string,
 
     audio: string,
     audio_tracks: string,
@@ -84,6 +85,7 @@ export interface localeInterface {
   player: {
     message_is_not_online: string,
     message_loading_video: string,
+    message_reconnecting: string,
     message_error: string,
 
     stream_status_offline: string,
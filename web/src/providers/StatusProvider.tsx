@@ -5,6 +5,7 @@ export interface StreamStatus {
 	motd: string;
 	viewers: number;
 	isOnline: boolean;
+	isReconnecting?: boolean;
 }
 
 export interface WhepSession {
@@ -17,10 +18,13 @@ export interface WhepSession {
 
 	videoBitrate: number;
 	videoLayerCurrent: string;
+	videoLayerPending: string;
 	videoTimestamp: string;
 	videoPacketsWritten: number;
 	videoSequenceNumber: number;
 
+	bandwidthEstimate: number;
+
 	sequenceNumber: number;
 	timestamp: number;
 }